@@ -2,87 +2,168 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
-	"encoding/json"
-	"fmt"
-	"github.com/go-redis/redis/v8"
+	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
+
+	authRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/auth/repository"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/ingest"
+	ingestRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/ingest/repository"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/ingest/source"
+	ingestUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/ingest/usecase"
+	jobRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/jobs/repository"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles/repository"
+	videoUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles/usecase"
+	webhookRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks/repository"
+	webhookUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks/usecase"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/db/aws"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/db/postgres"
+	clientRedis "github.com/amankumarsingh77/cloud-video-encoder/pkg/db/redis"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
 )
 
-type EncodeJob struct {
-	JobID                  string             `json:"job_id" redis:"job_id"`
-	UserID                 string             `json:"user_id" redis:"user_id"`
-	VideoID                string             `json:"video_id" redis:"video_id"`
-	InputS3Key             string             `json:"input_s3_key" redis:"input_s3_key"`
-	InputBucket            string             `json:"input_bucket" redis:"input_bucket"`
-	Progress               float64            `json:"progress" redis:"progress"`
-	OutputS3Key            string             `json:"output_s3_key" redis:"output_s3_key"`
-	OutputBucket           string             `json:"output_bucket" redis:"output_bucket"`
-	Qualities              []InputQualityInfo `json:"qualities" redis:"qualities"`
-	OutputFormats          []PlaybackFormat   `json:"output_formats" redis:"output_formats"`
-	EnablePerTitleEncoding bool               `json:"enable_per_title_encoding" redis:"enable_per_title_encoding"`
-	Status                 JobStatus          `json:"status" redis:"status"`
-	StartedAt              time.Time          `json:"started_at" redis:"started_at"`
-	CompletedAt            time.Time          `json:"completed_at" redis:"completed_at"`
-}
+// Ingests videos for one user from a watch folder, an S3 prefix or a manifest:
+//
+//	go run cmd/ingestion.go -user <id> -watch /srv/incoming
+//	go run cmd/ingestion.go -user <id> -s3 s3://media/incoming/ -interval 5m
+//	go run cmd/ingestion.go -user <id> -manifest batch.csv
+//
+// Every source is recorded once ingested, so rerunning or restarting the command is safe.
+func main() {
+	configFile := flag.String("config", "config.yml", "path to the config file")
+	userID := flag.String("user", "", "ID of the user the videos are ingested for")
+	watchDir := flag.String("watch", "", "local directory to watch")
+	s3Prefix := flag.String("s3", "", "s3://bucket/prefix to watch")
+	manifest := flag.String("manifest", "", "CSV or JSON manifest of sources")
+	interval := flag.Duration("interval", 30*time.Second, "rescan interval of watched sources")
+	once := flag.Bool("once", false, "scan the watched source once and exit")
+	settle := flag.Duration("settle", 30*time.Second, "time a file in the watch folder must be unmodified before it is ingested")
+	formats := flag.String("formats", "", "comma separated output formats (hls, dash), defaults to hls")
+	perTitle := flag.Bool("per-title", false, "enable per-title encoding")
+	maxAttempts := flag.Int("max-attempts", 3, "attempts per source before it is given up")
+	scratchDir := flag.String("scratch", "", "directory S3 sources are staged in")
+	flag.Parse()
 
-type InputQualityInfo struct {
-	// Define fields as per your requirements
-}
+	sources := 0
+	for _, s := range []string{*watchDir, *s3Prefix, *manifest} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 || *userID == "" {
+		flag.Usage()
+		log.Fatal("Exactly one of -watch, -s3 or -manifest and a -user are required")
+	}
+	ownerID, err := uuid.Parse(*userID)
+	if err != nil {
+		log.Fatalf("Invalid user ID: %v", err)
+	}
 
-type PlaybackFormat struct {
-	// Define fields as per your requirements
-}
+	cfgFile, err := config.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	cfg, err := config.ParseConfig(cfgFile)
+	if err != nil {
+		log.Fatalf("Failed to parse config: %v", err)
+	}
 
-type JobStatus string
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
 
-const (
-	JobStatusQueued     JobStatus = "video_jobs"
-	JobStatusProcessing JobStatus = "in_progress"
-	JobStatusCompleted  JobStatus = "completed"
-	JobStatusFailed     JobStatus = "failed"
-)
+	psqlDB, err := postgres.NewPsqlDB(cfg)
+	if err != nil {
+		appLogger.Fatalf("PostgreSQL init error: %s", err)
+	}
+	defer psqlDB.Close()
 
-func main() {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     "intimate-racer-53028.upstash.io:6379",
-		Password: "Ac8kAAIjcDE2N2JmODcxY2U1MzI0MWU5OTA3MGY5YjM0Y2FjMjIxN3AxMA",
-		DB:       0,
-		TLSConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	})
+	redisClient, err := clientRedis.NewRedisClient(cfg)
+	if err != nil {
+		appLogger.Fatalf("Redis init error: %s", err)
+	}
 
-	job := EncodeJob{
-		JobID:                  "12345",
-		UserID:                 "user_001",
-		VideoID:                "video_001",
-		InputS3Key:             "BitBloom.mp4",
-		InputBucket:            "input-bucket",
-		Progress:               0.0,
-		OutputS3Key:            "temp/output/video_001_encoded.mp4",
-		OutputBucket:           "output-bucket",
-		Qualities:              []InputQualityInfo{},
-		OutputFormats:          []PlaybackFormat{},
-		EnablePerTitleEncoding: false,
-		Status:                 JobStatusQueued,
-		StartedAt:              time.Now(),
-		CompletedAt:            time.Time{},
+	awsClient, presignClient, err := aws.NewAWSClient(
+		cfg.S3.Endpoint,
+		cfg.S3.Region,
+		cfg.S3.AccessKey,
+		cfg.S3.SecretKey,
+	)
+	if err != nil {
+		appLogger.Fatalf("AWS init error: %s", err)
+	}
+
+	awsRepo, err := repository.NewStorageRepository(cfg, awsClient, presignClient)
+	if err != nil {
+		appLogger.Fatalf("Storage init error: %s", err)
 	}
+	redisRepo := repository.NewVideoRedisRepo(redisClient)
+	videoRepo := repository.NewVideoRepo(psqlDB)
+	jobRepo := jobRepository.NewJobRepo(psqlDB)
+	webhookRepo := webhookRepository.NewWebhookRepo(psqlDB)
+	// Events are only queued here, the server and workers deliver them
+	webhookDispatcher := webhookUsecase.NewWebhookDispatcher(cfg, webhookRepo, appLogger)
+	videoUC := videoUsecase.NewVideoUseCase(cfg, videoRepo, redisRepo, awsRepo, jobRepo, webhookDispatcher, appLogger)
+	ingestUC := ingestUsecase.NewIngestUseCase(cfg, ingestRepository.NewIngestRepo(psqlDB), videoUC, awsRepo, *scratchDir, *maxAttempts, appLogger)
 
-	ctx := context.Background()
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-	jobJSON, err := json.Marshal(job)
+	// The use cases act for the user like they would for an API request
+	user, err := authRepository.NewAuthRepo(psqlDB).GetByID(ctx, ownerID)
 	if err != nil {
-		log.Fatalf("Error marshalling job: %v", err)
+		appLogger.Fatalf("Failed to load user %s: %s", ownerID, err)
 	}
+	ctx = context.WithValue(ctx, utils.UserCtxKey{}, user)
 
-	channel := "video_jobs"
-	err = rdb.Publish(ctx, channel, jobJSON).Err()
+	defaults := models.ImportInput{EnablePerTitleEncoding: *perTitle}
+	for _, format := range strings.Split(*formats, ",") {
+		if format = strings.TrimSpace(format); format != "" {
+			defaults.OutputFormats = append(defaults.OutputFormats, models.PlaybackFormat(format))
+		}
+	}
+
+	var src ingest.Source
+	switch {
+	case *watchDir != "":
+		src, err = source.NewFolderSource(*watchDir, defaults, *settle)
+	case *s3Prefix != "":
+		src, err = source.NewS3Source(awsRepo, *s3Prefix, defaults)
+	default:
+		src, err = source.NewManifestSource(awsRepo, *manifest, defaults)
+		// A manifest is read once unless a rescan interval is asked for
+		if !isFlagSet("interval") {
+			*once = true
+		}
+	}
 	if err != nil {
-		log.Fatalf("Error publishing job to Redis: %v", err)
+		appLogger.Fatalf("Invalid source: %s", err)
+	}
+
+	scanInterval := *interval
+	if *once {
+		scanInterval = 0
+	}
+	appLogger.Infof("Ingesting for user %s", ownerID)
+	if err = ingestUC.Run(ctx, src, scanInterval); err != nil && ctx.Err() == nil {
+		appLogger.Fatalf("Ingest failed: %s", err)
 	}
+	appLogger.Info("Ingest finished")
+}
 
-	fmt.Printf("Job published successfully to Redis channel: %s\n", channel)
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	authRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/auth/repository"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	jobRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/jobs/repository"
+	liveRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/live/repository"
+	liveUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/live/usecase"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles/repository"
+	videoUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles/usecase"
+	webhookRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks/repository"
+	webhookUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks/usecase"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/db/aws"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/db/postgres"
+	clientRedis "github.com/amankumarsingh77/cloud-video-encoder/pkg/db/redis"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+)
+
+// Runs the RTMP ingest for live streams:
+//
+//	go run cmd/live.go -config config.yml
+//
+// Encoders publish to rtmp://<host>:1935/live/<stream key>. Every stream is transcoded into
+// live HLS under live/<user>/<session> in the output bucket and recorded; when it ends the
+// recording is queued for encoding like an upload.
+func main() {
+	configFile := flag.String("config", "config.yml", "path to the config file")
+	flag.Parse()
+
+	cfgFile, err := config.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	cfg, err := config.ParseConfig(cfgFile)
+	if err != nil {
+		log.Fatalf("Failed to parse config: %v", err)
+	}
+
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+
+	psqlDB, err := postgres.NewPsqlDB(cfg)
+	if err != nil {
+		appLogger.Fatalf("PostgreSQL init error: %s", err)
+	}
+	defer psqlDB.Close()
+
+	redisClient, err := clientRedis.NewRedisClient(cfg)
+	if err != nil {
+		appLogger.Fatalf("Redis init error: %s", err)
+	}
+
+	awsClient, presignClient, err := aws.NewAWSClient(
+		cfg.S3.Endpoint,
+		cfg.S3.Region,
+		cfg.S3.AccessKey,
+		cfg.S3.SecretKey,
+	)
+	if err != nil {
+		appLogger.Fatalf("AWS init error: %s", err)
+	}
+
+	awsRepo, err := repository.NewStorageRepository(cfg, awsClient, presignClient)
+	if err != nil {
+		appLogger.Fatalf("Storage init error: %s", err)
+	}
+	redisRepo := repository.NewVideoRedisRepo(redisClient)
+	videoRepo := repository.NewVideoRepo(psqlDB)
+	jobRepo := jobRepository.NewJobRepo(psqlDB)
+	webhookRepo := webhookRepository.NewWebhookRepo(psqlDB)
+	// Events are only queued here, the server and workers deliver them
+	webhookDispatcher := webhookUsecase.NewWebhookDispatcher(cfg, webhookRepo, appLogger)
+	videoUC := videoUsecase.NewVideoUseCase(cfg, videoRepo, redisRepo, awsRepo, jobRepo, webhookDispatcher, appLogger)
+	liveUC := liveUsecase.NewLiveUseCase(cfg, liveRepository.NewLiveRepo(psqlDB), authRepository.NewAuthRepo(psqlDB), videoUC, awsRepo, appLogger)
+	ingester := liveUsecase.NewIngester(cfg, liveUC, awsRepo, appLogger)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err = ingester.Run(ctx); err != nil {
+		appLogger.Fatalf("Live ingest failed: %s", err)
+	}
+	appLogger.Info("Live ingest stopped")
+}
@@ -0,0 +1,33 @@
+CREATE TYPE webhook_delivery_status AS ENUM ('pending', 'succeeded', 'failed');
+
+CREATE TABLE webhooks
+(
+    webhook_id  UUID PRIMARY KEY                  DEFAULT uuid_generate_v4(),
+    user_id     UUID                     NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    url         TEXT                     NOT NULL CHECK ( url <> '' ),
+    secret      VARCHAR(128)             NOT NULL,
+    events      JSONB                    NOT NULL DEFAULT '[]'::jsonb, -- empty means every event
+    active      BOOLEAN                  NOT NULL DEFAULT true,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhooks_user_id ON webhooks (user_id);
+
+CREATE TABLE webhook_deliveries
+(
+    delivery_id     UUID PRIMARY KEY                  DEFAULT uuid_generate_v4(),
+    webhook_id      UUID                     NOT NULL REFERENCES webhooks (webhook_id) ON DELETE CASCADE,
+    event           VARCHAR(64)              NOT NULL,
+    payload         JSONB                    NOT NULL,
+    status          webhook_delivery_status  NOT NULL DEFAULT 'pending',
+    attempts        INTEGER                  NOT NULL DEFAULT 0,
+    response_status INTEGER                  NOT NULL DEFAULT 0,  -- HTTP status of the last attempt
+    error_message   TEXT                     NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    delivered_at    TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, created_at DESC);
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,34 @@
+-- Replaces the encoding_jobs table of the initial migration, which was never written to and
+-- used serial ids and TEXT[] columns that don't match the jobs the API creates.
+DROP TABLE IF EXISTS encoding_jobs;
+
+CREATE TABLE encoding_jobs
+(
+    job_id                    UUID PRIMARY KEY,
+    user_id                   UUID                     NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    video_id                  UUID,
+    input_s3_key              TEXT                     NOT NULL,
+    input_bucket              VARCHAR(255)             NOT NULL,
+    file_size                 BIGINT                   NOT NULL DEFAULT 0,
+    duration                  DOUBLE PRECISION         NOT NULL DEFAULT 0,
+    output_s3_key             TEXT                     NOT NULL DEFAULT '',
+    output_bucket             VARCHAR(255)             NOT NULL DEFAULT '',
+    qualities                 JSONB                    NOT NULL DEFAULT '[]'::jsonb,
+    output_formats            JSONB                    NOT NULL DEFAULT '[]'::jsonb,
+    enable_per_title_encoding BOOLEAN                  NOT NULL DEFAULT false,
+    status                    job_status               NOT NULL DEFAULT 'queued',
+    stage                     VARCHAR(16)              NOT NULL DEFAULT '',
+    stage_timings             JSONB                    NOT NULL DEFAULT '{}'::jsonb,
+    progress                  DOUBLE PRECISION         NOT NULL DEFAULT 0,
+    attempts                  INTEGER                  NOT NULL DEFAULT 0,
+    worker_id                 VARCHAR(255)             NOT NULL DEFAULT '',
+    error_message             TEXT                     NOT NULL DEFAULT '',
+    created_at                TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at                TIMESTAMP WITH TIME ZONE,
+    completed_at              TIMESTAMP WITH TIME ZONE,
+    updated_at                TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_encoding_jobs_user_created ON encoding_jobs (user_id, created_at DESC);
+CREATE INDEX idx_encoding_jobs_video_id ON encoding_jobs (video_id);
+CREATE INDEX idx_encoding_jobs_status ON encoding_jobs (status);
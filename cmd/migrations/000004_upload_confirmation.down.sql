@@ -0,0 +1,7 @@
+-- Enum values can't be dropped, pending_upload and uploaded stay in job_status
+ALTER TABLE video_files
+    DROP COLUMN IF EXISTS enable_per_title_encoding,
+    DROP COLUMN IF EXISTS output_formats,
+    DROP COLUMN IF EXISTS qualities,
+    DROP COLUMN IF EXISTS checksum,
+    DROP COLUMN IF EXISTS mime_type;
@@ -0,0 +1,10 @@
+ALTER TYPE job_status ADD VALUE IF NOT EXISTS 'pending_upload';
+ALTER TYPE job_status ADD VALUE IF NOT EXISTS 'uploaded';
+
+ALTER TABLE video_files
+    ADD COLUMN IF NOT EXISTS mime_type                 VARCHAR(127) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS checksum                  VARCHAR(64)  NOT NULL DEFAULT '', -- hex SHA-256 declared by the client
+    -- Encode settings requested at upload, used for the job queued once the upload is confirmed
+    ADD COLUMN IF NOT EXISTS qualities                 JSONB        NOT NULL DEFAULT '[]'::jsonb,
+    ADD COLUMN IF NOT EXISTS output_formats            JSONB        NOT NULL DEFAULT '[]'::jsonb,
+    ADD COLUMN IF NOT EXISTS enable_per_title_encoding BOOLEAN      NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ingested_sources;
+DROP TYPE IF EXISTS ingest_status;
@@ -0,0 +1,21 @@
+CREATE TYPE ingest_status AS ENUM ('ingesting', 'ingested', 'failed');
+
+-- Sources the ingest command has taken in. A source is identified by its URI and a fingerprint
+-- of its content (size and mtime, ETag or checksum), so a replaced file is ingested again.
+CREATE TABLE ingested_sources
+(
+    source        TEXT                     NOT NULL,
+    fingerprint   VARCHAR(255)             NOT NULL,
+    user_id       UUID                     NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    status        ingest_status            NOT NULL DEFAULT 'ingesting',
+    video_id      UUID,
+    job_id        UUID,
+    import_id     UUID,
+    attempts      INTEGER                  NOT NULL DEFAULT 1,
+    error_message TEXT                     NOT NULL DEFAULT '',
+    claimed_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    ingested_at   TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (source, fingerprint)
+);
+
+CREATE INDEX idx_ingested_sources_user_id ON ingested_sources (user_id, claimed_at DESC);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS content_keys;
+
+ALTER TABLE encoding_jobs
+    DROP COLUMN IF EXISTS key_rotation_segments,
+    DROP COLUMN IF EXISTS encryption_mode;
+
+ALTER TABLE video_files
+    DROP COLUMN IF EXISTS key_rotation_segments,
+    DROP COLUMN IF EXISTS encryption_mode;
@@ -0,0 +1,19 @@
+ALTER TABLE video_files
+    ADD COLUMN IF NOT EXISTS encryption_mode       VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS key_rotation_segments INTEGER     NOT NULL DEFAULT 0;
+
+ALTER TABLE encoding_jobs
+    ADD COLUMN IF NOT EXISTS encryption_mode       VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS key_rotation_segments INTEGER     NOT NULL DEFAULT 0;
+
+-- Keys are sealed with the server's master key; encrypted_key holds the nonce and ciphertext
+CREATE TABLE IF NOT EXISTS content_keys
+(
+    video_id      UUID                     NOT NULL REFERENCES video_files (video_id) ON DELETE CASCADE,
+    key_index     INTEGER                  NOT NULL,
+    kid           VARCHAR(32)              NOT NULL,
+    encrypted_key BYTEA                    NOT NULL,
+    iv            BYTEA                    NOT NULL,
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (video_id, key_index)
+);
@@ -0,0 +1,4 @@
+-- Enum values can't be dropped, live stays in job_status
+DROP TABLE IF EXISTS live_sessions;
+DROP TABLE IF EXISTS stream_keys;
+DROP TYPE IF EXISTS live_session_status;
@@ -0,0 +1,38 @@
+ALTER TYPE job_status ADD VALUE IF NOT EXISTS 'live';
+
+CREATE TYPE live_session_status AS ENUM ('live', 'ended', 'failed');
+
+-- key_hash is the hex SHA-256 of the key, the key itself is only shown when it is created
+CREATE TABLE stream_keys
+(
+    stream_key_id UUID PRIMARY KEY                  DEFAULT uuid_generate_v4(),
+    user_id       UUID                     NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    name          VARCHAR(255)             NOT NULL,
+    key_hash      VARCHAR(64)              NOT NULL UNIQUE,
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at  TIMESTAMP WITH TIME ZONE,
+    revoked_at    TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_stream_keys_user_id ON stream_keys (user_id);
+
+-- updated_at is the ingest's heartbeat, a live session that stopped beating is taken over
+CREATE TABLE live_sessions
+(
+    session_id    UUID PRIMARY KEY                  DEFAULT uuid_generate_v4(),
+    stream_key_id UUID                     NOT NULL REFERENCES stream_keys (stream_key_id) ON DELETE CASCADE,
+    user_id       UUID                     NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    video_id      UUID                     REFERENCES video_files (video_id) ON DELETE SET NULL,
+    job_id        UUID,
+    status        live_session_status      NOT NULL DEFAULT 'live',
+    output_bucket VARCHAR(255)             NOT NULL,
+    output_key    VARCHAR(255)             NOT NULL,
+    error_message TEXT                     NOT NULL DEFAULT '',
+    started_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    ended_at      TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_live_sessions_user_id ON live_sessions (user_id, started_at DESC);
+-- A key publishes one stream at a time
+CREATE UNIQUE INDEX idx_live_sessions_live_key ON live_sessions (stream_key_id) WHERE status = 'live';
@@ -0,0 +1,8 @@
+ALTER TABLE encoding_jobs
+    DROP COLUMN IF EXISTS clip_ranges;
+
+DROP INDEX IF EXISTS idx_video_files_parent_video_id;
+
+ALTER TABLE video_files
+    DROP COLUMN IF EXISTS clip_ranges,
+    DROP COLUMN IF EXISTS parent_video_id;
@@ -0,0 +1,9 @@
+-- A clip shares the source object of its parent and cuts clip_ranges from it when encoded
+ALTER TABLE video_files
+    ADD COLUMN IF NOT EXISTS parent_video_id UUID  REFERENCES video_files (video_id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS clip_ranges     JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+CREATE INDEX IF NOT EXISTS idx_video_files_parent_video_id ON video_files (parent_video_id);
+
+ALTER TABLE encoding_jobs
+    ADD COLUMN IF NOT EXISTS clip_ranges JSONB NOT NULL DEFAULT '[]'::jsonb;
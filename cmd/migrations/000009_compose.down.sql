@@ -0,0 +1,2 @@
+ALTER TABLE encoding_jobs
+    DROP COLUMN IF EXISTS compose_sources;
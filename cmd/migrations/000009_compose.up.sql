@@ -0,0 +1,3 @@
+-- The videos a composition joins, rendered into the job's input before it is encoded
+ALTER TABLE encoding_jobs
+    ADD COLUMN IF NOT EXISTS compose_sources JSONB NOT NULL DEFAULT '[]'::jsonb;
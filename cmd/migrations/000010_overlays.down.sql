@@ -0,0 +1,5 @@
+ALTER TABLE encoding_jobs
+    DROP COLUMN IF EXISTS overlays;
+
+ALTER TABLE video_files
+    DROP COLUMN IF EXISTS overlays;
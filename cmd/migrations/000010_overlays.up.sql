@@ -0,0 +1,6 @@
+-- Images and text burned into the video when it is encoded
+ALTER TABLE video_files
+    ADD COLUMN IF NOT EXISTS overlays JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+ALTER TABLE encoding_jobs
+    ADD COLUMN IF NOT EXISTS overlays JSONB NOT NULL DEFAULT '[]'::jsonb;
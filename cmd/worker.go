@@ -2,15 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	drmRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/drm/repository"
+	jobRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/jobs/repository"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles/repository"
+	videoUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles/usecase"
+	webhookRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks/repository"
+	webhookUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks/usecase"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/worker"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/db/aws"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/db/postgres"
 	clientRedis "github.com/amankumarsingh77/cloud-video-encoder/pkg/db/redis"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/health"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
-	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/metrics"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -18,10 +26,10 @@ import (
 )
 
 const (
-	redisAddr     = "localhost:6379"
-	queueName     = "video_jobs"
-	maxCPUUsage   = 80.0
-	checkInterval = 10 * time.Second
+	redisAddr       = "localhost:6379"
+	queueName       = "video_jobs"
+	defaultHTTPAddr = ":9091"
+	httpStopTimeout = 5 * time.Second
 )
 
 func main() {
@@ -71,58 +79,84 @@ func main() {
 	appLogger.Info("AWS client initialized successfully")
 
 	// Initialize repositories
-	awsRepo := repository.NewAwsRepository(awsClient, presignClient)
+	awsRepo, err := repository.NewStorageRepository(cfg, awsClient, presignClient)
+	if err != nil {
+		appLogger.Fatalf("Storage init error: %s", err)
+	}
 	redisRepo := repository.NewVideoRedisRepo(redisClient)
+	jobRepo := jobRepository.NewJobRepo(psqlDB)
+	webhookRepo := webhookRepository.NewWebhookRepo(psqlDB)
+	webhookDispatcher := webhookUsecase.NewWebhookDispatcher(cfg, webhookRepo, appLogger)
+	videoRepo := repository.NewVideoRepo(psqlDB)
+	keyRepo, err := drmRepository.NewDrmRepo(cfg, psqlDB)
+	if err != nil {
+		appLogger.Fatalf("Content key store init error: %s", err)
+	}
+	videoUC := videoUsecase.NewVideoUseCase(cfg, videoRepo, redisRepo, awsRepo, jobRepo, webhookDispatcher, appLogger)
 
 	// Create context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Initialize and start worker pool
-	videoWorker := worker.NewWorker(cfg, appLogger, redisRepo, awsRepo)
+	videoWorker := worker.NewWorker(cfg, appLogger, redisRepo, awsRepo, keyRepo, jobRepo, videoRepo, webhookDispatcher)
 	if err := videoWorker.Start(ctx); err != nil {
 		appLogger.Fatalf("Failed to start worker: %s", err)
 	}
 
+	// URL imports run next to the encode jobs and feed new jobs into the queue
+	importRunner := worker.NewImportRunner(cfg, appLogger, redisRepo, videoUC)
+	importRunner.Start(ctx)
+
+	// Deliver job events and retry failed deliveries until shutdown
+	go webhookDispatcher.Run(ctx)
+
+	// Readiness covers everything a job needs; liveness only that the process still serves HTTP
+	checker := health.NewChecker(0)
+	checker.Add("postgres", health.Postgres(psqlDB))
+	checker.Add("redis", health.Redis(redisClient))
+	if cfg.Storage.Backend == repository.StorageBackendLocal {
+		checker.Add("storage", health.DiskSpace(cfg.Storage.LocalRoot, 0))
+	} else {
+		checker.Add("s3", health.S3Buckets(awsClient, cfg.S3.InputBucket, cfg.S3.OutputBucket))
+	}
+	checker.Add("tools", health.Tools(worker.RequiredBinaries, worker.RequiredEncoders))
+	checker.Add("scratch_disk", health.DiskSpace(videoWorker.ScratchDir(), cfg.Worker.MinFreeDiskMB))
+	checker.Add("queue_subscription", videoWorker.CheckSubscription)
+	checker.Add("import_subscription", importRunner.CheckSubscription)
+
+	// Serve metrics and health for the lifetime of the worker, including the drain
+	httpAddr := cfg.Worker.HTTPAddr
+	if httpAddr == "" {
+		httpAddr = defaultHTTPAddr
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", checker.LiveHandler())
+	mux.Handle("/readyz", checker.ReadyHandler())
+	httpServer := &http.Server{Addr: httpAddr, Handler: mux}
+	go func() {
+		appLogger.Infof("Worker HTTP server listening on %s", httpAddr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			appLogger.Errorf("Worker HTTP server error: %s", err)
+		}
+	}()
+
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start health check routine
-	//go runHealthCheck(ctx, appLogger, cfg)
-
 	sig := <-sigChan
 	appLogger.Infof("Received shutdown signal: %v", sig)
 
-	// Initialize graceful shutdown
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer shutdownCancel()
-
-	// Stop the worker
+	// Drain the worker; jobs that don't finish within the drain timeout are checkpointed and requeued
 	videoWorker.Stop()
+	importRunner.Stop()
 
-	// Wait for shutdown context
-	<-shutdownCtx.Done()
-	appLogger.Info("Worker service stopped successfully")
-}
-
-func runHealthCheck(ctx context.Context, logger logger.Logger, cfg *config.Config) {
-	ticker := time.NewTicker(checkInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			_, cpuUsage := utils.CheckCPUUsage(cfg.Worker.MaxCPUUsage)
-
-			if cpuUsage > maxCPUUsage {
-				logger.Warnf("High CPU usage detected: %.2f%%", cpuUsage)
-			}
-
-			// Add additional health checks here (Redis, Postgres, etc.)
-			logger.Infof("Health check - CPU Usage: %.2f%%", cpuUsage)
-		}
+	httpCtx, httpCancel := context.WithTimeout(context.Background(), httpStopTimeout)
+	defer httpCancel()
+	if err := httpServer.Shutdown(httpCtx); err != nil {
+		appLogger.Errorf("Worker HTTP server shutdown error: %s", err)
 	}
+	appLogger.Info("Worker service stopped successfully")
 }
@@ -15,6 +15,12 @@ type Config struct {
 	Cookie   Cookie
 	Logger   Logger
 	Worker   WorkerConfig
+	Webhooks WebhookConfig
+	Import   ImportConfig
+	Storage  StorageConfig
+	Playback PlaybackConfig
+	Drm      DrmConfig
+	Live     LiveConfig
 }
 
 type ServerConfig struct {
@@ -22,11 +28,47 @@ type ServerConfig struct {
 	Port         string
 	Mode         string
 	JwtSecretKey string
+	// TrustedProxies are the CIDRs of reverse proxies whose X-Forwarded-For is believed. Without
+	// any the client address is the peer address of the connection.
+	TrustedProxies []string
 }
 
 type WorkerConfig struct {
-	WorkerCount int
-	MaxCPUUsage float64
+	WorkerCount     int
+	MaxCPUUsage     float64
+	MinFreeMemoryMB int
+	MinFreeDiskMB   int
+	MaxJobCost      float64
+	ScratchDir      string
+	DrainTimeout    int
+	HTTPAddr        string
+	OverlayFontFile string // Font of text overlays, fontconfig's default when empty
+
+	// Optional cgroup v2 limits applied to each job's subprocesses
+	CgroupEnabled       bool
+	CgroupSlice         string
+	CgroupCPUWeight     uint64
+	CgroupCPUQuota      int
+	CgroupMemoryLimitMB int64
+}
+
+type WebhookConfig struct {
+	MaxAttempts    int
+	TimeoutSeconds int
+	PollInterval   int // Seconds between scans for due retries
+	// Lets endpoints on private and loopback addresses receive events, meant for local setups only
+	AllowPrivateNetworks bool
+}
+
+type ImportConfig struct {
+	QueueKey       string
+	Concurrency    int
+	MaxSizeMB      int64
+	TimeoutSeconds int
+	// s3:// sources are only read from these buckets
+	AllowedBuckets []string
+	// Lets HTTP sources reach private and loopback addresses, meant for local setups only
+	AllowPrivateNetworks bool
 }
 
 type Session struct {
@@ -69,6 +111,57 @@ type S3Config struct {
 	SecretKey    string
 	InputBucket  string
 	OutputBucket string
+	// Large transfers are split into parts of PartSizeMB and moved TransferConcurrency at a time.
+	// Uploads below MultipartThresholdMB are sent in a single request.
+	PartSizeMB           int
+	TransferConcurrency  int
+	MultipartThresholdMB int
+	// Client multipart uploads still incomplete after AbandonedUploadHours are aborted.
+	AbandonedUploadHours int
+}
+
+type StorageConfig struct {
+	// Backend is "s3" (default) or "local". The local backend keeps objects under LocalRoot and
+	// signs its upload URLs with SigningKey; they point at PublicURL, the server's own address.
+	Backend    string
+	LocalRoot  string
+	PublicURL  string
+	SigningKey string
+}
+
+type PlaybackConfig struct {
+	// Playback tokens are signed with TokenSecret, derived from the JWT secret when empty, and
+	// live TokenTTLSeconds unless a shorter lifetime is asked for.
+	TokenSecret     string
+	TokenTTLSeconds int
+	// SegmentMode is "proxy" (default), streaming segments through the server, or "presign",
+	// handing players presigned GetObject URLs.
+	SegmentMode string
+	// PublicURL is the server address put in front of rewritten manifest URIs. Empty keeps
+	// them host-relative.
+	PublicURL string
+}
+
+type DrmConfig struct {
+	// MasterKey (64 hex characters) seals content keys in the database. Derived from the JWT
+	// secret when empty.
+	MasterKey string
+}
+
+type LiveConfig struct {
+	// ListenAddr is where the RTMP ingest listens, ":1935" when empty
+	ListenAddr  string
+	MaxSessions int
+	// MaxConnections caps open connections, including ones that haven't published yet. Twice
+	// MaxSessions when 0
+	MaxConnections int
+	// The live playlists keep PlaylistSize segments of SegmentSeconds each
+	SegmentSeconds int
+	PlaylistSize   int
+	// TempDir holds the segments and recording of running sessions
+	TempDir string
+	// A live session whose ingest missed heartbeats for StaleSeconds is considered dead
+	StaleSeconds int
 }
 
 type Logger struct {
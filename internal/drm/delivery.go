@@ -0,0 +1,9 @@
+package drm
+
+import "github.com/labstack/echo/v4"
+
+type Handler interface {
+	GetKey() echo.HandlerFunc
+	GetLicense() echo.HandlerFunc
+	LicenseOptions() echo.HandlerFunc
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type drmHandler struct {
+	drmUC drm.UseCase
+}
+
+func NewDrmHandler(drmUC drm.UseCase) drm.Handler {
+	return &drmHandler{
+		drmUC: drmUC,
+	}
+}
+
+func (h *drmHandler) GetKey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		videoID, err := uuid.Parse(c.Param("video_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid video id"})
+		}
+		index := 0
+		if v := c.QueryParam("index"); v != "" {
+			if index, err = strconv.Atoi(v); err != nil || index < 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid key index"})
+			}
+		}
+		viewer := &models.PlaybackViewer{IP: c.RealIP(), Referer: c.Request().Referer()}
+
+		key, err := h.drmUC.GetKey(c.Request().Context(), videoID, index, c.QueryParam("token"), viewer)
+		if err != nil {
+			return keyError(c, err)
+		}
+		setKeyHeaders(c)
+		return c.Blob(http.StatusOK, echo.MIMEOctetStream, key)
+	}
+}
+
+func (h *drmHandler) GetLicense() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		videoID, err := uuid.Parse(c.Param("video_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid video id"})
+		}
+		req := &models.ClearKeyRequest{}
+		// ClearKey clients send JSON without saying so, so the body is decoded whatever its type
+		if err = json.NewDecoder(c.Request().Body).Decode(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid license request"})
+		}
+		viewer := &models.PlaybackViewer{IP: c.RealIP(), Referer: c.Request().Referer()}
+
+		license, err := h.drmUC.GetLicense(c.Request().Context(), videoID, req, c.QueryParam("token"), viewer)
+		if err != nil {
+			return keyError(c, err)
+		}
+		setKeyHeaders(c)
+		return c.JSON(http.StatusOK, license)
+	}
+}
+
+// LicenseOptions answers the CORS preflight of license requests from players on other origins.
+func (h *drmHandler) LicenseOptions() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Response().Header()
+		header.Set("Access-Control-Allow-Origin", "*")
+		header.Set("Access-Control-Allow-Methods", http.MethodPost)
+		header.Set("Access-Control-Allow-Headers", echo.HeaderContentType)
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func keyError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, drm.ErrKeyForbidden):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, drm.ErrKeyNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, drm.ErrInvalidKeyID):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+// setKeyHeaders lets players on other origins read the response and keeps keys out of caches.
+func setKeyHeaders(c echo.Context) {
+	header := c.Response().Header()
+	header.Set("Access-Control-Allow-Origin", "*")
+	header.Set("Cache-Control", "private, no-store")
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const testVideoID = "9f1c2d3e-0000-4000-8000-000000000001"
+
+// fakeDrmUC hands out keys to viewers from the IP the token is bound to.
+type fakeDrmUC struct {
+	drm.UseCase
+	boundIP string
+}
+
+func (u *fakeDrmUC) GetKey(_ context.Context, _ uuid.UUID, _ int, _ string, viewer *models.PlaybackViewer) ([]byte, error) {
+	if viewer.IP != u.boundIP {
+		return nil, drm.ErrKeyForbidden
+	}
+	return []byte("key-0-0123456789"), nil
+}
+
+func (u *fakeDrmUC) GetLicense(_ context.Context, _ uuid.UUID, req *models.ClearKeyRequest, _ string, viewer *models.PlaybackViewer) (*models.ClearKeyLicense, error) {
+	if viewer.IP != u.boundIP {
+		return nil, drm.ErrKeyForbidden
+	}
+	if len(req.KIDs) > 0 && req.KIDs[0] == "!!" {
+		return nil, fmt.Errorf("%w %q", drm.ErrInvalidKeyID, req.KIDs[0])
+	}
+	return &models.ClearKeyLicense{Keys: []models.JWK{{Kty: "oct"}}, Type: "temporary"}, nil
+}
+
+type bindingTest struct {
+	name    string
+	proxies []string
+	peer    string
+	headers map[string]string
+	want    int
+}
+
+var bindingTests = []bindingTest{
+	{name: "bound viewer", peer: "203.0.113.7:4000", want: http.StatusOK},
+	{name: "other viewer", peer: "198.51.100.1:4000", want: http.StatusForbidden},
+	{name: "forged X-Forwarded-For", peer: "198.51.100.1:4000",
+		headers: map[string]string{"X-Forwarded-For": "203.0.113.7"}, want: http.StatusForbidden},
+	{name: "forged X-Real-IP", peer: "198.51.100.1:4000",
+		headers: map[string]string{"X-Real-IP": "203.0.113.7"}, want: http.StatusForbidden},
+	{name: "behind a trusted proxy", proxies: []string{"10.0.0.0/8"}, peer: "10.0.0.2:4000",
+		headers: map[string]string{"X-Forwarded-For": "203.0.113.7"}, want: http.StatusOK},
+}
+
+// serve sends req to the key routes of a server that finds client IPs like the API server does.
+func serve(t *testing.T, tt bindingTest, uc drm.UseCase, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	extract, err := utils.NewIPExtractor(tt.proxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.IPExtractor = extract
+	// Requests carry a token, the session middleware is never reached
+	MapDrmRoutes(e.Group(drm.KeyRoutePrefix), NewDrmHandler(uc), nil)
+
+	req.RemoteAddr = tt.peer
+	for k, v := range tt.headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetKeyIPBinding(t *testing.T) {
+	for _, tt := range bindingTests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, drm.KeyRoutePrefix+"/"+testVideoID+"?token=tok", nil)
+			rec := serve(t, tt, &fakeDrmUC{boundIP: "203.0.113.7"}, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestGetLicenseIPBinding(t *testing.T) {
+	for _, tt := range bindingTests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, drm.KeyRoutePrefix+"/"+testVideoID+"/license?token=tok",
+				strings.NewReader(`{"kids":[],"type":"temporary"}`))
+			rec := serve(t, tt, &fakeDrmUC{boundIP: "203.0.113.7"}, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestGetLicenseStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "all keys", body: `{"kids":[],"type":"temporary"}`, want: http.StatusOK},
+		{name: "malformed kid", body: `{"kids":["!!"],"type":"temporary"}`, want: http.StatusBadRequest},
+		{name: "not json", body: `kids`, want: http.StatusBadRequest},
+	}
+	viewer := bindingTest{peer: "203.0.113.7:4000"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, drm.KeyRoutePrefix+"/"+testVideoID+"/license?token=tok",
+				strings.NewReader(tt.body))
+			rec := serve(t, viewer, &fakeDrmUC{boundIP: "203.0.113.7"}, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+func MapDrmRoutes(keyGroup *echo.Group, h drm.Handler, mw *middleware.MiddlewareManager) {
+	keyGroup.GET("/:video_id", h.GetKey(), tokenOrSession(mw))
+	keyGroup.POST("/:video_id/license", h.GetLicense(), tokenOrSession(mw))
+	keyGroup.OPTIONS("/:video_id/license", h.LicenseOptions())
+}
+
+// tokenOrSession lets players holding a playback token through, the handler verifies it.
+// Everyone else needs a session.
+func tokenOrSession(mw *middleware.MiddlewareManager) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withSession := mw.AuthSessionMiddleware(next)
+		return func(c echo.Context) error {
+			if c.QueryParam("token") != "" {
+				return next(c)
+			}
+			return withSession(c)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package drm
+
+import (
+	"context"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	// EnsureKeys returns the first count keys of a video, creating the ones it doesn't have yet.
+	// A retried job gets the keys of the earlier attempt back.
+	EnsureKeys(ctx context.Context, videoID uuid.UUID, count int) ([]*models.ContentKey, error)
+	GetKey(ctx context.Context, videoID uuid.UUID, index int) (*models.ContentKey, error)
+	GetKeys(ctx context.Context, videoID uuid.UUID) ([]*models.ContentKey, error)
+}
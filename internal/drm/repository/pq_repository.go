@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// keySize is the size of AES-128 keys, key IDs and IVs
+const keySize = 16
+
+type keyRow struct {
+	models.ContentKey
+	EncryptedKey []byte `db:"encrypted_key"`
+}
+
+type drmRepo struct {
+	db     *sqlx.DB
+	sealer *sealer
+}
+
+// NewDrmRepo stores content keys sealed with the configured master key.
+func NewDrmRepo(cfg *config.Config, db *sqlx.DB) (drm.Repository, error) {
+	s, err := newSealer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &drmRepo{
+		db:     db,
+		sealer: s,
+	}, nil
+}
+
+func (r *drmRepo) EnsureKeys(ctx context.Context, videoID uuid.UUID, count int) ([]*models.ContentKey, error) {
+	keys, err := r.listKeys(ctx, videoID, count)
+	if err != nil || len(keys) == count {
+		return keys, err
+	}
+
+	existing := make(map[int]bool, len(keys))
+	for _, key := range keys {
+		existing[key.KeyIndex] = true
+	}
+	for index := 0; index < count; index++ {
+		if existing[index] {
+			continue
+		}
+		key, err := newContentKey(videoID, index)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := r.sealer.seal(key)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = r.db.ExecContext(ctx, insertKeyQuery, videoID, index, key.KID, sealed, key.IV); err != nil {
+			return nil, fmt.Errorf("failed to save content key: %w", err)
+		}
+	}
+
+	if keys, err = r.listKeys(ctx, videoID, count); err != nil {
+		return nil, err
+	}
+	if len(keys) != count {
+		return nil, fmt.Errorf("expected %d content keys, found %d", count, len(keys))
+	}
+	return keys, nil
+}
+
+func (r *drmRepo) GetKey(ctx context.Context, videoID uuid.UUID, index int) (*models.ContentKey, error) {
+	row := &keyRow{}
+	if err := r.db.GetContext(ctx, row, getKeyQuery, videoID, index); err != nil {
+		return nil, fmt.Errorf("failed to get content key: %w", err)
+	}
+	return r.open(row)
+}
+
+func (r *drmRepo) GetKeys(ctx context.Context, videoID uuid.UUID) ([]*models.ContentKey, error) {
+	var rows []*keyRow
+	if err := r.db.SelectContext(ctx, &rows, getKeysQuery, videoID); err != nil {
+		return nil, fmt.Errorf("failed to get content keys: %w", err)
+	}
+	return r.openAll(rows)
+}
+
+func (r *drmRepo) listKeys(ctx context.Context, videoID uuid.UUID, count int) ([]*models.ContentKey, error) {
+	var rows []*keyRow
+	if err := r.db.SelectContext(ctx, &rows, listKeysQuery, videoID, count); err != nil {
+		return nil, fmt.Errorf("failed to list content keys: %w", err)
+	}
+	return r.openAll(rows)
+}
+
+func (r *drmRepo) openAll(rows []*keyRow) ([]*models.ContentKey, error) {
+	keys := make([]*models.ContentKey, 0, len(rows))
+	for _, row := range rows {
+		key, err := r.open(row)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (r *drmRepo) open(row *keyRow) (*models.ContentKey, error) {
+	key := row.ContentKey
+	raw, err := r.sealer.open(&key, row.EncryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	key.Key = raw
+	return &key, nil
+}
+
+func newContentKey(videoID uuid.UUID, index int) (*models.ContentKey, error) {
+	random := make([]byte, 3*keySize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to generate content key: %w", err)
+	}
+	return &models.ContentKey{
+		VideoID:  videoID,
+		KeyIndex: index,
+		KID:      hex.EncodeToString(random[:keySize]),
+		Key:      random[keySize : 2*keySize],
+		IV:       random[2*keySize:],
+	}, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+// sealer encrypts content keys at rest with AES-256-GCM. The video and key index are bound in
+// as additional data, so a sealed key copied to another row doesn't open.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+// newSealer uses the hex master key from the config, or one derived from the JWT secret when
+// none is set.
+func newSealer(cfg *config.Config) (*sealer, error) {
+	var masterKey []byte
+	if cfg.Drm.MasterKey != "" {
+		var err error
+		if masterKey, err = hex.DecodeString(cfg.Drm.MasterKey); err != nil || len(masterKey) != 32 {
+			return nil, errors.New("drm master key must be 64 hex characters")
+		}
+	} else {
+		mac := hmac.New(sha256.New, []byte(cfg.Server.JwtSecretKey))
+		mac.Write([]byte("content-keys"))
+		masterKey = mac.Sum(nil)
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key cipher: %w", err)
+	}
+	return &sealer{aead: aead}, nil
+}
+
+// seal returns the nonce followed by the encrypted key.
+func (s *sealer) seal(key *models.ContentKey) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to seal content key: %w", err)
+	}
+	return s.aead.Seal(nonce, nonce, key.Key, additionalData(key)), nil
+}
+
+func (s *sealer) open(key *models.ContentKey, sealed []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("sealed content key is truncated")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	raw, err := s.aead.Open(nil, nonce, ciphertext, additionalData(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open content key %d of video %s: %w", key.KeyIndex, key.VideoID, err)
+	}
+	return raw, nil
+}
+
+func additionalData(key *models.ContentKey) []byte {
+	return []byte(fmt.Sprintf("%s/%d/%s", key.VideoID, key.KeyIndex, key.KID))
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/google/uuid"
+)
+
+func testSealer(t *testing.T, masterKey, jwtSecret string) *sealer {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Drm.MasterKey = masterKey
+	cfg.Server.JwtSecretKey = jwtSecret
+	s, err := newSealer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testContentKey() *models.ContentKey {
+	return &models.ContentKey{
+		VideoID:  uuid.MustParse("9f1c2d3e-0000-4000-8000-000000000001"),
+		KeyIndex: 0,
+		KID:      "00112233445566778899aabbccddeeff",
+		Key:      []byte("0123456789abcdef"),
+	}
+}
+
+func TestNewSealer(t *testing.T) {
+	tests := []struct {
+		name      string
+		masterKey string
+		wantErr   bool
+	}{
+		{"derived from jwt secret", "", false},
+		{"hex master key", strings.Repeat("ab", 32), false},
+		{"not hex", strings.Repeat("zz", 32), true},
+		{"too short", strings.Repeat("ab", 16), true},
+		{"too long", strings.Repeat("ab", 33), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Drm.MasterKey = tt.masterKey
+			cfg.Server.JwtSecretKey = "jwt-secret"
+			if _, err := newSealer(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("newSealer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	s := testSealer(t, strings.Repeat("ab", 32), "")
+	key := testContentKey()
+	sealed, err := s.seal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, key.Key) {
+		t.Error("seal() left the key in the clear")
+	}
+	again, err := s.seal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Error("seal() reused a nonce")
+	}
+	raw, err := s.open(key, sealed)
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+	if !bytes.Equal(raw, key.Key) {
+		t.Errorf("open() = %x, want %x", raw, key.Key)
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	s := testSealer(t, strings.Repeat("ab", 32), "")
+	sealed, err := s.seal(testContentKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		sealer *sealer
+		key    func(k *models.ContentKey)
+		sealed func(b []byte) []byte
+	}{
+		{name: "other master key", sealer: testSealer(t, strings.Repeat("cd", 32), "")},
+		{name: "derived master key", sealer: testSealer(t, "", "jwt-secret")},
+		{name: "other video", key: func(k *models.ContentKey) { k.VideoID = uuid.MustParse("9f1c2d3e-0000-4000-8000-000000000002") }},
+		{name: "other index", key: func(k *models.ContentKey) { k.KeyIndex = 1 }},
+		{name: "other kid", key: func(k *models.ContentKey) { k.KID = "ffeeddccbbaa99887766554433221100" }},
+		{name: "flipped ciphertext", sealed: func(b []byte) []byte { b[len(b)-1] ^= 1; return b }},
+		{name: "flipped nonce", sealed: func(b []byte) []byte { b[0] ^= 1; return b }},
+		{name: "truncated tag", sealed: func(b []byte) []byte { return b[:len(b)-1] }},
+		{name: "shorter than a nonce", sealed: func(b []byte) []byte { return b[:4] }},
+		{name: "empty", sealed: func(b []byte) []byte { return nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opener := s
+			if tt.sealer != nil {
+				opener = tt.sealer
+			}
+			key := testContentKey()
+			if tt.key != nil {
+				tt.key(key)
+			}
+			b := append([]byte(nil), sealed...)
+			if tt.sealed != nil {
+				b = tt.sealed(b)
+			}
+			if raw, err := opener.open(key, b); err == nil {
+				t.Errorf("open() = %x, want an error", raw)
+			}
+		})
+	}
+}
+
+func TestDerivedSealerDependsOnSecret(t *testing.T) {
+	key := testContentKey()
+	sealed, err := testSealer(t, "", "jwt-secret").seal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testSealer(t, "", "jwt-secret").open(key, sealed); err != nil {
+		t.Errorf("open() with the same secret error = %v", err)
+	}
+	if _, err := testSealer(t, "", "other-secret").open(key, sealed); err == nil {
+		t.Error("open() with another secret succeeded")
+	}
+}
@@ -0,0 +1,16 @@
+package repository
+
+const (
+	keyColumns = `video_id, key_index, kid, encrypted_key, iv, created_at`
+
+	// Concurrent attempts agree on the key of the first writer
+	insertKeyQuery = `INSERT INTO content_keys (video_id, key_index, kid, encrypted_key, iv)
+					VALUES ($1, $2, $3, $4, $5)
+					ON CONFLICT (video_id, key_index) DO NOTHING`
+	listKeysQuery = `SELECT ` + keyColumns + ` FROM content_keys
+					WHERE video_id = $1 AND key_index < $2 ORDER BY key_index`
+	getKeysQuery = `SELECT ` + keyColumns + ` FROM content_keys
+					WHERE video_id = $1 ORDER BY key_index`
+	getKeyQuery = `SELECT ` + keyColumns + ` FROM content_keys
+					WHERE video_id = $1 AND key_index = $2`
+)
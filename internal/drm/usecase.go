@@ -0,0 +1,40 @@
+package drm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/google/uuid"
+)
+
+// KeyRoutePrefix is the path content keys are delivered under.
+const KeyRoutePrefix = "/api/v1/keys"
+
+var (
+	ErrKeyNotFound  = errors.New("key not found")
+	ErrKeyForbidden = errors.New("not allowed to fetch this key")
+	ErrInvalidKeyID = errors.New("invalid key id")
+)
+
+type UseCase interface {
+	// GetKey returns a raw content key to the owner of the video, or to a viewer holding a
+	// playback token for it when token is set.
+	GetKey(ctx context.Context, videoID uuid.UUID, index int, token string, viewer *models.PlaybackViewer) ([]byte, error)
+	// GetLicense answers a ClearKey license request with the requested keys of a video, all of
+	// them when the request names none. It is authorized like GetKey.
+	GetLicense(ctx context.Context, videoID uuid.UUID, req *models.ClearKeyRequest, token string, viewer *models.PlaybackViewer) (*models.ClearKeyLicense, error)
+}
+
+// KeyURL is the URI players fetch a key from. publicURL is the server address, empty for a
+// host-relative URI.
+func KeyURL(publicURL, videoID string, index int) string {
+	return fmt.Sprintf("%s%s/%s?index=%d", strings.TrimSuffix(publicURL, "/"), KeyRoutePrefix, videoID, index)
+}
+
+// LicenseURL is where ClearKey clients request the keys of a video.
+func LicenseURL(publicURL, videoID string) string {
+	return fmt.Sprintf("%s%s/%s/license", strings.TrimSuffix(publicURL, "/"), KeyRoutePrefix, videoID)
+}
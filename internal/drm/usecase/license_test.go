@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+func TestGetLicense(t *testing.T) {
+	uc, cfg := testUseCase()
+	viewer := &models.PlaybackViewer{}
+	token := playbackToken(t, cfg, testVideoID, "")
+	kid0 := base64.RawURLEncoding.EncodeToString([]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+
+	tests := []struct {
+		name     string
+		kids     []string
+		token    string
+		wantKeys []string
+		wantErr  error
+	}{
+		{name: "one kid", kids: []string{kid0}, token: token, wantKeys: []string{"key-0-0123456789"}},
+		{name: "padded kid", kids: []string{kid0 + "=="}, token: token, wantKeys: []string{"key-0-0123456789"}},
+		{name: "all keys", token: token, wantKeys: []string{"key-0-0123456789", "key-1-0123456789"}},
+		{name: "unknown kid", kids: []string{base64.RawURLEncoding.EncodeToString([]byte("unknown-kid-0000"))}, token: token, wantErr: drm.ErrKeyNotFound},
+		{name: "bad kid", kids: []string{"!!"}, token: token, wantErr: drm.ErrInvalidKeyID},
+		{name: "token for another video", token: playbackToken(t, cfg, otherID, ""), wantErr: drm.ErrKeyForbidden},
+		{name: "no token or session", wantErr: drm.ErrKeyForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			license, err := uc.GetLicense(context.Background(), testVideoID, &models.ClearKeyRequest{KIDs: tt.kids}, tt.token, viewer)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetLicense() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(license.Keys) != len(tt.wantKeys) {
+				t.Fatalf("GetLicense() returned %d keys, want %d", len(license.Keys), len(tt.wantKeys))
+			}
+			for i, jwk := range license.Keys {
+				k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+				if err != nil || string(k) != tt.wantKeys[i] || jwk.Kty != "oct" {
+					t.Errorf("GetLicense() key %d = %+v, want %q", i, jwk, tt.wantKeys[i])
+				}
+			}
+		})
+	}
+}
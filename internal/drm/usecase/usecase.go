@@ -0,0 +1,123 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+type drmUC struct {
+	cfg       *config.Config
+	repo      drm.Repository
+	videoRepo videofiles.Repository
+	logger    logger.Logger
+}
+
+func NewDrmUseCase(cfg *config.Config, repo drm.Repository, videoRepo videofiles.Repository, log logger.Logger) drm.UseCase {
+	return &drmUC{
+		cfg:       cfg,
+		repo:      repo,
+		videoRepo: videoRepo,
+		logger:    log,
+	}
+}
+
+func (d *drmUC) GetKey(ctx context.Context, videoID uuid.UUID, index int, token string, viewer *models.PlaybackViewer) ([]byte, error) {
+	if err := d.authorize(ctx, videoID, token, viewer); err != nil {
+		return nil, err
+	}
+
+	key, err := d.repo.GetKey(ctx, videoID, index)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, drm.ErrKeyNotFound
+		}
+		d.logger.Errorf("GetKey - %v", err)
+		return nil, fmt.Errorf("failed to fetch key: %v", err)
+	}
+	return key.Key, nil
+}
+
+func (d *drmUC) GetLicense(ctx context.Context, videoID uuid.UUID, req *models.ClearKeyRequest, token string, viewer *models.PlaybackViewer) (*models.ClearKeyLicense, error) {
+	if err := d.authorize(ctx, videoID, token, viewer); err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(req.KIDs))
+	for _, kid := range req.KIDs {
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(kid, "="))
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", drm.ErrInvalidKeyID, kid)
+		}
+		wanted[hex.EncodeToString(raw)] = true
+	}
+
+	keys, err := d.repo.GetKeys(ctx, videoID)
+	if err != nil {
+		d.logger.Errorf("GetLicense - %v", err)
+		return nil, fmt.Errorf("failed to fetch keys: %v", err)
+	}
+	license := &models.ClearKeyLicense{Keys: []models.JWK{}, Type: "temporary"}
+	for _, key := range keys {
+		if len(wanted) > 0 && !wanted[key.KID] {
+			continue
+		}
+		kid, err := hex.DecodeString(key.KID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored key id %q", key.KID)
+		}
+		license.Keys = append(license.Keys, models.JWK{
+			Kty: "oct",
+			Kid: base64.RawURLEncoding.EncodeToString(kid),
+			K:   base64.RawURLEncoding.EncodeToString(key.Key),
+		})
+	}
+	if len(license.Keys) == 0 {
+		return nil, drm.ErrKeyNotFound
+	}
+	return license, nil
+}
+
+// authorize lets through the holder of a playback token for the video when token is set, and
+// otherwise only its owner.
+func (d *drmUC) authorize(ctx context.Context, videoID uuid.UUID, token string, viewer *models.PlaybackViewer) error {
+	if token != "" {
+		claims, err := utils.ValidatePlaybackToken(token, utils.PlaybackSecret(d.cfg))
+		if err != nil || claims.VideoID != videoID.String() || !claims.Allows(viewer.IP, viewer.Referer) {
+			return drm.ErrKeyForbidden
+		}
+		return nil
+	}
+	return d.checkOwner(ctx, videoID)
+}
+
+func (d *drmUC) checkOwner(ctx context.Context, videoID uuid.UUID) error {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		return drm.ErrKeyForbidden
+	}
+	video, err := d.videoRepo.GetVideoByID(ctx, videoID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return drm.ErrKeyNotFound
+		}
+		d.logger.Errorf("GetKey - failed to fetch video: %v", err)
+		return fmt.Errorf("failed to fetch video: %v", err)
+	}
+	if video.UserID != user.UserID {
+		d.logger.Warnf("User %s is not authorized to fetch keys of video %s", user.UserID, videoID)
+		return drm.ErrKeyForbidden
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+var (
+	testVideoID = uuid.MustParse("9f1c2d3e-0000-4000-8000-000000000001")
+	testOwnerID = uuid.MustParse("9f1c2d3e-0000-4000-8000-000000000002")
+	otherID     = uuid.MustParse("9f1c2d3e-0000-4000-8000-000000000003")
+)
+
+type fakeKeyRepo struct {
+	drm.Repository
+	keys []*models.ContentKey
+}
+
+func (r *fakeKeyRepo) GetKey(_ context.Context, videoID uuid.UUID, index int) (*models.ContentKey, error) {
+	for _, key := range r.keys {
+		if key.VideoID == videoID && key.KeyIndex == index {
+			return key, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeKeyRepo) GetKeys(_ context.Context, videoID uuid.UUID) ([]*models.ContentKey, error) {
+	var keys []*models.ContentKey
+	for _, key := range r.keys {
+		if key.VideoID == videoID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+type fakeVideoRepo struct {
+	videofiles.Repository
+}
+
+func (fakeVideoRepo) GetVideoByID(_ context.Context, videoID uuid.UUID) (*models.VideoFile, error) {
+	if videoID != testVideoID {
+		return nil, sql.ErrNoRows
+	}
+	return &models.VideoFile{VideoID: testVideoID, UserID: testOwnerID}, nil
+}
+
+type nopLogger struct {
+	logger.Logger
+}
+
+func (nopLogger) Warnf(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+func testUseCase() (*drmUC, *config.Config) {
+	cfg := &config.Config{}
+	cfg.Server.JwtSecretKey = "jwt-secret"
+	repo := &fakeKeyRepo{keys: []*models.ContentKey{
+		{VideoID: testVideoID, KeyIndex: 0, KID: "00112233445566778899aabbccddeeff", Key: []byte("key-0-0123456789")},
+		{VideoID: testVideoID, KeyIndex: 1, KID: "ffeeddccbbaa99887766554433221100", Key: []byte("key-1-0123456789")},
+	}}
+	return &drmUC{cfg: cfg, repo: repo, videoRepo: fakeVideoRepo{}, logger: nopLogger{}}, cfg
+}
+
+func playbackToken(t *testing.T, cfg *config.Config, videoID uuid.UUID, ip string) string {
+	t.Helper()
+	token, err := utils.GeneratePlaybackToken(&utils.PlaybackClaims{
+		VideoID: videoID.String(),
+		IP:      ip,
+	}, utils.PlaybackSecret(cfg), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func userCtx(userID uuid.UUID) context.Context {
+	return context.WithValue(context.Background(), utils.UserCtxKey{}, &models.User{UserID: userID})
+}
+
+func TestGetKeyAuthorization(t *testing.T) {
+	uc, cfg := testUseCase()
+	viewer := &models.PlaybackViewer{IP: "203.0.113.7"}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		videoID uuid.UUID
+		token   string
+		want    error
+	}{
+		{name: "owner", ctx: userCtx(testOwnerID), videoID: testVideoID},
+		{name: "other user", ctx: userCtx(otherID), videoID: testVideoID, want: drm.ErrKeyForbidden},
+		{name: "anonymous", ctx: context.Background(), videoID: testVideoID, want: drm.ErrKeyForbidden},
+		{name: "unknown video", ctx: userCtx(testOwnerID), videoID: otherID, want: drm.ErrKeyNotFound},
+		{name: "playback token", ctx: context.Background(), videoID: testVideoID, token: playbackToken(t, cfg, testVideoID, "")},
+		{name: "token bound to the viewer ip", ctx: context.Background(), videoID: testVideoID, token: playbackToken(t, cfg, testVideoID, "203.0.113.7")},
+		{name: "token bound to another ip", ctx: context.Background(), videoID: testVideoID,
+			token: playbackToken(t, cfg, testVideoID, "203.0.113.8"), want: drm.ErrKeyForbidden},
+		{name: "token for another video", ctx: context.Background(), videoID: testVideoID,
+			token: playbackToken(t, cfg, otherID, ""), want: drm.ErrKeyForbidden},
+		// A bad token is refused even for the owner rather than falling back to the session
+		{name: "invalid token", ctx: userCtx(testOwnerID), videoID: testVideoID, token: "not-a-token", want: drm.ErrKeyForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := uc.GetKey(tt.ctx, tt.videoID, 0, tt.token, viewer)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("GetKey() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && string(key) != "key-0-0123456789" {
+				t.Errorf("GetKey() = %q, want key 0", key)
+			}
+		})
+	}
+
+	if _, err := uc.GetKey(userCtx(testOwnerID), testVideoID, 5, "", viewer); !errors.Is(err, drm.ErrKeyNotFound) {
+		t.Errorf("GetKey() of a missing index error = %v, want %v", err, drm.ErrKeyNotFound)
+	}
+}
@@ -0,0 +1,18 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	// ClaimSource records that the source is being ingested. It returns nil without error when
+	// the source was ingested already, is being ingested by someone else or failed maxAttempts
+	// times. A claim older than staleAfter is taken over.
+	ClaimSource(ctx context.Context, userID uuid.UUID, source, fingerprint string, maxAttempts int, staleAfter time.Duration) (*models.IngestRecord, error)
+	CompleteSource(ctx context.Context, record *models.IngestRecord) error
+	FailSource(ctx context.Context, record *models.IngestRecord) error
+}
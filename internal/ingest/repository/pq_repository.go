@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/ingest"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type ingestRepo struct {
+	db *sqlx.DB
+}
+
+func NewIngestRepo(db *sqlx.DB) ingest.Repository {
+	return &ingestRepo{
+		db: db,
+	}
+}
+
+func (r *ingestRepo) ClaimSource(ctx context.Context, userID uuid.UUID, source, fingerprint string, maxAttempts int, staleAfter time.Duration) (*models.IngestRecord, error) {
+	record := &models.IngestRecord{}
+	err := r.db.GetContext(ctx, record, claimSourceQuery, source, fingerprint, userID, maxAttempts, staleAfter.Seconds())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to claim source: %w", err)
+	}
+	return record, nil
+}
+
+func (r *ingestRepo) CompleteSource(ctx context.Context, record *models.IngestRecord) error {
+	if _, err := r.db.ExecContext(
+		ctx,
+		completeSourceQuery,
+		record.Source,
+		record.Fingerprint,
+		record.VideoID,
+		record.JobID,
+		record.ImportID,
+	); err != nil {
+		return fmt.Errorf("failed to complete source: %w", err)
+	}
+	return nil
+}
+
+func (r *ingestRepo) FailSource(ctx context.Context, record *models.IngestRecord) error {
+	if _, err := r.db.ExecContext(ctx, failSourceQuery, record.Source, record.Fingerprint, record.ErrorMessage); err != nil {
+		return fmt.Errorf("failed to record failed source: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package repository
+
+const (
+	ingestColumns = `source, fingerprint, user_id, status, COALESCE(video_id::text, '') AS video_id,
+					COALESCE(job_id::text, '') AS job_id, COALESCE(import_id::text, '') AS import_id,
+					attempts, error_message, claimed_at, ingested_at`
+
+	// A source can be claimed again after a failure or when its claim went stale
+	claimSourceQuery = `INSERT INTO ingested_sources (source, fingerprint, user_id)
+					VALUES ($1, $2, $3)
+					ON CONFLICT (source, fingerprint) DO UPDATE
+					SET status = 'ingesting',
+					    user_id = EXCLUDED.user_id,
+					    attempts = ingested_sources.attempts + 1,
+					    error_message = '',
+					    claimed_at = NOW()
+					WHERE (ingested_sources.status = 'failed' AND ingested_sources.attempts < $4)
+					   OR (ingested_sources.status = 'ingesting' AND ingested_sources.claimed_at < NOW() - $5 * INTERVAL '1 second')
+					RETURNING ` + ingestColumns
+
+	completeSourceQuery = `UPDATE ingested_sources
+					SET status = 'ingested',
+					    video_id = NULLIF($3, '')::uuid,
+					    job_id = NULLIF($4, '')::uuid,
+					    import_id = NULLIF($5, '')::uuid,
+					    ingested_at = NOW()
+					WHERE source = $1 AND fingerprint = $2`
+
+	failSourceQuery = `UPDATE ingested_sources SET status = 'failed', error_message = $3
+					WHERE source = $1 AND fingerprint = $2`
+)
@@ -0,0 +1,84 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/ingest"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+)
+
+// A file modified within settleTime may still be being copied in
+const defaultSettleTime = 30 * time.Second
+
+type folderSource struct {
+	dir        string
+	defaults   models.ImportInput
+	settleTime time.Duration
+}
+
+// NewFolderSource lists the video files under dir, including subdirectories. Hidden files and
+// files modified within settleTime are left for a later scan.
+func NewFolderSource(dir string, defaults models.ImportInput, settleTime time.Duration) (ingest.Source, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid watch folder: %w", err)
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("watch folder %s is not a directory", abs)
+	}
+	if settleTime <= 0 {
+		settleTime = defaultSettleTime
+	}
+	return &folderSource{dir: abs, defaults: defaults, settleTime: settleTime}, nil
+}
+
+func (s *folderSource) Scan(ctx context.Context) ([]*models.IngestItem, error) {
+	var items []*models.IngestItem
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != s.dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !utils.IsVideoFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed since the directory was read
+		}
+		if time.Since(info.ModTime()) < s.settleTime {
+			return nil
+		}
+		items = append(items, fileItem(path, info, s.defaults))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", s.dir, err)
+	}
+	return items, nil
+}
+
+// fileItem makes the item for a local file. Its fingerprint changes when the file is replaced.
+func fileItem(path string, info fs.FileInfo, input models.ImportInput) *models.IngestItem {
+	input.SourceURL = (&url.URL{Scheme: "file", Path: path}).String()
+	return &models.IngestItem{
+		Input:       input,
+		Fingerprint: fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano()),
+	}
+}
@@ -0,0 +1,184 @@
+package source
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/ingest"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+)
+
+type manifestSource struct {
+	awsRepo  videofiles.AWSRepository
+	path     string
+	defaults models.ImportInput
+}
+
+// NewManifestSource lists the sources in a CSV or JSON manifest. A JSON manifest is an array of
+// import requests as accepted by the import API. A CSV manifest has a header row naming its
+// columns: source_url, filename, format, mime_type, checksum, output_formats (separated by ";"),
+// enable_per_title_encoding and qualities (as JSON). Sources are local paths, relative to the
+// manifest, s3:// or http(s):// URLs. Options left out fall back to defaults.
+func NewManifestSource(awsRepo videofiles.AWSRepository, path string, defaults models.ImportInput) (ingest.Source, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv", ".json":
+	default:
+		return nil, fmt.Errorf("manifest %s must be a .csv or .json file", path)
+	}
+	return &manifestSource{awsRepo: awsRepo, path: path, defaults: defaults}, nil
+}
+
+// Scan returns the items of every valid entry. Invalid entries are reported in the error.
+func (s *manifestSource) Scan(ctx context.Context) ([]*models.IngestItem, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	var entries []models.ImportInput
+	if strings.EqualFold(filepath.Ext(s.path), ".json") {
+		if err = json.NewDecoder(f).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+	} else if entries, err = readCSVManifest(f); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	var items []*models.IngestItem
+	var errs []error
+	for i, entry := range entries {
+		item, err := s.item(ctx, s.withDefaults(entry))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("entry %d: %w", i+1, err))
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, errors.Join(errs...)
+}
+
+func (s *manifestSource) item(ctx context.Context, input models.ImportInput) (*models.IngestItem, error) {
+	if input.SourceURL == "" {
+		return nil, errors.New("missing source_url")
+	}
+	u, err := url.Parse(input.SourceURL)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 { // A one letter scheme is a Windows drive
+		path := input.SourceURL
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(s.path), path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a file", path)
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		return fileItem(abs, info, input), nil
+	}
+
+	switch u.Scheme {
+	case "s3":
+		head, err := s.awsRepo.HeadObject(ctx, u.Host, strings.TrimPrefix(u.Path, "/"))
+		if err != nil {
+			return nil, err
+		}
+		var etag string
+		if head.ETag != nil {
+			etag = strings.Trim(*head.ETag, `"`)
+		}
+		return &models.IngestItem{Input: input, Fingerprint: etag}, nil
+	case "http", "https":
+		// The content behind a URL can't be told apart without fetching it
+		fingerprint := input.Checksum
+		if fingerprint == "" {
+			fingerprint = "url"
+		}
+		return &models.IngestItem{Input: input, Fingerprint: fingerprint}, nil
+	default:
+		return nil, fmt.Errorf("unsupported source scheme %q", u.Scheme)
+	}
+}
+
+func (s *manifestSource) withDefaults(input models.ImportInput) models.ImportInput {
+	if len(input.Qualities) == 0 {
+		input.Qualities = s.defaults.Qualities
+	}
+	if len(input.OutputFormats) == 0 {
+		input.OutputFormats = s.defaults.OutputFormats
+	}
+	input.EnablePerTitleEncoding = input.EnablePerTitleEncoding || s.defaults.EnablePerTitleEncoding
+	return input
+}
+
+func readCSVManifest(r io.Reader) ([]models.ImportInput, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var entries []models.ImportInput
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var entry models.ImportInput
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			switch header[i] {
+			case "source_url":
+				entry.SourceURL = value
+			case "filename":
+				entry.FileName = value
+			case "format":
+				entry.Format = value
+			case "mime_type":
+				entry.MimeType = value
+			case "checksum":
+				entry.Checksum = value
+			case "output_formats":
+				for _, format := range strings.Split(value, ";") {
+					entry.OutputFormats = append(entry.OutputFormats, models.PlaybackFormat(strings.TrimSpace(format)))
+				}
+			case "enable_per_title_encoding":
+				if entry.EnablePerTitleEncoding, err = strconv.ParseBool(value); err != nil {
+					return nil, fmt.Errorf("line %d: invalid enable_per_title_encoding: %w", line, err)
+				}
+			case "qualities":
+				if err = json.Unmarshal([]byte(value), &entry.Qualities); err != nil {
+					return nil, fmt.Errorf("line %d: invalid qualities: %w", line, err)
+				}
+			default:
+				return nil, fmt.Errorf("unknown column %q", header[i])
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
@@ -0,0 +1,53 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/ingest"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+)
+
+type s3Source struct {
+	awsRepo  videofiles.AWSRepository
+	bucket   string
+	prefix   string
+	defaults models.ImportInput
+}
+
+// NewS3Source lists the video objects under an s3://bucket/prefix URL. S3 objects appear
+// complete, so unlike a folder nothing has to settle.
+func NewS3Source(awsRepo videofiles.AWSRepository, prefixURL string, defaults models.ImportInput) (ingest.Source, error) {
+	u, err := url.Parse(prefixURL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 prefix %q: expected s3://bucket/prefix", prefixURL)
+	}
+	return &s3Source{
+		awsRepo:  awsRepo,
+		bucket:   u.Host,
+		prefix:   strings.TrimPrefix(u.Path, "/"),
+		defaults: defaults,
+	}, nil
+}
+
+func (s *s3Source) Scan(ctx context.Context) ([]*models.IngestItem, error) {
+	objects, err := s.awsRepo.ListObjectsWithPrefix(ctx, s.bucket, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	var items []*models.IngestItem
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, "/") || !utils.IsVideoFile(path.Base(object.Key)) {
+			continue
+		}
+		input := s.defaults
+		input.SourceURL = (&url.URL{Scheme: "s3", Host: s.bucket, Path: "/" + object.Key}).String()
+		items = append(items, &models.IngestItem{Input: input, Fingerprint: object.ETag})
+	}
+	return items, nil
+}
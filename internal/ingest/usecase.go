@@ -0,0 +1,24 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+// Source finds files to ingest: a watched folder, an S3 prefix or a manifest.
+type Source interface {
+	// Scan lists the items that are ready to be ingested. Items ingested before are listed
+	// again, the use case skips them.
+	Scan(ctx context.Context) ([]*models.IngestItem, error)
+}
+
+type UseCase interface {
+	// Ingest uploads the item's source and creates its video and encode job. It returns nil
+	// without error when the item was ingested already.
+	Ingest(ctx context.Context, item *models.IngestItem) (*models.IngestRecord, error)
+	// Run ingests what the source lists. With a zero interval it scans once, otherwise it
+	// rescans every interval until ctx is done.
+	Run(ctx context.Context, source Source, interval time.Duration) error
+}
@@ -0,0 +1,245 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/ingest"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+)
+
+const (
+	defaultMaxAttempts = 3
+	// A claim older than this belongs to an ingester that died
+	staleClaimAge = 6 * time.Hour
+)
+
+type ingestUC struct {
+	cfg         *config.Config
+	ingestRepo  ingest.Repository
+	videoUC     videofiles.UseCase
+	awsRepo     videofiles.AWSRepository
+	scratchDir  string
+	maxAttempts int
+	logger      logger.Logger
+}
+
+// NewIngestUseCase returns the ingest use case. Sources from S3 are staged in scratchDir before
+// they are uploaded to the input bucket; failed sources are retried up to maxAttempts times.
+func NewIngestUseCase(
+	cfg *config.Config,
+	ingestRepo ingest.Repository,
+	videoUC videofiles.UseCase,
+	awsRepo videofiles.AWSRepository,
+	scratchDir string,
+	maxAttempts int,
+	log logger.Logger,
+) ingest.UseCase {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	if scratchDir == "" {
+		scratchDir = os.TempDir()
+	}
+	return &ingestUC{
+		cfg:         cfg,
+		ingestRepo:  ingestRepo,
+		videoUC:     videoUC,
+		awsRepo:     awsRepo,
+		scratchDir:  scratchDir,
+		maxAttempts: maxAttempts,
+		logger:      log,
+	}
+}
+
+func (u *ingestUC) Run(ctx context.Context, source ingest.Source, interval time.Duration) error {
+	for {
+		// A scan can fail for some entries only, the ones it found are still ingested
+		items, scanErr := source.Scan(ctx)
+		if scanErr != nil {
+			u.logger.Errorf("Ingest - Scan error: %v", scanErr)
+		}
+		for _, item := range items {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			record, err := u.Ingest(ctx, item)
+			switch {
+			case err != nil:
+				u.logger.Errorf("Ingest of %s failed: %v", item.Input.SourceURL, err)
+			case record != nil:
+				u.logger.Infof("Ingested %s: video %s, job %s, import %s", record.Source, record.VideoID, record.JobID, record.ImportID)
+			}
+		}
+		if interval == 0 {
+			if scanErr != nil {
+				return fmt.Errorf("failed to scan source: %w", scanErr)
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (u *ingestUC) Ingest(ctx context.Context, item *models.IngestItem) (*models.IngestRecord, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		u.logger.Errorf("Ingest - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	source, err := url.Parse(item.Input.SourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source %q: %v", item.Input.SourceURL, err)
+	}
+	record, err := u.ingestRepo.ClaimSource(ctx, user.UserID, item.Input.SourceURL, item.Fingerprint, u.maxAttempts, staleClaimAge)
+	if err != nil {
+		u.logger.Errorf("Ingest - ClaimSource error: %v", err)
+		return nil, err
+	}
+	if record == nil {
+		return nil, nil
+	}
+
+	switch source.Scheme {
+	case "file":
+		err = u.ingestFile(ctx, record, item, source.Path)
+	case "s3":
+		err = u.ingestObject(ctx, record, item, source.Host, strings.TrimPrefix(source.Path, "/"))
+	case "http", "https":
+		// Remote files go through the import queue, a worker fetches them
+		var task *models.ImportTask
+		if task, err = u.videoUC.ImportVideo(ctx, &item.Input); err == nil {
+			record.ImportID = task.ImportID
+		}
+	default:
+		err = fmt.Errorf("unsupported source scheme %q", source.Scheme)
+	}
+	if err != nil {
+		record.Status = models.IngestStatusFailed
+		record.ErrorMessage = err.Error()
+		if ferr := u.ingestRepo.FailSource(context.WithoutCancel(ctx), record); ferr != nil {
+			u.logger.Errorf("Ingest - FailSource error: %v", ferr)
+		}
+		return nil, err
+	}
+
+	record.Status = models.IngestStatusIngested
+	if err = u.ingestRepo.CompleteSource(context.WithoutCancel(ctx), record); err != nil {
+		// The video exists, without the record it would be ingested a second time
+		u.logger.Errorf("Ingest - CompleteSource of %s error: %v", record.Source, err)
+		return nil, err
+	}
+	return record, nil
+}
+
+// ingestFile uploads a local file to the input bucket and creates its video and encode job.
+func (u *ingestUC) ingestFile(ctx context.Context, record *models.IngestRecord, item *models.IngestItem, path string) error {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %v", err)
+	}
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	if item.Input.Checksum != "" && !strings.EqualFold(item.Input.Checksum, checksum) {
+		return fmt.Errorf("checksum mismatch")
+	}
+
+	input := uploadInput(item, filepath.Base(path), info.Size(), checksum)
+	// Watched folders are walked recursively, files of the same name in different folders only
+	// get their own object under their content's checksum
+	input.S3Key = fmt.Sprintf("uploads/%s/ingest/%s/%s", user.UserID, checksum, input.FileName)
+	if _, err = u.awsRepo.UploadFile(ctx, u.cfg.S3.InputBucket, input.S3Key, path, input.MimeType, checksum); err != nil {
+		u.logger.Errorf("Ingest - UploadFile error: %v", err)
+		return fmt.Errorf("failed to upload source: %v", err)
+	}
+	job, err := u.videoUC.CreateJob(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to create video: %v", err)
+	}
+	record.VideoID = job.VideoID
+	record.JobID = job.JobID
+	return nil
+}
+
+// ingestObject stages an S3 object locally and ingests it like a local file.
+func (u *ingestUC) ingestObject(ctx context.Context, record *models.IngestRecord, item *models.IngestItem, bucket, key string) error {
+	staged, err := os.CreateTemp(u.scratchDir, "ingest-*"+filepath.Ext(key))
+	if err != nil {
+		return fmt.Errorf("failed to stage source: %v", err)
+	}
+	staged.Close()
+	defer os.Remove(staged.Name())
+
+	if _, err = u.awsRepo.DownloadFile(ctx, bucket, key, staged.Name()); err != nil {
+		u.logger.Errorf("Ingest - DownloadFile error: %v", err)
+		return fmt.Errorf("failed to download source: %v", err)
+	}
+	if item.Input.FileName == "" {
+		// Name the video after the object, not the staging file
+		item.Input.FileName = filepath.Base(key)
+	}
+	return u.ingestFile(ctx, record, item, staged.Name())
+}
+
+// uploadInput fills in what the item left open from the file.
+func uploadInput(item *models.IngestItem, name string, size int64, checksum string) *models.VideoUploadInput {
+	input := &models.VideoUploadInput{
+		FileName:               item.Input.FileName,
+		FileSize:               size,
+		Format:                 strings.ToLower(item.Input.Format),
+		MimeType:               item.Input.MimeType,
+		Checksum:               checksum,
+		Qualities:              item.Input.Qualities,
+		OutputFormats:          item.Input.OutputFormats,
+		EnablePerTitleEncoding: item.Input.EnablePerTitleEncoding,
+	}
+	if input.FileName == "" {
+		input.FileName = name
+	}
+	ext := strings.ToLower(filepath.Ext(input.FileName))
+	if input.Format == "" {
+		input.Format = strings.TrimPrefix(ext, ".")
+	}
+	if input.MimeType == "" {
+		input.MimeType = utils.VideoMimeType(ext)
+		if input.MimeType == "" {
+			input.MimeType = "application/octet-stream"
+		}
+	}
+	return input
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open source: %v", err)
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, f); err != nil {
+		return "", fmt.Errorf("failed to read source: %v", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,9 @@
+package jobs
+
+import "github.com/labstack/echo/v4"
+
+type Handler interface {
+	GetJob() echo.HandlerFunc
+	ListJobs() echo.HandlerFunc
+	StreamEvents() echo.HandlerFunc
+}
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/jobs"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+type jobHandler struct {
+	jobUC jobs.UseCase
+}
+
+func NewJobHandler(jobUC jobs.UseCase) jobs.Handler {
+	return &jobHandler{
+		jobUC: jobUC,
+	}
+}
+
+func (h *jobHandler) GetJob() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		jobID := c.Param("job_id")
+		if _, err := uuid.Parse(jobID); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid job id"})
+		}
+		job, err := h.jobUC.GetJob(c.Request().Context(), jobID)
+		if err != nil {
+			if errors.Is(err, jobs.ErrJobNotFound) {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+			}
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, job)
+	}
+}
+
+// ListJobs lists the user's jobs, newest first. They can be filtered with the status, video_id,
+// from and to (RFC 3339, on the creation time) query parameters.
+func (h *jobHandler) ListJobs() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter := &models.JobFilter{}
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, filter); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid filter"})
+		}
+		pagination, err := utils.GetPaginationFromCtx(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		jobList, err := h.jobUC.ListJobs(c.Request().Context(), filter, pagination)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, jobList)
+	}
+}
+
+// StreamEvents follows a job over Server-Sent Events. The current state is sent first, then
+// every status or progress change, and the stream ends once the job reaches a terminal state.
+func (h *jobHandler) StreamEvents() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		jobID := c.Param("job_id")
+		if _, err := uuid.Parse(jobID); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid job id"})
+		}
+
+		ctx := c.Request().Context()
+		current, events, err := h.jobUC.WatchJob(ctx, jobID)
+		if err != nil {
+			if errors.Is(err, jobs.ErrJobNotFound) {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+			}
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		// Stop nginx from buffering the stream
+		res.Header().Set("X-Accel-Buffering", "no")
+		res.WriteHeader(http.StatusOK)
+
+		if err := writeEvent(res, "status", current); err != nil || current.Status.Terminal() {
+			return nil
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		last := current
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+					return nil
+				}
+				res.Flush()
+			case event, ok := <-events:
+				if !ok {
+					return nil
+				}
+				name := "progress"
+				if event.Status != last.Status || event.Stage != last.Stage {
+					name = "status"
+				}
+				if err := writeEvent(res, name, event); err != nil {
+					return nil
+				}
+				if event.Status.Terminal() {
+					return nil
+				}
+				last = event
+			}
+		}
+	}
+}
+
+func writeEvent(res *echo.Response, name string, event *models.JobEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(res, "event: %s\ndata: %s\n\n", name, data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
@@ -0,0 +1,14 @@
+package http
+
+import (
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/jobs"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+func MapJobRoutes(jobGroup *echo.Group, h jobs.Handler, mw *middleware.MiddlewareManager) {
+	jobGroup.Use(mw.AuthSessionMiddleware)
+	jobGroup.GET("", h.ListJobs())
+	jobGroup.GET("/:job_id", h.GetJob())
+	jobGroup.GET("/:job_id/events", h.StreamEvents())
+}
@@ -0,0 +1,16 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	// SaveJob inserts the job or updates the state of an existing one.
+	SaveJob(ctx context.Context, job *models.EncodeJob) error
+	GetJobByID(ctx context.Context, jobID string) (*models.EncodeJob, error)
+	ListJobs(ctx context.Context, userID uuid.UUID, filter *models.JobFilter, pq *utils.Pagination) (*models.JobList, error)
+}
@@ -0,0 +1,14 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+type RedisRepository interface {
+	// GetJob returns the latest recorded state of the job.
+	GetJob(ctx context.Context, jobID string) (*models.EncodeJob, error)
+	// SubscribeJobEvents streams state changes of the job until ctx is done.
+	SubscribeJobEvents(ctx context.Context, jobID string) (<-chan *models.JobEvent, error)
+}
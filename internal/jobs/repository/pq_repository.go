@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/jobs"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type jobRepo struct {
+	db *sqlx.DB
+}
+
+func NewJobRepo(db *sqlx.DB) jobs.Repository {
+	return &jobRepo{
+		db: db,
+	}
+}
+
+func (r *jobRepo) SaveJob(ctx context.Context, job *models.EncodeJob) error {
+	if _, err := r.db.ExecContext(
+		ctx,
+		saveJobQuery,
+		job.JobID,
+		job.UserID,
+		job.VideoID,
+		job.InputS3Key,
+		job.InputBucket,
+		job.FileSize,
+		job.Duration,
+		job.OutputS3Key,
+		job.OutputBucket,
+		job.Qualities,
+		job.OutputFormats,
+		job.EnablePerTitleEncoding,
+		job.EncryptionMode,
+		job.KeyRotationSegments,
+		job.ClipRanges,
+		job.Overlays,
+		job.ComposeSources,
+		job.Status,
+		job.Stage,
+		job.StageTimings,
+		job.Progress,
+		job.Attempts,
+		job.WorkerID,
+		job.ErrorMessage,
+		job.CreatedAt,
+		job.StartedAt,
+		job.CompletedAt,
+	); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	return nil
+}
+
+func (r *jobRepo) GetJobByID(ctx context.Context, jobID string) (*models.EncodeJob, error) {
+	job := &models.EncodeJob{}
+	if err := r.db.GetContext(ctx, job, getJobByIDQuery, jobID); err != nil {
+		return nil, fmt.Errorf("failed to get job by id: %w", err)
+	}
+	return job, nil
+}
+
+func (r *jobRepo) ListJobs(ctx context.Context, userID uuid.UUID, filter *models.JobFilter, pq *utils.Pagination) (*models.JobList, error) {
+	args := []interface{}{userID, string(filter.Status), filter.VideoID, filter.From, filter.To}
+
+	var totalCount int
+	if err := r.db.GetContext(ctx, &totalCount, getTotalJobsQuery, args...); err != nil {
+		return nil, fmt.Errorf("failed to get total jobs: %w", err)
+	}
+	jobList := make([]*models.EncodeJob, 0, pq.GetSize())
+	if totalCount > 0 {
+		if err := r.db.SelectContext(
+			ctx,
+			&jobList,
+			listJobsQuery,
+			append(args, pq.GetOffset(), pq.GetLimit())...,
+		); err != nil {
+			return nil, fmt.Errorf("failed to list jobs: %w", err)
+		}
+	}
+	return &models.JobList{
+		Jobs:       jobList,
+		TotalCount: totalCount,
+		Page:       pq.GetPage(),
+		PageSize:   pq.GetSize(),
+		HasMore:    utils.GetHasMore(pq.GetPage(), totalCount, pq.GetSize()),
+	}, nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/jobs"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/go-redis/redis/v8"
+)
+
+const eventBufferSize = 16
+
+type jobRedisRepo struct {
+	redisClient *redis.Client
+}
+
+func NewJobRedisRepo(redisClient *redis.Client) jobs.RedisRepository {
+	return &jobRedisRepo{
+		redisClient: redisClient,
+	}
+}
+
+func (r *jobRedisRepo) GetJob(ctx context.Context, jobID string) (*models.EncodeJob, error) {
+	fields, err := r.redisClient.HGetAll(ctx, models.JobProgressKey+jobID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job state: %w", err)
+	}
+	jobData, ok := fields["job_data"]
+	if !ok {
+		return nil, jobs.ErrJobNotFound
+	}
+
+	job := &models.EncodeJob{}
+	if err := json.Unmarshal([]byte(jobData), job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job data: %w", err)
+	}
+	// Progress may be updated on its own without rewriting job_data
+	if progress, err := strconv.ParseFloat(fields["progress"], 64); err == nil {
+		job.Progress = progress
+	}
+	return job, nil
+}
+
+func (r *jobRedisRepo) SubscribeJobEvents(ctx context.Context, jobID string) (<-chan *models.JobEvent, error) {
+	pubsub := r.redisClient.Subscribe(ctx, models.JobEventsChannel+jobID)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to job events: %w", err)
+	}
+
+	events := make(chan *models.JobEvent, eventBufferSize)
+	go func() {
+		defer pubsub.Close()
+		defer close(events)
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				event := &models.JobEvent{}
+				if err := json.Unmarshal([]byte(msg.Payload), event); err != nil {
+					log.Printf("Error unmarshaling job event: %v", err)
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
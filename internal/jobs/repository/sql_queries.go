@@ -0,0 +1,38 @@
+package repository
+
+const (
+	jobColumns = `job_id, user_id, COALESCE(video_id::text, '') AS video_id, input_s3_key, input_bucket, file_size, duration,
+					output_s3_key, output_bucket, qualities, output_formats, enable_per_title_encoding, encryption_mode,
+					key_rotation_segments, clip_ranges, overlays, compose_sources, status, stage, stage_timings, progress, attempts,
+					worker_id, error_message, created_at, started_at, completed_at, updated_at`
+
+	saveJobQuery = `INSERT INTO encoding_jobs (job_id, user_id, video_id, input_s3_key, input_bucket, file_size, duration,
+					output_s3_key, output_bucket, qualities, output_formats, enable_per_title_encoding, encryption_mode,
+					key_rotation_segments, clip_ranges, overlays, compose_sources, status, stage, stage_timings, progress, attempts,
+					worker_id, error_message, created_at, started_at, completed_at)
+					VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+					$20, $21, $22, $23, $24, $25, $26, $27)
+					ON CONFLICT (job_id) DO UPDATE
+					SET output_s3_key = EXCLUDED.output_s3_key,
+					    status = EXCLUDED.status,
+					    stage = EXCLUDED.stage,
+					    stage_timings = EXCLUDED.stage_timings,
+					    progress = EXCLUDED.progress,
+					    attempts = EXCLUDED.attempts,
+					    worker_id = EXCLUDED.worker_id,
+					    error_message = EXCLUDED.error_message,
+					    started_at = EXCLUDED.started_at,
+					    completed_at = EXCLUDED.completed_at,
+					    updated_at = NOW()`
+	getJobByIDQuery = `SELECT ` + jobColumns + ` FROM encoding_jobs WHERE job_id = $1`
+
+	// Empty filters match everything
+	jobFilterClause = `WHERE user_id = $1
+					AND ($2 = '' OR status::text = $2)
+					AND ($3 = '' OR video_id::text = $3)
+					AND ($4::timestamptz IS NULL OR created_at >= $4)
+					AND ($5::timestamptz IS NULL OR created_at < $5)`
+	getTotalJobsQuery = `SELECT COUNT(job_id) FROM encoding_jobs ` + jobFilterClause
+	listJobsQuery     = `SELECT ` + jobColumns + ` FROM encoding_jobs ` + jobFilterClause + `
+					ORDER BY created_at DESC OFFSET $6 LIMIT $7`
+)
@@ -0,0 +1,19 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type UseCase interface {
+	GetJob(ctx context.Context, jobID string) (*models.EncodeJob, error)
+	ListJobs(ctx context.Context, filter *models.JobFilter, pagination *utils.Pagination) (*models.JobList, error)
+	// WatchJob returns the current state of the job and a stream of its later changes. The
+	// stream is closed when ctx is done.
+	WatchJob(ctx context.Context, jobID string) (*models.JobEvent, <-chan *models.JobEvent, error)
+}
@@ -0,0 +1,124 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/jobs"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+)
+
+type jobUC struct {
+	cfg       *config.Config
+	repo      jobs.Repository
+	redisRepo jobs.RedisRepository
+	logger    logger.Logger
+}
+
+func NewJobUseCase(cfg *config.Config, repo jobs.Repository, redisRepo jobs.RedisRepository, log logger.Logger) jobs.UseCase {
+	return &jobUC{
+		cfg:       cfg,
+		repo:      repo,
+		redisRepo: redisRepo,
+		logger:    log,
+	}
+}
+
+func (j *jobUC) GetJob(ctx context.Context, jobID string) (*models.EncodeJob, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		j.logger.Errorf("GetJob - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	job, err := j.repo.GetJobByID(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, jobs.ErrJobNotFound
+		}
+		j.logger.Errorf("GetJob - GetJobByID error: %v", err)
+		return nil, fmt.Errorf("failed to fetch job: %v", err)
+	}
+	if job.UserID != user.UserID.String() {
+		j.logger.Warnf("User %s is not authorized to access job %s", user.UserID, jobID)
+		return nil, jobs.ErrJobNotFound
+	}
+	job.OutputLocations = job.Outputs()
+	return job, nil
+}
+
+func (j *jobUC) ListJobs(ctx context.Context, filter *models.JobFilter, pagination *utils.Pagination) (*models.JobList, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		j.logger.Errorf("ListJobs - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	if err = utils.ValidateStruct(ctx, filter); err != nil {
+		return nil, fmt.Errorf("invalid filter: %v", err)
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, fmt.Errorf("invalid filter: from must be before to")
+	}
+	if pagination.Page < 1 {
+		pagination.Page = 1
+	}
+	if pagination.Size < 1 || pagination.Size > 100 {
+		pagination.Size = 10
+	}
+	jobList, err := j.repo.ListJobs(ctx, user.UserID, filter, pagination)
+	if err != nil {
+		j.logger.Errorf("ListJobs - ListJobs error: %v", err)
+		return nil, fmt.Errorf("failed to list jobs: %v", err)
+	}
+	for _, job := range jobList.Jobs {
+		job.OutputLocations = job.Outputs()
+	}
+	return jobList, nil
+}
+
+func (j *jobUC) WatchJob(ctx context.Context, jobID string) (*models.JobEvent, <-chan *models.JobEvent, error) {
+	if err := j.authorize(ctx, jobID); err != nil {
+		return nil, nil, err
+	}
+
+	events, err := j.redisRepo.SubscribeJobEvents(ctx, jobID)
+	if err != nil {
+		j.logger.Errorf("WatchJob - SubscribeJobEvents error: %v", err)
+		return nil, nil, fmt.Errorf("failed to follow job: %v", err)
+	}
+
+	// Read the state again now that we're subscribed, so no change can slip in between
+	job, err := j.redisRepo.GetJob(ctx, jobID)
+	if err != nil {
+		j.logger.Errorf("WatchJob - GetJob error: %v", err)
+		return nil, nil, fmt.Errorf("failed to fetch job: %v", err)
+	}
+	current := models.NewJobEvent(job)
+	return &current, events, nil
+}
+
+// authorize checks that the job exists and belongs to the user in the context.
+func (j *jobUC) authorize(ctx context.Context, jobID string) error {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		j.logger.Errorf("GetUserFromCtx: %v", err)
+		return err
+	}
+	job, err := j.redisRepo.GetJob(ctx, jobID)
+	if err != nil {
+		if err == jobs.ErrJobNotFound {
+			return err
+		}
+		j.logger.Errorf("GetJob error: %v", err)
+		return fmt.Errorf("failed to fetch job: %v", err)
+	}
+	if job.UserID != user.UserID.String() {
+		j.logger.Warnf("User %s is not authorized to access job %s", user.UserID, jobID)
+		return jobs.ErrJobNotFound
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package live
+
+import "github.com/labstack/echo/v4"
+
+type Handler interface {
+	CreateStreamKey() echo.HandlerFunc
+	ListStreamKeys() echo.HandlerFunc
+	RevokeStreamKey() echo.HandlerFunc
+	ListSessions() echo.HandlerFunc
+	GetSession() echo.HandlerFunc
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/live"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type liveHandler struct {
+	liveUC live.UseCase
+}
+
+func NewLiveHandler(liveUC live.UseCase) live.Handler {
+	return &liveHandler{
+		liveUC: liveUC,
+	}
+}
+
+func (h *liveHandler) CreateStreamKey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		input := &models.StreamKeyInput{}
+		if err := c.Bind(input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		}
+		key, err := h.liveUC.CreateStreamKey(c.Request().Context(), input)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusCreated, key)
+	}
+}
+
+func (h *liveHandler) ListStreamKeys() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		keys, err := h.liveUC.ListStreamKeys(c.Request().Context())
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, keys)
+	}
+}
+
+func (h *liveHandler) RevokeStreamKey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		keyID, err := uuid.Parse(c.Param("stream_key_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid stream key id"})
+		}
+		if err = h.liveUC.RevokeStreamKey(c.Request().Context(), keyID); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "Stream key revoked successfully"})
+	}
+}
+
+func (h *liveHandler) ListSessions() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		pagination, err := utils.GetPaginationFromCtx(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		sessions, err := h.liveUC.ListSessions(c.Request().Context(), pagination)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, sessions)
+	}
+}
+
+func (h *liveHandler) GetSession() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sessionID, err := uuid.Parse(c.Param("session_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid session id"})
+		}
+		session, err := h.liveUC.GetSession(c.Request().Context(), sessionID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, session)
+	}
+}
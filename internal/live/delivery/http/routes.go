@@ -0,0 +1,16 @@
+package http
+
+import (
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/live"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+func MapLiveRoutes(liveGroup *echo.Group, h live.Handler, mw *middleware.MiddlewareManager) {
+	liveGroup.Use(mw.AuthSessionMiddleware)
+	liveGroup.POST("/keys", h.CreateStreamKey())
+	liveGroup.GET("/keys", h.ListStreamKeys())
+	liveGroup.DELETE("/keys/:stream_key_id", h.RevokeStreamKey())
+	liveGroup.GET("/sessions", h.ListSessions())
+	liveGroup.GET("/sessions/:session_id", h.GetSession())
+}
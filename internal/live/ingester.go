@@ -0,0 +1,9 @@
+package live
+
+import "context"
+
+// Ingester accepts RTMP publishers and transcodes their streams into live HLS.
+type Ingester interface {
+	// Run listens for publishers until ctx is done, then waits for running sessions to end.
+	Run(ctx context.Context) error
+}
@@ -0,0 +1,33 @@
+package live
+
+import (
+	"context"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	CreateStreamKey(ctx context.Context, key *models.StreamKey) (*models.StreamKey, error)
+	ListStreamKeys(ctx context.Context, userID uuid.UUID) ([]*models.StreamKey, error)
+	RevokeStreamKey(ctx context.Context, userID, streamKeyID uuid.UUID) error
+	// GetStreamKeyByHash returns the unrevoked key with the given hash.
+	GetStreamKeyByHash(ctx context.Context, keyHash string) (*models.StreamKey, error)
+
+	// FailStaleSessions fails the live sessions of a stream key whose heartbeat is older than
+	// staleAfter and returns them.
+	FailStaleSessions(ctx context.Context, streamKeyID uuid.UUID, staleAfter time.Duration) ([]*models.LiveSession, error)
+	// CreateSession starts a live session of a stream key. If the key is still live elsewhere
+	// ErrStreamKeyInUse is returned.
+	CreateSession(ctx context.Context, session *models.LiveSession) (*models.LiveSession, error)
+	// TouchSession records a heartbeat of a live session. It returns ErrSessionNotLive for a
+	// session that isn't live anymore.
+	TouchSession(ctx context.Context, sessionID uuid.UUID) error
+	// EndSession records how a live session ended. It returns ErrSessionNotLive for a session
+	// that isn't live anymore.
+	EndSession(ctx context.Context, session *models.LiveSession) error
+	GetSessionByID(ctx context.Context, sessionID uuid.UUID) (*models.LiveSession, error)
+	ListSessions(ctx context.Context, userID uuid.UUID, pq *utils.Pagination) (*models.LiveSessionList, error)
+}
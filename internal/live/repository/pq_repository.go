@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/live"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type liveRepo struct {
+	db *sqlx.DB
+}
+
+func NewLiveRepo(db *sqlx.DB) live.Repository {
+	return &liveRepo{
+		db: db,
+	}
+}
+
+func (r *liveRepo) CreateStreamKey(ctx context.Context, key *models.StreamKey) (*models.StreamKey, error) {
+	created := &models.StreamKey{}
+	if err := r.db.QueryRowxContext(ctx, createStreamKeyQuery, key.UserID, key.Name, key.KeyHash).StructScan(created); err != nil {
+		return nil, fmt.Errorf("failed to create stream key: %w", err)
+	}
+	return created, nil
+}
+
+func (r *liveRepo) ListStreamKeys(ctx context.Context, userID uuid.UUID) ([]*models.StreamKey, error) {
+	keys := make([]*models.StreamKey, 0)
+	if err := r.db.SelectContext(ctx, &keys, listStreamKeysQuery, userID); err != nil {
+		return nil, fmt.Errorf("failed to list stream keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (r *liveRepo) RevokeStreamKey(ctx context.Context, userID, streamKeyID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, revokeStreamKeyQuery, streamKeyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke stream key: %w", err)
+	}
+	count, _ := res.RowsAffected()
+	if count == 0 {
+		return fmt.Errorf("no stream key found to revoke")
+	}
+	return nil
+}
+
+func (r *liveRepo) GetStreamKeyByHash(ctx context.Context, keyHash string) (*models.StreamKey, error) {
+	key := &models.StreamKey{}
+	if err := r.db.GetContext(ctx, key, getStreamKeyByHashQuery, keyHash); err != nil {
+		return nil, fmt.Errorf("failed to get stream key: %w", err)
+	}
+	return key, nil
+}
+
+func (r *liveRepo) FailStaleSessions(ctx context.Context, streamKeyID uuid.UUID, staleAfter time.Duration) ([]*models.LiveSession, error) {
+	sessions := make([]*models.LiveSession, 0)
+	if err := r.db.SelectContext(ctx, &sessions, failStaleSessionsQuery, streamKeyID, staleAfter.Seconds()); err != nil {
+		return nil, fmt.Errorf("failed to end stale live sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (r *liveRepo) CreateSession(ctx context.Context, session *models.LiveSession) (*models.LiveSession, error) {
+	created := &models.LiveSession{}
+	err := r.db.GetContext(
+		ctx,
+		created,
+		createSessionQuery,
+		session.SessionID,
+		session.StreamKeyID,
+		session.UserID,
+		session.VideoID,
+		session.OutputBucket,
+		session.OutputKey,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, live.ErrStreamKeyInUse
+		}
+		return nil, fmt.Errorf("failed to create live session: %w", err)
+	}
+	return created, nil
+}
+
+func (r *liveRepo) TouchSession(ctx context.Context, sessionID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, touchSessionQuery, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to touch live session: %w", err)
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return live.ErrSessionNotLive
+	}
+	return nil
+}
+
+func (r *liveRepo) EndSession(ctx context.Context, session *models.LiveSession) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		endSessionQuery,
+		session.SessionID,
+		session.Status,
+		session.JobID,
+		session.ErrorMessage,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to end live session: %w", err)
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return live.ErrSessionNotLive
+	}
+	return nil
+}
+
+func (r *liveRepo) GetSessionByID(ctx context.Context, sessionID uuid.UUID) (*models.LiveSession, error) {
+	session := &models.LiveSession{}
+	if err := r.db.GetContext(ctx, session, getSessionByIDQuery, sessionID); err != nil {
+		return nil, fmt.Errorf("failed to get live session by id: %w", err)
+	}
+	return session, nil
+}
+
+func (r *liveRepo) ListSessions(ctx context.Context, userID uuid.UUID, pq *utils.Pagination) (*models.LiveSessionList, error) {
+	var totalCount int
+	if err := r.db.GetContext(ctx, &totalCount, getTotalSessionsQuery, userID); err != nil {
+		return nil, fmt.Errorf("failed to get total live sessions: %w", err)
+	}
+	sessions := make([]*models.LiveSession, 0, pq.GetSize())
+	if totalCount > 0 {
+		if err := r.db.SelectContext(
+			ctx,
+			&sessions,
+			listSessionsQuery,
+			userID,
+			pq.GetOffset(),
+			pq.GetLimit(),
+		); err != nil {
+			return nil, fmt.Errorf("failed to list live sessions: %w", err)
+		}
+	}
+	return &models.LiveSessionList{
+		Sessions:   sessions,
+		TotalCount: totalCount,
+		Page:       pq.GetPage(),
+		PageSize:   pq.GetSize(),
+		HasMore:    utils.GetHasMore(pq.GetPage(), totalCount, pq.GetSize()),
+	}, nil
+}
@@ -0,0 +1,37 @@
+package repository
+
+const (
+	streamKeyColumns = `stream_key_id, user_id, name, key_hash, created_at, last_used_at, revoked_at`
+
+	createStreamKeyQuery = `INSERT INTO stream_keys (user_id, name, key_hash)
+					VALUES ($1, $2, $3)
+					RETURNING ` + streamKeyColumns
+	listStreamKeysQuery = `SELECT ` + streamKeyColumns + ` FROM stream_keys
+					WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at`
+	revokeStreamKeyQuery = `UPDATE stream_keys SET revoked_at = NOW()
+					WHERE stream_key_id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	getStreamKeyByHashQuery = `UPDATE stream_keys SET last_used_at = NOW()
+					WHERE key_hash = $1 AND revoked_at IS NULL
+					RETURNING ` + streamKeyColumns
+
+	sessionColumns = `session_id, stream_key_id, user_id, COALESCE(video_id::text, '') AS video_id, COALESCE(job_id::text, '') AS job_id, status,
+					output_bucket, output_key, error_message, started_at, updated_at, ended_at`
+
+	failStaleSessionsQuery = `UPDATE live_sessions
+					SET status = 'failed', error_message = 'ingest stopped', ended_at = NOW()
+					WHERE stream_key_id = $1 AND status = 'live' AND updated_at < NOW() - $2 * INTERVAL '1 second'
+					RETURNING ` + sessionColumns
+	// Conflicts with the partial unique index when the key is live already
+	createSessionQuery = `INSERT INTO live_sessions (session_id, stream_key_id, user_id, video_id, output_bucket, output_key)
+					VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6)
+					ON CONFLICT DO NOTHING
+					RETURNING ` + sessionColumns
+	touchSessionQuery = `UPDATE live_sessions SET updated_at = NOW() WHERE session_id = $1 AND status = 'live'`
+	endSessionQuery   = `UPDATE live_sessions
+					SET status = $2, job_id = NULLIF($3, '')::uuid, error_message = $4, updated_at = NOW(), ended_at = NOW()
+					WHERE session_id = $1 AND status = 'live'`
+	getSessionByIDQuery   = `SELECT ` + sessionColumns + ` FROM live_sessions WHERE session_id = $1`
+	getTotalSessionsQuery = `SELECT COUNT(session_id) FROM live_sessions WHERE user_id = $1`
+	listSessionsQuery     = `SELECT ` + sessionColumns + ` FROM live_sessions
+					WHERE user_id = $1 ORDER BY started_at DESC OFFSET $2 LIMIT $3`
+)
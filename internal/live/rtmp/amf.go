@@ -0,0 +1,207 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// AMF0 type markers
+const (
+	amfNumber      = 0x00
+	amfBoolean     = 0x01
+	amfString      = 0x02
+	amfObject      = 0x03
+	amfNull        = 0x05
+	amfUndefined   = 0x06
+	amfECMAArray   = 0x08
+	amfObjectEnd   = 0x09
+	amfStrictArray = 0x0a
+	amfDate        = 0x0b
+	amfLongString  = 0x0c
+)
+
+// maxAMFDepth limits how deeply objects and arrays nest. Commands only nest a level or two;
+// decoding is recursive, so unbounded nesting would let a client exhaust the stack.
+const maxAMFDepth = 32
+
+var (
+	errAMFShort = errors.New("amf: truncated value")
+	errAMFDepth = errors.New("amf: values nested too deeply")
+)
+
+// decodeAMF reads the AMF0 values of a command or data message. Numbers come back as float64,
+// objects and ECMA arrays as map[string]interface{}, null and undefined as nil.
+func decodeAMF(data []byte) ([]interface{}, error) {
+	var values []interface{}
+	for len(data) > 0 {
+		value, n, err := decodeAMFValue(data, 0)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+		data = data[n:]
+	}
+	return values, nil
+}
+
+func decodeAMFValue(data []byte, depth int) (interface{}, int, error) {
+	if len(data) == 0 {
+		return nil, 0, errAMFShort
+	}
+	if depth > maxAMFDepth {
+		return nil, 0, errAMFDepth
+	}
+	switch data[0] {
+	case amfNumber:
+		if len(data) < 9 {
+			return nil, 0, errAMFShort
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data[1:9])), 9, nil
+	case amfBoolean:
+		if len(data) < 2 {
+			return nil, 0, errAMFShort
+		}
+		return data[1] != 0, 2, nil
+	case amfString:
+		s, n, err := decodeAMFString(data[1:], 2)
+		return s, n + 1, err
+	case amfLongString:
+		s, n, err := decodeAMFString(data[1:], 4)
+		return s, n + 1, err
+	case amfNull, amfUndefined:
+		return nil, 1, nil
+	case amfObject:
+		object, n, err := decodeAMFProperties(data[1:], depth+1)
+		return object, n + 1, err
+	case amfECMAArray:
+		// The count is only a hint, the properties end with an object end marker
+		if len(data) < 5 {
+			return nil, 0, errAMFShort
+		}
+		object, n, err := decodeAMFProperties(data[5:], depth+1)
+		return object, n + 5, err
+	case amfStrictArray:
+		if len(data) < 5 {
+			return nil, 0, errAMFShort
+		}
+		count := binary.BigEndian.Uint32(data[1:5])
+		offset := 5
+		var array []interface{}
+		for i := uint32(0); i < count; i++ {
+			value, n, err := decodeAMFValue(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			array = append(array, value)
+			offset += n
+		}
+		return array, offset, nil
+	case amfDate:
+		if len(data) < 11 {
+			return nil, 0, errAMFShort
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data[1:9])), 11, nil
+	}
+	return nil, 0, fmt.Errorf("amf: unsupported type 0x%02x", data[0])
+}
+
+func decodeAMFString(data []byte, lengthSize int) (string, int, error) {
+	if len(data) < lengthSize {
+		return "", 0, errAMFShort
+	}
+	var length int
+	if lengthSize == 2 {
+		length = int(binary.BigEndian.Uint16(data))
+	} else {
+		length = int(binary.BigEndian.Uint32(data))
+	}
+	if len(data) < lengthSize+length {
+		return "", 0, errAMFShort
+	}
+	return string(data[lengthSize : lengthSize+length]), lengthSize + length, nil
+}
+
+func decodeAMFProperties(data []byte, depth int) (map[string]interface{}, int, error) {
+	object := make(map[string]interface{})
+	offset := 0
+	for {
+		key, n, err := decodeAMFString(data[offset:], 2)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		if key == "" {
+			if offset >= len(data) || data[offset] != amfObjectEnd {
+				return nil, 0, errors.New("amf: missing object end")
+			}
+			return object, offset + 1, nil
+		}
+		value, n, err := decodeAMFValue(data[offset:], depth)
+		if err != nil {
+			return nil, 0, err
+		}
+		object[key] = value
+		offset += n
+	}
+}
+
+// encodeAMF writes values as AMF0. It takes what decodeAMF returns; maps become objects.
+func encodeAMF(values ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, value := range values {
+		encodeAMFValue(&buf, value)
+	}
+	return buf.Bytes()
+}
+
+func encodeAMFValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case float64:
+		buf.WriteByte(amfNumber)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case int:
+		encodeAMFValue(buf, float64(v))
+	case bool:
+		buf.WriteByte(amfBoolean)
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case string:
+		if len(v) > math.MaxUint16 {
+			buf.WriteByte(amfLongString)
+			binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		} else {
+			buf.WriteByte(amfString)
+			binary.Write(buf, binary.BigEndian, uint16(len(v)))
+		}
+		buf.WriteString(v)
+	case map[string]interface{}:
+		buf.WriteByte(amfObject)
+		// Sorted so that the encoding is stable
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			binary.Write(buf, binary.BigEndian, uint16(len(key)))
+			buf.WriteString(key)
+			encodeAMFValue(buf, v[key])
+		}
+		buf.Write([]byte{0, 0, amfObjectEnd})
+	case []interface{}:
+		buf.WriteByte(amfStrictArray)
+		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		for _, item := range v {
+			encodeAMFValue(buf, item)
+		}
+	default:
+		buf.WriteByte(amfNull)
+	}
+}
@@ -0,0 +1,90 @@
+package rtmp
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeAMFRoundTrip(t *testing.T) {
+	values := []interface{}{
+		"connect",
+		1.0,
+		map[string]interface{}{
+			"app":   "live",
+			"flags": []interface{}{true, nil, 2.5},
+			"inner": map[string]interface{}{"level": 2.0},
+		},
+		nil,
+	}
+	decoded, err := decodeAMF(encodeAMF(values...))
+	if err != nil {
+		t.Fatalf("decodeAMF: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, values) {
+		t.Fatalf("decoded %#v, want %#v", decoded, values)
+	}
+}
+
+func TestDecodeAMFMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated number", []byte{amfNumber, 0, 0}},
+		{"truncated string", []byte{amfString, 0, 10, 'a'}},
+		{"truncated long string", []byte{amfLongString, 0xff, 0xff, 0xff, 0xff}},
+		{"object without end", []byte{amfObject, 0, 1, 'a', amfNull}},
+		{"empty key without end marker", []byte{amfObject, 0, 0, amfNull}},
+		{"array longer than data", []byte{amfStrictArray, 0xff, 0xff, 0xff, 0xff, amfNull}},
+		{"unsupported type", []byte{0x10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeAMF(tt.data); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestDecodeAMFDepth(t *testing.T) {
+	nested := func(depth int, open []byte) []byte {
+		var buf bytes.Buffer
+		for i := 0; i < depth; i++ {
+			buf.Write(open)
+		}
+		buf.WriteByte(amfNull)
+		return buf.Bytes()
+	}
+	// Each level is a strict array of one value
+	array := []byte{amfStrictArray, 0, 0, 0, 1}
+	// Each level is an object with the property "a"
+	object := []byte{amfObject, 0, 1, 'a'}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		depth error
+	}{
+		{"arrays at the limit", nested(maxAMFDepth, array), nil},
+		{"arrays past the limit", nested(maxAMFDepth+1, array), errAMFDepth},
+		{"deep objects", nested(1<<20, object), errAMFDepth},
+		{"deep arrays", nested(1<<20, array), errAMFDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeAMF(tt.data)
+			if tt.depth == nil {
+				if err != nil {
+					t.Fatalf("decodeAMF: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.depth) {
+				t.Fatalf("got error %v, want %v", err, tt.depth)
+			}
+		})
+	}
+}
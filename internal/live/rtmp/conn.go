@@ -0,0 +1,516 @@
+// Package rtmp implements the server side of RTMP publishing: the handshake, the chunk stream
+// and the commands an encoder sends to publish one stream.
+package rtmp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Message types
+const (
+	msgSetChunkSize     = 1
+	msgAbort            = 2
+	msgAck              = 3
+	msgUserControl      = 4
+	msgWindowAckSize    = 5
+	msgSetPeerBandwidth = 6
+	MsgAudio            = 8
+	MsgVideo            = 9
+	msgCommandAMF3      = 17
+	MsgData             = 18
+	msgCommandAMF0      = 20
+)
+
+const (
+	handshakeSize    = 1536
+	defaultChunkSize = 128
+	// Chunk size of what the server sends and the largest one it accepts
+	outChunkSize = 4096
+	maxChunkSize = 1 << 24
+	// Bytes the peer may send before it expects an acknowledgement
+	windowAckSize   = 2500000
+	publishStreamID = 1
+
+	// Limits on what a client may make the server buffer. Commands are small, media messages
+	// are at most one frame.
+	maxChunkStreams = 16
+	maxCommandSize  = 64 << 10
+	maxMediaSize    = 8 << 20
+
+	controlChunkStream = 2
+	commandChunkStream = 3
+	statusChunkStream  = 5
+)
+
+// Message is an audio, video or data message of the published stream. Timestamp is in
+// milliseconds.
+type Message struct {
+	Type      uint8
+	Timestamp uint32
+	Payload   []byte
+}
+
+type chunkStream struct {
+	timestamp uint32
+	delta     uint32
+	length    uint32
+	typeID    uint8
+	streamID  uint32
+	extended  bool
+	payload   []byte
+}
+
+type rawMessage struct {
+	typeID    uint8
+	streamID  uint32
+	timestamp uint32
+	payload   []byte
+}
+
+// Conn is a connection of a publishing client.
+type Conn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	timeout time.Duration
+
+	inChunkSize uint32
+	streams     map[uint32]*chunkStream
+	received    uint64
+	acked       uint64
+	ackWindow   uint32
+
+	// App and StreamName are what the client connected to and publishes, set by WaitPublish.
+	// The stream name is the stream key; a query string after it is dropped.
+	App        string
+	StreamName string
+}
+
+// NewConn wraps a client connection. Reads fail once the client sent nothing for timeout.
+func NewConn(conn net.Conn, timeout time.Duration) *Conn {
+	c := &Conn{
+		conn:        conn,
+		w:           bufio.NewWriter(conn),
+		timeout:     timeout,
+		inChunkSize: defaultChunkSize,
+		streams:     make(map[uint32]*chunkStream),
+	}
+	c.r = bufio.NewReader(&countingReader{conn: c})
+	return c
+}
+
+type countingReader struct {
+	conn *Conn
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	if r.conn.timeout > 0 {
+		r.conn.conn.SetReadDeadline(time.Now().Add(r.conn.timeout))
+	}
+	n, err := r.conn.conn.Read(p)
+	r.conn.received += uint64(n)
+	return n, err
+}
+
+// Handshake runs the plain RTMP handshake. Clients that offer the digest handshake fall back
+// to it because S1 carries a zero version.
+func (c *Conn) Handshake() error {
+	c0c1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(c.r, c0c1); err != nil {
+		return fmt.Errorf("failed to read C0/C1: %w", err)
+	}
+	if c0c1[0] != 3 {
+		return fmt.Errorf("unsupported RTMP version %d", c0c1[0])
+	}
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	s0s1s2[0] = 3
+	if _, err := rand.Read(s0s1s2[9 : 1+handshakeSize]); err != nil {
+		return fmt.Errorf("failed to generate S1: %w", err)
+	}
+	// S2 echoes C1
+	copy(s0s1s2[1+handshakeSize:], c0c1[1:])
+	if _, err := c.w.Write(s0s1s2); err != nil {
+		return fmt.Errorf("failed to write S0/S1/S2: %w", err)
+	}
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write S0/S1/S2: %w", err)
+	}
+	if _, err := io.ReadFull(c.r, make([]byte, handshakeSize)); err != nil {
+		return fmt.Errorf("failed to read C2: %w", err)
+	}
+	return nil
+}
+
+// WaitPublish answers the client's commands until it asks to publish a stream. The publish is
+// left unanswered for AcceptPublish or RejectPublish.
+func (c *Conn) WaitPublish() error {
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		if msg.typeID != msgCommandAMF0 && msg.typeID != msgCommandAMF3 {
+			if err = c.handleControl(msg); err != nil {
+				return err
+			}
+			continue
+		}
+		name, txn, values, err := decodeCommand(msg)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "connect":
+			if len(values) > 0 {
+				if object, ok := values[0].(map[string]interface{}); ok {
+					c.App, _ = object["app"].(string)
+				}
+			}
+			if err = c.sendConnectResult(txn); err != nil {
+				return err
+			}
+		case "releaseStream", "FCPublish":
+			if err = c.sendCommand(commandChunkStream, 0, "_result", txn, nil); err != nil {
+				return err
+			}
+		case "createStream":
+			if err = c.sendCommand(commandChunkStream, 0, "_result", txn, nil, float64(publishStreamID)); err != nil {
+				return err
+			}
+		case "publish":
+			if len(values) < 2 {
+				return errors.New("publish without a stream name")
+			}
+			streamName, _ := values[1].(string)
+			streamName, _, _ = strings.Cut(streamName, "?")
+			if streamName == "" {
+				return errors.New("publish without a stream name")
+			}
+			c.StreamName = streamName
+			return nil
+		case "deleteStream", "FCUnpublish", "closeStream":
+			return io.EOF
+		}
+	}
+}
+
+// AcceptPublish tells the client it may start sending the stream.
+func (c *Conn) AcceptPublish() error {
+	// Stream Begin
+	event := make([]byte, 6)
+	binary.BigEndian.PutUint32(event[2:], publishStreamID)
+	if err := c.writeMessage(controlChunkStream, msgUserControl, 0, event); err != nil {
+		return err
+	}
+	return c.sendStatus("status", "NetStream.Publish.Start", "Publishing "+c.StreamName)
+}
+
+// RejectPublish refuses the publish with a reason for the client.
+func (c *Conn) RejectPublish(description string) error {
+	return c.sendStatus("error", "NetStream.Publish.BadName", description)
+}
+
+// ReadMessage returns the next audio, video or data message of the published stream. It
+// returns io.EOF once the client unpublishes or hangs up.
+func (c *Conn) ReadMessage() (*Message, error) {
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		switch msg.typeID {
+		case MsgAudio, MsgVideo:
+			return &Message{Type: msg.typeID, Timestamp: msg.timestamp, Payload: msg.payload}, nil
+		case MsgData:
+			// Encoders wrap their metadata as @setDataFrame(onMetaData, ...), FLV keeps
+			// onMetaData(...)
+			payload := msg.payload
+			if name, n, err := decodeAMFValue(payload, 0); err == nil && name == "@setDataFrame" {
+				payload = payload[n:]
+			}
+			return &Message{Type: MsgData, Timestamp: msg.timestamp, Payload: payload}, nil
+		case msgCommandAMF0, msgCommandAMF3:
+			name, _, _, err := decodeCommand(msg)
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "deleteStream", "FCUnpublish", "closeStream":
+				return nil, io.EOF
+			}
+		default:
+			if err = c.handleControl(msg); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// readMessage reassembles the next complete message from the chunk stream.
+func (c *Conn) readMessage() (*rawMessage, error) {
+	for {
+		first, err := c.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		format := first >> 6
+		csid := uint32(first & 0x3f)
+		switch csid {
+		case 0:
+			b, err := c.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			csid = 64 + uint32(b)
+		case 1:
+			var b [2]byte
+			if _, err = io.ReadFull(c.r, b[:]); err != nil {
+				return nil, err
+			}
+			csid = 64 + uint32(b[0]) + uint32(b[1])<<8
+		}
+
+		cs := c.streams[csid]
+		if cs == nil {
+			if format != 0 {
+				return nil, fmt.Errorf("chunk stream %d starts without a full header", csid)
+			}
+			if len(c.streams) >= maxChunkStreams {
+				return nil, fmt.Errorf("too many chunk streams")
+			}
+			cs = &chunkStream{}
+			c.streams[csid] = cs
+		}
+
+		if format < 3 {
+			header := make([]byte, [3]int{11, 7, 3}[format])
+			if _, err = io.ReadFull(c.r, header); err != nil {
+				return nil, err
+			}
+			ts := uint24(header[0:3])
+			if format <= 1 {
+				cs.length = uint24(header[3:6])
+				cs.typeID = header[6]
+				if cs.length > maxMessageSize(cs.typeID) {
+					return nil, fmt.Errorf("message of type %d is too large: %d bytes", cs.typeID, cs.length)
+				}
+			}
+			if format == 0 {
+				cs.streamID = binary.LittleEndian.Uint32(header[7:11])
+			}
+			cs.extended = ts == 0xffffff
+			if cs.extended {
+				if ts, err = c.readUint32(); err != nil {
+					return nil, err
+				}
+			}
+			// A type 3 chunk that starts a message repeats this field as its delta
+			cs.delta = ts
+			if format == 0 {
+				cs.timestamp = ts
+			} else {
+				cs.timestamp += ts
+			}
+			cs.payload = cs.payload[:0]
+		} else {
+			if cs.extended {
+				if _, err = c.readUint32(); err != nil {
+					return nil, err
+				}
+			}
+			if len(cs.payload) == 0 {
+				cs.timestamp += cs.delta
+			}
+		}
+
+		n := cs.length - uint32(len(cs.payload))
+		if n > c.inChunkSize {
+			n = c.inChunkSize
+		}
+		start := len(cs.payload)
+		cs.payload = append(cs.payload, make([]byte, n)...)
+		if _, err = io.ReadFull(c.r, cs.payload[start:]); err != nil {
+			return nil, err
+		}
+		if err = c.acknowledge(); err != nil {
+			return nil, err
+		}
+		if uint32(len(cs.payload)) < cs.length {
+			continue
+		}
+
+		msg := &rawMessage{
+			typeID:    cs.typeID,
+			streamID:  cs.streamID,
+			timestamp: cs.timestamp,
+			payload:   cs.payload,
+		}
+		cs.payload = nil
+		return msg, nil
+	}
+}
+
+// maxMessageSize is the largest message of a type the server reassembles.
+func maxMessageSize(typeID uint8) uint32 {
+	if typeID == MsgAudio || typeID == MsgVideo {
+		return maxMediaSize
+	}
+	return maxCommandSize
+}
+
+func (c *Conn) handleControl(msg *rawMessage) error {
+	switch msg.typeID {
+	case msgSetChunkSize:
+		if len(msg.payload) < 4 {
+			return errors.New("short set chunk size message")
+		}
+		size := binary.BigEndian.Uint32(msg.payload) & 0x7fffffff
+		if size == 0 || size > maxChunkSize {
+			return fmt.Errorf("invalid chunk size %d", size)
+		}
+		c.inChunkSize = size
+	case msgAbort:
+		if len(msg.payload) >= 4 {
+			if cs := c.streams[binary.BigEndian.Uint32(msg.payload)]; cs != nil {
+				cs.payload = nil
+			}
+		}
+	case msgWindowAckSize:
+		if len(msg.payload) >= 4 {
+			c.ackWindow = binary.BigEndian.Uint32(msg.payload)
+		}
+	}
+	// Acknowledgements, user control and anything else the server has no use for
+	return nil
+}
+
+// acknowledge tells the client how much was received once it sent a window's worth.
+func (c *Conn) acknowledge() error {
+	window := uint64(c.ackWindow)
+	if window == 0 {
+		window = windowAckSize
+	}
+	if c.received-c.acked < window {
+		return nil
+	}
+	c.acked = c.received
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(c.received))
+	return c.writeMessage(controlChunkStream, msgAck, 0, payload)
+}
+
+func (c *Conn) sendConnectResult(txn float64) error {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, windowAckSize)
+	if err := c.writeMessage(controlChunkStream, msgWindowAckSize, 0, payload); err != nil {
+		return err
+	}
+	// Dynamic limit type
+	if err := c.writeMessage(controlChunkStream, msgSetPeerBandwidth, 0, append(payload, 2)); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(payload, outChunkSize)
+	if err := c.writeMessage(controlChunkStream, msgSetChunkSize, 0, payload); err != nil {
+		return err
+	}
+	return c.sendCommand(commandChunkStream, 0, "_result", txn,
+		map[string]interface{}{
+			"fmsVer":       "FMS/3,0,1,123",
+			"capabilities": float64(31),
+		},
+		map[string]interface{}{
+			"level":          "status",
+			"code":           "NetConnection.Connect.Success",
+			"description":    "Connection succeeded.",
+			"objectEncoding": float64(0),
+		},
+	)
+}
+
+func (c *Conn) sendStatus(level, code, description string) error {
+	return c.sendCommand(statusChunkStream, publishStreamID, "onStatus", 0, nil, map[string]interface{}{
+		"level":       level,
+		"code":        code,
+		"description": description,
+	})
+}
+
+func (c *Conn) sendCommand(csid, streamID uint32, name string, txn float64, args ...interface{}) error {
+	values := append([]interface{}{name, txn}, args...)
+	return c.writeMessage(csid, msgCommandAMF0, streamID, encodeAMF(values...))
+}
+
+// writeMessage sends a message with timestamp 0, split into chunks of outChunkSize.
+func (c *Conn) writeMessage(csid uint32, typeID uint8, streamID uint32, payload []byte) error {
+	header := make([]byte, 12)
+	header[0] = byte(csid)
+	putUint24(header[4:7], uint32(len(payload)))
+	header[7] = typeID
+	binary.LittleEndian.PutUint32(header[8:12], streamID)
+	if _, err := c.w.Write(header); err != nil {
+		return err
+	}
+	for offset := 0; ; {
+		end := min(offset+outChunkSize, len(payload))
+		if _, err := c.w.Write(payload[offset:end]); err != nil {
+			return err
+		}
+		if offset = end; offset >= len(payload) {
+			break
+		}
+		if err := c.w.WriteByte(3<<6 | byte(csid)); err != nil {
+			return err
+		}
+	}
+	return c.w.Flush()
+}
+
+func (c *Conn) readUint32() (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(c.r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+func decodeCommand(msg *rawMessage) (string, float64, []interface{}, error) {
+	payload := msg.payload
+	// AMF3 commands carry AMF0 values after a format byte
+	if msg.typeID == msgCommandAMF3 && len(payload) > 0 && payload[0] == 0 {
+		payload = payload[1:]
+	}
+	values, err := decodeAMF(payload)
+	if len(values) < 2 {
+		if err == nil {
+			err = errors.New("command without a name and transaction")
+		}
+		return "", 0, nil, fmt.Errorf("invalid command: %w", err)
+	}
+	name, _ := values[0].(string)
+	txn, _ := values[1].(float64)
+	// The command object (null for most commands) and the arguments follow
+	return name, txn, values[2:], nil
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+}
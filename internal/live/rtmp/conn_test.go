@@ -0,0 +1,122 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chunk writes a chunk with a full (type 0) header, or a type 3 continuation header when
+// typeID is 0.
+func chunk(buf *bytes.Buffer, csid uint32, typeID uint8, timestamp uint32, length int, data []byte) {
+	if typeID == 0 {
+		buf.WriteByte(0xc0 | byte(csid))
+		buf.Write(data)
+		return
+	}
+	buf.WriteByte(byte(csid))
+	header := make([]byte, 11)
+	putUint24(header[0:3], timestamp)
+	putUint24(header[3:6], uint32(length))
+	header[6] = typeID
+	binary.LittleEndian.PutUint32(header[7:11], publishStreamID)
+	buf.Write(header)
+	buf.Write(data)
+}
+
+// readFrom returns a connection reading data, then EOF.
+func readFrom(t *testing.T, data []byte) *Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	go func() {
+		client.Write(data)
+		client.Close()
+	}()
+	t.Cleanup(func() { server.Close() })
+	return NewConn(server, time.Second)
+}
+
+func TestReadMessageReassemblesChunks(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xab}, 300)
+	var buf bytes.Buffer
+	chunk(&buf, 4, MsgVideo, 1000, len(payload), payload[:defaultChunkSize])
+	chunk(&buf, 4, 0, 0, 0, payload[defaultChunkSize:2*defaultChunkSize])
+	chunk(&buf, 4, 0, 0, 0, payload[2*defaultChunkSize:])
+
+	msg, err := readFrom(t, buf.Bytes()).readMessage()
+	if err != nil {
+		t.Fatalf("readMessage: %v", err)
+	}
+	if msg.typeID != MsgVideo || msg.timestamp != 1000 || !bytes.Equal(msg.payload, payload) {
+		t.Fatalf("got type %d at %d with %d bytes", msg.typeID, msg.timestamp, len(msg.payload))
+	}
+}
+
+func TestReadMessageLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  func() []byte
+		error string
+	}{
+		{
+			name: "oversized command",
+			data: func() []byte {
+				var buf bytes.Buffer
+				chunk(&buf, 3, msgCommandAMF0, 0, maxCommandSize+1, nil)
+				return buf.Bytes()
+			},
+			error: "too large",
+		},
+		{
+			name: "oversized media",
+			data: func() []byte {
+				var buf bytes.Buffer
+				chunk(&buf, 4, MsgVideo, 0, maxMediaSize+1, nil)
+				return buf.Bytes()
+			},
+			error: "too large",
+		},
+		{
+			name: "too many chunk streams",
+			data: func() []byte {
+				var buf bytes.Buffer
+				// Every stream starts a message and leaves it incomplete
+				for csid := uint32(3); csid < 3+maxChunkStreams+1; csid++ {
+					chunk(&buf, csid, MsgVideo, 0, 1000, make([]byte, defaultChunkSize))
+				}
+				return buf.Bytes()
+			},
+			error: "too many chunk streams",
+		},
+		{
+			name: "continuation without a header",
+			data: func() []byte {
+				var buf bytes.Buffer
+				chunk(&buf, 5, 0, 0, 0, []byte{1, 2, 3})
+				return buf.Bytes()
+			},
+			error: "without a full header",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readFrom(t, tt.data()).readMessage()
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.error)
+			}
+		})
+	}
+}
+
+func TestReadMessageTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	chunk(&buf, 4, MsgAudio, 0, 100, make([]byte, 50))
+	_, err := readFrom(t, buf.Bytes()).readMessage()
+	if err != io.ErrUnexpectedEOF && err != io.EOF {
+		t.Fatalf("got error %v, want EOF", err)
+	}
+}
@@ -0,0 +1,34 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// FLVWriter writes the messages of a published stream as an FLV file, which is what RTMP
+// carries in its audio, video and data messages.
+type FLVWriter struct {
+	w io.Writer
+}
+
+func NewFLVWriter(w io.Writer) *FLVWriter {
+	return &FLVWriter{w: w}
+}
+
+// WriteHeader writes the file header announcing audio and video.
+func (f *FLVWriter) WriteHeader() error {
+	_, err := f.w.Write([]byte{'F', 'L', 'V', 1, 0x05, 0, 0, 0, 9, 0, 0, 0, 0})
+	return err
+}
+
+func (f *FLVWriter) WriteMessage(msg *Message) error {
+	tag := make([]byte, 11+len(msg.Payload)+4)
+	tag[0] = msg.Type
+	putUint24(tag[1:4], uint32(len(msg.Payload)))
+	putUint24(tag[4:7], msg.Timestamp&0xffffff)
+	tag[7] = byte(msg.Timestamp >> 24)
+	copy(tag[11:], msg.Payload)
+	binary.BigEndian.PutUint32(tag[11+len(msg.Payload):], uint32(11+len(msg.Payload)))
+	_, err := f.w.Write(tag)
+	return err
+}
@@ -0,0 +1,37 @@
+package live
+
+import (
+	"context"
+	"errors"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrStreamKeyInvalid = errors.New("invalid stream key")
+	ErrStreamKeyInUse   = errors.New("stream key is already live")
+	ErrSessionNotLive   = errors.New("live session is no longer live")
+)
+
+type UseCase interface {
+	// CreateStreamKey returns the new key in full, it can't be read back later.
+	CreateStreamKey(ctx context.Context, input *models.StreamKeyInput) (*models.StreamKey, error)
+	ListStreamKeys(ctx context.Context) ([]*models.StreamKey, error)
+	RevokeStreamKey(ctx context.Context, streamKeyID uuid.UUID) error
+	ListSessions(ctx context.Context, pagination *utils.Pagination) (*models.LiveSessionList, error)
+	// GetSession returns a session of the user, with a playback URL while it is live.
+	GetSession(ctx context.Context, sessionID uuid.UUID) (*models.LiveSession, error)
+
+	// StartSession authorizes a publish with streamKey and creates its session and the video
+	// it is recorded as. It runs on the ingest, outside of any user request.
+	StartSession(ctx context.Context, streamKey string) (*models.LiveSession, error)
+	// KeepAlive records that the ingest of a session is still running. It returns
+	// ErrSessionNotLive when the session was failed in the meantime, its ingest has to stop.
+	KeepAlive(ctx context.Context, session *models.LiveSession) error
+	// EndSession uploads the recording at recordingPath as the session's video and queues its
+	// encode job. A non-nil streamErr marks the session failed, the recording is kept anyway.
+	// With ErrSessionNotLive as streamErr only what the ingest still published is removed.
+	EndSession(ctx context.Context, session *models.LiveSession, recordingPath string, streamErr error) error
+}
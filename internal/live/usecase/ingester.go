@@ -0,0 +1,507 @@
+package usecase
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/live"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/live/rtmp"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+)
+
+const (
+	defaultListenAddr     = ":1935"
+	defaultMaxSessions    = 10
+	defaultSegmentSeconds = 4
+	defaultPlaylistSize   = 6
+
+	// A publisher that sends nothing for readTimeout is dropped, a client that hasn't asked to
+	// publish by handshakeTimeout too
+	readTimeout      = 30 * time.Second
+	handshakeTimeout = 10 * time.Second
+	syncInterval     = time.Second
+	// Ending a session uploads the whole recording
+	endTimeout = 30 * time.Minute
+
+	// Messages buffered to find out whether the stream carries audio before the transcoder
+	// starts
+	probeMessages = 300
+
+	recordingName    = "recording.flv"
+	liveAudioBitrate = "128k"
+)
+
+type ingester struct {
+	cfg      *config.Config
+	liveUC   live.UseCase
+	awsRepo  videofiles.AWSRepository
+	logger   logger.Logger
+	sessions chan struct{}
+	conns    chan struct{}
+}
+
+func NewIngester(cfg *config.Config, liveUC live.UseCase, awsRepo videofiles.AWSRepository, log logger.Logger) live.Ingester {
+	maxSessions := cfg.Live.MaxSessions
+	if maxSessions <= 0 {
+		maxSessions = defaultMaxSessions
+	}
+	maxConns := cfg.Live.MaxConnections
+	if maxConns <= 0 {
+		maxConns = 2 * maxSessions
+	}
+	return &ingester{
+		cfg:      cfg,
+		liveUC:   liveUC,
+		awsRepo:  awsRepo,
+		logger:   log,
+		sessions: make(chan struct{}, maxSessions),
+		conns:    make(chan struct{}, maxConns),
+	}
+}
+
+func (i *ingester) Run(ctx context.Context) error {
+	addr := i.cfg.Live.ListenAddr
+	if addr == "" {
+		addr = defaultListenAddr
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+	i.logger.Infof("RTMP ingest listening on %s", addr)
+
+	var wg sync.WaitGroup
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			i.logger.Warnf("Live - accept error: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		select {
+		case i.conns <- struct{}{}:
+		default:
+			i.logger.Warnf("Live - rejected connection from %s, too many connections", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-i.conns }()
+			i.serve(ctx, conn)
+		}()
+	}
+	// Closing the connections ends the sessions, their recordings are still queued
+	wg.Wait()
+	return nil
+}
+
+// serve runs one publisher connection from the handshake to the end of its session.
+func (i *ingester) serve(ctx context.Context, netConn net.Conn) {
+	defer netConn.Close()
+	stop := context.AfterFunc(ctx, func() { netConn.Close() })
+	defer stop()
+
+	remote := netConn.RemoteAddr().String()
+	conn := rtmp.NewConn(netConn, readTimeout)
+	// The read timeout restarts with every read, this bounds the whole way to the publish
+	handshake := time.AfterFunc(handshakeTimeout, func() { netConn.Close() })
+	if err := conn.Handshake(); err != nil {
+		handshake.Stop()
+		i.logger.Debugf("Live - handshake with %s failed: %v", remote, err)
+		return
+	}
+	if err := conn.WaitPublish(); err != nil {
+		handshake.Stop()
+		i.logger.Debugf("Live - %s did not publish: %v", remote, err)
+		return
+	}
+	if !handshake.Stop() {
+		i.logger.Debugf("Live - %s did not publish in time", remote)
+		return
+	}
+
+	select {
+	case i.sessions <- struct{}{}:
+		defer func() { <-i.sessions }()
+	default:
+		i.logger.Warnf("Live - rejected %s, too many live sessions", remote)
+		conn.RejectPublish("too many live streams")
+		return
+	}
+
+	session, err := i.liveUC.StartSession(ctx, conn.StreamName)
+	if err != nil {
+		reason := "failed to start the stream"
+		if errors.Is(err, live.ErrStreamKeyInvalid) || errors.Is(err, live.ErrStreamKeyInUse) {
+			reason = err.Error()
+		}
+		i.logger.Warnf("Live - rejected publish from %s: %v", remote, err)
+		conn.RejectPublish(reason)
+		return
+	}
+	i.logger.Infof("Live session %s of user %s started from %s", session.SessionID, session.UserID, remote)
+
+	var recordingPath string
+	workDir, streamErr := os.MkdirTemp(i.cfg.Live.TempDir, "live-"+session.SessionID.String()+"-")
+	if streamErr == nil {
+		defer os.RemoveAll(workDir)
+		recordingPath = filepath.Join(workDir, recordingName)
+		if streamErr = conn.AcceptPublish(); streamErr == nil {
+			streamErr = i.stream(ctx, conn, session, workDir, recordingPath)
+		}
+	}
+
+	endCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), endTimeout)
+	defer cancel()
+	if err = i.liveUC.EndSession(endCtx, session, recordingPath, streamErr); err != nil {
+		i.logger.Errorf("Live session %s ended with error: %v", session.SessionID, err)
+		return
+	}
+	i.logger.Infof("Live session %s ended", session.SessionID)
+}
+
+// stream records the published stream to recordingPath and transcodes it into live HLS that is
+// synced to the session's output while it runs.
+func (i *ingester) stream(ctx context.Context, conn *rtmp.Conn, session *models.LiveSession, workDir, recordingPath string) error {
+	recordingFile, err := os.Create(recordingPath)
+	if err != nil {
+		return fmt.Errorf("failed to create recording: %w", err)
+	}
+	defer recordingFile.Close()
+	buffered := bufio.NewWriter(recordingFile)
+	recording := rtmp.NewFLVWriter(buffered)
+	if err = recording.WriteHeader(); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+
+	// The transcoder starts once it is known whether there is audio to map
+	var probe []*rtmp.Message
+	hasAudio, hasVideo := false, false
+	var tc *transcoder
+
+	// A session that was taken over stops publishing, closing the connection ends the loop
+	var lost atomic.Bool
+	onLost := func() {
+		lost.Store(true)
+		conn.Close()
+	}
+
+	var streamErr error
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case errors.Is(err, io.EOF) || ctx.Err() != nil:
+			case errors.As(err, &netErr) && netErr.Timeout():
+				streamErr = fmt.Errorf("stream timed out")
+			default:
+				streamErr = fmt.Errorf("stream interrupted: %w", err)
+			}
+			break
+		}
+		if err = recording.WriteMessage(msg); err != nil {
+			streamErr = fmt.Errorf("failed to write recording: %w", err)
+			break
+		}
+
+		if tc == nil {
+			probe = append(probe, msg)
+			hasAudio = hasAudio || msg.Type == rtmp.MsgAudio
+			hasVideo = hasVideo || msg.Type == rtmp.MsgVideo
+			if !(hasAudio && hasVideo) && len(probe) < probeMessages {
+				continue
+			}
+			if !hasVideo {
+				streamErr = fmt.Errorf("stream has no video")
+				break
+			}
+			if tc, err = i.startTranscoder(ctx, session, workDir, hasAudio, onLost); err != nil {
+				streamErr = err
+				break
+			}
+			for _, buffered := range probe {
+				tc.write(buffered)
+			}
+			probe = nil
+			continue
+		}
+		// A transcoder failure ends the live output, the recording goes on
+		tc.write(msg)
+	}
+
+	if err = buffered.Flush(); err != nil && streamErr == nil {
+		streamErr = fmt.Errorf("failed to write recording: %w", err)
+	}
+	if tc != nil {
+		if err = tc.stop(); err != nil && streamErr == nil {
+			streamErr = err
+		}
+	}
+	if lost.Load() {
+		return live.ErrSessionNotLive
+	}
+	return streamErr
+}
+
+// transcoder is the ffmpeg process turning the stream into live HLS, and the loop that syncs
+// its output to storage.
+type transcoder struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	flv      *rtmp.FLVWriter
+	stderr   bytes.Buffer
+	writeErr error
+
+	cancelSync context.CancelFunc
+	synced     chan struct{}
+}
+
+func (i *ingester) startTranscoder(ctx context.Context, session *models.LiveSession, workDir string, hasAudio bool, onLost func()) (*transcoder, error) {
+	hlsDir := filepath.Join(workDir, "hls")
+	if err := os.MkdirAll(hlsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create live output directory: %w", err)
+	}
+
+	tc := &transcoder{synced: make(chan struct{})}
+	tc.cmd = exec.Command("ffmpeg", i.transcodeArgs(hlsDir, hasAudio)...)
+	tc.cmd.Stderr = &tc.stderr
+	stdin, err := tc.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transcoder input: %w", err)
+	}
+	tc.stdin = stdin
+	if err = tc.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start transcoder: %w", err)
+	}
+	tc.flv = rtmp.NewFLVWriter(stdin)
+	tc.writeErr = tc.flv.WriteHeader()
+
+	// The output keeps syncing through shutdown so the playlists end properly
+	syncCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	tc.cancelSync = cancel
+	go func() {
+		defer close(tc.synced)
+		i.syncLoop(syncCtx, session, hlsDir, onLost)
+	}()
+	return tc, nil
+}
+
+func (t *transcoder) write(msg *rtmp.Message) {
+	if t.writeErr == nil {
+		t.writeErr = t.flv.WriteMessage(msg)
+	}
+}
+
+// stop lets ffmpeg finish the playlists, then waits for the last sync.
+func (t *transcoder) stop() error {
+	t.stdin.Close()
+	err := t.cmd.Wait()
+	t.cancelSync()
+	<-t.synced
+	if err != nil {
+		return fmt.Errorf("transcoder failed: %v, stderr: %s", err, strings.TrimSpace(t.stderr.String()))
+	}
+	return nil
+}
+
+// transcodeArgs encodes the default quality ladder from the FLV on stdin into a sliding window
+// HLS playlist per quality and a master playlist. Key frames are forced on segment boundaries
+// so every rendition cuts at the same points.
+func (i *ingester) transcodeArgs(hlsDir string, hasAudio bool) []string {
+	segmentSeconds := i.cfg.Live.SegmentSeconds
+	if segmentSeconds <= 0 {
+		segmentSeconds = defaultSegmentSeconds
+	}
+	playlistSize := i.cfg.Live.PlaylistSize
+	if playlistSize <= 0 {
+		playlistSize = defaultPlaylistSize
+	}
+	qualities := utils.GetDefaultQualities()
+
+	split := fmt.Sprintf("[0:v]split=%d", len(qualities))
+	var scales, streamMap []string
+	for n := range qualities {
+		split += fmt.Sprintf("[v%d]", n)
+	}
+	args := []string{"-hide_banner", "-loglevel", "error", "-f", "flv", "-i", "pipe:0"}
+	var outputs []string
+	for n, quality := range qualities {
+		height, _ := strconv.Atoi(strings.TrimSuffix(quality.Resolution, "p"))
+		scales = append(scales, fmt.Sprintf("[v%d]scale=-2:'min(%d,ih)'[out%d]", n, height, n))
+		outputs = append(outputs,
+			"-map", fmt.Sprintf("[out%d]", n),
+			fmt.Sprintf("-b:v:%d", n), fmt.Sprintf("%dk", quality.Bitrate),
+			fmt.Sprintf("-maxrate:v:%d", n), fmt.Sprintf("%dk", quality.MaxBitrate),
+			fmt.Sprintf("-bufsize:v:%d", n), fmt.Sprintf("%dk", 2*quality.MaxBitrate),
+		)
+		entry := fmt.Sprintf("v:%d", n)
+		if hasAudio {
+			outputs = append(outputs, "-map", "0:a:0")
+			entry += fmt.Sprintf(",a:%d", n)
+		}
+		streamMap = append(streamMap, entry)
+	}
+	args = append(args, "-filter_complex", split+";"+strings.Join(scales, ";"))
+	args = append(args, outputs...)
+	args = append(args,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-tune", "zerolatency",
+		"-sc_threshold", "0",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentSeconds),
+	)
+	if hasAudio {
+		args = append(args, "-c:a", "aac", "-b:a", liveAudioBitrate, "-ac", "2")
+	}
+	return append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segmentSeconds),
+		"-hls_list_size", strconv.Itoa(playlistSize),
+		"-hls_flags", "delete_segments+independent_segments+temp_file",
+		"-hls_segment_filename", filepath.Join(hlsDir, "stream_%v", "segment_%05d.ts"),
+		"-master_pl_name", models.HLSManifestName,
+		"-var_stream_map", strings.Join(streamMap, " "),
+		filepath.Join(hlsDir, "stream_%v", "index.m3u8"),
+	)
+}
+
+type syncedFile struct {
+	modTime time.Time
+	size    int64
+}
+
+// syncLoop mirrors the live output directory to storage until ctx is done, then once more.
+// Segments go up before the playlists that list them; segments ffmpeg removed from the window
+// are removed from storage too. When the heartbeat finds the session isn't live anymore it calls
+// onLost and stops syncing.
+func (i *ingester) syncLoop(ctx context.Context, session *models.LiveSession, hlsDir string, onLost func()) {
+	synced := make(map[string]syncedFile)
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+	heartbeat := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			// The final playlists carry EXT-X-ENDLIST
+			i.syncOutput(context.WithoutCancel(ctx), session, hlsDir, synced)
+			return
+		case <-ticker.C:
+		}
+		i.syncOutput(ctx, session, hlsDir, synced)
+		if time.Since(heartbeat) >= i.heartbeatInterval() {
+			heartbeat = time.Now()
+			err := i.liveUC.KeepAlive(ctx, session)
+			if errors.Is(err, live.ErrSessionNotLive) {
+				i.logger.Warnf("Live session %s is no longer live, stopping its ingest", session.SessionID)
+				onLost()
+				return
+			}
+			if err != nil {
+				i.logger.Warnf("Live session %s - heartbeat failed: %v", session.SessionID, err)
+			}
+		}
+	}
+}
+
+func (i *ingester) syncOutput(ctx context.Context, session *models.LiveSession, hlsDir string, synced map[string]syncedFile) {
+	present := make(map[string]bool)
+	var playlists []string
+	err := filepath.Walk(hlsDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			// ffmpeg deletes segments while the directory is walked
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(file, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(hlsDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		present[rel] = true
+		state := syncedFile{modTime: info.ModTime(), size: info.Size()}
+		if synced[rel] == state {
+			return nil
+		}
+		if strings.HasSuffix(rel, ".m3u8") {
+			playlists = append(playlists, rel)
+			return nil
+		}
+		if i.upload(ctx, session, hlsDir, rel, "video/mp2t") {
+			synced[rel] = state
+		}
+		return nil
+	})
+	if err != nil {
+		i.logger.Warnf("Live session %s - failed to read output: %v", session.SessionID, err)
+		return
+	}
+	for _, rel := range playlists {
+		info, err := os.Stat(filepath.Join(hlsDir, filepath.FromSlash(rel)))
+		if err != nil {
+			continue
+		}
+		if i.upload(ctx, session, hlsDir, rel, "application/vnd.apple.mpegurl") {
+			synced[rel] = syncedFile{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	for rel := range synced {
+		if present[rel] {
+			continue
+		}
+		if err = i.awsRepo.RemoveObject(ctx, session.OutputBucket, session.OutputKey+"/"+rel); err != nil {
+			i.logger.Warnf("Live session %s - failed to remove %s: %v", session.SessionID, rel, err)
+			continue
+		}
+		delete(synced, rel)
+	}
+}
+
+func (i *ingester) upload(ctx context.Context, session *models.LiveSession, hlsDir, rel, contentType string) bool {
+	key := session.OutputKey + "/" + rel
+	if _, err := i.awsRepo.UploadFile(ctx, session.OutputBucket, key, filepath.Join(hlsDir, filepath.FromSlash(rel)), contentType, ""); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			i.logger.Warnf("Live session %s - failed to upload %s: %v", session.SessionID, rel, err)
+		}
+		return false
+	}
+	return true
+}
+
+// heartbeatInterval keeps a few heartbeats within the time after which a session is stale.
+func (i *ingester) heartbeatInterval() time.Duration {
+	stale := i.cfg.Live.StaleSeconds
+	if stale <= 0 {
+		stale = defaultStaleSeconds
+	}
+	return time.Duration(stale) * time.Second / 3
+}
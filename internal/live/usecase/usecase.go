@@ -0,0 +1,377 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/auth"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/live"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	streamKeyBytes      = 24
+	defaultStaleSeconds = 30
+	livePlaybackTTL     = time.Hour
+
+	recordingFormat   = "flv"
+	recordingMimeType = "video/x-flv"
+	// A recording no larger than the FLV header holds no media
+	flvHeaderSize = 13
+)
+
+type liveUC struct {
+	cfg      *config.Config
+	repo     live.Repository
+	authRepo auth.Repository
+	videoUC  videofiles.UseCase
+	awsRepo  videofiles.AWSRepository
+	logger   logger.Logger
+}
+
+func NewLiveUseCase(
+	cfg *config.Config,
+	repo live.Repository,
+	authRepo auth.Repository,
+	videoUC videofiles.UseCase,
+	awsRepo videofiles.AWSRepository,
+	log logger.Logger,
+) live.UseCase {
+	return &liveUC{
+		cfg:      cfg,
+		repo:     repo,
+		authRepo: authRepo,
+		videoUC:  videoUC,
+		awsRepo:  awsRepo,
+		logger:   log,
+	}
+}
+
+func (u *liveUC) CreateStreamKey(ctx context.Context, input *models.StreamKeyInput) (*models.StreamKey, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		u.logger.Errorf("CreateStreamKey - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	if err = utils.ValidateStruct(ctx, input); err != nil {
+		u.logger.Errorf("CreateStreamKey - ValidateStruct error: %v", err)
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+
+	secret := make([]byte, streamKeyBytes)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate stream key: %v", err)
+	}
+	key := hex.EncodeToString(secret)
+
+	created, err := u.repo.CreateStreamKey(ctx, &models.StreamKey{
+		UserID:  user.UserID,
+		Name:    input.Name,
+		KeyHash: hashStreamKey(key),
+	})
+	if err != nil {
+		u.logger.Errorf("CreateStreamKey - CreateStreamKey error: %v", err)
+		return nil, fmt.Errorf("failed to create stream key: %v", err)
+	}
+	// Only the hash is stored, this is the one time the user sees the key
+	created.Key = key
+	return created, nil
+}
+
+func (u *liveUC) ListStreamKeys(ctx context.Context) ([]*models.StreamKey, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		u.logger.Errorf("ListStreamKeys - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	keys, err := u.repo.ListStreamKeys(ctx, user.UserID)
+	if err != nil {
+		u.logger.Errorf("ListStreamKeys - ListStreamKeys error: %v", err)
+		return nil, fmt.Errorf("failed to list stream keys: %v", err)
+	}
+	return keys, nil
+}
+
+func (u *liveUC) RevokeStreamKey(ctx context.Context, streamKeyID uuid.UUID) error {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		u.logger.Errorf("RevokeStreamKey - GetUserFromCtx error: %v", err)
+		return err
+	}
+	if err = u.repo.RevokeStreamKey(ctx, user.UserID, streamKeyID); err != nil {
+		u.logger.Errorf("RevokeStreamKey - RevokeStreamKey error: %v", err)
+		return fmt.Errorf("failed to revoke stream key: %v", err)
+	}
+	return nil
+}
+
+func (u *liveUC) ListSessions(ctx context.Context, pagination *utils.Pagination) (*models.LiveSessionList, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		u.logger.Errorf("ListSessions - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	if pagination.Page < 1 {
+		pagination.Page = 1
+	}
+	if pagination.Size < 1 || pagination.Size > 100 {
+		pagination.Size = 10
+	}
+	sessions, err := u.repo.ListSessions(ctx, user.UserID, pagination)
+	if err != nil {
+		u.logger.Errorf("ListSessions - ListSessions error: %v", err)
+		return nil, fmt.Errorf("failed to list live sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+func (u *liveUC) GetSession(ctx context.Context, sessionID uuid.UUID) (*models.LiveSession, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		u.logger.Errorf("GetSession - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	session, err := u.repo.GetSessionByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("live session not found")
+		}
+		u.logger.Errorf("GetSession - GetSessionByID error: %v", err)
+		return nil, fmt.Errorf("failed to fetch live session: %v", err)
+	}
+	if session.UserID != user.UserID {
+		u.logger.Warnf("User %s is not authorized to access live session %s", user.UserID, sessionID)
+		return nil, fmt.Errorf("live session not found")
+	}
+	if session.Status == models.LiveSessionLive {
+		if session.PlaybackURL, err = u.playbackURL(session); err != nil {
+			u.logger.Errorf("GetSession - %v", err)
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// playbackURL points at the live master playlist through the tokenized playback route, which
+// serves the live output like the output of an encode job.
+func (u *liveUC) playbackURL(session *models.LiveSession) (string, error) {
+	ttl := livePlaybackTTL
+	if u.cfg.Playback.TokenTTLSeconds > 0 {
+		ttl = time.Duration(u.cfg.Playback.TokenTTLSeconds) * time.Second
+	}
+	claims := &utils.PlaybackClaims{
+		VideoID: session.VideoID,
+		UserID:  session.UserID.String(),
+		Bucket:  session.OutputBucket,
+		Prefix:  session.OutputKey,
+	}
+	token, err := utils.GeneratePlaybackToken(claims, utils.PlaybackSecret(u.cfg), time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	base := strings.TrimSuffix(u.cfg.Playback.PublicURL, "/") + videofiles.PlaybackRoutePrefix
+	return base + "/" + token + "/" + models.HLSManifestName, nil
+}
+
+func (u *liveUC) StartSession(ctx context.Context, streamKey string) (*models.LiveSession, error) {
+	key, err := u.repo.GetStreamKeyByHash(ctx, hashStreamKey(streamKey))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, live.ErrStreamKeyInvalid
+		}
+		u.logger.Errorf("StartSession - GetStreamKeyByHash error: %v", err)
+		return nil, fmt.Errorf("failed to fetch stream key: %v", err)
+	}
+	userCtx, err := u.userContext(ctx, key.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	stale, err := u.repo.FailStaleSessions(ctx, key.StreamKeyID, u.staleAfter())
+	if err != nil {
+		u.logger.Errorf("StartSession - FailStaleSessions error: %v", err)
+		return nil, fmt.Errorf("failed to end stale live sessions: %v", err)
+	}
+	for _, session := range stale {
+		u.abandonSession(userCtx, session)
+	}
+
+	sessionID := uuid.New()
+	video, err := u.videoUC.CreateLiveVideo(userCtx, &models.VideoUploadInput{
+		FileName: fmt.Sprintf("live-%s.%s", sessionID, recordingFormat),
+		Format:   recordingFormat,
+		MimeType: recordingMimeType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create live video: %v", err)
+	}
+
+	session, err := u.repo.CreateSession(ctx, &models.LiveSession{
+		SessionID:    sessionID,
+		StreamKeyID:  key.StreamKeyID,
+		UserID:       key.UserID,
+		VideoID:      video.VideoID.String(),
+		OutputBucket: u.cfg.S3.OutputBucket,
+		OutputKey:    fmt.Sprintf("live/%s/%s", key.UserID, sessionID),
+	})
+	if err != nil {
+		if derr := u.videoUC.DeleteVideo(userCtx, video.VideoID); derr != nil {
+			u.logger.Errorf("StartSession - failed to remove video %s: %v", video.VideoID, derr)
+		}
+		if errors.Is(err, live.ErrStreamKeyInUse) {
+			return nil, err
+		}
+		u.logger.Errorf("StartSession - CreateSession error: %v", err)
+		return nil, fmt.Errorf("failed to start live session: %v", err)
+	}
+	return session, nil
+}
+
+func (u *liveUC) KeepAlive(ctx context.Context, session *models.LiveSession) error {
+	return u.repo.TouchSession(ctx, session.SessionID)
+}
+
+func (u *liveUC) EndSession(ctx context.Context, session *models.LiveSession, recordingPath string, streamErr error) error {
+	if errors.Is(streamErr, live.ErrSessionNotLive) {
+		// The session was taken over and its video removed, the recording has nowhere to go
+		u.removeOutput(ctx, session)
+		return streamErr
+	}
+	session.Status = models.LiveSessionEnded
+	if streamErr != nil {
+		session.Status = models.LiveSessionFailed
+		session.ErrorMessage = streamErr.Error()
+	}
+	recordErr := u.publishRecording(ctx, session, recordingPath)
+	if recordErr != nil {
+		u.logger.Errorf("EndSession - recording of live session %s: %v", session.SessionID, recordErr)
+		session.Status = models.LiveSessionFailed
+		if session.ErrorMessage == "" {
+			session.ErrorMessage = recordErr.Error()
+		}
+	}
+	if err := u.repo.EndSession(ctx, session); err != nil {
+		u.logger.Errorf("EndSession - EndSession error: %v", err)
+		return fmt.Errorf("failed to end live session: %v", err)
+	}
+	return recordErr
+}
+
+// publishRecording uploads the recording as the source of the session's video and queues its
+// encode job. A session that recorded nothing loses its video.
+func (u *liveUC) publishRecording(ctx context.Context, session *models.LiveSession, recordingPath string) error {
+	videoID, err := uuid.Parse(session.VideoID)
+	if err != nil {
+		return fmt.Errorf("live session has no video")
+	}
+	userCtx, err := u.userContext(ctx, session.UserID)
+	if err != nil {
+		return err
+	}
+	var size int64
+	if recordingPath != "" {
+		if info, err := os.Stat(recordingPath); err == nil {
+			size = info.Size()
+		}
+	}
+	if size <= flvHeaderSize {
+		if err = u.videoUC.DeleteVideo(userCtx, videoID); err != nil {
+			return fmt.Errorf("failed to remove empty recording: %v", err)
+		}
+		session.VideoID = ""
+		return nil
+	}
+
+	video, err := u.videoUC.GetVideo(userCtx, videoID)
+	if err != nil {
+		return err
+	}
+	checksum, err := fileChecksum(recordingPath)
+	if err != nil {
+		return err
+	}
+	if _, err = u.awsRepo.UploadFile(ctx, video.S3Bucket, video.S3Key, recordingPath, recordingMimeType, checksum); err != nil {
+		return fmt.Errorf("failed to upload recording: %v", err)
+	}
+	completed, err := u.videoUC.CompleteLiveVideo(userCtx, video.VideoID, size, checksum)
+	if err != nil {
+		return fmt.Errorf("failed to queue recording: %v", err)
+	}
+	session.JobID = completed.Job.JobID
+	return nil
+}
+
+// abandonSession removes the video and live output of a session that was failed because its
+// ingest stopped sending heartbeats. Its recording was on the ingest and is lost.
+func (u *liveUC) abandonSession(ctx context.Context, session *models.LiveSession) {
+	u.logger.Warnf("Live session %s stopped without ending, removing its video and output", session.SessionID)
+	u.removeOutput(ctx, session)
+	if videoID, err := uuid.Parse(session.VideoID); err == nil {
+		if err = u.videoUC.DeleteVideo(ctx, videoID); err != nil {
+			u.logger.Errorf("Live - failed to remove video %s of session %s: %v", videoID, session.SessionID, err)
+		}
+	}
+}
+
+// removeOutput removes the live HLS output of a session.
+func (u *liveUC) removeOutput(ctx context.Context, session *models.LiveSession) {
+	objects, err := u.awsRepo.ListObjectsWithPrefix(ctx, session.OutputBucket, session.OutputKey+"/")
+	if err != nil {
+		u.logger.Errorf("Live - failed to list output of session %s: %v", session.SessionID, err)
+		return
+	}
+	for _, object := range objects {
+		if err = u.awsRepo.RemoveObject(ctx, session.OutputBucket, object.Key); err != nil {
+			u.logger.Errorf("Live - failed to remove %s: %v", object.Key, err)
+		}
+	}
+}
+
+// userContext acts for the owner of a stream key like an API request of theirs would.
+func (u *liveUC) userContext(ctx context.Context, userID uuid.UUID) (context.Context, error) {
+	user, err := u.authRepo.GetByID(ctx, userID)
+	if err != nil {
+		u.logger.Errorf("Live - failed to load user %s: %v", userID, err)
+		return nil, fmt.Errorf("failed to load user: %v", err)
+	}
+	return context.WithValue(ctx, utils.UserCtxKey{}, user), nil
+}
+
+func (u *liveUC) staleAfter() time.Duration {
+	if u.cfg.Live.StaleSeconds > 0 {
+		return time.Duration(u.cfg.Live.StaleSeconds) * time.Second
+	}
+	return defaultStaleSeconds * time.Second
+}
+
+func hashStreamKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open recording: %v", err)
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, f); err != nil {
+		return "", fmt.Errorf("failed to hash recording: %v", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/metrics"
+	"github.com/labstack/echo/v4"
+)
+
+// MetricsMiddleware records request latency by method, route template and status code.
+func (mw *MiddlewareManager) MetricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.WithLabelValues(
+			c.Request().Method,
+			route,
+			strconv.Itoa(responseStatus(c, err)),
+		).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// responseStatus is the status the client gets. A returned error is only written by Echo's
+// error handler after the middleware chain, so its status is taken from the error itself.
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return http.StatusInternalServerError
+}
@@ -1,12 +1,92 @@
 package models
 
-import "io"
+import (
+	"io"
+	"time"
+)
+
+// ChecksumMetadataKey is the object metadata key holding the hex SHA-256 of uploaded output.
+const ChecksumMetadataKey = "sha256"
 
 type UploadInput struct {
 	File       io.Reader `json:"file,omitempty"`
 	Name       string    `json:"name,required"`
 	MimeType   string    `json:"mime_type,required"`
 	Size       int64     `json:"size,required"`
+	Checksum   string    `json:"checksum,omitempty"` // hex SHA-256, enforced by S3 when set
 	Key        string    `json:"key,required"`
 	BucketName string    `json:"bucket_name,required"`
 }
+
+// MultipartUpload is an S3 multipart upload a client sends a video's source through.
+type MultipartUpload struct {
+	VideoID  string `json:"video_id"`
+	UploadID string `json:"upload_id"`
+	Key      string `json:"key"`
+	// PartSize is the size every part but the last should have for the file to fit S3's part limit.
+	PartSize  int64 `json:"part_size"`
+	PartCount int   `json:"part_count"`
+	// ChecksumRequired is set when every part URL must be requested with the part's SHA-256.
+	ChecksumRequired bool `json:"checksum_required"`
+}
+
+type PartURL struct {
+	PartNumber int32     `json:"part_number"`
+	URL        string    `json:"url"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type UploadedPart struct {
+	PartNumber     int32     `json:"part_number" validate:"required,min=1,max=10000"`
+	ETag           string    `json:"etag" validate:"required"`
+	Size           int64     `json:"size,omitempty"`
+	ChecksumSHA256 string    `json:"checksum_sha256,omitempty"` // base64, as returned by S3
+	LastModified   time.Time `json:"last_modified,omitempty"`
+}
+
+type CompleteMultipartInput struct {
+	// Parts may be left empty to complete the upload with every part S3 has received.
+	Parts []UploadedPart `json:"parts" validate:"omitempty,dive"`
+}
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// PendingUpload is a multipart upload that was started but neither completed nor aborted.
+type PendingUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// TusUpload is the state of a tus upload. Its data goes into an S3 multipart upload one part at
+// a time; bytes that don't fill a part yet are kept as the upload's tail, an object of its own,
+// until the next chunk.
+type TusUpload struct {
+	ID        string         `json:"id"`
+	UserID    string         `json:"user_id"`
+	Bucket    string         `json:"bucket"`
+	Key       string         `json:"key"`
+	UploadID  string         `json:"upload_id"` // of the S3 multipart upload
+	Length    int64          `json:"length"`
+	Offset    int64          `json:"offset"`
+	PartSize  int64          `json:"part_size"`
+	Parts     []UploadedPart `json:"parts"`
+	TailSize  int64          `json:"tail_size,omitempty"` // bytes of the tail object that belong to the upload
+	FileName  string         `json:"file_name"`
+	MimeType  string         `json:"mime_type"`
+	Format    string         `json:"format"`
+	Checksum  string         `json:"checksum,omitempty"`   // declared hex SHA-256 of the file
+	HashState []byte         `json:"hash_state,omitempty"` // SHA-256 state over the bytes received
+	CreatedAt time.Time      `json:"created_at"`
+	VideoID   string         `json:"video_id,omitempty"` // set once the upload is finished
+}
+
+type TusUploadInput struct {
+	Length   int64
+	Metadata map[string]string // decoded Upload-Metadata
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+)
+
+// MaxClipRanges is the most ranges a clip can join.
+const MaxClipRanges = 20
+
+// ClipRange is a part of a video in seconds from its start, End excluded.
+type ClipRange struct {
+	Start float64 `json:"start" validate:"min=0"`
+	End   float64 `json:"end" validate:"gtfield=Start"`
+}
+
+func (r ClipRange) Duration() float64 {
+	return r.End - r.Start
+}
+
+// ClipRangeList is stored as a JSONB array. The ranges are joined in order.
+type ClipRangeList []ClipRange
+
+func (l ClipRangeList) Value() (driver.Value, error) {
+	return jsonArrayValue(l, len(l))
+}
+
+func (l *ClipRangeList) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
+
+// Duration is the length of the clip the ranges make up.
+func (l ClipRangeList) Duration() float64 {
+	var total float64
+	for _, r := range l {
+		total += r.Duration()
+	}
+	return total
+}
+
+// Check rejects ranges that can't be cut from a source of the given duration. A duration of
+// 0 means it isn't known yet and only the ranges themselves are checked.
+func (l ClipRangeList) Check(duration float64) error {
+	if len(l) == 0 {
+		return fmt.Errorf("no ranges to clip")
+	}
+	if len(l) > MaxClipRanges {
+		return fmt.Errorf("at most %d ranges can be joined", MaxClipRanges)
+	}
+	for i, r := range l {
+		if r.Start < 0 || r.End <= r.Start {
+			return fmt.Errorf("range %d: end must be after start", i)
+		}
+		if duration > 0 && r.End > duration {
+			return fmt.Errorf("range %d: ends after the video (%.3fs)", i, duration)
+		}
+	}
+	return nil
+}
+
+// Within returns the ranges, given on the timeline of a clip cut with parent, on the timeline
+// of the source the parent was cut from. A range spanning a cut of the parent is split there.
+func (l ClipRangeList) Within(parent ClipRangeList) ClipRangeList {
+	var mapped ClipRangeList
+	for _, r := range l {
+		var offset float64
+		for _, p := range parent {
+			start, end := math.Max(r.Start, offset), math.Min(r.End, offset+p.Duration())
+			if start < end {
+				mapped = append(mapped, ClipRange{Start: p.Start + start - offset, End: p.Start + end - offset})
+			}
+			offset += p.Duration()
+		}
+	}
+	return mapped
+}
+
+// ClipInput asks for a clip of a video, either one range given by Start and End or several
+// Ranges joined in order. The clip is encoded with the settings of its parent.
+type ClipInput struct {
+	Start    float64     `json:"start" validate:"omitempty,min=0"`
+	End      float64     `json:"end" validate:"omitempty,min=0"`
+	Ranges   []ClipRange `json:"ranges" validate:"omitempty,dive"`
+	FileName string      `json:"filename" validate:"omitempty,lte=255"`
+}
+
+// ClipRanges returns the ranges the input asks for.
+func (in *ClipInput) ClipRanges() ClipRangeList {
+	if len(in.Ranges) > 0 {
+		return in.Ranges
+	}
+	return ClipRangeList{{Start: in.Start, End: in.End}}
+}
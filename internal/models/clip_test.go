@@ -0,0 +1,100 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClipRangeListCheck(t *testing.T) {
+	tooMany := make(ClipRangeList, MaxClipRanges+1)
+	for i := range tooMany {
+		tooMany[i] = ClipRange{Start: float64(i), End: float64(i) + 0.5}
+	}
+	tests := []struct {
+		name     string
+		ranges   ClipRangeList
+		duration float64
+		wantErr  bool
+	}{
+		{"single range", ClipRangeList{{Start: 1, End: 5}}, 10, false},
+		{"ends at the duration", ClipRangeList{{Start: 0, End: 10}}, 10, false},
+		{"several ranges out of order", ClipRangeList{{Start: 6, End: 8}, {Start: 1, End: 2}}, 10, false},
+		{"unknown duration", ClipRangeList{{Start: 100, End: 200}}, 0, false},
+		{"no ranges", nil, 10, true},
+		{"too many ranges", tooMany, 0, true},
+		{"negative start", ClipRangeList{{Start: -1, End: 2}}, 10, true},
+		{"empty range", ClipRangeList{{Start: 3, End: 3}}, 10, true},
+		{"end before start", ClipRangeList{{Start: 4, End: 2}}, 10, true},
+		{"ends after the video", ClipRangeList{{Start: 8, End: 10.5}}, 10, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ranges.Check(tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check(%v) error = %v, want error %v", tt.duration, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClipRangeListWithin(t *testing.T) {
+	// The parent shows 10-20 and then 30-35 of its source, 15s in all
+	parent := ClipRangeList{{Start: 10, End: 20}, {Start: 30, End: 35}}
+	tests := []struct {
+		name   string
+		ranges ClipRangeList
+		want   ClipRangeList
+	}{
+		{"inside the first range", ClipRangeList{{Start: 2, End: 5}}, ClipRangeList{{Start: 12, End: 15}}},
+		{"inside the second range", ClipRangeList{{Start: 11, End: 14}}, ClipRangeList{{Start: 31, End: 34}}},
+		{"across the cut", ClipRangeList{{Start: 8, End: 12}}, ClipRangeList{{Start: 18, End: 20}, {Start: 30, End: 32}}},
+		{"whole parent", ClipRangeList{{Start: 0, End: 15}}, parent},
+		{"past the parent", ClipRangeList{{Start: 14, End: 20}}, ClipRangeList{{Start: 34, End: 35}}},
+		{"several ranges", ClipRangeList{{Start: 12, End: 13}, {Start: 0, End: 1}},
+			ClipRangeList{{Start: 32, End: 33}, {Start: 10, End: 11}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ranges.Within(parent); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Within = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlayListClip(t *testing.T) {
+	// The clip joins 10-20 and 30-40 of the video
+	ranges := ClipRangeList{{Start: 10, End: 20}, {Start: 30, End: 40}}
+	whole := Overlay{Type: OverlayText, Text: "whole"}
+	tests := []struct {
+		name     string
+		overlays OverlayList
+		want     OverlayList
+	}{
+		{"whole video", OverlayList{whole}, OverlayList{whole}},
+		{"inside a range", OverlayList{{Type: OverlayText, Start: 12, End: 15}},
+			OverlayList{{Type: OverlayText, Start: 2, End: 5}}},
+		{"across both ranges", OverlayList{{Type: OverlayText, Start: 15, End: 35}},
+			OverlayList{{Type: OverlayText, Start: 5, End: 15}}},
+		{"to the end", OverlayList{{Type: OverlayText, Start: 35}},
+			OverlayList{{Type: OverlayText, Start: 15, End: 20}}},
+		{"left out of the clip", OverlayList{{Type: OverlayText, Start: 22, End: 28}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.overlays.Clip(ranges); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Clip = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlayListClipReordered(t *testing.T) {
+	// The clip shows 30-40 before 10-20, the overlay ends up in two places
+	ranges := ClipRangeList{{Start: 30, End: 40}, {Start: 10, End: 20}}
+	got := OverlayList{{Type: OverlayText, Start: 15, End: 35}}.Clip(ranges)
+	want := OverlayList{{Type: OverlayText, Start: 0, End: 5}, {Type: OverlayText, Start: 15, End: 20}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Clip = %+v, want %+v", got, want)
+	}
+}
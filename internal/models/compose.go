@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+const (
+	// MaxComposeSources is the most videos a composition can join.
+	MaxComposeSources = 20
+	// TransitionCut joins two videos without a transition.
+	TransitionCut = "cut"
+	// DefaultTransitionDuration is used for transitions that don't give a duration.
+	DefaultTransitionDuration = 1.0
+	maxTransitionDuration     = 5.0
+)
+
+// Transition is how one video of a composition leads into the next. Types other than cut are
+// ffmpeg xfade transitions, the audio crossfades along.
+type Transition struct {
+	Type     string  `json:"type" validate:"required,oneof=cut fade fadeblack fadewhite dissolve wipeleft wiperight wipeup wipedown slideleft slideright circleopen circleclose"`
+	Duration float64 `json:"duration,omitempty" validate:"omitempty,gt=0,lte=5"` // Seconds, taken from both videos
+}
+
+// Overlap is how long the transition plays over the end and the start of the videos it joins.
+func (t Transition) Overlap() float64 {
+	if t.Type == "" || t.Type == TransitionCut {
+		return 0
+	}
+	if t.Duration <= 0 {
+		return DefaultTransitionDuration
+	}
+	return t.Duration
+}
+
+// ComposeInput asks for a new video joining VideoIDs in order. Transitions is either empty
+// for plain cuts, a single transition used for every join or one per join.
+type ComposeInput struct {
+	VideoIDs    []string     `json:"video_ids" validate:"required,min=2,max=20,dive,uuid"`
+	Transitions []Transition `json:"transitions" validate:"omitempty,dive"`
+	FileName    string       `json:"filename" validate:"omitempty,lte=255"`
+}
+
+// TransitionAt returns the transition into the i-th video, i > 0.
+func (in *ComposeInput) TransitionAt(i int) Transition {
+	switch len(in.Transitions) {
+	case 0:
+		return Transition{Type: TransitionCut}
+	case 1:
+		return in.Transitions[0]
+	default:
+		return in.Transitions[i-1]
+	}
+}
+
+// ComposeSource is one video joined into a composition. Clips are joined as they play, cut
+// from S3Key with ClipRanges.
+type ComposeSource struct {
+	VideoID    string        `json:"video_id"`
+	S3Key      string        `json:"s3_key"`
+	ClipRanges ClipRangeList `json:"clip_ranges,omitempty"`
+	Duration   float64       `json:"duration,omitempty"` // As known when the composition was asked for, 0 if not
+	Transition Transition    `json:"transition"`         // Into this video from the one before
+}
+
+// ComposeSourceList is stored as a JSONB array, in the order the videos are joined.
+type ComposeSourceList []ComposeSource
+
+func (l ComposeSourceList) Value() (driver.Value, error) {
+	return jsonArrayValue(l, len(l))
+}
+
+func (l *ComposeSourceList) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
+
+// Check rejects compositions that can't be rendered: every transition has to fit into both
+// videos it joins. Durations of 0 aren't known and aren't checked.
+func (l ComposeSourceList) Check() error {
+	if len(l) < 2 {
+		return fmt.Errorf("at least 2 videos are needed")
+	}
+	if len(l) > MaxComposeSources {
+		return fmt.Errorf("at most %d videos can be joined", MaxComposeSources)
+	}
+	for i := 1; i < len(l); i++ {
+		overlap := l[i].Transition.Overlap()
+		if overlap > maxTransitionDuration {
+			return fmt.Errorf("transition %d is longer than %.0fs", i, maxTransitionDuration)
+		}
+		for _, source := range []ComposeSource{l[i-1], l[i]} {
+			if source.Duration > 0 && overlap >= source.Duration {
+				return fmt.Errorf("transition %d is longer than video %s", i, source.VideoID)
+			}
+		}
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
 
 type JobStatus string
 
@@ -11,19 +15,186 @@ const (
 	JobStatusFailed     JobStatus = "failed"
 )
 
+const (
+	// JobProgressKey prefixes the Redis hash holding the latest state of a job.
+	JobProgressKey = "video:progress:"
+	// JobEventsChannel prefixes the Redis channel a job's state changes are published on.
+	JobEventsChannel = "video:events:"
+)
+
+// Terminal reports whether a job in this status will not change anymore.
+func (s JobStatus) Terminal() bool {
+	return s == JobStatusCompleted || s == JobStatusFailed
+}
+
+type JobStage string
+
+const (
+	JobStageDownload JobStage = "download"
+	JobStageClip     JobStage = "clip"
+	JobStageCompose  JobStage = "compose"
+	JobStageSplit    JobStage = "split"
+	JobStageEncode   JobStage = "encode"
+	JobStagePackage  JobStage = "package"
+	JobStageUpload   JobStage = "upload"
+)
+
 type EncodeJob struct {
-	JobID                  string             `json:"job_id" db:"job_id" redis:"job_id" validate:"omitempty"`
-	UserID                 string             `json:"user_id" db:"user_id" redis:"user_id" validate:"omitempty"`
-	VideoID                string             `json:"video_id" db:"video_id" redis:"video_id" validate:"omitempty"`
-	InputS3Key             string             `json:"input_s3_key" db:"input_s3_key" redis:"input_s3_key" validate:"required"`
-	InputBucket            string             `json:"input_bucket" db:"input_bucket" redis:"input_bucket" validate:"required"`
-	Progress               float64            `json:"progress" db:"progress" redis:"progress" validate:"omitempty"`
-	OutputS3Key            string             `json:"output_s3_key" db:"output_s3_key" redis:"output_s3_key" validate:"required"`
-	OutputBucket           string             `json:"output_bucket" db:"output_bucket" redis:"output_bucket" validate:"required"`
-	Qualities              []InputQualityInfo `json:"qualities" db:"qualities" redis:"qualities" validate:"omitempty"`
-	OutputFormats          []PlaybackFormat   `json:"output_formats" db:"output_formats" redis:"output_formats" validate:"omitempty"`
-	EnablePerTitleEncoding bool               `json:"enable_per_title_encoding" db:"enable_per_title_encoding" redis:"enable_per_title_encoding" validate:"omitempty"`
-	Status                 JobStatus          `json:"status" db:"status" redis:"status" validate:"required"`
-	StartedAt              time.Time          `json:"started_at" db:"started_at" redis:"started_at" validate:"omitempty"`
-	CompletedAt            time.Time          `json:"completed_at" db:"completed_at" redis:"completed_at" validate:"omitempty"`
+	JobID                  string            `json:"job_id" db:"job_id" redis:"job_id" validate:"omitempty"`
+	UserID                 string            `json:"user_id" db:"user_id" redis:"user_id" validate:"omitempty"`
+	VideoID                string            `json:"video_id" db:"video_id" redis:"video_id" validate:"omitempty"`
+	InputS3Key             string            `json:"input_s3_key" db:"input_s3_key" redis:"input_s3_key" validate:"required"`
+	InputBucket            string            `json:"input_bucket" db:"input_bucket" redis:"input_bucket" validate:"required"`
+	FileSize               int64             `json:"file_size" db:"file_size" redis:"file_size" validate:"omitempty"`
+	Duration               float64           `json:"duration" db:"duration" redis:"duration" validate:"omitempty"`
+	Progress               float64           `json:"progress" db:"progress" redis:"progress" validate:"omitempty"`
+	OutputS3Key            string            `json:"output_s3_key" db:"output_s3_key" redis:"output_s3_key" validate:"required"`
+	OutputBucket           string            `json:"output_bucket" db:"output_bucket" redis:"output_bucket" validate:"required"`
+	Qualities              QualityList       `json:"qualities" db:"qualities" redis:"qualities" validate:"omitempty"`
+	OutputFormats          FormatList        `json:"output_formats" db:"output_formats" redis:"output_formats" validate:"omitempty"`
+	EnablePerTitleEncoding bool              `json:"enable_per_title_encoding" db:"enable_per_title_encoding" redis:"enable_per_title_encoding" validate:"omitempty"`
+	EncryptionMode         EncryptionMode    `json:"encryption_mode,omitempty" db:"encryption_mode" redis:"encryption_mode" validate:"omitempty"`
+	KeyRotationSegments    int               `json:"key_rotation_segments,omitempty" db:"key_rotation_segments" redis:"key_rotation_segments" validate:"omitempty"`
+	ClipRanges             ClipRangeList     `json:"clip_ranges,omitempty" db:"clip_ranges" redis:"clip_ranges" validate:"omitempty"`             // Cut from the input before encoding
+	Overlays               OverlayList       `json:"overlays,omitempty" db:"overlays" redis:"overlays" validate:"omitempty"`                      // Burned in when encoding
+	ComposeSources         ComposeSourceList `json:"compose_sources,omitempty" db:"compose_sources" redis:"compose_sources" validate:"omitempty"` // Joined into the input before encoding
+	Status                 JobStatus         `json:"status" db:"status" redis:"status" validate:"required"`
+	Stage                  JobStage          `json:"stage" db:"stage" redis:"stage" validate:"omitempty"`
+	StageTimings           StageTimings      `json:"stage_timings" db:"stage_timings" redis:"stage_timings" validate:"omitempty"`
+	Attempts               int               `json:"attempts" db:"attempts" redis:"attempts" validate:"omitempty"`
+	WorkerID               string            `json:"worker_id,omitempty" db:"worker_id" redis:"worker_id" validate:"omitempty"`
+	ErrorMessage           string            `json:"error_message,omitempty" db:"error_message" redis:"error_message" validate:"omitempty"`
+	CreatedAt              time.Time         `json:"created_at" db:"created_at" redis:"created_at" validate:"omitempty"`
+	StartedAt              *time.Time        `json:"started_at,omitempty" db:"started_at" redis:"started_at" validate:"omitempty"`
+	CompletedAt            *time.Time        `json:"completed_at,omitempty" db:"completed_at" redis:"completed_at" validate:"omitempty"`
+	UpdatedAt              time.Time         `json:"updated_at" db:"updated_at" redis:"updated_at" validate:"omitempty"`
+	OutputLocations        []OutputLocation  `json:"output_locations,omitempty" db:"-" redis:"-" validate:"omitempty"`
+}
+
+const (
+	// HLSManifestName and DASHManifestName are the manifests mp4dash writes into the output.
+	HLSManifestName  = "master.m3u8"
+	DASHManifestName = "stream.mpd"
+)
+
+// OutputLocation points at the manifest a player opens for one output format.
+type OutputLocation struct {
+	Format PlaybackFormat `json:"format"`
+	Bucket string         `json:"bucket"`
+	Key    string         `json:"key"`
+}
+
+// Outputs returns where the manifests of a completed job are published.
+func (j *EncodeJob) Outputs() []OutputLocation {
+	if j.Status != JobStatusCompleted || j.OutputS3Key == "" {
+		return nil
+	}
+	locations := make([]OutputLocation, 0, len(j.OutputFormats))
+	for _, format := range j.OutputFormats {
+		name := HLSManifestName
+		if format == FormatDASH {
+			name = DASHManifestName
+		}
+		locations = append(locations, OutputLocation{
+			Format: format,
+			Bucket: j.OutputBucket,
+			Key:    j.OutputS3Key + "/" + name,
+		})
+	}
+	return locations
+}
+
+// StageTiming records when a processing stage ran. CompletedAt is nil while it is running.
+type StageTiming struct {
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Seconds     float64    `json:"seconds"`
+}
+
+// StageTimings is stored as a JSONB object keyed by stage.
+type StageTimings map[JobStage]*StageTiming
+
+func (t StageTimings) Value() (driver.Value, error) {
+	if t == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (t *StageTimings) Scan(src interface{}) error {
+	return scanJSON(src, t)
+}
+
+// QualityList is stored as a JSONB array.
+type QualityList []InputQualityInfo
+
+func (l QualityList) Value() (driver.Value, error) {
+	return jsonArrayValue(l, len(l))
+}
+
+func (l *QualityList) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
+
+// FormatList is stored as a JSONB array.
+type FormatList []PlaybackFormat
+
+func (l FormatList) Value() (driver.Value, error) {
+	return jsonArrayValue(l, len(l))
+}
+
+func (l *FormatList) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
+
+func jsonArrayValue(v interface{}, n int) (driver.Value, error) {
+	if n == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+type JobFilter struct {
+	Status  JobStatus  `query:"status" validate:"omitempty,oneof=queued in_progress completed failed"`
+	VideoID string     `query:"video_id" validate:"omitempty,uuid"`
+	From    *time.Time `query:"from" validate:"omitempty"`
+	To      *time.Time `query:"to" validate:"omitempty"`
+}
+
+type JobList struct {
+	Jobs       []*EncodeJob `json:"jobs"`
+	TotalCount int          `json:"total_count"`
+	Page       int          `json:"page"`
+	PageSize   int          `json:"page_size"`
+	HasMore    bool         `json:"has_more"`
+}
+
+// JobEvent describes a change of a job's state. It is published to followers of the job and
+// sent as the data of job.* webhook events.
+type JobEvent struct {
+	JobID    string    `json:"job_id"`
+	VideoID  string    `json:"video_id"`
+	Status   JobStatus `json:"status"`
+	Stage    JobStage  `json:"stage,omitempty"`
+	Progress float64   `json:"progress"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func NewJobEvent(job *EncodeJob) JobEvent {
+	return JobEvent{
+		JobID:    job.JobID,
+		VideoID:  job.VideoID,
+		Status:   job.Status,
+		Stage:    job.Stage,
+		Progress: job.Progress,
+		Error:    job.ErrorMessage,
+	}
 }
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EncryptionMode is how the HLS output of a video is encrypted. Empty leaves it in the clear.
+type EncryptionMode string
+
+const (
+	EncryptionNone EncryptionMode = ""
+	// EncryptionAES128 encrypts whole segments with AES-128-CBC.
+	EncryptionAES128 EncryptionMode = "aes-128"
+	// EncryptionSampleAES encrypts the samples inside the segments (cbcs).
+	EncryptionSampleAES EncryptionMode = "sample-aes"
+	// EncryptionCENC is Common Encryption with the cenc scheme and ClearKey signalling, DASH only.
+	EncryptionCENC EncryptionMode = "cenc"
+	// EncryptionCBCS is Common Encryption with the cbcs scheme. The same segments play as
+	// SAMPLE-AES over HLS and with ClearKey over DASH.
+	EncryptionCBCS EncryptionMode = "cbcs"
+)
+
+// ContentKey is one key of a video. Videos using key rotation have one key per rotation
+// period, numbered from 0 by KeyIndex.
+type ContentKey struct {
+	VideoID   uuid.UUID `json:"video_id" db:"video_id"`
+	KeyIndex  int       `json:"key_index" db:"key_index"`
+	KID       string    `json:"kid" db:"kid"` // hex key ID
+	Key       []byte    `json:"-" db:"-"`
+	IV        []byte    `json:"-" db:"iv"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// ClearKeyRequest is the license request of an EME ClearKey client. KIDs are base64url.
+type ClearKeyRequest struct {
+	KIDs []string `json:"kids"`
+	Type string   `json:"type"`
+}
+
+// ClearKeyLicense answers a ClearKeyRequest with the keys as a JWK set.
+type ClearKeyLicense struct {
+	Keys []JWK  `json:"keys"`
+	Type string `json:"type"`
+}
+
+// JWK is a symmetric key, with its ID and value base64url without padding.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	K   string `json:"k"`
+}
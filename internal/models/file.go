@@ -5,19 +5,43 @@ import (
 	"time"
 )
 
+const (
+	// VideoStatusPendingUpload is a video whose upload hasn't been confirmed yet.
+	VideoStatusPendingUpload JobStatus = "pending_upload"
+	// VideoStatusUploaded is a video whose source object was verified in the input bucket.
+	VideoStatusUploaded JobStatus = "uploaded"
+)
+
 type VideoFile struct {
-	VideoID      uuid.UUID     `json:"video_id" db:"video_id" redis:"video_id" validate:"omitempty"`
-	UserID       uuid.UUID     `json:"user_id" db:"user_id" redis:"user_id" validate:"omitempty"`
-	FileName     string        `json:"file_name" db:"file_name" redis:"file_name" validate:"required,lte=255"`
-	FileSize     int64         `json:"file_size" db:"file_size" redis:"file_size" validate:"required"`
-	Duration     int64         `json:"duration" db:"duration" redis:"duration" validate:"required"`
-	S3Key        string        `json:"s3_key" db:"s3_key" redis:"s3_key" validate:"required,lte=255"`
-	Status       JobStatus     `json:"status" db:"status" redis:"status" validate:"omitempty"`
-	S3Bucket     string        `json:"s3_bucket" db:"s3_bucket" redis:"s3_bucket" validate:"required,lte=255"`
-	Format       string        `json:"format" db:"format" redis:"format" validate:"required,lte=20"`
-	UploadedAt   time.Time     `json:"uploaded_at" db:"uploaded_at" redis:"uploaded_at" validate:"omitempty"`
-	PlaybackInfo *PlaybackInfo `json:"-"`
-	UpdatedAt    time.Time     `json:"updated_at" db:"updated_at" redis:"updated_at" validate:"omitempty"`
+	VideoID                uuid.UUID      `json:"video_id" db:"video_id" redis:"video_id" validate:"omitempty"`
+	UserID                 uuid.UUID      `json:"user_id" db:"user_id" redis:"user_id" validate:"omitempty"`
+	FileName               string         `json:"file_name" db:"file_name" redis:"file_name" validate:"required,lte=255"`
+	FileSize               int64          `json:"file_size" db:"file_size" redis:"file_size" validate:"required"`
+	Duration               int64          `json:"duration" db:"duration" redis:"duration" validate:"required"`
+	S3Key                  string         `json:"s3_key" db:"s3_key" redis:"s3_key" validate:"required,lte=255"`
+	Status                 JobStatus      `json:"status" db:"status" redis:"status" validate:"omitempty"`
+	S3Bucket               string         `json:"s3_bucket" db:"s3_bucket" redis:"s3_bucket" validate:"required,lte=255"`
+	Format                 string         `json:"format" db:"format" redis:"format" validate:"required,lte=20"`
+	MimeType               string         `json:"mime_type" db:"mime_type" redis:"mime_type" validate:"omitempty,lte=127"`
+	Checksum               string         `json:"checksum,omitempty" db:"checksum" redis:"checksum" validate:"omitempty"`
+	Qualities              QualityList    `json:"qualities" db:"qualities" redis:"qualities" validate:"omitempty"`
+	OutputFormats          FormatList     `json:"output_formats" db:"output_formats" redis:"output_formats" validate:"omitempty"`
+	EnablePerTitleEncoding bool           `json:"enable_per_title_encoding" db:"enable_per_title_encoding" redis:"enable_per_title_encoding" validate:"omitempty"`
+	EncryptionMode         EncryptionMode `json:"encryption_mode,omitempty" db:"encryption_mode" redis:"encryption_mode" validate:"omitempty"`
+	KeyRotationSegments    int            `json:"key_rotation_segments,omitempty" db:"key_rotation_segments" redis:"key_rotation_segments" validate:"omitempty"`
+	ParentVideoID          string         `json:"parent_video_id,omitempty" db:"parent_video_id" redis:"parent_video_id" validate:"omitempty"` // Set on clips, empty once the parent is deleted
+	ClipRanges             ClipRangeList  `json:"clip_ranges,omitempty" db:"clip_ranges" redis:"clip_ranges" validate:"omitempty"`
+	Overlays               OverlayList    `json:"overlays,omitempty" db:"overlays" redis:"overlays" validate:"omitempty"`
+	UploadedAt             time.Time      `json:"uploaded_at" db:"uploaded_at" redis:"uploaded_at" validate:"omitempty"`
+	PlaybackInfo           *PlaybackInfo  `json:"-"`
+	UpdatedAt              time.Time      `json:"updated_at" db:"updated_at" redis:"updated_at" validate:"omitempty"`
+}
+
+// CompletedUpload is the result of confirming an upload: the verified video and the encode
+// job queued for it.
+type CompletedUpload struct {
+	Video *VideoFile `json:"video"`
+	Job   *EncodeJob `json:"job"`
 }
 
 type FilterOptions struct {
@@ -39,7 +63,14 @@ type VideoUploadInput struct {
 	FileName               string             `json:"filename" validate:"required,lte=255"`
 	FileSize               int64              `json:"file_size" validate:"required"`
 	Format                 string             `json:"format" validate:"required,lte=20"`
+	MimeType               string             `json:"mime_type" validate:"required,lte=127"`
+	Checksum               string             `json:"checksum" validate:"omitempty,len=64,hexadecimal"` // hex SHA-256 of the file
 	Qualities              []InputQualityInfo `json:"qualities" validate:"dive"`
 	OutputFormats          []PlaybackFormat   `json:"output_formats" validate:"dive"`
 	EnablePerTitleEncoding bool               `json:"enable_per_title_encoding"`
+	EncryptionMode         EncryptionMode     `json:"encryption_mode" validate:"omitempty,oneof=aes-128 sample-aes cenc cbcs"`
+	KeyRotationSegments    int                `json:"key_rotation_segments" validate:"omitempty,min=0"` // New key every N segments, 0 keeps one
+	Overlays               []Overlay          `json:"overlays" validate:"omitempty,max=8,dive"`
+	// S3Key is where a caller that stores the source itself put it, uploads/<user>/<filename> if empty
+	S3Key string `json:"-"`
 }
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// DefaultImportQueueKey is the Redis channel imports are queued on unless configured otherwise.
+const DefaultImportQueueKey = "video_imports"
+
+type ImportStatus string
+
+const (
+	ImportStatusQueued    ImportStatus = "queued"
+	ImportStatusImporting ImportStatus = "importing"
+	ImportStatusCompleted ImportStatus = "completed"
+	ImportStatusFailed    ImportStatus = "failed"
+)
+
+// ImportInput asks for a video to be fetched from an HTTP(S) or s3:// URL. The file name, format
+// and MIME type default to what the source reports.
+type ImportInput struct {
+	SourceURL              string             `json:"source_url" validate:"required,url"`
+	FileName               string             `json:"filename" validate:"omitempty,lte=255"`
+	Format                 string             `json:"format" validate:"omitempty,lte=20"`
+	MimeType               string             `json:"mime_type" validate:"omitempty,lte=127"`
+	Checksum               string             `json:"checksum" validate:"omitempty,len=64,hexadecimal"` // hex SHA-256 of the file
+	Qualities              []InputQualityInfo `json:"qualities" validate:"dive"`
+	OutputFormats          []PlaybackFormat   `json:"output_formats" validate:"dive"`
+	EnablePerTitleEncoding bool               `json:"enable_per_title_encoding"`
+}
+
+// ImportTask is a queued import. Once the source is in the input bucket the video and its
+// encode job are created and their IDs recorded here.
+type ImportTask struct {
+	ImportID  string       `json:"import_id"`
+	UserID    string       `json:"user_id"`
+	Status    ImportStatus `json:"status"`
+	Input     ImportInput  `json:"input"`
+	Size      int64        `json:"size,omitempty"` // Bytes imported so far
+	VideoID   string       `json:"video_id,omitempty"`
+	JobID     string       `json:"job_id,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Attempts  int          `json:"attempts"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type IngestStatus string
+
+const (
+	IngestStatusIngesting IngestStatus = "ingesting"
+	IngestStatusIngested  IngestStatus = "ingested"
+	IngestStatusFailed    IngestStatus = "failed"
+)
+
+// IngestItem is a source found by the ingest command together with the options to encode it
+// with. Input.SourceURL is a file://, s3:// or http(s):// URI.
+type IngestItem struct {
+	Input ImportInput
+	// Fingerprint identifies the content at the source, a changed source is ingested again.
+	Fingerprint string
+}
+
+// IngestRecord is what the ingest command stored about a source it took in.
+type IngestRecord struct {
+	Source       string       `json:"source" db:"source"`
+	Fingerprint  string       `json:"fingerprint" db:"fingerprint"`
+	UserID       uuid.UUID    `json:"user_id" db:"user_id"`
+	Status       IngestStatus `json:"status" db:"status"`
+	VideoID      string       `json:"video_id,omitempty" db:"video_id"`
+	JobID        string       `json:"job_id,omitempty" db:"job_id"`
+	ImportID     string       `json:"import_id,omitempty" db:"import_id"` // Set for HTTP sources, handed to the import queue
+	Attempts     int          `json:"attempts" db:"attempts"`
+	ErrorMessage string       `json:"error_message,omitempty" db:"error_message"`
+	ClaimedAt    time.Time    `json:"claimed_at" db:"claimed_at"`
+	IngestedAt   *time.Time   `json:"ingested_at,omitempty" db:"ingested_at"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoStatusLive is the video recording a live session that hasn't ended yet.
+const VideoStatusLive JobStatus = "live"
+
+type LiveSessionStatus string
+
+const (
+	LiveSessionLive   LiveSessionStatus = "live"
+	LiveSessionEnded  LiveSessionStatus = "ended"
+	LiveSessionFailed LiveSessionStatus = "failed"
+)
+
+// StreamKey lets an encoder publish live streams for its user. Only a hash of the key is
+// stored, the key itself is returned once when it is created.
+type StreamKey struct {
+	StreamKeyID uuid.UUID  `json:"stream_key_id" db:"stream_key_id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	Key         string     `json:"key,omitempty" db:"-"`
+	KeyHash     string     `json:"-" db:"key_hash"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+type StreamKeyInput struct {
+	Name string `json:"name" validate:"required,lte=255"`
+}
+
+// LiveSession is one publish of a stream key. Its HLS output is written under OutputKey while
+// it is live; the recording becomes the video VideoID once it ends.
+type LiveSession struct {
+	SessionID    uuid.UUID         `json:"session_id" db:"session_id"`
+	StreamKeyID  uuid.UUID         `json:"stream_key_id" db:"stream_key_id"`
+	UserID       uuid.UUID         `json:"user_id" db:"user_id"`
+	VideoID      string            `json:"video_id,omitempty" db:"video_id"` // Empty once the video is deleted
+	JobID        string            `json:"job_id,omitempty" db:"job_id"`     // Encode job of the recording
+	Status       LiveSessionStatus `json:"status" db:"status"`
+	OutputBucket string            `json:"output_bucket" db:"output_bucket"`
+	OutputKey    string            `json:"output_key" db:"output_key"`
+	ErrorMessage string            `json:"error_message,omitempty" db:"error_message"`
+	PlaybackURL  string            `json:"playback_url,omitempty" db:"-"` // Set while the session is live
+	StartedAt    time.Time         `json:"started_at" db:"started_at"`
+	UpdatedAt    time.Time         `json:"updated_at" db:"updated_at"`
+	EndedAt      *time.Time        `json:"ended_at,omitempty" db:"ended_at"`
+}
+
+type LiveSessionList struct {
+	Sessions   []*LiveSession `json:"sessions"`
+	TotalCount int            `json:"total_count"`
+	Page       int            `json:"page"`
+	PageSize   int            `json:"page_size"`
+	HasMore    bool           `json:"has_more"`
+}
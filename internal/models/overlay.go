@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type OverlayType string
+
+const (
+	OverlayImage OverlayType = "image"
+	OverlayText  OverlayType = "text"
+)
+
+type OverlayPosition string
+
+const (
+	OverlayTopLeft     OverlayPosition = "top-left"
+	OverlayTopRight    OverlayPosition = "top-right"
+	OverlayBottomLeft  OverlayPosition = "bottom-left"
+	OverlayBottomRight OverlayPosition = "bottom-right"
+	OverlayCenter      OverlayPosition = "center"
+)
+
+const (
+	// MaxOverlays is the most overlays a video can have.
+	MaxOverlays = 8
+	// MaxOverlayImageSize is the largest image an overlay can use, in bytes.
+	MaxOverlayImageSize = 10 << 20
+
+	DefaultOverlayScale    = 0.15 // Of the video's width
+	DefaultOverlayFontSize = 0.04 // Of the video's height
+	DefaultOverlayMargin   = 0.03 // Of the video's height
+	DefaultOverlayColor    = "#ffffff"
+)
+
+// Variables text overlays can use. They are filled in once when the video is encoded and every
+// viewer sees the same text, OverlayVarOwnerID is the ID of the user who owns the video.
+// OverlayVarTimestamp is the position in the video.
+const (
+	OverlayVarVideoID   = "{video_id}"
+	OverlayVarOwnerID   = "{owner_id}"
+	OverlayVarJobID     = "{job_id}"
+	OverlayVarTimestamp = "{timestamp}"
+)
+
+// Overlay is an image or text burned into the video. Sizes are relative to the video so the
+// overlay looks the same at every resolution. Start and End limit it to a part of the video,
+// an End of 0 keeps it to the end.
+type Overlay struct {
+	Type      OverlayType     `json:"type" validate:"required,oneof=image text"`
+	ImageKey  string          `json:"image_key,omitempty" validate:"required_if=Type image,omitempty,lte=1024"` // In the input bucket, under the user's uploads
+	Text      string          `json:"text,omitempty" validate:"required_if=Type text,omitempty,lte=256"`
+	FontSize  float64         `json:"font_size,omitempty" validate:"omitempty,gt=0,lte=0.5"`
+	FontColor string          `json:"font_color,omitempty" validate:"omitempty,hexcolor"`
+	Position  OverlayPosition `json:"position,omitempty" validate:"omitempty,oneof=top-left top-right bottom-left bottom-right center"`
+	Margin    float64         `json:"margin,omitempty" validate:"omitempty,min=0,lte=0.5"`
+	Scale     float64         `json:"scale,omitempty" validate:"omitempty,gt=0,lte=1"`
+	Opacity   float64         `json:"opacity,omitempty" validate:"omitempty,gt=0,lte=1"`
+	Start     float64         `json:"start,omitempty" validate:"omitempty,min=0"`
+	End       float64         `json:"end,omitempty" validate:"omitempty,gtfield=Start"`
+}
+
+// WithDefaults returns the overlay with unset options filled in.
+func (o Overlay) WithDefaults() Overlay {
+	if o.Position == "" {
+		o.Position = OverlayBottomRight
+	}
+	if o.Margin == 0 {
+		o.Margin = DefaultOverlayMargin
+	}
+	if o.Opacity == 0 {
+		o.Opacity = 1
+	}
+	switch o.Type {
+	case OverlayImage:
+		if o.Scale == 0 {
+			o.Scale = DefaultOverlayScale
+		}
+	case OverlayText:
+		if o.FontSize == 0 {
+			o.FontSize = DefaultOverlayFontSize
+		}
+		if o.FontColor == "" {
+			o.FontColor = DefaultOverlayColor
+		}
+	}
+	return o
+}
+
+// OverlayList is stored as a JSONB array, later overlays are drawn over earlier ones.
+type OverlayList []Overlay
+
+func (l OverlayList) Value() (driver.Value, error) {
+	return jsonArrayValue(l, len(l))
+}
+
+func (l *OverlayList) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
+
+// overlayImageTypes are the image formats overlays can use.
+var overlayImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+}
+
+// IsOverlayImageType reports whether an overlay can use an image of the MIME type.
+func IsOverlayImageType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return overlayImageTypes[strings.ToLower(strings.TrimSpace(mediaType))]
+}
+
+// CheckOwner rejects overlay images the user can't use, only their own uploads can be.
+func (l OverlayList) CheckOwner(userID string) error {
+	if len(l) > MaxOverlays {
+		return fmt.Errorf("at most %d overlays are allowed", MaxOverlays)
+	}
+	prefix := fmt.Sprintf("uploads/%s/", userID)
+	for i, overlay := range l {
+		if overlay.Type != OverlayImage {
+			continue
+		}
+		if !strings.HasPrefix(overlay.ImageKey, prefix) || strings.Contains(overlay.ImageKey, "..") {
+			return fmt.Errorf("overlay %d: image must be one of your uploads", i)
+		}
+	}
+	return nil
+}
+
+// Clip returns the overlays on the timeline of a clip cut from the video with ranges. An
+// overlay limited to a part of the video shows wherever that part ends up in the clip, which
+// can take one overlay per range; overlays on parts left out of the clip are dropped.
+func (l OverlayList) Clip(ranges ClipRangeList) OverlayList {
+	var clipped OverlayList
+	for _, overlay := range l {
+		if overlay.Start == 0 && overlay.End == 0 {
+			clipped = append(clipped, overlay)
+			continue
+		}
+		end := overlay.End
+		if end == 0 {
+			end = math.Inf(1)
+		}
+		first := len(clipped)
+		var offset float64
+		for _, r := range ranges {
+			start, stop := math.Max(overlay.Start, r.Start), math.Min(end, r.End)
+			if start < stop {
+				piece := overlay
+				piece.Start, piece.End = offset+start-r.Start, offset+stop-r.Start
+				if last := len(clipped) - 1; last >= first && clipped[last].End == piece.Start {
+					// Joined ranges that were contiguous in the video
+					clipped[last].End = piece.End
+				} else {
+					clipped = append(clipped, piece)
+				}
+			}
+			offset += r.Duration()
+		}
+	}
+	return clipped
+}
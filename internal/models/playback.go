@@ -1,5 +1,12 @@
 package models
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"time"
+)
+
 type PlaybackFormat string
 
 const (
@@ -34,15 +41,51 @@ type QualityInfo struct {
 	Bitrate    int          `json:"bitrate"`
 }
 
+// QualityMap is stored as a JSONB object keyed by quality.
+type QualityMap map[VideoQuality]QualityInfo
+
+func (m QualityMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (m *QualityMap) Scan(src interface{}) error {
+	return scanJSON(src, m)
+}
+
+// StringList is passed to and read from the database as a JSON array.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	return jsonArrayValue(l, len(l))
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
+
+// PlaybackInfo describes the published output of a video. The worker stores the thumbnail and
+// manifest URLs as object keys of the output; they are turned into playback URLs valid until
+// ExpiresAt when the info is read.
 type PlaybackInfo struct {
-	VideoID   string                       `json:"video_id" db:"video_id" validate:"required"`
-	Title     string                       `json:"title" db:"title" validate:"required,lte=255"`
-	Duration  float64                      `json:"duration" db:"duration" validate:"omitempty"`
-	Thumbnail string                       `json:"thumbnail" db:"thumbnail" validate:"omitempty"`
-	Qualities map[VideoQuality]QualityInfo `json:"qualities" db:"qualities" validate:"omitempty"`
-	Subtitles []string                     `json:"subtitles" db:"subtitles" validate:"omitempty"`
-	Format    PlaybackFormat               `json:"format" db:"format" validate:"omitempty"`
-	Status    JobStatus                    `json:"status" db:"status" validate:"omitempty"`
+	VideoID      string         `json:"video_id" db:"video_id" validate:"required"`
+	Title        string         `json:"title" db:"title" validate:"required,lte=255"`
+	Duration     float64        `json:"duration" db:"duration" validate:"omitempty"`
+	Thumbnail    string         `json:"thumbnail" db:"thumbnail" validate:"omitempty"`
+	Qualities    QualityMap     `json:"qualities" db:"qualities" validate:"omitempty"`
+	Subtitles    StringList     `json:"subtitles" db:"subtitles" validate:"omitempty"`
+	Format       PlaybackFormat `json:"format" db:"format" validate:"omitempty"`
+	Status       JobStatus      `json:"status" db:"status" validate:"omitempty"`
+	ErrorMessage string         `json:"error_message,omitempty" db:"error_message" validate:"omitempty"`
+	ExpiresAt    *time.Time     `json:"expires_at,omitempty" db:"-" validate:"omitempty"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at" validate:"omitempty"`
+	UpdatedAt    time.Time      `json:"updated_at" db:"updated_at" validate:"omitempty"`
 }
 
 func (p *PlaybackInfo) GetPlaybackURL(format PlaybackFormat, quality VideoQuality) string {
@@ -56,3 +99,40 @@ func (p *PlaybackInfo) GetPlaybackURL(format PlaybackFormat, quality VideoQualit
 	}
 	return ""
 }
+
+const (
+	// PlaybackSegmentsProxy streams segments through the server behind the playback token.
+	PlaybackSegmentsProxy = "proxy"
+	// PlaybackSegmentsPresign points players at presigned GetObject URLs of the segments.
+	PlaybackSegmentsPresign = "presign"
+)
+
+// PlaybackTokenInput asks for a playback token. BindIP ties the token to the requesting
+// address and Referrer to the origin of the page embedding the player.
+type PlaybackTokenInput struct {
+	Format     PlaybackFormat `json:"format" validate:"omitempty,oneof=hls dash"`
+	TTLSeconds int            `json:"ttl_seconds" validate:"omitempty,min=1"`
+	BindIP     bool           `json:"bind_ip"`
+	Referrer   string         `json:"referrer" validate:"omitempty,url"`
+}
+
+type PlaybackToken struct {
+	Token       string         `json:"token"`
+	Format      PlaybackFormat `json:"format"`
+	ManifestURL string         `json:"manifest_url"`
+	ExpiresAt   time.Time      `json:"expires_at"`
+}
+
+// PlaybackViewer is who a playback request comes from, checked against the token bindings.
+type PlaybackViewer struct {
+	IP      string
+	Referer string
+}
+
+// PlaybackObject is the answer to a playback request: a redirect to Location, or Body.
+type PlaybackObject struct {
+	Location      string
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookEvent string
+
+const (
+	EventVideoUploaded WebhookEvent = "video.uploaded"
+	EventJobStarted    WebhookEvent = "job.started"
+	EventJobProgress   WebhookEvent = "job.progress"
+	EventJobCompleted  WebhookEvent = "job.completed"
+	EventJobFailed     WebhookEvent = "job.failed"
+	EventWebhookTest   WebhookEvent = "webhook.test"
+)
+
+// WebhookEvents lists the events a user can subscribe to.
+var WebhookEvents = []WebhookEvent{
+	EventVideoUploaded,
+	EventJobStarted,
+	EventJobProgress,
+	EventJobCompleted,
+	EventJobFailed,
+}
+
+func (e WebhookEvent) Valid() bool {
+	for _, event := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	DeliveryStatusSucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryStatusFailed    WebhookDeliveryStatus = "failed"
+)
+
+// EventList is stored as a JSONB array. An empty list subscribes to every event.
+type EventList []WebhookEvent
+
+func (l EventList) Value() (driver.Value, error) {
+	if l == nil {
+		l = EventList{}
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (l *EventList) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
+
+// RawJSON holds a JSONB column as-is and marshals it back without re-encoding.
+type RawJSON json.RawMessage
+
+func (r RawJSON) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return "null", nil
+	}
+	return string(r), nil
+}
+
+func (r *RawJSON) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		*r = append((*r)[:0], v...)
+	case string:
+		*r = RawJSON(v)
+	case nil:
+		*r = nil
+	default:
+		return fmt.Errorf("cannot scan %T into RawJSON", src)
+	}
+	return nil
+}
+
+func (r RawJSON) MarshalJSON() ([]byte, error) {
+	if len(r) == 0 {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+func scanJSON(src interface{}, dest interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T as JSON", src)
+	}
+}
+
+type Webhook struct {
+	WebhookID uuid.UUID `json:"webhook_id" db:"webhook_id" validate:"omitempty"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id" validate:"omitempty"`
+	URL       string    `json:"url" db:"url" validate:"required,url,lte=2048"`
+	Secret    string    `json:"secret,omitempty" db:"secret" validate:"omitempty"`
+	Events    EventList `json:"events" db:"events" validate:"omitempty"`
+	Active    bool      `json:"active" db:"active" validate:"omitempty"`
+	CreatedAt time.Time `json:"created_at" db:"created_at" validate:"omitempty"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at" validate:"omitempty"`
+}
+
+type WebhookInput struct {
+	URL    string         `json:"url" validate:"required,url,lte=2048"`
+	Events []WebhookEvent `json:"events" validate:"omitempty"`
+}
+
+type WebhookDelivery struct {
+	DeliveryID     uuid.UUID             `json:"delivery_id" db:"delivery_id"`
+	WebhookID      uuid.UUID             `json:"webhook_id" db:"webhook_id"`
+	Event          WebhookEvent          `json:"event" db:"event"`
+	Payload        RawJSON               `json:"payload" db:"payload"`
+	Status         WebhookDeliveryStatus `json:"status" db:"status"`
+	Attempts       int                   `json:"attempts" db:"attempts"`
+	ResponseStatus int                   `json:"response_status" db:"response_status"`
+	ErrorMessage   string                `json:"error_message" db:"error_message"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at" db:"next_attempt_at"`
+	CreatedAt      time.Time             `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time            `json:"delivered_at" db:"delivered_at"`
+}
+
+type WebhookDeliveryList struct {
+	Deliveries []*WebhookDelivery `json:"deliveries"`
+	TotalCount int                `json:"total_count"`
+	Page       int                `json:"page"`
+	PageSize   int                `json:"page_size"`
+	HasMore    bool               `json:"has_more"`
+}
+
+// WebhookPayload is the body posted to webhook endpoints.
+type WebhookPayload struct {
+	ID        uuid.UUID    `json:"id"`
+	Event     WebhookEvent `json:"event"`
+	CreatedAt time.Time    `json:"created_at"`
+	Data      interface{}  `json:"data"`
+}
@@ -4,12 +4,28 @@ import (
 	authHttp "github.com/amankumarsingh77/cloud-video-encoder/internal/auth/delivery/http"
 	authRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/auth/repository"
 	authUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/auth/usecase"
+	drmHttp "github.com/amankumarsingh77/cloud-video-encoder/internal/drm/delivery/http"
+	drmRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/drm/repository"
+	drmUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/drm/usecase"
+	jobHttp "github.com/amankumarsingh77/cloud-video-encoder/internal/jobs/delivery/http"
+	jobRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/jobs/repository"
+	jobUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/jobs/usecase"
+	liveHttp "github.com/amankumarsingh77/cloud-video-encoder/internal/live/delivery/http"
+	liveRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/live/repository"
+	liveUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/live/usecase"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/middleware"
 	sessionRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/session/repository"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/session/usecase"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
 	videoHttp "github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles/delivery/http"
 	videoRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles/repository"
 	videoUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles/usecase"
+	webhookHttp "github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks/delivery/http"
+	webhookRepository "github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks/repository"
+	webhookUsecase "github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks/usecase"
+	healthcheck "github.com/amankumarsingh77/cloud-video-encoder/pkg/health"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/localstore"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/metrics"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
 	"github.com/labstack/echo/v4"
 	"net/http"
@@ -18,29 +34,79 @@ import (
 func (s *Server) MapHandlers(e *echo.Echo) error {
 	aRepo := authRepository.NewAuthRepo(s.db)
 	nRepo := videoRepository.NewVideoRepo(s.db)
-	vAWSRepo := videoRepository.NewAwsRepository(s.s3Client, s.preSignClient)
+	vAWSRepo, err := videoRepository.NewStorageRepository(s.cfg, s.s3Client, s.preSignClient)
+	if err != nil {
+		return err
+	}
 	vRedisRepo := videoRepository.NewVideoRedisRepo(s.redisClient)
 	sRepo := sessionRepository.NewSessionRepository(s.redisClient, s.cfg)
+	wRepo := webhookRepository.NewWebhookRepo(s.db)
+	jRepo := jobRepository.NewJobRepo(s.db)
+	jRedisRepo := jobRepository.NewJobRedisRepo(s.redisClient)
+	lRepo := liveRepository.NewLiveRepo(s.db)
+	dRepo, err := drmRepository.NewDrmRepo(s.cfg, s.db)
+	if err != nil {
+		return err
+	}
+
+	s.webhookDispatcher = webhookUsecase.NewWebhookDispatcher(s.cfg, wRepo, s.logger)
+	s.uploadJanitor = videoUsecase.NewUploadJanitor(s.cfg, nRepo, vRedisRepo, vAWSRepo, s.logger)
 
 	authUC := authUsecase.NewAuthUseCase(s.cfg, aRepo, s.logger)
-	videoUC := videoUsecase.NewVideoUseCase(s.cfg, nRepo, vRedisRepo, vAWSRepo, s.logger)
+	videoUC := videoUsecase.NewVideoUseCase(s.cfg, nRepo, vRedisRepo, vAWSRepo, jRepo, s.webhookDispatcher, s.logger)
+	webhookUC := webhookUsecase.NewWebhookUseCase(s.cfg, wRepo, s.webhookDispatcher, s.logger)
+	jobUC := jobUsecase.NewJobUseCase(s.cfg, jRepo, jRedisRepo, s.logger)
 	sessUC := usecase.NewSessionUseCase(sRepo, s.cfg)
+	drmUC := drmUsecase.NewDrmUseCase(s.cfg, dRepo, nRepo, s.logger)
+	liveUC := liveUsecase.NewLiveUseCase(s.cfg, lRepo, aRepo, videoUC, vAWSRepo, s.logger)
 
 	authHandlers := authHttp.NewAuthHandler(s.cfg, authUC, sessUC, s.logger)
 	videoHandlers := videoHttp.NewVideoHandler(videoUC)
+	webhookHandlers := webhookHttp.NewWebhookHandler(webhookUC)
+	jobHandlers := jobHttp.NewJobHandler(jobUC)
+	drmHandlers := drmHttp.NewDrmHandler(drmUC)
+	liveHandlers := liveHttp.NewLiveHandler(liveUC)
 
 	mw := middleware.NewMiddlewareManager(authUC, s.cfg, []string{"*"}, sessUC, s.logger)
+	e.Use(mw.MetricsMiddleware)
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
 
 	v1 := e.Group("/api/v1")
 	health := v1.Group("/health")
 	authGroup := v1.Group("/auth")
 	videoGroup := v1.Group("/video")
+	webhookGroup := v1.Group("/webhooks")
+	jobGroup := v1.Group("/jobs")
+	keyGroup := v1.Group("/keys")
+	liveGroup := v1.Group("/live")
 
 	authHttp.MapAuthRoutes(authGroup, authHandlers, mw, authUC, s.cfg)
 	videoHttp.MapVideoRoutes(videoGroup, videoHandlers, mw)
+	videoHttp.MapPlaybackRoutes(e.Group(videofiles.PlaybackRoutePrefix), videoHandlers)
+	webhookHttp.MapWebhookRoutes(webhookGroup, webhookHandlers, mw)
+	jobHttp.MapJobRoutes(jobGroup, jobHandlers, mw)
+	drmHttp.MapDrmRoutes(keyGroup, drmHandlers, mw)
+	liveHttp.MapLiveRoutes(liveGroup, liveHandlers, mw)
+
+	checker := healthcheck.NewChecker(0)
+	checker.Add("postgres", healthcheck.Postgres(s.db))
+	checker.Add("redis", healthcheck.Redis(s.redisClient))
+	if s.cfg.Storage.Backend == videoRepository.StorageBackendLocal {
+		// Signed URLs carry their own authorization, the routes are public
+		store, signer, err := videoRepository.NewLocalStore(s.cfg)
+		if err != nil {
+			return err
+		}
+		localstore.NewHandler(store, signer).MapRoutes(e.Group(localstore.RoutePrefix))
+		checker.Add("storage", healthcheck.DiskSpace(store.Root(), 0))
+	} else {
+		checker.Add("s3", healthcheck.S3Buckets(s.s3Client, s.cfg.S3.InputBucket, s.cfg.S3.OutputBucket))
+	}
 	health.GET("", func(c echo.Context) error {
 		s.logger.Infof("Health check RequestID: %s", utils.GetRequestID(c))
 		return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
 	})
+	health.GET("/live", echo.WrapHandler(checker.LiveHandler()))
+	health.GET("/ready", echo.WrapHandler(checker.ReadyHandler()))
 	return nil
 }
@@ -3,7 +3,10 @@ package server
 import (
 	"context"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
@@ -28,11 +31,22 @@ type Server struct {
 	s3Client      *s3.Client
 	preSignClient *s3.PresignClient
 	logger        logger.Logger
+
+	webhookDispatcher webhooks.Dispatcher
+	uploadJanitor     videofiles.UploadJanitor
 }
 
 func NewServer(cfg *config.Config, db *sqlx.DB, redisClient *redis.Client, s3Client *s3.Client, preSignClient *s3.PresignClient, logger logger.Logger) *Server {
+	e := echo.New()
+	// Playback tokens and keys can be bound to the client IP, so it must not come from headers
+	// a client can forge
+	ipExtractor, err := utils.NewIPExtractor(cfg.Server.TrustedProxies)
+	if err != nil {
+		logger.Fatalf("Invalid server config: %v", err)
+	}
+	e.IPExtractor = ipExtractor
 	return &Server{
-		echo:          echo.New(),
+		echo:          e,
 		cfg:           cfg,
 		db:            db,
 		redisClient:   redisClient,
@@ -44,8 +58,16 @@ func NewServer(cfg *config.Config, db *sqlx.DB, redisClient *redis.Client, s3Cli
 
 func (s *Server) Run() error {
 	if err := s.MapHandlers(s.echo); err != nil {
-		return nil
+		return err
 	}
+
+	// Deliver queued and retried webhook events and clean up abandoned uploads for as long as
+	// the server runs
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go s.webhookDispatcher.Run(backgroundCtx)
+	go s.uploadJanitor.Run(backgroundCtx)
+
 	s.echo.Server.MaxHeaderBytes = maxHeaderBytes
 	s.echo.Server.ReadTimeout = time.Second * s.echo.Server.ReadTimeout
 	server := &http.Server{
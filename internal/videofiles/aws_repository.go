@@ -4,12 +4,37 @@ import (
 	"context"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"time"
 )
 
 type AWSRepository interface {
 	GetPresignedURL(ctx context.Context, input *models.UploadInput) (string, error)
 	PutObject(ctx context.Context, input models.UploadInput) (*s3.PutObjectOutput, error)
+	// PresignGetObject presigns the GET of an object for expires.
+	PresignGetObject(ctx context.Context, bucket, key string, expires time.Duration) (string, error)
 	GetObject(ctx context.Context, bucket, filename string) (*s3.GetObjectOutput, error)
 	ListObjects(ctx context.Context, bucket string) ([]string, error)
+	ListObjectsWithPrefix(ctx context.Context, bucket, prefix string) ([]models.ObjectInfo, error)
 	RemoveObject(ctx context.Context, bucket, filename string) error
+	HeadObject(ctx context.Context, bucket, key string) (*s3.HeadObjectOutput, error)
+	// DownloadFile fetches the object into localPath with parallel ranged requests. A partial
+	// download of the same object version left at localPath is resumed.
+	DownloadFile(ctx context.Context, bucket, key, localPath string) (int64, error)
+	// UploadFile sends localPath to the bucket, as a multipart upload when the file is large.
+	// A non-empty checksum (hex SHA-256 of the file) is verified by S3 and kept in the object
+	// metadata under models.ChecksumMetadataKey.
+	UploadFile(ctx context.Context, bucket, key, localPath, contentType, checksum string) (int64, error)
+
+	// CreateMultipartUpload starts a multipart upload for a client and returns its upload ID.
+	// With checksummed set every part has to be sent with its SHA-256.
+	CreateMultipartUpload(ctx context.Context, bucket, key, contentType string, checksummed bool) (string, error)
+	// PresignUploadPart presigns the PUT of one part. A non-empty checksum (hex SHA-256 of the
+	// part) is signed into the URL.
+	PresignUploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, checksum string) (*models.PartURL, error)
+	// UploadPart sends one part of a multipart upload from memory.
+	UploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, data []byte) (*models.UploadedPart, error)
+	ListParts(ctx context.Context, bucket, key, uploadID string) ([]models.UploadedPart, error)
+	CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []models.UploadedPart) error
+	AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error
+	ListMultipartUploads(ctx context.Context, bucket, prefix string) ([]models.PendingUpload, error)
 }
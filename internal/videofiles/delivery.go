@@ -5,10 +5,27 @@ import "github.com/labstack/echo/v4"
 type Handler interface {
 	GetPresignUpload() echo.HandlerFunc
 	UploadVideo() echo.HandlerFunc
+	CompleteUpload() echo.HandlerFunc
+	StartMultipartUpload() echo.HandlerFunc
+	GetUploadPartURL() echo.HandlerFunc
+	ListUploadParts() echo.HandlerFunc
+	CompleteMultipartUpload() echo.HandlerFunc
+	AbortMultipartUpload() echo.HandlerFunc
+	TusOptions() echo.HandlerFunc
+	TusCreate() echo.HandlerFunc
+	TusHead() echo.HandlerFunc
+	TusPatch() echo.HandlerFunc
+	TusDelete() echo.HandlerFunc
+	ImportVideo() echo.HandlerFunc
+	GetImport() echo.HandlerFunc
+	CreateClip() echo.HandlerFunc
+	ComposeVideos() echo.HandlerFunc
 	ListVideos() echo.HandlerFunc
 	GetVideoByID() echo.HandlerFunc
 	DeleteVideo() echo.HandlerFunc
 	GetPlaybackInfo() echo.HandlerFunc
+	CreatePlaybackToken() echo.HandlerFunc
+	Playback() echo.HandlerFunc
 	SearchVideos() echo.HandlerFunc
 	UpdateVideo() echo.HandlerFunc
 
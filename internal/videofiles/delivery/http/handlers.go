@@ -1,12 +1,14 @@
 package http
 
 import (
+	"errors"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"net/http"
+	"strconv"
 )
 
 type videoHandler struct {
@@ -47,6 +49,158 @@ func (h *videoHandler) UploadVideo() echo.HandlerFunc {
 	}
 }
 
+func (h *videoHandler) CompleteUpload() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		videoID, err := uuid.Parse(c.Param("video_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid video id"})
+		}
+		completed, err := h.videoUC.CompleteUpload(c.Request().Context(), videoID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, completed)
+	}
+}
+
+func (h *videoHandler) StartMultipartUpload() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		videoID, err := uuid.Parse(c.Param("video_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid video id"})
+		}
+		upload, err := h.videoUC.StartMultipartUpload(c.Request().Context(), videoID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusCreated, upload)
+	}
+}
+
+// GetUploadPartURL presigns the upload of one part. The optional checksum query parameter is
+// the hex SHA-256 of the part, required if the video was declared with a checksum.
+func (h *videoHandler) GetUploadPartURL() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		videoID, err := uuid.Parse(c.Param("video_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid video id"})
+		}
+		partNumber, err := strconv.ParseInt(c.Param("part_number"), 10, 32)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid part number"})
+		}
+		url, err := h.videoUC.GetUploadPartURL(c.Request().Context(), videoID, c.Param("upload_id"), int32(partNumber), c.QueryParam("checksum"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, url)
+	}
+}
+
+func (h *videoHandler) ListUploadParts() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		videoID, err := uuid.Parse(c.Param("video_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid video id"})
+		}
+		parts, err := h.videoUC.ListUploadParts(c.Request().Context(), videoID, c.Param("upload_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, parts)
+	}
+}
+
+func (h *videoHandler) CompleteMultipartUpload() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		videoID, err := uuid.Parse(c.Param("video_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid video id"})
+		}
+		input := &models.CompleteMultipartInput{}
+		if err = c.Bind(input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		}
+		completed, err := h.videoUC.CompleteMultipartUpload(c.Request().Context(), videoID, c.Param("upload_id"), input)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, completed)
+	}
+}
+
+func (h *videoHandler) AbortMultipartUpload() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		videoID, err := uuid.Parse(c.Param("video_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid video id"})
+		}
+		if err = h.videoUC.AbortMultipartUpload(c.Request().Context(), videoID, c.Param("upload_id")); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "Upload aborted successfully"})
+	}
+}
+
+func (h *videoHandler) ImportVideo() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		input := &models.ImportInput{}
+		if err := c.Bind(input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		}
+		task, err := h.videoUC.ImportVideo(c.Request().Context(), input)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusAccepted, task)
+	}
+}
+
+func (h *videoHandler) CreateClip() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		videoID, err := uuid.Parse(c.Param("video_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid video id"})
+		}
+		input := &models.ClipInput{}
+		if err = c.Bind(input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		}
+		clip, err := h.videoUC.CreateClip(c.Request().Context(), videoID, input)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusAccepted, clip)
+	}
+}
+
+func (h *videoHandler) ComposeVideos() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		input := &models.ComposeInput{}
+		if err := c.Bind(input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		}
+		composed, err := h.videoUC.ComposeVideos(c.Request().Context(), input)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusAccepted, composed)
+	}
+}
+
+func (h *videoHandler) GetImport() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		task, err := h.videoUC.GetImport(c.Request().Context(), c.Param("import_id"))
+		if err != nil {
+			if errors.Is(err, videofiles.ErrImportNotFound) {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+			}
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, task)
+	}
+}
+
 func (h *videoHandler) GetVideoByID() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		videoID, err := uuid.Parse(c.Param("video_id"))
@@ -130,6 +284,9 @@ func (h *videoHandler) GetPlaybackInfo() echo.HandlerFunc {
 		}
 		playbackInfo, err := h.videoUC.GetPlaybackInfo(c.Request().Context(), videoID)
 		if err != nil {
+			if errors.Is(err, videofiles.ErrPlaybackNotReady) {
+				return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+			}
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 		}
 		return c.JSON(http.StatusOK, playbackInfo)
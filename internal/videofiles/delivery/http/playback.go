@@ -0,0 +1,74 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func (h *videoHandler) CreatePlaybackToken() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		videoID, err := uuid.Parse(c.Param("video_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid video id"})
+		}
+		input := &models.PlaybackTokenInput{}
+		if err = c.Bind(input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		}
+		token, err := h.videoUC.CreatePlaybackToken(c.Request().Context(), videoID, input, c.RealIP())
+		if err != nil {
+			if errors.Is(err, videofiles.ErrPlaybackNotReady) {
+				return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+			}
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusCreated, token)
+	}
+}
+
+// Playback serves PlaybackRoutePrefix/<token>/<path>. The path is taken from the decoded URL
+// so that escaped segment names reach storage as they were written.
+func (h *videoHandler) Playback() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		rest := strings.TrimPrefix(c.Request().URL.Path, videofiles.PlaybackRoutePrefix+"/")
+		token, objectPath, _ := strings.Cut(rest, "/")
+		viewer := &models.PlaybackViewer{IP: c.RealIP(), Referer: c.Request().Referer()}
+
+		object, err := h.videoUC.GetPlaybackObject(c.Request().Context(), token, objectPath, viewer)
+		if err != nil {
+			switch {
+			case errors.Is(err, videofiles.ErrPlaybackTokenInvalid):
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			case errors.Is(err, videofiles.ErrPlaybackForbidden):
+				return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+			case errors.Is(err, videofiles.ErrPlaybackNotFound):
+				return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		header := c.Response().Header()
+		// Players are usually embedded in other origins; the token is what grants access
+		header.Set("Access-Control-Allow-Origin", "*")
+		// Manifests and redirects carry the token or a presigned URL and must not be shared
+		header.Set("Cache-Control", "private, no-store")
+		if object.Location != "" {
+			return c.Redirect(http.StatusFound, object.Location)
+		}
+		defer object.Body.Close()
+		if object.ContentLength >= 0 {
+			header.Set(echo.HeaderContentLength, strconv.FormatInt(object.ContentLength, 10))
+		}
+		if object.ContentType == "" {
+			object.ContentType = echo.MIMEOctetStream
+		}
+		return c.Stream(http.StatusOK, object.ContentType, object.Body)
+	}
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// fakePlaybackUC serves objects to viewers from the IP the token is bound to.
+type fakePlaybackUC struct {
+	videofiles.UseCase
+	boundIP string
+}
+
+func (u *fakePlaybackUC) GetPlaybackObject(_ context.Context, _, _ string, viewer *models.PlaybackViewer) (*models.PlaybackObject, error) {
+	if viewer.IP != u.boundIP {
+		return nil, videofiles.ErrPlaybackForbidden
+	}
+	return &models.PlaybackObject{Body: io.NopCloser(strings.NewReader("segment")), ContentLength: 7}, nil
+}
+
+func TestPlaybackIPBinding(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		peer    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "bound viewer", peer: "203.0.113.7:4000", want: http.StatusOK},
+		{name: "other viewer", peer: "198.51.100.1:4000", want: http.StatusForbidden},
+		{name: "forged X-Forwarded-For", peer: "198.51.100.1:4000",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.7"}, want: http.StatusForbidden},
+		{name: "forged X-Real-IP", peer: "198.51.100.1:4000",
+			headers: map[string]string{"X-Real-IP": "203.0.113.7"}, want: http.StatusForbidden},
+		{name: "behind a trusted proxy", proxies: []string{"10.0.0.0/8"}, peer: "10.0.0.2:4000",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.7"}, want: http.StatusOK},
+		{name: "forged hop behind a trusted proxy", proxies: []string{"10.0.0.0/8"}, peer: "10.0.0.2:4000",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.7, 198.51.100.1"}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			extract, err := utils.NewIPExtractor(tt.proxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.IPExtractor = extract
+			MapPlaybackRoutes(e.Group(videofiles.PlaybackRoutePrefix), NewVideoHandler(&fakePlaybackUC{boundIP: "203.0.113.7"}))
+
+			req := httptest.NewRequest(http.MethodGet, videofiles.PlaybackRoutePrefix+"/tok/video/seg-1.m4s", nil)
+			req.RemoteAddr = tt.peer
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -10,10 +10,32 @@ func MapVideoRoutes(videoGroup *echo.Group, h videofiles.Handler, mw *middleware
 	videoGroup.Use(mw.AuthSessionMiddleware)
 	videoGroup.POST("/get-upload-url", h.GetPresignUpload())
 	videoGroup.POST("/upload", h.UploadVideo())
+	videoGroup.POST("/:video_id/complete-upload", h.CompleteUpload())
+	videoGroup.POST("/:video_id/multipart", h.StartMultipartUpload())
+	videoGroup.GET("/:video_id/multipart/:upload_id/parts", h.ListUploadParts())
+	videoGroup.GET("/:video_id/multipart/:upload_id/parts/:part_number", h.GetUploadPartURL())
+	videoGroup.POST("/:video_id/multipart/:upload_id/complete", h.CompleteMultipartUpload())
+	videoGroup.DELETE("/:video_id/multipart/:upload_id", h.AbortMultipartUpload())
+	videoGroup.OPTIONS("/tus", h.TusOptions())
+	videoGroup.POST("/tus", h.TusCreate())
+	videoGroup.HEAD("/tus/:upload_id", h.TusHead())
+	videoGroup.PATCH("/tus/:upload_id", h.TusPatch())
+	videoGroup.DELETE("/tus/:upload_id", h.TusDelete())
+	videoGroup.POST("/import", h.ImportVideo())
+	videoGroup.GET("/import/:import_id", h.GetImport())
+	videoGroup.POST("/:video_id/clips", h.CreateClip())
+	videoGroup.POST("/compose", h.ComposeVideos())
 	videoGroup.GET("/:video_id", h.GetVideoByID())
 	videoGroup.GET("/list-videos", h.ListVideos())
 	videoGroup.GET("/search", h.SearchVideos())
 	videoGroup.DELETE("/:video_id", h.DeleteVideo())
 	videoGroup.PUT("/:video_id", h.UpdateVideo())
 	videoGroup.GET("/:video_id/playback-info", h.GetPlaybackInfo())
+	videoGroup.POST("/:video_id/playback-token", h.CreatePlaybackToken())
+}
+
+// MapPlaybackRoutes maps the tokenized playback routes. The token in the path authorizes them,
+// so they go without the session middleware.
+func MapPlaybackRoutes(playbackGroup *echo.Group, h videofiles.Handler) {
+	playbackGroup.GET("/:token/*", h.Playback())
 }
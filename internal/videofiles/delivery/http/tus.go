@@ -0,0 +1,148 @@
+package http
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	tusVersion          = "1.0.0"
+	tusExtensions       = "creation,termination"
+	tusChunkContentType = "application/offset+octet-stream"
+)
+
+func (h *videoHandler) TusOptions() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Response().Header()
+		header.Set("Tus-Resumable", tusVersion)
+		header.Set("Tus-Version", tusVersion)
+		header.Set("Tus-Extension", tusExtensions)
+		header.Set("Tus-Max-Size", strconv.FormatInt(videofiles.MaxTusUploadSize, 10))
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (h *videoHandler) TusCreate() echo.HandlerFunc {
+	return tusHandler(func(c echo.Context) error {
+		length, err := strconv.ParseInt(c.Request().Header.Get("Upload-Length"), 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid Upload-Length"})
+		}
+		metadata, err := parseTusMetadata(c.Request().Header.Get("Upload-Metadata"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid Upload-Metadata"})
+		}
+		upload, err := h.videoUC.CreateTusUpload(c.Request().Context(), &models.TusUploadInput{
+			Length:   length,
+			Metadata: metadata,
+		})
+		if err != nil {
+			return tusError(c, err)
+		}
+		c.Response().Header().Set("Location", strings.TrimSuffix(c.Request().URL.Path, "/")+"/"+upload.ID)
+		c.Response().Header().Set("Upload-Offset", "0")
+		return c.NoContent(http.StatusCreated)
+	})
+}
+
+func (h *videoHandler) TusHead() echo.HandlerFunc {
+	return tusHandler(func(c echo.Context) error {
+		upload, err := h.videoUC.GetTusUpload(c.Request().Context(), c.Param("upload_id"))
+		if err != nil {
+			return tusError(c, err)
+		}
+		header := c.Response().Header()
+		header.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		header.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		header.Set("Cache-Control", "no-store")
+		return c.NoContent(http.StatusOK)
+	})
+}
+
+func (h *videoHandler) TusPatch() echo.HandlerFunc {
+	return tusHandler(func(c echo.Context) error {
+		if c.Request().Header.Get("Content-Type") != tusChunkContentType {
+			return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": "Content-Type must be " + tusChunkContentType})
+		}
+		offset, err := strconv.ParseInt(c.Request().Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid Upload-Offset"})
+		}
+		upload, err := h.videoUC.WriteTusChunk(c.Request().Context(), c.Param("upload_id"), offset, c.Request().Body)
+		if upload != nil && upload.VideoID != "" {
+			// Also when queueing the finished upload failed, complete-upload needs the video
+			c.Response().Header().Set("X-Video-Id", upload.VideoID)
+		}
+		if err != nil {
+			return tusError(c, err)
+		}
+		c.Response().Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+func (h *videoHandler) TusDelete() echo.HandlerFunc {
+	return tusHandler(func(c echo.Context) error {
+		if err := h.videoUC.TerminateTusUpload(c.Request().Context(), c.Param("upload_id")); err != nil {
+			return tusError(c, err)
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// tusHandler rejects clients that don't speak our tus version and marks every response with it.
+func tusHandler(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Tus-Resumable", tusVersion)
+		if c.Request().Header.Get("Tus-Resumable") != tusVersion {
+			c.Response().Header().Set("Tus-Version", tusVersion)
+			return c.NoContent(http.StatusPreconditionFailed)
+		}
+		return next(c)
+	}
+}
+
+func tusError(c echo.Context, err error) error {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, videofiles.ErrUploadNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, videofiles.ErrUploadOffsetMismatch):
+		status = http.StatusConflict
+	case errors.Is(err, videofiles.ErrUploadLocked):
+		status = http.StatusLocked
+	case errors.Is(err, videofiles.ErrUploadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	}
+	return c.JSON(status, map[string]string{"error": err.Error()})
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated "key base64value" pairs.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, errors.New("malformed metadata pair")
+		}
+	}
+	return metadata, nil
+}
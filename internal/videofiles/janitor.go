@@ -0,0 +1,8 @@
+package videofiles
+
+import "context"
+
+// UploadJanitor cleans up client uploads that were started but never finished.
+type UploadJanitor interface {
+	Run(ctx context.Context)
+}
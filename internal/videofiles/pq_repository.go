@@ -5,6 +5,7 @@ import (
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
 	"github.com/google/uuid"
+	"time"
 )
 
 type Repository interface {
@@ -12,7 +13,19 @@ type Repository interface {
 	GetVideos(ctx context.Context, userID uuid.UUID, pq *utils.Pagination) (*models.VideoList, error)
 	GetVideoByID(ctx context.Context, videoID uuid.UUID) (*models.VideoFile, error)
 	UpdateVideo(ctx context.Context, video *models.VideoFile) (*models.VideoFile, error)
+	// TransitionVideoStatus moves the video from one status to another and reports whether it
+	// was still in the from status.
+	TransitionVideoStatus(ctx context.Context, videoID uuid.UUID, from, to models.JobStatus) (bool, error)
+	// FinishLiveRecording records the size and checksum of a live recording and moves its video
+	// from live to pending_upload. It reports whether the video was still live.
+	FinishLiveRecording(ctx context.Context, videoID uuid.UUID, fileSize int64, checksum string) (bool, error)
+	// DeleteAbandonedUploads deletes videos still pending_upload that weren't touched since
+	// before and have no encoding job, and returns them.
+	DeleteAbandonedUploads(ctx context.Context, before time.Time) ([]*models.VideoFile, error)
 	GetVideosByQuery(ctx context.Context, userID uuid.UUID, query string, pq *utils.Pagination) (*models.VideoList, error)
 	DeleteVideo(ctx context.Context, userID uuid.UUID, videoID uuid.UUID) error
 	GetPlaybackInfo(ctx context.Context, videoID uuid.UUID) (*models.PlaybackInfo, error)
+	// SavePlaybackInfo stores the playback info of a video and moves the video to the same
+	// status in one transaction.
+	SavePlaybackInfo(ctx context.Context, info *models.PlaybackInfo) error
 }
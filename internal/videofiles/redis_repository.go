@@ -2,17 +2,56 @@ package videofiles
 
 import (
 	"context"
+	"time"
+
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 )
 
 type RedisRepository interface {
 	EnqueueJob(ctx context.Context, key string, videoJob *models.EncodeJob) error
+	// QueueLength returns the number of jobs waiting in the queue list.
+	QueueLength(ctx context.Context, key string) (int64, error)
 	PeekJob(ctx context.Context, key string) (*models.EncodeJob, error)
-	SubscribeToJobs(ctx context.Context, key string) (<-chan *models.EncodeJob, error)
+	// ClaimJob moves the next job onto the consumer's processing list and locks it for ttl. It
+	// waits a few seconds and returns nil when no job arrives. The receipt identifies the claim
+	// for AckJob.
+	ClaimJob(ctx context.Context, key, consumer string, ttl time.Duration) (job *models.EncodeJob, receipt string, err error)
+	// AckJob removes a finished or requeued claim from the consumer's processing list.
+	AckJob(ctx context.Context, key, consumer, receipt string) error
+	// KeepJobsAlive renews the consumer's heartbeat and its job locks, and returns the jobs
+	// whose lock another consumer took over.
+	KeepJobsAlive(ctx context.Context, key, consumer string, jobIDs []string, ttl time.Duration) ([]string, error)
+	// RecoverJobs returns the jobs claimed by consumers that died to the queue.
+	RecoverJobs(ctx context.Context, key string) (int, error)
 
 	DequeueJob(ctx context.Context, key string) (*models.EncodeJob, error)
 	GetJobStatus(ctx context.Context, key string, jobID string) (models.JobStatus, error)
 
 	UpdateProgress(ctx context.Context, jobID string, key string, progress float64) error
 	UpdateStatus(ctx context.Context, jobID string, key string, status models.JobStatus) error
+
+	// CheckpointJob stores the job state under key+jobID and publishes the change on
+	// models.JobEventsChannel+jobID.
+	CheckpointJob(ctx context.Context, key string, job *models.EncodeJob) error
+	// ReleaseJobLock releases the job's lock if consumer holds it.
+	ReleaseJobLock(ctx context.Context, jobID, consumer string) error
+
+	// SaveTusUpload stores the upload state, expiring after ttl.
+	SaveTusUpload(ctx context.Context, upload *models.TusUpload, ttl time.Duration) error
+	// GetTusUpload returns ErrUploadNotFound for unknown or expired uploads.
+	GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error)
+	DeleteTusUpload(ctx context.Context, id string) error
+	LockTusUpload(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	UnlockTusUpload(ctx context.Context, id string) error
+	// LockUploadJanitor reports whether this process may run the upload janitor for the next ttl.
+	LockUploadJanitor(ctx context.Context, ttl time.Duration) (bool, error)
+
+	EnqueueImport(ctx context.Context, key string, task *models.ImportTask) error
+	// SubscribeToImports pops imports off the queue list, each is delivered to one subscriber
+	// only. It holds the import's lock until ReleaseImportLock.
+	SubscribeToImports(ctx context.Context, key string) (<-chan *models.ImportTask, error)
+	ReleaseImportLock(ctx context.Context, importID string) error
+	SaveImport(ctx context.Context, task *models.ImportTask, ttl time.Duration) error
+	// GetImport returns ErrImportNotFound for unknown or expired imports.
+	GetImport(ctx context.Context, importID string) (*models.ImportTask, error)
 }
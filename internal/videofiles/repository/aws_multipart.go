@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Part URLs are cheap to request again, so they don't need to outlive a slow part by much
+const partURLExpiry = time.Hour
+
+func (a *awsRepository) CreateMultipartUpload(ctx context.Context, bucket, key, contentType string, checksummed bool) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:      &bucket,
+		Key:         &key,
+		ContentType: &contentType,
+	}
+	if checksummed {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+	}
+	res, err := a.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	return *res.UploadId, nil
+}
+
+func (a *awsRepository) PresignUploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, checksum string) (*models.PartURL, error) {
+	input := &s3.UploadPartInput{
+		Bucket:     &bucket,
+		Key:        &key,
+		UploadId:   &uploadID,
+		PartNumber: &partNumber,
+	}
+	if checksum != "" {
+		encoded, err := base64Checksum(checksum)
+		if err != nil {
+			return nil, err
+		}
+		input.ChecksumSHA256 = &encoded
+	}
+	req, err := a.preSignClient.PresignUploadPart(ctx, input, s3.WithPresignExpires(partURLExpiry))
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload part: %w", err)
+	}
+	return &models.PartURL{
+		PartNumber: partNumber,
+		URL:        req.URL,
+		ExpiresAt:  time.Now().Add(partURLExpiry),
+	}, nil
+}
+
+func (a *awsRepository) UploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, data []byte) (*models.UploadedPart, error) {
+	size := int64(len(data))
+	var part *models.UploadedPart
+	err := withRetry(ctx, "upload_part", func() error {
+		res, err := a.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        &bucket,
+			Key:           &key,
+			UploadId:      &uploadID,
+			PartNumber:    &partNumber,
+			ContentLength: &size,
+			Body:          bytes.NewReader(data),
+		})
+		if err != nil {
+			return fmt.Errorf("part %d: %w", partNumber, err)
+		}
+		part = &models.UploadedPart{
+			PartNumber: partNumber,
+			ETag:       deref(res.ETag),
+			Size:       size,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+func (a *awsRepository) ListParts(ctx context.Context, bucket, key, uploadID string) ([]models.UploadedPart, error) {
+	var parts []models.UploadedPart
+	paginator := s3.NewListPartsPaginator(a.client, &s3.ListPartsInput{
+		Bucket:   &bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts: %w", err)
+		}
+		for _, part := range page.Parts {
+			uploaded := models.UploadedPart{
+				PartNumber: deref(part.PartNumber),
+				ETag:       deref(part.ETag),
+				Size:       deref(part.Size),
+			}
+			if part.ChecksumSHA256 != nil {
+				uploaded.ChecksumSHA256 = *part.ChecksumSHA256
+			}
+			if part.LastModified != nil {
+				uploaded.LastModified = *part.LastModified
+			}
+			parts = append(parts, uploaded)
+		}
+	}
+	return parts, nil
+}
+
+func (a *awsRepository) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []models.UploadedPart) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{
+			PartNumber: &part.PartNumber,
+			ETag:       &part.ETag,
+		}
+		if part.ChecksumSHA256 != "" {
+			completed[i].ChecksumSHA256 = &part.ChecksumSHA256
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool { return *completed[i].PartNumber < *completed[j].PartNumber })
+
+	if _, err := a.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &bucket,
+		Key:             &key,
+		UploadId:        &uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	}); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (a *awsRepository) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	if _, err := a.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	}); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (a *awsRepository) ListMultipartUploads(ctx context.Context, bucket, prefix string) ([]models.PendingUpload, error) {
+	var uploads []models.PendingUpload
+	input := &s3.ListMultipartUploadsInput{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	}
+	for {
+		page, err := a.client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list multipart uploads: %w", err)
+		}
+		for _, upload := range page.Uploads {
+			pending := models.PendingUpload{
+				Key:      deref(upload.Key),
+				UploadID: deref(upload.UploadId),
+			}
+			if upload.Initiated != nil {
+				pending.Initiated = *upload.Initiated
+			}
+			uploads = append(uploads, pending)
+		}
+		if page.IsTruncated == nil || !*page.IsTruncated {
+			return uploads, nil
+		}
+		input.KeyMarker = page.NextKeyMarker
+		input.UploadIdMarker = page.NextUploadIdMarker
+	}
+}
+
+func deref[T any](v *T) T {
+	var zero T
+	if v == nil {
+		return zero
+	}
+	return *v
+}
@@ -3,40 +3,67 @@ package repository
 import (
 	"context"
 	"fmt"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"log"
 	"regexp"
+	"strings"
 	"time"
 )
 
+var videoFilePattern = regexp.MustCompile(`^.+\.(mp4|mkv|avi|mov|wmv|flv|webm|m4v|mpeg|mpg|3gp|ogv|vob|ts|mxf)$`)
+
 type awsRepository struct {
-	client        *s3.Client
-	preSignClient *s3.PresignClient
+	client             *s3.Client
+	preSignClient      *s3.PresignClient
+	partSize           int64
+	concurrency        int
+	multipartThreshold int64
 }
 
-func NewAwsRepository(awsClient *s3.Client, preSignClient *s3.PresignClient) videofiles.AWSRepository {
-	return &awsRepository{
-		preSignClient: preSignClient,
-		client:        awsClient,
+func NewAwsRepository(cfg *config.Config, awsClient *s3.Client, preSignClient *s3.PresignClient) videofiles.AWSRepository {
+	repo := &awsRepository{
+		preSignClient:      preSignClient,
+		client:             awsClient,
+		partSize:           defaultPartSize,
+		concurrency:        defaultTransferConcurrency,
+		multipartThreshold: defaultMultipartThreshold,
+	}
+	if cfg.S3.PartSizeMB > 0 {
+		repo.partSize = max(int64(cfg.S3.PartSizeMB)<<20, minPartSize)
+	}
+	if cfg.S3.TransferConcurrency > 0 {
+		repo.concurrency = cfg.S3.TransferConcurrency
 	}
+	if cfg.S3.MultipartThresholdMB > 0 {
+		repo.multipartThreshold = int64(cfg.S3.MultipartThresholdMB) << 20
+	}
+	return repo
 }
 
 func (a *awsRepository) GetPresignedURL(ctx context.Context, input *models.UploadInput) (string, error) {
-	pattern := `^.+\.(mp4|mkv|avi|mov|wmv|flv|webm|m4v|mpeg|mpg|3gp|ogv|vob|ts|mxf)$`
-	re := regexp.MustCompile(pattern)
-	if !re.MatchString(input.Name) {
+	if !videoFilePattern.MatchString(input.Name) {
 		return "", fmt.Errorf("invalid file format: %s", input.Name)
 	}
+	putInput := &s3.PutObjectInput{
+		Bucket:        &input.BucketName,
+		Key:           &input.Key,
+		ContentLength: &input.Size,
+		ContentType:   &input.MimeType,
+	}
+	if input.Checksum != "" {
+		// Signed into the URL, so S3 rejects a body that doesn't match and keeps the checksum
+		checksum, err := base64Checksum(input.Checksum)
+		if err != nil {
+			return "", err
+		}
+		putInput.ChecksumSHA256 = &checksum
+	}
 	pubObjectReq, err := a.preSignClient.PresignPutObject(
 		ctx,
-		&s3.PutObjectInput{
-			Bucket:        &input.BucketName,
-			Key:           &input.Key,
-			ContentLength: &input.Size,
-			ContentType:   &input.MimeType,
-		},
+		putInput,
 		s3.WithPresignExpires(60*time.Minute),
 	)
 	if err != nil {
@@ -45,6 +72,17 @@ func (a *awsRepository) GetPresignedURL(ctx context.Context, input *models.Uploa
 	return pubObjectReq.URL, nil
 }
 
+func (a *awsRepository) PresignGetObject(ctx context.Context, bucket, key string, expires time.Duration) (string, error) {
+	req, err := a.preSignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign get object %s: %w", key, err)
+	}
+	return req.URL, nil
+}
+
 // This thing is useless as not more than 10 users can upload videos at once. But just letting it be here.
 func (a *awsRepository) PutObject(ctx context.Context, input models.UploadInput) (*s3.PutObjectOutput, error) {
 	//pattern := `^.+\.(mp4|mkv|avi|mov|wmv|flv|webm|m4v|mpeg|mpg|3gp|ogv|vob|ts|mxf|)$`
@@ -86,6 +124,32 @@ func (a *awsRepository) ListObjects(ctx context.Context, bucket string) ([]strin
 	return keys, nil
 }
 
+func (a *awsRepository) ListObjectsWithPrefix(ctx context.Context, bucket, prefix string) ([]models.ObjectInfo, error) {
+	var objects []models.ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(a.client, &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			object := models.ObjectInfo{
+				Key:  deref(obj.Key),
+				Size: deref(obj.Size),
+				ETag: strings.Trim(deref(obj.ETag), `"`),
+			}
+			if obj.LastModified != nil {
+				object.LastModified = *obj.LastModified
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
 func (a *awsRepository) GetObject(ctx context.Context, bucket, fileKey string) (*s3.GetObjectOutput, error) {
 	res, err := a.client.GetObject(
 		ctx,
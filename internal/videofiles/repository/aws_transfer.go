@@ -0,0 +1,395 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/metrics"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	minPartSize                = 5 << 20 // S3 rejects smaller parts except the last one
+	defaultPartSize            = 16 << 20
+	defaultTransferConcurrency = 8
+	defaultMultipartThreshold  = 64 << 20
+	maxUploadParts             = 10000
+
+	maxTransferAttempts = 5
+	minTransferBackoff  = 500 * time.Millisecond
+	maxTransferBackoff  = 20 * time.Second
+
+	downloadStateSuffix = ".download"
+)
+
+// downloadState is kept next to a partial download so it can be resumed. It is only valid for
+// the object version it was started against.
+type downloadState struct {
+	ETag     string `json:"etag"`
+	Size     int64  `json:"size"`
+	PartSize int64  `json:"part_size"`
+	Done     []int  `json:"done"`
+}
+
+func (a *awsRepository) HeadObject(ctx context.Context, bucket, key string) (*s3.HeadObjectOutput, error) {
+	res, err := a.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       &bucket,
+		Key:          &key,
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to head object %s: %w", key, err)
+	}
+	return res, nil
+}
+
+func (a *awsRepository) DownloadFile(ctx context.Context, bucket, key, localPath string) (int64, error) {
+	head, err := a.HeadObject(ctx, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	if head.ContentLength != nil {
+		size = *head.ContentLength
+	}
+	var etag string
+	if head.ETag != nil {
+		etag = *head.ETag
+	}
+
+	statePath := localPath + downloadStateSuffix
+	state := loadDownloadState(statePath)
+	if state == nil || state.ETag != etag || state.Size != size || !fileExists(localPath) {
+		state = &downloadState{ETag: etag, Size: size, PartSize: a.partSize}
+	} else {
+		log.Printf("Resuming download of %s: %d parts already on disk", key, len(state.Done))
+	}
+
+	file, err := os.OpenFile(localPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer file.Close()
+	if err := file.Truncate(size); err != nil {
+		return 0, fmt.Errorf("failed to allocate %s: %w", localPath, err)
+	}
+
+	done := make(map[int]bool, len(state.Done))
+	for _, part := range state.Done {
+		done[part] = true
+	}
+	numParts := int((size + state.PartSize - 1) / state.PartSize)
+	var pending []int
+	for part := 0; part < numParts; part++ {
+		if !done[part] {
+			pending = append(pending, part)
+		}
+	}
+
+	var stateMu sync.Mutex
+	err = a.runParts(ctx, pending, func(ctx context.Context, part int) error {
+		start := int64(part) * state.PartSize
+		end := min(start+state.PartSize, size) - 1
+		if err := a.downloadRange(ctx, bucket, key, etag, file, start, end); err != nil {
+			return fmt.Errorf("part %d: %w", part, err)
+		}
+
+		stateMu.Lock()
+		defer stateMu.Unlock()
+		state.Done = append(state.Done, part)
+		if err := saveDownloadState(statePath, state); err != nil {
+			log.Printf("Failed to save download state for %s: %v", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to flush %s: %w", localPath, err)
+	}
+	os.Remove(statePath)
+	return size, nil
+}
+
+// downloadRange fetches bytes [start, end] of the object version identified by etag into file.
+func (a *awsRepository) downloadRange(ctx context.Context, bucket, key, etag string, file *os.File, start, end int64) error {
+	rangeHeader := fmt.Sprintf("bytes=%d-%d", start, end)
+	input := &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Range:  &rangeHeader,
+	}
+	if etag != "" {
+		// Fail instead of mixing parts of two versions when the object is replaced mid-download
+		input.IfMatch = &etag
+	}
+
+	return withRetry(ctx, "get_range", func() error {
+		res, err := a.client.GetObject(ctx, input)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		written, err := io.Copy(io.NewOffsetWriter(file, start), res.Body)
+		if err != nil {
+			return err
+		}
+		if expected := end - start + 1; written != expected {
+			return fmt.Errorf("short read: got %d of %d bytes", written, expected)
+		}
+		return nil
+	})
+}
+
+func (a *awsRepository) UploadFile(ctx context.Context, bucket, key, localPath, contentType, checksum string) (int64, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", localPath, err)
+	}
+	size := info.Size()
+
+	var metadata map[string]string
+	if checksum != "" {
+		metadata = map[string]string{models.ChecksumMetadataKey: checksum}
+	}
+
+	if size < a.multipartThreshold {
+		input := &s3.PutObjectInput{
+			Bucket:        &bucket,
+			Key:           &key,
+			ContentType:   &contentType,
+			ContentLength: &size,
+			Metadata:      metadata,
+		}
+		if checksum != "" {
+			// S3 rejects the upload if the body doesn't hash to this value
+			encoded, err := base64Checksum(checksum)
+			if err != nil {
+				return 0, err
+			}
+			input.ChecksumSHA256 = &encoded
+		}
+		err = withRetry(ctx, "put_object", func() error {
+			input.Body = io.NewSectionReader(file, 0, size)
+			_, err := a.client.PutObject(ctx, input)
+			return err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		return size, nil
+	}
+
+	if err := a.uploadMultipart(ctx, bucket, key, contentType, metadata, file, size); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// uploadMultipart uploads file in parts, retrying each part on its own. Every part carries a
+// SHA-256 checksum that S3 verifies. The upload is aborted if any part ultimately fails so no
+// orphaned parts are left behind.
+func (a *awsRepository) uploadMultipart(ctx context.Context, bucket, key, contentType string, metadata map[string]string, file *os.File, size int64) error {
+	partSize := a.partSize
+	if (size+partSize-1)/partSize > maxUploadParts {
+		partSize = (size + maxUploadParts - 1) / maxUploadParts
+	}
+	numParts := int((size + partSize - 1) / partSize)
+
+	created, err := a.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:            &bucket,
+		Key:               &key,
+		ContentType:       &contentType,
+		Metadata:          metadata,
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start multipart upload for %s: %w", key, err)
+	}
+	uploadID := created.UploadId
+
+	completed := make([]types.CompletedPart, numParts)
+	parts := make([]int, numParts)
+	for i := range parts {
+		parts[i] = i
+	}
+	err = a.runParts(ctx, parts, func(ctx context.Context, part int) error {
+		offset := int64(part) * partSize
+		length := min(partSize, size-offset)
+		partNumber := int32(part + 1)
+
+		return withRetry(ctx, "upload_part", func() error {
+			res, err := a.client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:            &bucket,
+				Key:               &key,
+				UploadId:          uploadID,
+				PartNumber:        &partNumber,
+				ContentLength:     &length,
+				ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+				Body:              io.NewSectionReader(file, offset, length),
+			})
+			if err != nil {
+				return fmt.Errorf("part %d: %w", partNumber, err)
+			}
+			completed[part] = types.CompletedPart{
+				ETag:           res.ETag,
+				PartNumber:     &partNumber,
+				ChecksumSHA256: res.ChecksumSHA256,
+			}
+			return nil
+		})
+	})
+	if err == nil {
+		sort.Slice(completed, func(i, j int) bool { return *completed[i].PartNumber < *completed[j].PartNumber })
+		err = withRetry(ctx, "complete_multipart", func() error {
+			_, err := a.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+				Bucket:          &bucket,
+				Key:             &key,
+				UploadId:        uploadID,
+				MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+			})
+			return err
+		})
+	}
+	if err != nil {
+		// The job context may already be cancelled, abort with a fresh one
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, abortErr := a.client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   &bucket,
+			Key:      &key,
+			UploadId: uploadID,
+		}); abortErr != nil {
+			log.Printf("Failed to abort multipart upload for %s: %v", key, abortErr)
+		}
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// runParts calls fn for every part with at most a.concurrency running at once. The first error
+// cancels the remaining parts and is returned.
+func (a *awsRepository) runParts(ctx context.Context, parts []int, fn func(ctx context.Context, part int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	work := make(chan int)
+	for i := 0; i < a.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range work {
+				if err := fn(ctx, part); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, part := range parts {
+		select {
+		case work <- part:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// withRetry runs fn until it succeeds, the attempts run out or ctx is done, backing off
+// between attempts.
+func withRetry(ctx context.Context, operation string, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < maxTransferAttempts; attempt++ {
+		if attempt > 0 {
+			metrics.S3Retries.WithLabelValues(operation).Inc()
+			if sleepErr := utils.SleepWithContext(ctx, utils.Backoff(attempt-1, minTransferBackoff, maxTransferBackoff)); sleepErr != nil {
+				return errors.Join(err, sleepErr)
+			}
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%s failed after %d attempts: %w", operation, maxTransferAttempts, err)
+}
+
+// base64Checksum converts a hex SHA-256 digest to the base64 form S3 expects.
+func base64Checksum(checksum string) (string, error) {
+	raw, err := hex.DecodeString(checksum)
+	if err != nil || len(raw) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 checksum %q", checksum)
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+func loadDownloadState(path string) *downloadState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state downloadState
+	if err := json.Unmarshal(data, &state); err != nil || state.PartSize <= 0 {
+		return nil
+	}
+	return &state
+}
+
+func saveDownloadState(path string, state *downloadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a truncated state file behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/localstore"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	StorageBackendS3    = "s3"
+	StorageBackendLocal = "local"
+
+	uploadURLExpiry = 60 * time.Minute
+)
+
+// localRepository is an AWSRepository keeping objects on the local filesystem. Its presigned
+// URLs are served by localstore.Handler.
+type localRepository struct {
+	store  *localstore.Store
+	signer *localstore.Signer
+}
+
+func NewLocalRepository(store *localstore.Store, signer *localstore.Signer) videofiles.AWSRepository {
+	return &localRepository{store: store, signer: signer}
+}
+
+// NewLocalStore creates the store and signer of the local backend from the config. Without a
+// signing key one is derived from the JWT secret, so signed URLs and session tokens never share
+// a key.
+func NewLocalStore(cfg *config.Config) (*localstore.Store, *localstore.Signer, error) {
+	store, err := localstore.New(cfg.Storage.LocalRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := cfg.Storage.SigningKey
+	if key == "" {
+		mac := hmac.New(sha256.New, []byte(cfg.Server.JwtSecretKey))
+		mac.Write([]byte("local-storage"))
+		key = hex.EncodeToString(mac.Sum(nil))
+	}
+	signer, err := localstore.NewSigner(key, cfg.Storage.PublicURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, signer, nil
+}
+
+// NewStorageRepository returns the AWSRepository of the configured storage backend.
+func NewStorageRepository(cfg *config.Config, awsClient *s3.Client, preSignClient *s3.PresignClient) (videofiles.AWSRepository, error) {
+	switch cfg.Storage.Backend {
+	case "", StorageBackendS3:
+		return NewAwsRepository(cfg, awsClient, preSignClient), nil
+	case StorageBackendLocal:
+		store, signer, err := NewLocalStore(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalRepository(store, signer), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+func (l *localRepository) GetPresignedURL(ctx context.Context, input *models.UploadInput) (string, error) {
+	if !videoFilePattern.MatchString(input.Name) {
+		return "", fmt.Errorf("invalid file format: %s", input.Name)
+	}
+	req := &localstore.SignedRequest{
+		Method:        http.MethodPut,
+		Bucket:        input.BucketName,
+		Key:           input.Key,
+		Expires:       time.Now().Add(uploadURLExpiry),
+		ContentType:   input.MimeType,
+		ContentLength: input.Size,
+	}
+	if input.Checksum != "" {
+		checksum, err := base64Checksum(input.Checksum)
+		if err != nil {
+			return "", err
+		}
+		req.Checksum = checksum
+	}
+	return l.signer.Sign(req), nil
+}
+
+func (l *localRepository) PutObject(ctx context.Context, input models.UploadInput) (*s3.PutObjectOutput, error) {
+	meta, err := l.store.Put(input.BucketName, input.Key, input.File, input.MimeType, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload file : %w", err)
+	}
+	return &s3.PutObjectOutput{ETag: quoted(meta.ETag), ChecksumSHA256: &meta.ChecksumSHA256}, nil
+}
+
+func (l *localRepository) PresignGetObject(ctx context.Context, bucket, key string, expires time.Duration) (string, error) {
+	if _, err := l.store.Stat(bucket, key); err != nil {
+		return "", fmt.Errorf("failed to presign get object %s: %w", key, err)
+	}
+	return l.signer.Sign(&localstore.SignedRequest{
+		Method:  http.MethodGet,
+		Bucket:  bucket,
+		Key:     key,
+		Expires: time.Now().Add(expires),
+	}), nil
+}
+
+func (l *localRepository) GetObject(ctx context.Context, bucket, filename string) (*s3.GetObjectOutput, error) {
+	f, meta, err := l.store.Open(bucket, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file : %w", err)
+	}
+	return &s3.GetObjectOutput{
+		Body:          f,
+		ContentLength: &meta.ContentLength,
+		ContentType:   &meta.ContentType,
+		ETag:          quoted(meta.ETag),
+		LastModified:  &meta.LastModified,
+		Metadata:      meta.Metadata,
+	}, nil
+}
+
+func (l *localRepository) ListObjects(ctx context.Context, bucket string) ([]string, error) {
+	objects, err := l.store.List(bucket, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects : %w", err)
+	}
+	var keys []string
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+func (l *localRepository) ListObjectsWithPrefix(ctx context.Context, bucket, prefix string) ([]models.ObjectInfo, error) {
+	objects, err := l.store.List(bucket, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	infos := make([]models.ObjectInfo, 0, len(objects))
+	for _, obj := range objects {
+		infos = append(infos, models.ObjectInfo{
+			Key:          obj.Key,
+			Size:         obj.ContentLength,
+			ETag:         obj.ETag,
+			LastModified: obj.LastModified,
+		})
+	}
+	return infos, nil
+}
+
+func (l *localRepository) RemoveObject(ctx context.Context, bucket, filename string) error {
+	if err := l.store.Remove(bucket, filename); err != nil {
+		return fmt.Errorf("failed to remove file : %w", err)
+	}
+	return nil
+}
+
+func (l *localRepository) HeadObject(ctx context.Context, bucket, key string) (*s3.HeadObjectOutput, error) {
+	meta, err := l.store.Stat(bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to head object %s: %w", key, err)
+	}
+	head := &s3.HeadObjectOutput{
+		ContentLength: &meta.ContentLength,
+		ContentType:   &meta.ContentType,
+		ETag:          quoted(meta.ETag),
+		LastModified:  &meta.LastModified,
+		Metadata:      meta.Metadata,
+	}
+	if meta.ChecksumSHA256 != "" {
+		head.ChecksumSHA256 = &meta.ChecksumSHA256
+	}
+	return head, nil
+}
+
+// DownloadFile copies the object to localPath. A copy is fast enough not to need resuming.
+func (l *localRepository) DownloadFile(ctx context.Context, bucket, key, localPath string) (int64, error) {
+	f, _, err := l.store.Open(bucket, key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer f.Close()
+
+	if err = os.MkdirAll(filepath.Dir(localPath), os.ModePerm); err != nil {
+		return 0, fmt.Errorf("failed to create directory for %s: %w", localPath, err)
+	}
+	tmp := localPath + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+	size, err := io.Copy(out, contextReader{ctx: ctx, r: f})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	if err = os.Rename(tmp, localPath); err != nil {
+		return 0, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return size, nil
+}
+
+func (l *localRepository) UploadFile(ctx context.Context, bucket, key, localPath, contentType, checksum string) (int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer f.Close()
+
+	var metadata map[string]string
+	var encoded string
+	if checksum != "" {
+		metadata = map[string]string{models.ChecksumMetadataKey: checksum}
+		if encoded, err = base64Checksum(checksum); err != nil {
+			return 0, err
+		}
+	}
+	meta, err := l.store.Put(bucket, key, contextReader{ctx: ctx, r: f}, contentType, encoded, metadata)
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return meta.ContentLength, nil
+}
+
+func (l *localRepository) CreateMultipartUpload(ctx context.Context, bucket, key, contentType string, checksummed bool) (string, error) {
+	upload, err := l.store.CreateUpload(bucket, key, contentType, checksummed)
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	return upload.UploadID, nil
+}
+
+func (l *localRepository) PresignUploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, checksum string) (*models.PartURL, error) {
+	if _, err := l.store.GetUpload(bucket, key, uploadID); err != nil {
+		return nil, fmt.Errorf("failed to presign upload part: %w", err)
+	}
+	req := &localstore.SignedRequest{
+		Method:        http.MethodPut,
+		Bucket:        bucket,
+		Key:           key,
+		Expires:       time.Now().Add(partURLExpiry),
+		ContentLength: -1,
+		UploadID:      uploadID,
+		PartNumber:    partNumber,
+	}
+	if checksum != "" {
+		encoded, err := base64Checksum(checksum)
+		if err != nil {
+			return nil, err
+		}
+		req.Checksum = encoded
+	}
+	return &models.PartURL{
+		PartNumber: partNumber,
+		URL:        l.signer.Sign(req),
+		ExpiresAt:  req.Expires,
+	}, nil
+}
+
+func (l *localRepository) UploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, data []byte) (*models.UploadedPart, error) {
+	part, err := l.store.WritePart(bucket, key, uploadID, partNumber, bytes.NewReader(data), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+	}
+	return uploadedPart(part), nil
+}
+
+func (l *localRepository) ListParts(ctx context.Context, bucket, key, uploadID string) ([]models.UploadedPart, error) {
+	parts, err := l.store.ListParts(bucket, key, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list parts: %w", err)
+	}
+	uploaded := make([]models.UploadedPart, 0, len(parts))
+	for i := range parts {
+		uploaded = append(uploaded, *uploadedPart(&parts[i]))
+	}
+	return uploaded, nil
+}
+
+func (l *localRepository) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []models.UploadedPart) error {
+	completed := make([]localstore.Part, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, localstore.Part{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	if _, err := l.store.CompleteUpload(bucket, key, uploadID, completed); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (l *localRepository) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	if err := l.store.AbortUpload(bucket, key, uploadID); err != nil && !errors.Is(err, localstore.ErrUploadNotFound) {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (l *localRepository) ListMultipartUploads(ctx context.Context, bucket, prefix string) ([]models.PendingUpload, error) {
+	uploads, err := l.store.ListUploads(bucket, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list multipart uploads: %w", err)
+	}
+	pending := make([]models.PendingUpload, 0, len(uploads))
+	for _, upload := range uploads {
+		pending = append(pending, models.PendingUpload{
+			Key:       upload.Key,
+			UploadID:  upload.UploadID,
+			Initiated: upload.Initiated,
+		})
+	}
+	return pending, nil
+}
+
+func uploadedPart(part *localstore.Part) *models.UploadedPart {
+	return &models.UploadedPart{
+		PartNumber:     part.PartNumber,
+		ETag:           part.ETag,
+		Size:           part.Size,
+		ChecksumSHA256: part.ChecksumSHA256,
+		LastModified:   part.LastModified,
+	}
+}
+
+func quoted(etag string) *string {
+	q := `"` + etag + `"`
+	return &q
+}
+
+// contextReader stops a local copy once ctx is done, like a cancelled S3 transfer.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"math"
+	"time"
 )
 
 type videoRepo struct {
@@ -28,10 +30,21 @@ func (v *videoRepo) CreateVideo(ctx context.Context, videoFile *models.VideoFile
 		videoFile.UserID,
 		videoFile.FileName,
 		videoFile.FileSize,
-		0,
+		videoFile.Duration,
 		videoFile.S3Key,
 		videoFile.S3Bucket,
 		videoFile.Format,
+		videoFile.Status,
+		videoFile.MimeType,
+		videoFile.Checksum,
+		videoFile.Qualities,
+		videoFile.OutputFormats,
+		videoFile.EnablePerTitleEncoding,
+		videoFile.EncryptionMode,
+		videoFile.KeyRotationSegments,
+		videoFile.ParentVideoID,
+		videoFile.ClipRanges,
+		videoFile.Overlays,
 	).StructScan(video); err != nil {
 		return nil, fmt.Errorf("failed to create video: %w", err)
 	}
@@ -120,6 +133,32 @@ func (v *videoRepo) UpdateVideo(ctx context.Context, video *models.VideoFile) (*
 	return videoFile, nil
 }
 
+func (v *videoRepo) TransitionVideoStatus(ctx context.Context, videoID uuid.UUID, from, to models.JobStatus) (bool, error) {
+	res, err := v.db.ExecContext(ctx, transitionVideoStatusQuery, videoID, from, to)
+	if err != nil {
+		return false, fmt.Errorf("failed to update video status: %w", err)
+	}
+	count, _ := res.RowsAffected()
+	return count == 1, nil
+}
+
+func (v *videoRepo) FinishLiveRecording(ctx context.Context, videoID uuid.UUID, fileSize int64, checksum string) (bool, error) {
+	res, err := v.db.ExecContext(ctx, finishLiveRecordingQuery, videoID, fileSize, checksum)
+	if err != nil {
+		return false, fmt.Errorf("failed to finish live recording: %w", err)
+	}
+	count, _ := res.RowsAffected()
+	return count == 1, nil
+}
+
+func (v *videoRepo) DeleteAbandonedUploads(ctx context.Context, before time.Time) ([]*models.VideoFile, error) {
+	var videos []*models.VideoFile
+	if err := v.db.SelectContext(ctx, &videos, deleteAbandonedUploadsQuery, before); err != nil {
+		return nil, fmt.Errorf("failed to delete abandoned uploads: %w", err)
+	}
+	return videos, nil
+}
+
 func (v *videoRepo) GetVideosByQuery(ctx context.Context, userID uuid.UUID, query string, pq *utils.Pagination) (*models.VideoList, error) {
 	var totalCount int
 	if err := v.db.GetContext(
@@ -200,3 +239,37 @@ func (v *videoRepo) GetPlaybackInfo(ctx context.Context, videoID uuid.UUID) (*mo
 	}
 	return playbackInfo, nil
 }
+
+func (v *videoRepo) SavePlaybackInfo(ctx context.Context, info *models.PlaybackInfo) error {
+	tx, err := v.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, completeVideoQuery, info.VideoID, info.Status, int64(math.Round(info.Duration)))
+	if err != nil {
+		return fmt.Errorf("failed to update video status: %w", err)
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return fmt.Errorf("no video found with id %s", info.VideoID)
+	}
+	if _, err = tx.ExecContext(
+		ctx,
+		savePlaybackInfoQuery,
+		info.VideoID,
+		info.Duration,
+		info.Thumbnail,
+		info.Qualities,
+		info.Subtitles,
+		info.Format,
+		info.Status,
+		info.ErrorMessage,
+	); err != nil {
+		return fmt.Errorf("failed to save playback info: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit playback info: %w", err)
+	}
+	return nil
+}
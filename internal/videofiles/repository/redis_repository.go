@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
@@ -21,21 +22,27 @@ func NewVideoRedisRepo(redisClient *redis.Client) videofiles.RedisRepository {
 	}
 }
 
+// EnqueueJob appends the job to the queue list. It waits there until a worker pops it, so jobs
+// queued while no worker is running aren't lost.
 func (v *videoRedisRepo) EnqueueJob(ctx context.Context, key string, videoJob *models.EncodeJob) error {
-	// Marshal the job to JSON
 	jobData, err := json.Marshal(videoJob)
 	if err != nil {
 		return fmt.Errorf("failed to marshal job: %w", err)
 	}
-	
-	// Publish the job to Redis pub/sub channel
-	if err := v.redisClient.Publish(ctx, key, jobData).Err(); err != nil {
-		return fmt.Errorf("failed to publish job: %w", err)
+	if err := v.redisClient.RPush(ctx, key, jobData).Err(); err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
 	}
-	
 	return nil
 }
 
+func (v *videoRedisRepo) QueueLength(ctx context.Context, key string) (int64, error) {
+	length, err := v.redisClient.LLen(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queue length: %w", err)
+	}
+	return length, nil
+}
+
 func (v *videoRedisRepo) PeekJob(ctx context.Context, key string) (*models.EncodeJob, error) {
 	// First, check if there are any jobs in the queue
 	length, err := v.redisClient.LLen(ctx, key).Result()
@@ -75,7 +82,8 @@ func (v *videoRedisRepo) PeekJob(ctx context.Context, key string) (*models.Encod
 			continue
 		}
 
-		job.StartedAt = time.Now()
+		now := time.Now()
+		job.StartedAt = &now
 		job.Status = models.JobStatusProcessing
 		updatedJobData, err := json.Marshal(job)
 		if err != nil {
@@ -109,7 +117,8 @@ func (v *videoRedisRepo) DequeueJob(ctx context.Context, key string) (*models.En
 	if err = json.Unmarshal([]byte(res[1]), job); err != nil {
 		return nil, fmt.Errorf("error unmarshalling job: %v", err)
 	}
-	job.StartedAt = time.Now()
+	now := time.Now()
+	job.StartedAt = &now
 	job.Status = models.JobStatusProcessing
 	if err := v.UpdateStatus(ctx, job.JobID, "video:progress:", models.JobStatusProcessing); err != nil {
 		return nil, fmt.Errorf("error updating job status: %v", err)
@@ -144,7 +153,8 @@ func (v *videoRedisRepo) UpdateStatus(ctx context.Context, jobID string, key str
 
 	job.Status = status
 	if status == models.JobStatusCompleted || status == models.JobStatusFailed {
-		job.CompletedAt = time.Now()
+		now := time.Now()
+		job.CompletedAt = &now
 	}
 
 	updatedJobData, err := json.Marshal(job)
@@ -164,6 +174,44 @@ func (v *videoRedisRepo) UpdateStatus(ctx context.Context, jobID string, key str
 	return nil
 }
 
+func (v *videoRedisRepo) CheckpointJob(ctx context.Context, key string, job *models.EncodeJob) error {
+	progressKey := key + job.JobID
+
+	jobData, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	err = v.redisClient.HSet(ctx, progressKey,
+		"status", string(job.Status),
+		"stage", string(job.Stage),
+		"progress", job.Progress,
+		"job_data", string(jobData),
+	).Err()
+	if err != nil {
+		return fmt.Errorf("failed to checkpoint job: %w", err)
+	}
+
+	event, err := json.Marshal(models.NewJobEvent(job))
+	if err != nil {
+		return fmt.Errorf("failed to marshal job event: %w", err)
+	}
+	if err := v.redisClient.Publish(ctx, models.JobEventsChannel+job.JobID, event).Err(); err != nil {
+		return fmt.Errorf("failed to publish job event: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseJobLock releases the job's lock if consumer holds it. Once a job is requeued another
+// consumer may hold it already.
+func (v *videoRedisRepo) ReleaseJobLock(ctx context.Context, jobID, consumer string) error {
+	if err := releaseJobLockScript.Run(ctx, v.redisClient, []string{jobLockKey + jobID}, consumer).Err(); err != nil {
+		return fmt.Errorf("failed to release job lock: %w", err)
+	}
+	return nil
+}
+
 func (v *videoRedisRepo) GetJobStatus(ctx context.Context, key string, jobID string) (models.JobStatus, error) {
 	status, err := v.redisClient.HGet(ctx, key+jobID, "status").Result()
 	if err != nil {
@@ -173,64 +221,340 @@ func (v *videoRedisRepo) GetJobStatus(ctx context.Context, key string, jobID str
 	return models.JobStatus(status), nil
 }
 
-func (v *videoRedisRepo) SubscribeToJobs(ctx context.Context, key string) (<-chan *models.EncodeJob, error) {
-	// Create buffered channel for jobs
-	jobChan := make(chan *models.EncodeJob, 100)
-	
-	// Subscribe to the Redis pub/sub channel
-	pubsub := v.redisClient.Subscribe(ctx, key)
-	
-	// Start goroutine to handle messages
-	go func() {
-		defer pubsub.Close()
-		defer close(jobChan)
-		
+// ClaimJob moves the next job of the queue list onto the consumer's processing list and locks
+// it for ttl. The job stays on the processing list until AckJob with the returned receipt, so a
+// job whose worker dies before finishing it isn't lost: RecoverJobs returns it to the queue. It
+// returns nil when no job arrived within jobPopTimeout, or when the job is a duplicate of one a
+// live consumer holds the lock of.
+func (v *videoRedisRepo) ClaimJob(ctx context.Context, key, consumer string, ttl time.Duration) (*models.EncodeJob, string, error) {
+	processing := processingKey(key, consumer)
+	data, err := v.redisClient.BLMove(ctx, key, processing, "LEFT", "RIGHT", jobPopTimeout).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to claim job from %s: %w", key, err)
+	}
+
+	var job models.EncodeJob
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		log.Printf("Dropping malformed job from %s: %v", key, err)
+		v.redisClient.LRem(ctx, processing, 1, data)
+		return nil, "", nil
+	}
+
+	locked, err := lockJobScript.Run(ctx, v.redisClient, []string{jobLockKey + job.JobID},
+		consumer, ttl.Milliseconds(), jobConsumerKey).Bool()
+	if err != nil {
+		v.returnClaimedJob(key, processing, data)
+		return nil, "", fmt.Errorf("failed to lock job %s: %w", job.JobID, err)
+	}
+	if !locked {
+		// The copy being processed is on its consumer's processing list and comes back from
+		// there if that consumer dies
+		log.Printf("Dropping duplicate of job %s, a worker is processing it", job.JobID)
+		v.redisClient.LRem(ctx, processing, 1, data)
+		return nil, "", nil
+	}
+
+	job.Status = models.JobStatusProcessing
+	now := time.Now()
+	job.StartedAt = &now
+	return &job, data, nil
+}
+
+// AckJob removes the claim with receipt from the consumer's processing list.
+func (v *videoRedisRepo) AckJob(ctx context.Context, key, consumer, receipt string) error {
+	if err := v.redisClient.LRem(ctx, processingKey(key, consumer), 1, receipt).Err(); err != nil {
+		return fmt.Errorf("failed to ack job: %w", err)
+	}
+	return nil
+}
+
+// KeepJobsAlive renews the consumer's heartbeat and the locks it holds on jobIDs for ttl. It
+// returns the jobs whose lock another consumer has taken over since, their processing has to
+// stop.
+func (v *videoRedisRepo) KeepJobsAlive(ctx context.Context, key, consumer string, jobIDs []string, ttl time.Duration) ([]string, error) {
+	pipe := v.redisClient.TxPipeline()
+	pipe.SAdd(ctx, key+jobConsumersSuffix, consumer)
+	pipe.Set(ctx, jobConsumerKey+consumer, 1, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to renew worker heartbeat: %w", err)
+	}
+
+	var lost []string
+	for _, jobID := range jobIDs {
+		kept, err := extendJobLockScript.Run(ctx, v.redisClient, []string{jobLockKey + jobID},
+			consumer, ttl.Milliseconds()).Bool()
+		if err != nil {
+			return lost, fmt.Errorf("failed to renew lock of job %s: %w", jobID, err)
+		}
+		if !kept {
+			lost = append(lost, jobID)
+		}
+	}
+	return lost, nil
+}
+
+// RecoverJobs moves the jobs left on the processing lists of consumers whose heartbeat ran out
+// back to the head of the queue list, and returns how many it moved.
+func (v *videoRedisRepo) RecoverJobs(ctx context.Context, key string) (int, error) {
+	consumers, err := v.redisClient.SMembers(ctx, key+jobConsumersSuffix).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list workers: %w", err)
+	}
+	recovered := 0
+	for _, consumer := range consumers {
+		alive, err := v.redisClient.Exists(ctx, jobConsumerKey+consumer).Result()
+		if err != nil {
+			return recovered, fmt.Errorf("failed to check worker %s: %w", consumer, err)
+		}
+		if alive > 0 {
+			continue
+		}
+		// Moving from the tail to the head one at a time keeps the claim order
 		for {
+			err := v.redisClient.LMove(ctx, processingKey(key, consumer), key, "RIGHT", "LEFT").Err()
+			if errors.Is(err, redis.Nil) {
+				break
+			}
+			if err != nil {
+				return recovered, fmt.Errorf("failed to recover jobs of worker %s: %w", consumer, err)
+			}
+			recovered++
+		}
+		if err := v.redisClient.SRem(ctx, key+jobConsumersSuffix, consumer).Err(); err != nil {
+			return recovered, fmt.Errorf("failed to remove worker %s: %w", consumer, err)
+		}
+	}
+	return recovered, nil
+}
+
+// returnClaimedJob puts a claimed job that couldn't be locked back at the head of the queue.
+func (v *videoRedisRepo) returnClaimedJob(key, processing, jobData string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := v.redisClient.LPush(ctx, key, jobData).Err(); err != nil {
+		// It stays on the processing list and is recovered from there
+		log.Printf("Error returning job to %s: %v", key, err)
+		return
+	}
+	v.redisClient.LRem(ctx, processing, 1, jobData)
+}
+
+func processingKey(key, consumer string) string {
+	return key + ":processing:" + consumer
+}
+
+// returnJob puts a popped job or import that was never handed over back at the head of its
+// queue and releases the lock taken for it. The context it was popped with is usually gone.
+func (v *videoRedisRepo) returnJob(key, lockKey, jobData string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if lockKey != "" {
+		v.redisClient.Del(ctx, lockKey)
+	}
+	if err := v.redisClient.LPush(ctx, key, jobData).Err(); err != nil {
+		log.Printf("Error returning job to %s: %v", key, err)
+	}
+}
+
+const (
+	// How long a pop waits for a job before checking whether the subscriber is still wanted
+	jobPopTimeout = 5 * time.Second
+
+	jobLockKey = "lock:"
+	// A worker's heartbeat, its processing list is recovered once this runs out
+	jobConsumerKey     = "worker:alive:"
+	jobConsumersSuffix = ":consumers"
+
+	tusUploadKey = "tus:upload:"
+	tusLockKey   = "tus:lock:"
+
+	uploadJanitorLockKey = "janitor:uploads:lock"
+)
+
+// lockJobScript locks a job for a consumer unless a consumer that is still alive, the same one
+// included, holds the lock. The lock of a dead consumer is taken over, its copy of the job was
+// recovered.
+var lockJobScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and redis.call('EXISTS', ARGV[3] .. owner) == 1 then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// extendJobLockScript renews a job lock unless another consumer took it over.
+var extendJobLockScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+var releaseJobLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func (v *videoRedisRepo) SaveTusUpload(ctx context.Context, upload *models.TusUpload, ttl time.Duration) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tus upload: %w", err)
+	}
+	if err = v.redisClient.Set(ctx, tusUploadKey+upload.ID, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save tus upload: %w", err)
+	}
+	return nil
+}
+
+func (v *videoRedisRepo) GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error) {
+	data, err := v.redisClient.Get(ctx, tusUploadKey+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, videofiles.ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to get tus upload: %w", err)
+	}
+	upload := &models.TusUpload{}
+	if err = json.Unmarshal(data, upload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tus upload: %w", err)
+	}
+	return upload, nil
+}
+
+func (v *videoRedisRepo) DeleteTusUpload(ctx context.Context, id string) error {
+	if err := v.redisClient.Del(ctx, tusUploadKey+id).Err(); err != nil {
+		return fmt.Errorf("failed to delete tus upload: %w", err)
+	}
+	return nil
+}
+
+func (v *videoRedisRepo) LockTusUpload(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	locked, err := v.redisClient.SetNX(ctx, tusLockKey+id, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to lock tus upload: %w", err)
+	}
+	return locked, nil
+}
+
+func (v *videoRedisRepo) UnlockTusUpload(ctx context.Context, id string) error {
+	if err := v.redisClient.Del(ctx, tusLockKey+id).Err(); err != nil {
+		return fmt.Errorf("failed to unlock tus upload: %w", err)
+	}
+	return nil
+}
+
+const (
+	importTaskKey = "import:task:"
+	importLockKey = "import:lock:"
+	// Long enough for a slow download, a crashed worker's lock still runs out
+	importLockTTL = 2 * time.Hour
+)
+
+// EnqueueImport appends the import to the queue list, where it waits for a worker.
+func (v *videoRedisRepo) EnqueueImport(ctx context.Context, key string, task *models.ImportTask) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal import: %w", err)
+	}
+	if err = v.redisClient.RPush(ctx, key, data).Err(); err != nil {
+		return fmt.Errorf("failed to enqueue import: %w", err)
+	}
+	return nil
+}
+
+func (v *videoRedisRepo) SubscribeToImports(ctx context.Context, key string) (<-chan *models.ImportTask, error) {
+	if err := v.redisClient.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", key, err)
+	}
+
+	taskChan := make(chan *models.ImportTask)
+	go func() {
+		defer close(taskChan)
+
+		for ctx.Err() == nil {
+			res, err := v.redisClient.BLPop(ctx, jobPopTimeout, key).Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Error popping import from %s: %v", key, err)
+				}
+				return
+			}
+			task := &models.ImportTask{}
+			if err := json.Unmarshal([]byte(res[1]), task); err != nil {
+				log.Printf("Error unmarshaling import: %v", err)
+				continue
+			}
+			// An import queued twice only runs for whoever holds its lock
+			locked, err := v.redisClient.SetNX(ctx, importLockKey+task.ImportID, 1, importLockTTL).Result()
+			if err != nil {
+				log.Printf("Error locking import: %v", err)
+				v.returnJob(key, "", res[1])
+				return
+			}
+			if !locked {
+				continue
+			}
 			select {
+			case taskChan <- task:
 			case <-ctx.Done():
+				v.returnJob(key, importLockKey+task.ImportID, res[1])
 				return
-			default:
-				msg, err := pubsub.ReceiveMessage(ctx)
-				if err != nil {
-					log.Printf("Error receiving message: %v", err)
-					continue
-				}
-				
-				// Parse the job from the message
-				var job models.EncodeJob
-				if err := json.Unmarshal([]byte(msg.Payload), &job); err != nil {
-					log.Printf("Error unmarshaling job: %v", err)
-					continue
-				}
-				
-				// Try to acquire lock for the job
-				lockKey := fmt.Sprintf("lock:%s", job.JobID)
-				locked, err := v.redisClient.SetNX(ctx, lockKey, "1", 10*time.Minute).Result()
-				if err != nil {
-					log.Printf("Error setting lock: %v", err)
-					continue
-				}
-				
-				if !locked {
-					// Job is already being processed by another worker
-					continue
-				}
-				
-				// Update job status to processing
-				job.Status = models.JobStatusProcessing
-				job.StartedAt = time.Now()
-				
-				// Send job to worker
-				select {
-				case jobChan <- &job:
-				case <-ctx.Done():
-					// Release lock if we can't send the job
-					v.redisClient.Del(ctx, lockKey)
-					return
-				}
 			}
 		}
 	}()
-	
-	return jobChan, nil
+
+	return taskChan, nil
+}
+
+func (v *videoRedisRepo) ReleaseImportLock(ctx context.Context, importID string) error {
+	if err := v.redisClient.Del(ctx, importLockKey+importID).Err(); err != nil {
+		return fmt.Errorf("failed to release import lock: %w", err)
+	}
+	return nil
+}
+
+func (v *videoRedisRepo) SaveImport(ctx context.Context, task *models.ImportTask, ttl time.Duration) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal import: %w", err)
+	}
+	if err = v.redisClient.Set(ctx, importTaskKey+task.ImportID, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save import: %w", err)
+	}
+	return nil
+}
+
+func (v *videoRedisRepo) GetImport(ctx context.Context, importID string) (*models.ImportTask, error) {
+	data, err := v.redisClient.Get(ctx, importTaskKey+importID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, videofiles.ErrImportNotFound
+		}
+		return nil, fmt.Errorf("failed to get import: %w", err)
+	}
+	task := &models.ImportTask{}
+	if err = json.Unmarshal(data, task); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal import: %w", err)
+	}
+	return task, nil
+}
+
+// LockUploadJanitor isn't released, the lock runs out after ttl so one replica sweeps per ttl.
+func (v *videoRedisRepo) LockUploadJanitor(ctx context.Context, ttl time.Duration) (bool, error) {
+	locked, err := v.redisClient.SetNX(ctx, uploadJanitorLockKey, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to lock upload janitor: %w", err)
+	}
+	return locked, nil
 }
@@ -1,11 +1,19 @@
 package repository
 
 const (
-	createVideoQuery = `INSERT INTO video_files (user_id, filename, file_size, duration, s3_key, s3_bucket, format) 
-					VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)`
-	getVideosByUserIDQuery = `SELECT video_id, user_id, filename, file_size, duration, s3_key, s3_bucket, format, status, uploaded_at, updated_at FROM video_files
+	videoColumns = `video_id, user_id, filename AS file_name, file_size, COALESCE(duration, 0) AS duration, s3_key, s3_bucket,
+					COALESCE(format, '') AS format, status, mime_type, checksum, qualities, output_formats, enable_per_title_encoding,
+					encryption_mode, key_rotation_segments, COALESCE(parent_video_id::text, '') AS parent_video_id, clip_ranges,
+					overlays, uploaded_at, updated_at`
+
+	createVideoQuery = `INSERT INTO video_files (user_id, filename, file_size, duration, s3_key, s3_bucket, format, status,
+					mime_type, checksum, qualities, output_formats, enable_per_title_encoding, encryption_mode, key_rotation_segments,
+					parent_video_id, clip_ranges, overlays)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, '')::uuid, $17, $18)
+					RETURNING ` + videoColumns
+	getVideosByUserIDQuery = `SELECT ` + videoColumns + ` FROM video_files
 					WHERE user_id = $1 ORDER BY uploaded_at OFFSET $2 LIMIT $3`
-	getVideoByIDQuery = `SELECT video_id, user_id, filename, file_size, duration, s3_key, s3_bucket, format, status, uploaded_at, updated_at FROM video_files
+	getVideoByIDQuery = `SELECT ` + videoColumns + ` FROM video_files
 					WHERE video_id = $1`
 	getTotalVideosByUserIDQuery = `SELECT COUNT(video_id) FROM video_files WHERE user_id = $1`
 	getTotalVideosCountQuery    = `SELECT COUNT(video_id) FROM video_files WHERE user_id = $1 AND filename ILIKE '%' || $2 || '%'`
@@ -18,10 +26,37 @@ const (
 									    format = COALESCE(nullif($6, ''), format),
 									    status = COALESCE(nullif($7, ''), status)
 									WHERE video_id = $8 `
-	getVideosBySearchQuery = `SELECT video_id, user_id, filename, file_size, duration, s3_key, s3_bucket, format, status, uploaded_at, updated_at FROM video_files
+	getVideosBySearchQuery = `SELECT ` + videoColumns + ` FROM video_files
 					WHERE filename ILIKE '%' || $1 || '%' AND user_id = $2`
+	// Only moves the video on if it is still in the expected status
+	transitionVideoStatusQuery = `UPDATE video_files SET status = $3, updated_at = NOW()
+					WHERE video_id = $1 AND status = $2`
+	finishLiveRecordingQuery = `UPDATE video_files SET file_size = $2, checksum = $3, status = 'pending_upload', updated_at = NOW()
+					WHERE video_id = $1 AND status = 'live'`
+	// Rows with an encoding job were confirmed once and are left to the job's own handling
+	deleteAbandonedUploadsQuery = `DELETE FROM video_files v
+					WHERE v.status = 'pending_upload' AND v.updated_at < $1
+					AND NOT EXISTS (SELECT 1 FROM encoding_jobs j WHERE j.video_id = v.video_id)
+					RETURNING ` + videoColumns
 	deleteVideoQuery     = `DELETE FROM video_files WHERE video_id = $1 AND user_id = $2`
-	getPlaybackInfoQuery = `SELECT video_id, title, duration, thumbnail, qualities, subtitles, format, status, error_message, created_at, updated_at 
+	getPlaybackInfoQuery = `SELECT video_id, title, duration, thumbnail, qualities, to_jsonb(subtitles) AS subtitles, format, status,
+						COALESCE(error_message, '') AS error_message, created_at, updated_at
 						FROM playback_info WHERE video_id = $1`
+	// The title is the video's file name; subtitles arrive as a JSON array
+	savePlaybackInfoQuery = `INSERT INTO playback_info (video_id, title, duration, thumbnail, qualities, subtitles, format, status, error_message)
+						SELECT video_id, filename, $2, $3, $4, ARRAY(SELECT jsonb_array_elements_text($5::jsonb)), $6, $7, NULLIF($8, '')
+						FROM video_files WHERE video_id = $1
+						ON CONFLICT (video_id) DO UPDATE
+						SET title = EXCLUDED.title,
+						    duration = EXCLUDED.duration,
+						    thumbnail = EXCLUDED.thumbnail,
+						    qualities = EXCLUDED.qualities,
+						    subtitles = EXCLUDED.subtitles,
+						    format = EXCLUDED.format,
+						    status = EXCLUDED.status,
+						    error_message = EXCLUDED.error_message,
+						    updated_at = NOW()`
+	completeVideoQuery = `UPDATE video_files SET status = $2, duration = COALESCE(NULLIF($3, 0), duration), updated_at = NOW()
+						WHERE video_id = $1`
 	getStorageUsageQuery = `SELECT user_id, SUM(file_size) as total_size FROM video_files WHERE user_id = $1 GROUP BY user_id`
 )
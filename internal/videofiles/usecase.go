@@ -2,14 +2,79 @@ package videofiles
 
 import (
 	"context"
+	"errors"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
 	"github.com/google/uuid"
+	"io"
+)
+
+const (
+	// TusPartSize is the size of the parts tus uploads are stored in.
+	TusPartSize = 16 << 20
+	// MaxTusUploadSize is the largest upload accepted over tus, as many parts as S3 allows.
+	MaxTusUploadSize = TusPartSize * 10000
+	// TusTailPrefix is where the bytes of tus uploads that don't fill a part yet are kept.
+	TusTailPrefix = "tus-tails/"
+	// PlaybackRoutePrefix is the public path tokenized playback is served under.
+	PlaybackRoutePrefix = "/api/v1/playback"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadLocked         = errors.New("upload is locked by another request")
+	ErrUploadTooLarge       = errors.New("upload exceeds the maximum size")
+	ErrImportNotFound       = errors.New("import not found")
+	ErrPlaybackNotReady     = errors.New("video has no completed output to play")
+	ErrPlaybackTokenInvalid = errors.New("invalid or expired playback token")
+	ErrPlaybackForbidden    = errors.New("playback token is not valid for this viewer")
+	ErrPlaybackNotFound     = errors.New("playback object not found")
 )
 
 type UseCase interface {
 	GetPresignUrl(ctx context.Context, input *models.UploadInput) (string, error)
 	CreateVideo(ctx context.Context, input *models.VideoUploadInput) (*models.VideoFile, error)
+	// CompleteUpload verifies the uploaded object of a pending video and queues its encode job.
+	CompleteUpload(ctx context.Context, videoID uuid.UUID) (*models.CompletedUpload, error)
+
+	StartMultipartUpload(ctx context.Context, videoID uuid.UUID) (*models.MultipartUpload, error)
+	GetUploadPartURL(ctx context.Context, videoID uuid.UUID, uploadID string, partNumber int32, checksum string) (*models.PartURL, error)
+	ListUploadParts(ctx context.Context, videoID uuid.UUID, uploadID string) ([]models.UploadedPart, error)
+	// CompleteMultipartUpload assembles the uploaded parts and then completes the upload like
+	// CompleteUpload.
+	CompleteMultipartUpload(ctx context.Context, videoID uuid.UUID, uploadID string, input *models.CompleteMultipartInput) (*models.CompletedUpload, error)
+	AbortMultipartUpload(ctx context.Context, videoID uuid.UUID, uploadID string) error
+
+	CreateTusUpload(ctx context.Context, input *models.TusUploadInput) (*models.TusUpload, error)
+	GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error)
+	// WriteTusChunk appends body to the upload at offset. Once the last byte is in, the video is
+	// created and its upload completed like CompleteUpload.
+	WriteTusChunk(ctx context.Context, id string, offset int64, body io.Reader) (*models.TusUpload, error)
+	TerminateTusUpload(ctx context.Context, id string) error
+
+	// ImportVideo queues the import of a video from a remote URL.
+	ImportVideo(ctx context.Context, input *models.ImportInput) (*models.ImportTask, error)
+	GetImport(ctx context.Context, importID string) (*models.ImportTask, error)
+	// RunImport copies the source of a queued import into the input bucket, then creates the
+	// video and queues its encode job. It runs on the worker, outside of any user request.
+	RunImport(ctx context.Context, task *models.ImportTask) error
+
+	// CreateLiveVideo creates the video a live stream is recorded as. It stays live until
+	// CompleteLiveVideo.
+	CreateLiveVideo(ctx context.Context, input *models.VideoUploadInput) (*models.VideoFile, error)
+	// CompleteLiveVideo completes the upload of a live recording, already sent to the video's
+	// source object, and queues its encode job.
+	CompleteLiveVideo(ctx context.Context, videoID uuid.UUID, fileSize int64, checksum string) (*models.CompletedUpload, error)
+
+	// CreateClip creates a video cut from the ranges of another one and queues its encode job.
+	// The clip shares its parent's source object.
+	CreateClip(ctx context.Context, parentID uuid.UUID, input *models.ClipInput) (*models.CompletedUpload, error)
+
+	// ComposeVideos creates a video joining other videos in order, with optional transitions,
+	// and queues its encode job.
+	ComposeVideos(ctx context.Context, input *models.ComposeInput) (*models.CompletedUpload, error)
+
 	//UploadVideo(ctx context.Context, input *models.VideoUploadInput) (*models.VideoFile, error)
 	CreateJob(ctx context.Context, input *models.VideoUploadInput) (*models.EncodeJob, error)
 	GetVideo(ctx context.Context, videoID uuid.UUID) (*models.VideoFile, error)
@@ -20,4 +85,10 @@ type UseCase interface {
 	UpdateVideo(ctx context.Context, video *models.VideoFile) error
 
 	GetPlaybackInfo(ctx context.Context, videoID uuid.UUID) (*models.PlaybackInfo, error)
+	// CreatePlaybackToken issues a short-lived token for the latest output of a video. clientIP
+	// is what the token is bound to when input.BindIP is set.
+	CreatePlaybackToken(ctx context.Context, videoID uuid.UUID, input *models.PlaybackTokenInput, clientIP string) (*models.PlaybackToken, error)
+	// GetPlaybackObject serves objectPath, relative to the output the token grants, to a viewer.
+	// Manifests come back with their URIs rewritten to tokenized or presigned URLs.
+	GetPlaybackObject(ctx context.Context, token, objectPath string, viewer *models.PlaybackViewer) (*models.PlaybackObject, error)
 }
@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+func (v *videoFileUC) CreateClip(ctx context.Context, parentID uuid.UUID, input *models.ClipInput) (*models.CompletedUpload, error) {
+	if err := utils.ValidateStruct(ctx, input); err != nil {
+		v.logger.Errorf("CreateClip - ValidateStruct error: %v", err)
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	parent, err := v.GetVideo(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Status == models.VideoStatusPendingUpload || parent.Status == models.VideoStatusLive {
+		return nil, fmt.Errorf("video has no source to clip yet")
+	}
+	var duration float64
+	switch {
+	case len(parent.ClipRanges) > 0:
+		duration = parent.ClipRanges.Duration()
+	case parent.Duration > 0:
+		// The stored duration is rounded to the second, the worker checks the exact one
+		duration = float64(parent.Duration) + 0.5
+	}
+	ranges := input.ClipRanges()
+	if err = ranges.Check(duration); err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	// A composed video's source only exists once its composition ran
+	if _, err = v.awsRepo.HeadObject(ctx, v.cfg.S3.InputBucket, parent.S3Key); err != nil {
+		v.logger.Warnf("CreateClip - HeadObject of %s error: %v", parent.S3Key, err)
+		return nil, fmt.Errorf("video has no source to clip yet")
+	}
+	sourceRanges := ranges
+	if len(parent.ClipRanges) > 0 {
+		// A clip of a clip is cut from the same source, at the parts of it the parent shows
+		sourceRanges = ranges.Within(parent.ClipRanges)
+		if err = sourceRanges.Check(0); err != nil {
+			return nil, fmt.Errorf("invalid input: %v", err)
+		}
+	}
+
+	// The clip is cut from the parent's source object when it is encoded, nothing is copied
+	clip := *parent
+	clip.FileName = clipFileName(parent.FileName, input.FileName)
+	clip.Duration = 0
+	clip.Status = models.VideoStatusUploaded
+	clip.ParentVideoID = parent.VideoID.String()
+	clip.ClipRanges = sourceRanges
+	// The parent's overlays are timed on the parent, the clip shows them where they were
+	clip.Overlays = parent.Overlays.Clip(ranges)
+	created, err := v.videoRepo.CreateVideo(ctx, &clip)
+	if err != nil {
+		v.logger.Errorf("CreateClip - CreateVideo error: %v", err)
+		return nil, err
+	}
+	job, err := v.queueJob(ctx, created)
+	if err != nil {
+		return nil, err
+	}
+	return &models.CompletedUpload{Video: created, Job: job}, nil
+}
+
+// clipFileName is the name given to a clip, or one derived from its parent's.
+func clipFileName(parentName, name string) string {
+	if name != "" {
+		return name
+	}
+	ext := path.Ext(parentName)
+	name = strings.TrimSuffix(parentName, ext) + "-clip" + ext
+	if len(name) > 255 {
+		return name[len(name)-255:]
+	}
+	return name
+}
@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const defaultComposeFileName = "composition.mp4"
+
+func (v *videoFileUC) ComposeVideos(ctx context.Context, input *models.ComposeInput) (*models.CompletedUpload, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		v.logger.Errorf("GetUserFromCtx: %v", err)
+		return nil, err
+	}
+	if err = utils.ValidateStruct(ctx, input); err != nil {
+		v.logger.Errorf("ComposeVideos - ValidateStruct error: %v", err)
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	if n := len(input.Transitions); n > 1 && n != len(input.VideoIDs)-1 {
+		return nil, fmt.Errorf("invalid input: give one transition for all joins or one per join")
+	}
+
+	sources := make(models.ComposeSourceList, len(input.VideoIDs))
+	checked := make(map[string]bool, len(input.VideoIDs))
+	var first *models.VideoFile
+	for i, id := range input.VideoIDs {
+		videoID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid video id %q", id)
+		}
+		video, err := v.GetVideo(ctx, videoID)
+		if err != nil {
+			return nil, err
+		}
+		if video.Status == models.VideoStatusPendingUpload || video.Status == models.VideoStatusLive {
+			return nil, fmt.Errorf("video %s has no source to compose yet", videoID)
+		}
+		// A composed video's source only exists once its composition ran
+		if !checked[video.S3Key] {
+			if _, err = v.awsRepo.HeadObject(ctx, v.cfg.S3.InputBucket, video.S3Key); err != nil {
+				v.logger.Warnf("ComposeVideos - HeadObject of %s error: %v", video.S3Key, err)
+				return nil, fmt.Errorf("video %s has no source to compose yet", videoID)
+			}
+			checked[video.S3Key] = true
+		}
+		if first == nil {
+			first = video
+		}
+		sources[i] = models.ComposeSource{
+			VideoID:    video.VideoID.String(),
+			S3Key:      video.S3Key,
+			ClipRanges: video.ClipRanges,
+			Duration:   float64(video.Duration),
+		}
+		if len(video.ClipRanges) > 0 {
+			sources[i].Duration = video.ClipRanges.Duration()
+		}
+		if i > 0 {
+			sources[i].Transition = input.TransitionAt(i)
+		}
+	}
+	if err = sources.Check(); err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+
+	// The worker renders the composition into the video's source object before encoding it,
+	// with the encode settings of the first video
+	fileName := input.FileName
+	if fileName == "" {
+		fileName = defaultComposeFileName
+	}
+	composed := &models.VideoFile{
+		UserID:                 user.UserID,
+		FileName:               fileName,
+		S3Key:                  fmt.Sprintf("uploads/%s/composed-%s.mp4", user.UserID, uuid.New()),
+		S3Bucket:               v.cfg.S3.InputBucket,
+		Status:                 models.VideoStatusUploaded,
+		Format:                 "mp4",
+		MimeType:               "video/mp4",
+		Qualities:              first.Qualities,
+		OutputFormats:          first.OutputFormats,
+		EnablePerTitleEncoding: first.EnablePerTitleEncoding,
+		EncryptionMode:         first.EncryptionMode,
+		KeyRotationSegments:    first.KeyRotationSegments,
+	}
+	created, err := v.videoRepo.CreateVideo(ctx, composed)
+	if err != nil {
+		v.logger.Errorf("ComposeVideos - CreateVideo error: %v", err)
+		return nil, err
+	}
+	job := v.newJob(created)
+	job.ComposeSources = sources
+	if err = v.enqueueJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return &models.CompletedUpload{Video: created, Job: job}, nil
+}
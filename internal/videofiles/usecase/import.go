@@ -0,0 +1,385 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultImportMaxSizeMB = 10 << 10
+	defaultImportTimeout   = time.Hour
+	// Import state outlives the import so clients can still look up the video it created
+	importRetention = 7 * 24 * time.Hour
+	importPartSize  = 16 << 20
+)
+
+// importSource is the opened source of an import.
+type importSource struct {
+	body        io.ReadCloser
+	size        int64 // -1 when the source doesn't say
+	contentType string
+	name        string
+}
+
+func (v *videoFileUC) ImportVideo(ctx context.Context, input *models.ImportInput) (*models.ImportTask, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		v.logger.Errorf("ImportVideo - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	if err = utils.ValidateStruct(ctx, input); err != nil {
+		v.logger.Errorf("ImportVideo - ValidateStruct error: %v", err)
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	if strings.ContainsAny(input.FileName, "/\\") {
+		return nil, fmt.Errorf("invalid input: filename must not contain a path")
+	}
+	if err = v.checkImportSource(ctx, input.SourceURL); err != nil {
+		v.logger.Warnf("ImportVideo - rejected source for user %s: %v", user.UserID, err)
+		return nil, err
+	}
+
+	now := time.Now()
+	task := &models.ImportTask{
+		ImportID:  uuid.New().String(),
+		UserID:    user.UserID.String(),
+		Status:    models.ImportStatusQueued,
+		Input:     *input,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err = v.redisRepo.SaveImport(ctx, task, importRetention); err != nil {
+		v.logger.Errorf("ImportVideo - SaveImport error: %v", err)
+		return nil, fmt.Errorf("failed to queue the import: %v", err)
+	}
+	if err = v.redisRepo.EnqueueImport(ctx, v.importQueueKey(), task); err != nil {
+		v.logger.Errorf("ImportVideo - EnqueueImport error: %v", err)
+		return nil, fmt.Errorf("failed to queue the import: %v", err)
+	}
+	return task, nil
+}
+
+func (v *videoFileUC) GetImport(ctx context.Context, importID string) (*models.ImportTask, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		v.logger.Errorf("GetImport - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	task, err := v.redisRepo.GetImport(ctx, importID)
+	if err != nil {
+		return nil, err
+	}
+	if task.UserID != user.UserID.String() {
+		v.logger.Warnf("User %s is not authorized to access import %s", user.UserID, importID)
+		return nil, videofiles.ErrImportNotFound
+	}
+	return task, nil
+}
+
+func (v *videoFileUC) RunImport(ctx context.Context, task *models.ImportTask) error {
+	task.Status = models.ImportStatusImporting
+	task.Attempts++
+	task.Size = 0
+	task.Error = ""
+	v.saveImport(task)
+
+	timeout := defaultImportTimeout
+	if v.cfg.Import.TimeoutSeconds > 0 {
+		timeout = time.Duration(v.cfg.Import.TimeoutSeconds) * time.Second
+	}
+	importCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := v.runImport(importCtx, task)
+	if err != nil {
+		if ctx.Err() != nil {
+			// The worker is shutting down, the import goes back to the queue
+			task.Status = models.ImportStatusQueued
+			v.saveImport(task)
+			return ctx.Err()
+		}
+		v.logger.Errorf("RunImport - import %s failed: %v", task.ImportID, err)
+		task.Status = models.ImportStatusFailed
+		task.Error = err.Error()
+		v.saveImport(task)
+		return err
+	}
+
+	task.Status = models.ImportStatusCompleted
+	task.VideoID = result.Video.VideoID.String()
+	task.JobID = result.Job.JobID
+	v.saveImport(task)
+	return nil
+}
+
+func (v *videoFileUC) runImport(ctx context.Context, task *models.ImportTask) (*models.CompletedUpload, error) {
+	// The source was checked when the import was queued, the configuration may have changed since
+	if err := v.checkImportSource(ctx, task.Input.SourceURL); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(task.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid import owner: %v", err)
+	}
+	src, err := v.openImportSource(ctx, task.Input.SourceURL)
+	if err != nil {
+		return nil, err
+	}
+	defer src.body.Close()
+
+	maxSize := v.maxImportSize()
+	if src.size > maxSize {
+		return nil, fmt.Errorf("source is %d bytes, imports are limited to %d", src.size, maxSize)
+	}
+
+	input := importUploadInput(task, src)
+	applyEncodeDefaults(input)
+	videoFile := v.newVideoFile(userID, input, models.VideoStatusUploaded)
+
+	size, checksum, err := v.copyImportSource(ctx, task, src.body, videoFile)
+	if err != nil {
+		return nil, err
+	}
+	if input.Checksum != "" && !strings.EqualFold(checksum, input.Checksum) {
+		v.removeObject(videoFile.S3Bucket, videoFile.S3Key)
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+	videoFile.FileSize = size
+
+	video, err := v.videoRepo.CreateVideo(ctx, videoFile)
+	if err != nil {
+		v.logger.Errorf("RunImport - CreateVideo error: %v", err)
+		return nil, fmt.Errorf("failed to create video: %v", err)
+	}
+	v.notify(ctx, userID, models.EventVideoUploaded, video)
+	job, err := v.queueJob(ctx, video)
+	if err != nil {
+		return nil, err
+	}
+	return &models.CompletedUpload{Video: video, Job: job}, nil
+}
+
+// copyImportSource streams body into the video's source object as a multipart upload and
+// returns its size and hex SHA-256.
+func (v *videoFileUC) copyImportSource(ctx context.Context, task *models.ImportTask, body io.Reader, videoFile *models.VideoFile) (int64, string, error) {
+	maxSize := v.maxImportSize()
+	uploadID, err := v.awsRepo.CreateMultipartUpload(ctx, videoFile.S3Bucket, videoFile.S3Key, videoFile.MimeType, false)
+	if err != nil {
+		v.logger.Errorf("RunImport - CreateMultipartUpload error: %v", err)
+		return 0, "", fmt.Errorf("failed to start upload: %v", err)
+	}
+	completed := false
+	defer func() {
+		if !completed {
+			v.abortUpload(videoFile.S3Bucket, videoFile.S3Key, uploadID)
+		}
+	}()
+
+	hasher := sha256.New()
+	// One part more than the limit allows, so an oversized source is noticed
+	reader := io.LimitReader(body, maxSize+1)
+	buf := make([]byte, max(int64(importPartSize), (maxSize+maxUploadParts-1)/maxUploadParts))
+	var parts []models.UploadedPart
+	var size int64
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		size += int64(n)
+		if size > maxSize {
+			return 0, "", fmt.Errorf("source exceeds the import limit of %d bytes", maxSize)
+		}
+		if readErr != nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+			return 0, "", fmt.Errorf("failed to read source: %v", readErr)
+		}
+		if n > 0 {
+			hasher.Write(buf[:n])
+			part, err := v.awsRepo.UploadPart(ctx, videoFile.S3Bucket, videoFile.S3Key, uploadID, int32(len(parts)+1), buf[:n])
+			if err != nil {
+				v.logger.Errorf("RunImport - UploadPart error: %v", err)
+				return 0, "", fmt.Errorf("failed to store source: %v", err)
+			}
+			parts = append(parts, *part)
+			task.Size = size
+			v.saveImport(task)
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	if size == 0 {
+		return 0, "", fmt.Errorf("source is empty")
+	}
+
+	if err = v.awsRepo.CompleteMultipartUpload(ctx, videoFile.S3Bucket, videoFile.S3Key, uploadID, parts); err != nil {
+		v.logger.Errorf("RunImport - CompleteMultipartUpload error: %v", err)
+		return 0, "", fmt.Errorf("failed to store source: %v", err)
+	}
+	completed = true
+	return size, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// checkImportSource rejects sources the importer must not read: unsupported schemes, hosts
+// resolving to non-public addresses and buckets that aren't allowed.
+func (v *videoFileUC) checkImportSource(ctx context.Context, sourceURL string) error {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return fmt.Errorf("invalid source url: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Hostname() == "" {
+			return fmt.Errorf("invalid source url: missing host")
+		}
+		if !v.cfg.Import.AllowPrivateNetworks {
+			if err = utils.CheckPublicHost(ctx, u.Hostname()); err != nil {
+				return fmt.Errorf("source not allowed: %v", err)
+			}
+		}
+	case "s3":
+		if u.Host == "" || strings.TrimPrefix(u.Path, "/") == "" {
+			return fmt.Errorf("invalid source url: s3 urls need a bucket and a key")
+		}
+		if !slices.Contains(v.cfg.Import.AllowedBuckets, u.Host) {
+			return fmt.Errorf("source not allowed: bucket %s can't be imported from", u.Host)
+		}
+	default:
+		return fmt.Errorf("invalid source url: unsupported scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+func (v *videoFileUC) openImportSource(ctx context.Context, sourceURL string) (*importSource, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source url: %v", err)
+	}
+	if u.Scheme == "s3" {
+		key := strings.TrimPrefix(u.Path, "/")
+		object, err := v.awsRepo.GetObject(ctx, u.Host, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open source: %v", err)
+		}
+		src := &importSource{body: object.Body, size: -1, name: path.Base(key)}
+		if object.ContentLength != nil {
+			src.size = *object.ContentLength
+		}
+		if object.ContentType != nil {
+			src.contentType = *object.ContentType
+		}
+		return src, nil
+	}
+
+	// No client timeout, the import context bounds the whole transfer
+	client := utils.NewPublicHTTPClient(0, v.cfg.Import.AllowPrivateNetworks)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source url: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to open source: %s", resp.Status)
+	}
+	return &importSource{
+		body:        resp.Body,
+		size:        resp.ContentLength,
+		contentType: resp.Header.Get("Content-Type"),
+		// After redirects the final URL usually names the file best
+		name: path.Base(resp.Request.URL.Path),
+	}, nil
+}
+
+// importUploadInput fills in what the import request left open from the source.
+func importUploadInput(task *models.ImportTask, src *importSource) *models.VideoUploadInput {
+	input := &models.VideoUploadInput{
+		FileName:               task.Input.FileName,
+		Format:                 strings.ToLower(task.Input.Format),
+		MimeType:               task.Input.MimeType,
+		Checksum:               task.Input.Checksum,
+		Qualities:              task.Input.Qualities,
+		OutputFormats:          task.Input.OutputFormats,
+		EnablePerTitleEncoding: task.Input.EnablePerTitleEncoding,
+	}
+	if input.FileName == "" {
+		input.FileName = src.name
+		if input.FileName == "" || input.FileName == "." || input.FileName == "/" || len(input.FileName) > 255 {
+			input.FileName = "import-" + task.ImportID
+		}
+	}
+	ext := strings.ToLower(path.Ext(input.FileName))
+	if input.MimeType == "" {
+		if mediaType, _, err := mime.ParseMediaType(src.contentType); err == nil && mediaType != "application/octet-stream" {
+			input.MimeType = mediaType
+		} else if byExt := utils.VideoMimeType(ext); byExt != "" {
+			input.MimeType = byExt
+		} else {
+			input.MimeType = "application/octet-stream"
+		}
+	}
+	if input.Format == "" {
+		input.Format = strings.TrimPrefix(ext, ".")
+		if input.Format == "" {
+			_, subtype, _ := strings.Cut(input.MimeType, "/")
+			input.Format = subtype
+		}
+	}
+	return input
+}
+
+// saveImport records the import state. It uses its own context since the import's may be done.
+func (v *videoFileUC) saveImport(task *models.ImportTask) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	task.UpdatedAt = time.Now()
+	if err := v.redisRepo.SaveImport(ctx, task, importRetention); err != nil {
+		v.logger.Errorf("SaveImport of import %s error: %v", task.ImportID, err)
+	}
+}
+
+func (v *videoFileUC) abortUpload(bucket, key, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := v.awsRepo.AbortMultipartUpload(ctx, bucket, key, uploadID); err != nil {
+		v.logger.Errorf("AbortMultipartUpload of %s error: %v", key, err)
+	}
+}
+
+func (v *videoFileUC) removeObject(bucket, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := v.awsRepo.RemoveObject(ctx, bucket, key); err != nil {
+		v.logger.Errorf("RemoveObject of %s error: %v", key, err)
+	}
+}
+
+func (v *videoFileUC) maxImportSize() int64 {
+	if v.cfg.Import.MaxSizeMB > 0 {
+		return v.cfg.Import.MaxSizeMB << 20
+	}
+	return defaultImportMaxSizeMB << 20
+}
+
+func (v *videoFileUC) importQueueKey() string {
+	if v.cfg.Import.QueueKey != "" {
+		return v.cfg.Import.QueueKey
+	}
+	return models.DefaultImportQueueKey
+}
@@ -0,0 +1,139 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+)
+
+const (
+	defaultAbandonedUploadAge = 24 * time.Hour
+	janitorInterval           = time.Hour
+	uploadsPrefix             = "uploads/"
+	// Held until it runs out, a little under the interval so the next sweep finds it free
+	janitorLockTTL = janitorInterval - time.Minute
+)
+
+type uploadJanitor struct {
+	bucket    string
+	videoRepo videofiles.Repository
+	redisRepo videofiles.RedisRepository
+	awsRepo   videofiles.AWSRepository
+	logger    logger.Logger
+	maxAge    time.Duration
+}
+
+func NewUploadJanitor(cfg *config.Config, videoRepo videofiles.Repository, redisRepo videofiles.RedisRepository, awsRepo videofiles.AWSRepository, log logger.Logger) videofiles.UploadJanitor {
+	j := &uploadJanitor{
+		bucket:    cfg.S3.InputBucket,
+		videoRepo: videoRepo,
+		redisRepo: redisRepo,
+		awsRepo:   awsRepo,
+		logger:    log,
+		maxAge:    defaultAbandonedUploadAge,
+	}
+	if cfg.S3.AbandonedUploadHours > 0 {
+		j.maxAge = time.Duration(cfg.S3.AbandonedUploadHours) * time.Hour
+	}
+	return j
+}
+
+func (j *uploadJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		j.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep runs on one API replica per interval, the others find the lock taken.
+func (j *uploadJanitor) sweep(ctx context.Context) {
+	locked, err := j.redisRepo.LockUploadJanitor(ctx, janitorLockTTL)
+	if err != nil {
+		j.logger.Errorf("Upload janitor: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+	j.abortAbandoned(ctx)
+	j.removeAbandonedVideos(ctx)
+	j.removeAbandonedTails(ctx)
+}
+
+// abortAbandoned aborts multipart uploads started longer than maxAge ago, which frees the
+// storage their parts take up.
+func (j *uploadJanitor) abortAbandoned(ctx context.Context) {
+	uploads, err := j.awsRepo.ListMultipartUploads(ctx, j.bucket, uploadsPrefix)
+	if err != nil {
+		j.logger.Errorf("Upload janitor: failed to list multipart uploads: %v", err)
+		return
+	}
+	cutoff := time.Now().Add(-j.maxAge)
+	aborted := 0
+	for _, upload := range uploads {
+		if upload.Initiated.After(cutoff) {
+			continue
+		}
+		if err := j.awsRepo.AbortMultipartUpload(ctx, j.bucket, upload.Key, upload.UploadID); err != nil {
+			j.logger.Errorf("Upload janitor: %v", err)
+			continue
+		}
+		aborted++
+	}
+	if aborted > 0 {
+		j.logger.Infof("Upload janitor: aborted %d abandoned multipart uploads", aborted)
+	}
+}
+
+// removeAbandonedVideos deletes videos whose upload wasn't confirmed within maxAge, along with
+// whatever source object a client did upload for them.
+func (j *uploadJanitor) removeAbandonedVideos(ctx context.Context) {
+	videos, err := j.videoRepo.DeleteAbandonedUploads(ctx, time.Now().Add(-j.maxAge))
+	if err != nil {
+		j.logger.Errorf("Upload janitor: %v", err)
+		return
+	}
+	for _, video := range videos {
+		if err := j.awsRepo.RemoveObject(ctx, video.S3Bucket, video.S3Key); err != nil {
+			j.logger.Errorf("Upload janitor: source of video %s: %v", video.VideoID, err)
+		}
+	}
+	if len(videos) > 0 {
+		j.logger.Infof("Upload janitor: removed %d videos whose upload was never confirmed", len(videos))
+	}
+}
+
+// removeAbandonedTails removes the tails of tus uploads that weren't written to for maxAge. Their
+// state has expired from Redis by then, so they can't be resumed anymore.
+func (j *uploadJanitor) removeAbandonedTails(ctx context.Context) {
+	tails, err := j.awsRepo.ListObjectsWithPrefix(ctx, j.bucket, videofiles.TusTailPrefix)
+	if err != nil {
+		j.logger.Errorf("Upload janitor: failed to list tus tails: %v", err)
+		return
+	}
+	cutoff := time.Now().Add(-j.maxAge)
+	removed := 0
+	for _, tail := range tails {
+		if tail.LastModified.After(cutoff) {
+			continue
+		}
+		if err := j.awsRepo.RemoveObject(ctx, j.bucket, tail.Key); err != nil {
+			j.logger.Errorf("Upload janitor: %v", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		j.logger.Infof("Upload janitor: removed %d abandoned tus tails", removed)
+	}
+}
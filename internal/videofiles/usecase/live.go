@@ -0,0 +1,52 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+func (v *videoFileUC) CreateLiveVideo(ctx context.Context, input *models.VideoUploadInput) (*models.VideoFile, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		v.logger.Errorf("GetUserFromCtx: %v", err)
+		return nil, err
+	}
+	// The size of a recording is only known once the stream ends
+	if input.FileName == "" || input.Format == "" || input.MimeType == "" {
+		return nil, fmt.Errorf("invalid input: file name, format and mime type are required")
+	}
+	applyEncodeDefaults(input)
+	if err = checkEncryption(input); err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	videoFile, err := v.videoRepo.CreateVideo(ctx, v.newVideoFile(user.UserID, input, models.VideoStatusLive))
+	if err != nil {
+		v.logger.Errorf("CreateLiveVideo - CreateVideo error: %v", err)
+		return nil, err
+	}
+	return videoFile, nil
+}
+
+func (v *videoFileUC) CompleteLiveVideo(ctx context.Context, videoID uuid.UUID, fileSize int64, checksum string) (*models.CompletedUpload, error) {
+	video, err := v.GetVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	if video.Status != models.VideoStatusLive {
+		return nil, fmt.Errorf("video is not live")
+	}
+	finished, err := v.videoRepo.FinishLiveRecording(ctx, videoID, fileSize, checksum)
+	if err != nil {
+		v.logger.Errorf("CompleteLiveVideo - FinishLiveRecording error: %v", err)
+		return nil, fmt.Errorf("failed to finish live recording: %v", err)
+	}
+	if !finished {
+		return nil, fmt.Errorf("live recording already completed")
+	}
+	// From here on the recording is an upload like any other
+	return v.CompleteUpload(ctx, videoID)
+}
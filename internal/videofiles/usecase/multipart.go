@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	clientPartSize = 64 << 20
+	maxUploadParts = 10000
+)
+
+func (v *videoFileUC) StartMultipartUpload(ctx context.Context, videoID uuid.UUID) (*models.MultipartUpload, error) {
+	video, err := v.getPendingVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parts grow past the default for files that wouldn't fit in S3's part limit otherwise
+	partSize := max(int64(clientPartSize), (video.FileSize+maxUploadParts-1)/maxUploadParts)
+	checksummed := video.Checksum != ""
+	uploadID, err := v.awsRepo.CreateMultipartUpload(ctx, video.S3Bucket, video.S3Key, video.MimeType, checksummed)
+	if err != nil {
+		v.logger.Errorf("StartMultipartUpload - CreateMultipartUpload error: %v", err)
+		return nil, fmt.Errorf("failed to start upload: %v", err)
+	}
+	return &models.MultipartUpload{
+		VideoID:          videoID.String(),
+		UploadID:         uploadID,
+		Key:              video.S3Key,
+		PartSize:         partSize,
+		PartCount:        int((video.FileSize + partSize - 1) / partSize),
+		ChecksumRequired: checksummed,
+	}, nil
+}
+
+func (v *videoFileUC) GetUploadPartURL(ctx context.Context, videoID uuid.UUID, uploadID string, partNumber int32, checksum string) (*models.PartURL, error) {
+	if partNumber < 1 || partNumber > maxUploadParts {
+		return nil, fmt.Errorf("invalid part number: must be between 1 and %d", maxUploadParts)
+	}
+	video, err := v.getPendingVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	if video.Checksum != "" && checksum == "" {
+		return nil, fmt.Errorf("checksum is required: the video was declared with a sha256 checksum")
+	}
+	url, err := v.awsRepo.PresignUploadPart(ctx, video.S3Bucket, video.S3Key, uploadID, partNumber, checksum)
+	if err != nil {
+		v.logger.Errorf("GetUploadPartURL - PresignUploadPart error: %v", err)
+		return nil, fmt.Errorf("failed to presign part: %v", err)
+	}
+	return url, nil
+}
+
+func (v *videoFileUC) ListUploadParts(ctx context.Context, videoID uuid.UUID, uploadID string) ([]models.UploadedPart, error) {
+	video, err := v.getPendingVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := v.awsRepo.ListParts(ctx, video.S3Bucket, video.S3Key, uploadID)
+	if err != nil {
+		v.logger.Errorf("ListUploadParts - ListParts error: %v", err)
+		return nil, fmt.Errorf("failed to list parts: %v", err)
+	}
+	if parts == nil {
+		parts = make([]models.UploadedPart, 0)
+	}
+	return parts, nil
+}
+
+func (v *videoFileUC) CompleteMultipartUpload(ctx context.Context, videoID uuid.UUID, uploadID string, input *models.CompleteMultipartInput) (*models.CompletedUpload, error) {
+	if err := utils.ValidateStruct(ctx, input); err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	video, err := v.getPendingVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := input.Parts
+	if len(parts) == 0 {
+		if parts, err = v.awsRepo.ListParts(ctx, video.S3Bucket, video.S3Key, uploadID); err != nil {
+			v.logger.Errorf("CompleteMultipartUpload - ListParts error: %v", err)
+			return nil, fmt.Errorf("failed to list parts: %v", err)
+		}
+		if len(parts) == 0 {
+			return nil, fmt.Errorf("no parts have been uploaded")
+		}
+	}
+	if err = v.awsRepo.CompleteMultipartUpload(ctx, video.S3Bucket, video.S3Key, uploadID, parts); err != nil {
+		v.logger.Errorf("CompleteMultipartUpload - CompleteMultipartUpload error: %v", err)
+		return nil, fmt.Errorf("failed to complete upload: %v", err)
+	}
+	return v.CompleteUpload(ctx, videoID)
+}
+
+func (v *videoFileUC) AbortMultipartUpload(ctx context.Context, videoID uuid.UUID, uploadID string) error {
+	video, err := v.getPendingVideo(ctx, videoID)
+	if err != nil {
+		return err
+	}
+	if err = v.awsRepo.AbortMultipartUpload(ctx, video.S3Bucket, video.S3Key, uploadID); err != nil {
+		v.logger.Errorf("AbortMultipartUpload - AbortMultipartUpload error: %v", err)
+		return fmt.Errorf("failed to abort upload: %v", err)
+	}
+	return nil
+}
+
+// getPendingVideo returns the user's video if its upload is still open. Upload IDs are only
+// ever used together with the video's key, so S3 rejects IDs of uploads to other videos.
+func (v *videoFileUC) getPendingVideo(ctx context.Context, videoID uuid.UUID) (*models.VideoFile, error) {
+	video, err := v.GetVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	if video.Status != models.VideoStatusPendingUpload {
+		return nil, fmt.Errorf("upload already completed")
+	}
+	return video, nil
+}
@@ -0,0 +1,34 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/google/uuid"
+)
+
+// checkOverlays makes sure the images of the overlays are the user's, are images of a size the
+// encoder takes and are there to be burned in when the video is encoded. The worker checks the
+// bytes it downloads again, the object can change until then.
+func (v *videoFileUC) checkOverlays(ctx context.Context, userID uuid.UUID, overlays models.OverlayList) error {
+	if err := overlays.CheckOwner(userID.String()); err != nil {
+		return err
+	}
+	for i, overlay := range overlays {
+		if overlay.Type != models.OverlayImage {
+			continue
+		}
+		head, err := v.awsRepo.HeadObject(ctx, v.cfg.S3.InputBucket, overlay.ImageKey)
+		if err != nil {
+			return fmt.Errorf("overlay %d: image not found", i)
+		}
+		if head.ContentType == nil || !models.IsOverlayImageType(*head.ContentType) {
+			return fmt.Errorf("overlay %d: image must be a PNG, JPEG or WebP", i)
+		}
+		if head.ContentLength == nil || *head.ContentLength > models.MaxOverlayImageSize {
+			return fmt.Errorf("overlay %d: image is larger than %d MB", i, models.MaxOverlayImageSize>>20)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPlaybackTokenTTL = time.Hour
+	// Manifests are read into memory to be rewritten
+	maxManifestSize = 8 << 20
+)
+
+var (
+	hlsURIAttribute = regexp.MustCompile(`URI="([^"]*)"`)
+	mpdOpenTag      = regexp.MustCompile(`<MPD[\s>][^>]*>|<MPD>`)
+	mpdBaseURL      = regexp.MustCompile(`<BaseURL([^>]*)>([^<]*)</BaseURL>`)
+	mpdKeyURL       = regexp.MustCompile(`[^\s"'<>]*` + regexp.QuoteMeta(drm.KeyRoutePrefix+"/") + `[^\s"'<>]*`)
+)
+
+func (v *videoFileUC) CreatePlaybackToken(ctx context.Context, videoID uuid.UUID, input *models.PlaybackTokenInput, clientIP string) (*models.PlaybackToken, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		v.logger.Errorf("CreatePlaybackToken - failed to get user from context: %v", err)
+		return nil, err
+	}
+	if err = utils.ValidateStruct(ctx, input); err != nil {
+		v.logger.Errorf("CreatePlaybackToken - ValidateStruct error: %v", err)
+		return nil, fmt.Errorf("invalid playback token request: %w", err)
+	}
+	video, err := v.videoRepo.GetVideoByID(ctx, videoID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("video not found")
+		}
+		v.logger.Errorf("CreatePlaybackToken - failed to fetch video: %v", err)
+		return nil, fmt.Errorf("failed to fetch video: %v", err)
+	}
+	if video.UserID != user.UserID {
+		v.logger.Warnf("User %s is not authorized to play video %s", user.UserID, videoID)
+		return nil, fmt.Errorf("unauthorized access to video")
+	}
+
+	job, err := v.latestOutput(ctx, user.UserID, videoID)
+	if err != nil {
+		return nil, err
+	}
+	var output *models.OutputLocation
+	for _, location := range job.Outputs() {
+		if input.Format == "" || location.Format == input.Format {
+			output = &location
+			break
+		}
+	}
+	if output == nil {
+		return nil, fmt.Errorf("video has no %s output", input.Format)
+	}
+
+	claims := &utils.PlaybackClaims{
+		VideoID: videoID.String(),
+		UserID:  user.UserID.String(),
+		Bucket:  output.Bucket,
+		Prefix:  job.OutputS3Key,
+	}
+	if input.BindIP {
+		if clientIP == "" {
+			return nil, fmt.Errorf("client address is unknown")
+		}
+		claims.IP = clientIP
+	}
+	if input.Referrer != "" {
+		if claims.Referrer = utils.Origin(input.Referrer); claims.Referrer == "" {
+			return nil, fmt.Errorf("invalid referrer %q", input.Referrer)
+		}
+	}
+
+	expiresAt := time.Now().Add(v.playbackTTL(input.TTLSeconds))
+	token, err := utils.GeneratePlaybackToken(claims, utils.PlaybackSecret(v.cfg), expiresAt)
+	if err != nil {
+		v.logger.Errorf("CreatePlaybackToken - %v", err)
+		return nil, err
+	}
+	return &models.PlaybackToken{
+		Token:       token,
+		Format:      output.Format,
+		ManifestURL: v.playbackURL(token, path.Base(output.Key)),
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+func (v *videoFileUC) GetPlaybackObject(ctx context.Context, token, objectPath string, viewer *models.PlaybackViewer) (*models.PlaybackObject, error) {
+	claims, err := utils.ValidatePlaybackToken(token, utils.PlaybackSecret(v.cfg))
+	if err != nil {
+		return nil, videofiles.ErrPlaybackTokenInvalid
+	}
+	if !claims.Allows(viewer.IP, viewer.Referer) {
+		return nil, videofiles.ErrPlaybackForbidden
+	}
+	// Rooted before cleaning so that ".." can't climb out of the output
+	rel := strings.TrimPrefix(path.Clean("/"+objectPath), "/")
+	if rel == "" {
+		return nil, videofiles.ErrPlaybackNotFound
+	}
+	key := claims.Prefix + "/" + rel
+
+	switch strings.ToLower(path.Ext(rel)) {
+	case ".m3u8", ".mpd":
+		return v.playbackManifest(ctx, token, claims, rel, key)
+	}
+
+	if v.cfg.Playback.SegmentMode == models.PlaybackSegmentsPresign {
+		location, err := v.awsRepo.PresignGetObject(ctx, claims.Bucket, key, time.Until(claims.ExpiresAt.Time))
+		if err != nil {
+			v.logger.Warnf("GetPlaybackObject - %v", err)
+			return nil, videofiles.ErrPlaybackNotFound
+		}
+		return &models.PlaybackObject{Location: location}, nil
+	}
+	object, err := v.awsRepo.GetObject(ctx, claims.Bucket, key)
+	if err != nil {
+		v.logger.Warnf("GetPlaybackObject - %v", err)
+		return nil, videofiles.ErrPlaybackNotFound
+	}
+	playback := &models.PlaybackObject{Body: object.Body, ContentLength: -1}
+	if object.ContentType != nil {
+		playback.ContentType = *object.ContentType
+	}
+	if object.ContentLength != nil {
+		playback.ContentLength = *object.ContentLength
+	}
+	return playback, nil
+}
+
+// playbackManifest fetches a playlist or MPD and points its URIs at the playback route. In
+// presign mode HLS segments get presigned URLs instead; DASH segment templates can't carry a
+// signature per segment, so there the playback route redirects to them.
+func (v *videoFileUC) playbackManifest(ctx context.Context, token string, claims *utils.PlaybackClaims, rel, key string) (*models.PlaybackObject, error) {
+	object, err := v.awsRepo.GetObject(ctx, claims.Bucket, key)
+	if err != nil {
+		v.logger.Warnf("GetPlaybackObject - %v", err)
+		return nil, videofiles.ErrPlaybackNotFound
+	}
+	defer object.Body.Close()
+	manifest, err := io.ReadAll(io.LimitReader(object.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", rel, err)
+	}
+	if len(manifest) > maxManifestSize {
+		return nil, fmt.Errorf("manifest %s is too large to rewrite", rel)
+	}
+
+	dir := path.Dir(rel)
+	contentType := "application/vnd.apple.mpegurl"
+	if strings.EqualFold(path.Ext(rel), ".mpd") {
+		contentType = "application/dash+xml"
+		manifest, err = rewriteMPD(manifest, v.playbackURL(token, dir)+"/")
+		if err == nil {
+			// ClearKey license URLs are escaped like any other XML text
+			manifest = mpdKeyURL.ReplaceAllFunc(manifest, func(match []byte) []byte {
+				if uri, ok := addKeyToken(html.UnescapeString(string(match)), token); ok {
+					return []byte(html.EscapeString(uri))
+				}
+				return match
+			})
+		}
+	} else {
+		manifest, err = rewriteHLS(manifest, func(uri string) (string, error) {
+			if uri, ok := addKeyToken(uri, token); ok {
+				return uri, nil
+			}
+			target, ok := resolvePlaybackURI(dir, uri)
+			if !ok {
+				return uri, nil
+			}
+			if v.cfg.Playback.SegmentMode != models.PlaybackSegmentsPresign || strings.EqualFold(path.Ext(target), ".m3u8") {
+				return v.playbackURL(token, target), nil
+			}
+			return v.awsRepo.PresignGetObject(ctx, claims.Bucket, claims.Prefix+"/"+target, time.Until(claims.ExpiresAt.Time))
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewrite manifest %s: %w", rel, err)
+	}
+	return &models.PlaybackObject{
+		Body:          io.NopCloser(bytes.NewReader(manifest)),
+		ContentType:   contentType,
+		ContentLength: int64(len(manifest)),
+	}, nil
+}
+
+// resolvePlaybackInfo turns the object keys the worker stored in the playback info into
+// playback URLs under a token for the owner.
+func (v *videoFileUC) resolvePlaybackInfo(ctx context.Context, userID, videoID uuid.UUID, info *models.PlaybackInfo) error {
+	if info.Status != models.JobStatusCompleted {
+		return nil
+	}
+	job, err := v.latestOutput(ctx, userID, videoID)
+	if err != nil {
+		return err
+	}
+	claims := &utils.PlaybackClaims{
+		VideoID: videoID.String(),
+		UserID:  userID.String(),
+		Bucket:  job.OutputBucket,
+		Prefix:  job.OutputS3Key,
+	}
+	expiresAt := time.Now().Add(v.playbackTTL(0))
+	token, err := utils.GeneratePlaybackToken(claims, utils.PlaybackSecret(v.cfg), expiresAt)
+	if err != nil {
+		v.logger.Errorf("GetPlaybackInfo - %v", err)
+		return err
+	}
+
+	// Keys of an older output are left as they are rather than pointed at the wrong files
+	resolve := func(key string) string {
+		if rel, ok := strings.CutPrefix(key, job.OutputS3Key+"/"); ok {
+			return v.playbackURL(token, rel)
+		}
+		return key
+	}
+	info.Thumbnail = resolve(info.Thumbnail)
+	for quality, qualityInfo := range info.Qualities {
+		qualityInfo.URLs.HLS = resolve(qualityInfo.URLs.HLS)
+		qualityInfo.URLs.DASH = resolve(qualityInfo.URLs.DASH)
+		info.Qualities[quality] = qualityInfo
+	}
+	info.ExpiresAt = &expiresAt
+	return nil
+}
+
+// playbackTTL is how long a playback token lives: the configured TTL, or less when requested.
+func (v *videoFileUC) playbackTTL(requestedSeconds int) time.Duration {
+	ttl := defaultPlaybackTokenTTL
+	if v.cfg.Playback.TokenTTLSeconds > 0 {
+		ttl = time.Duration(v.cfg.Playback.TokenTTLSeconds) * time.Second
+	}
+	if requested := time.Duration(requestedSeconds) * time.Second; requested > 0 && requested < ttl {
+		ttl = requested
+	}
+	return ttl
+}
+
+// latestOutput returns the most recent completed encode job of a video.
+func (v *videoFileUC) latestOutput(ctx context.Context, userID, videoID uuid.UUID) (*models.EncodeJob, error) {
+	filter := &models.JobFilter{Status: models.JobStatusCompleted, VideoID: videoID.String()}
+	list, err := v.jobRepo.ListJobs(ctx, userID, filter, &utils.Pagination{Page: 1, Size: 1})
+	if err != nil {
+		v.logger.Errorf("latestOutput - ListJobs error: %v", err)
+		return nil, fmt.Errorf("failed to fetch encode jobs: %v", err)
+	}
+	if len(list.Jobs) == 0 || len(list.Jobs[0].Outputs()) == 0 {
+		return nil, videofiles.ErrPlaybackNotReady
+	}
+	return list.Jobs[0], nil
+}
+
+func (v *videoFileUC) playbackURL(token, rel string) string {
+	segments := strings.Split(strings.Trim(rel, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	escaped := strings.Join(segments, "/")
+	if escaped == "." {
+		escaped = ""
+	}
+	base := strings.TrimSuffix(v.cfg.Playback.PublicURL, "/") + videofiles.PlaybackRoutePrefix + "/" + token
+	if escaped == "" {
+		return base
+	}
+	return base + "/" + escaped
+}
+
+// addKeyToken adds the playback token to a URI of the key endpoint, which authorizes players
+// with it too. Other URIs are left alone.
+func addKeyToken(uri, token string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || !strings.HasPrefix(u.Path, drm.KeyRoutePrefix+"/") {
+		return uri, false
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), true
+}
+
+// resolvePlaybackURI resolves a manifest URI against the manifest's directory. URIs that are
+// absolute or leave the output are not ours to rewrite.
+func resolvePlaybackURI(dir, uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.IsAbs() || u.Host != "" || strings.HasPrefix(u.Path, "/") || u.Path == "" {
+		return "", false
+	}
+	target := path.Join(dir, u.Path)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return "", false
+	}
+	return target, true
+}
+
+// rewriteHLS passes every URI of a playlist, on its own line or in a URI attribute, through
+// resolve.
+func rewriteHLS(playlist []byte, resolve func(uri string) (string, error)) ([]byte, error) {
+	lines := strings.Split(string(playlist), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			var resolveErr error
+			lines[i] = hlsURIAttribute.ReplaceAllStringFunc(line, func(attr string) string {
+				resolved, err := resolve(hlsURIAttribute.FindStringSubmatch(attr)[1])
+				if err != nil {
+					resolveErr = err
+					return attr
+				}
+				return `URI="` + resolved + `"`
+			})
+			if resolveErr != nil {
+				return nil, resolveErr
+			}
+		default:
+			resolved, err := resolve(trimmed)
+			if err != nil {
+				return nil, err
+			}
+			lines[i] = resolved
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// rewriteMPD makes segment URLs resolve under base: relative BaseURLs are joined to it, and an
+// MPD without one gets base as its BaseURL.
+func rewriteMPD(mpd []byte, base string) ([]byte, error) {
+	open := mpdOpenTag.FindIndex(mpd)
+	if open == nil {
+		return nil, fmt.Errorf("no MPD element")
+	}
+	if mpdBaseURL.Match(mpd) {
+		return mpdBaseURL.ReplaceAllFunc(mpd, func(element []byte) []byte {
+			match := mpdBaseURL.FindSubmatch(element)
+			value := html.UnescapeString(string(match[2]))
+			u, err := url.Parse(value)
+			if err != nil || u.IsAbs() || strings.HasPrefix(value, "/") {
+				return element
+			}
+			return []byte("<BaseURL" + string(match[1]) + ">" + html.EscapeString(base+value) + "</BaseURL>")
+		}), nil
+	}
+
+	// BaseURL follows ProgramInformation in the MPD schema
+	at := open[1]
+	if end := bytes.Index(mpd[at:], []byte("</ProgramInformation>")); end >= 0 {
+		at += end + len("</ProgramInformation>")
+	}
+	rewritten := make([]byte, 0, len(mpd)+len(base)+32)
+	rewritten = append(rewritten, mpd[:at]...)
+	rewritten = append(rewritten, "\n  <BaseURL>"+html.EscapeString(base)+"</BaseURL>"...)
+	rewritten = append(rewritten, mpd[at:]...)
+	return rewritten, nil
+}
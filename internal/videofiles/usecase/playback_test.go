@@ -0,0 +1,151 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+)
+
+func TestResolvePlaybackURI(t *testing.T) {
+	tests := []struct {
+		dir    string
+		uri    string
+		want   string
+		wantOK bool
+	}{
+		{".", "video/media.m3u8", "video/media.m3u8", true},
+		{"video", "seg-1.m4s", "video/seg-1.m4s", true},
+		{"video", "seg-1.m4s?v=2", "video/seg-1.m4s", true},
+		{"video", "../audio/media.m3u8", "audio/media.m3u8", true},
+		{"video", "../../other-job/master.m3u8", "", false},
+		{".", "../master.m3u8", "", false},
+		{".", "..", "", false},
+		{".", "/videos/other/master.m3u8", "", false},
+		{".", "https://cdn.example.com/seg.m4s", "", false},
+		{".", "//cdn.example.com/seg.m4s", "", false},
+		{".", "data:text/plain,hi", "", false},
+		{".", "", "", false},
+		{".", "%zz", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := resolvePlaybackURI(tt.dir, tt.uri)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("resolvePlaybackURI(%q, %q) = %q, %v; want %q, %v", tt.dir, tt.uri, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestAddKeyToken(t *testing.T) {
+	keyURI := "https://api.example.com" + drm.KeyRoutePrefix + "/video-1/0"
+	tests := []struct {
+		uri    string
+		want   string
+		wantOK bool
+	}{
+		{keyURI, keyURI + "?token=tok", true},
+		{keyURI + "?token=forged", keyURI + "?token=tok", true},
+		{"https://api.example.com/api/v1/other", "https://api.example.com/api/v1/other", false},
+		{"seg-1.m4s", "seg-1.m4s", false},
+	}
+	for _, tt := range tests {
+		got, ok := addKeyToken(tt.uri, "tok")
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("addKeyToken(%q) = %q, %v; want %q, %v", tt.uri, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRewriteHLS(t *testing.T) {
+	playlist := "#EXTM3U\n" +
+		"#EXT-X-MAP:URI=\"init.mp4\"\n" +
+		"#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"https://keys.example.com/k\"\n" +
+		"#EXTINF:2.0,\n" +
+		"seg-1.m4s\n" +
+		"\n"
+	resolve := func(uri string) (string, error) {
+		return "https://play.example.com/t/" + uri, nil
+	}
+	got, err := rewriteHLS([]byte(playlist), resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "#EXTM3U\n" +
+		"#EXT-X-MAP:URI=\"https://play.example.com/t/init.mp4\"\n" +
+		"#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"https://play.example.com/t/https://keys.example.com/k\"\n" +
+		"#EXTINF:2.0,\n" +
+		"https://play.example.com/t/seg-1.m4s\n" +
+		"\n"
+	if string(got) != want {
+		t.Errorf("rewriteHLS() =\n%s\nwant\n%s", got, want)
+	}
+
+	fail := func(uri string) (string, error) {
+		if uri == "init.mp4" {
+			return "", fmt.Errorf("no")
+		}
+		return uri, nil
+	}
+	if _, err := rewriteHLS([]byte(playlist), fail); err == nil {
+		t.Error("rewriteHLS() ignored an error resolving an attribute URI")
+	}
+}
+
+func TestRewriteMPD(t *testing.T) {
+	const base = "https://play.example.com/api/v1/play/tok/"
+	tests := []struct {
+		name    string
+		mpd     string
+		want    []string
+		notWant []string
+		wantErr bool
+	}{
+		{
+			name: "no BaseURL",
+			mpd:  `<?xml version="1.0"?><MPD xmlns="urn:mpeg:dash:schema:mpd:2011"><Period/></MPD>`,
+			want: []string{"<MPD xmlns=\"urn:mpeg:dash:schema:mpd:2011\">\n  <BaseURL>" + base + "</BaseURL><Period/>"},
+		},
+		{
+			name: "after ProgramInformation",
+			mpd:  `<MPD><ProgramInformation><Title>t</Title></ProgramInformation><Period/></MPD>`,
+			want: []string{"</ProgramInformation>\n  <BaseURL>" + base + "</BaseURL><Period/>"},
+		},
+		{
+			name: "relative BaseURL",
+			mpd:  `<MPD><Period><BaseURL>video/</BaseURL></Period></MPD>`,
+			want: []string{"<BaseURL>" + base + "video/</BaseURL>"},
+		},
+		{
+			name:    "absolute BaseURL",
+			mpd:     `<MPD><BaseURL>https://cdn.example.com/</BaseURL></MPD>`,
+			want:    []string{"<BaseURL>https://cdn.example.com/</BaseURL>"},
+			notWant: []string{base},
+		},
+		{
+			name:    "rooted BaseURL",
+			mpd:     `<MPD><BaseURL>/other/</BaseURL></MPD>`,
+			want:    []string{"<BaseURL>/other/</BaseURL>"},
+			notWant: []string{base},
+		},
+		{name: "not an MPD", mpd: `<html></html>`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rewriteMPD([]byte(tt.mpd), base)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rewriteMPD() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(got), s) {
+					t.Errorf("rewriteMPD() = %s, want it to contain %s", got, s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(string(got), s) {
+					t.Errorf("rewriteMPD() = %s, want it not to contain %s", got, s)
+				}
+			}
+		})
+	}
+}
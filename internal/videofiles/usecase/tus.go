@@ -0,0 +1,356 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	// A PATCH holds the lock while it streams, so it has to cover a slow chunk
+	tusLockTTL = time.Hour
+)
+
+var checksumPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// CreateTusUpload starts a tus upload. The metadata must name the file (filename) and its MIME
+// type (filetype); format and a hex SHA-256 checksum of the whole file are optional.
+func (v *videoFileUC) CreateTusUpload(ctx context.Context, input *models.TusUploadInput) (*models.TusUpload, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		v.logger.Errorf("CreateTusUpload - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	if input.Length <= 0 {
+		return nil, fmt.Errorf("invalid upload length")
+	}
+	if input.Length > videofiles.MaxTusUploadSize {
+		return nil, videofiles.ErrUploadTooLarge
+	}
+	fileName := input.Metadata["filename"]
+	mimeType := input.Metadata["filetype"]
+	if fileName == "" || mimeType == "" || len(fileName) > 255 || strings.ContainsAny(fileName, "/\\") {
+		return nil, fmt.Errorf("invalid metadata: filename and filetype are required")
+	}
+	format := input.Metadata["format"]
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	}
+	checksum := input.Metadata["checksum"]
+	if checksum != "" && !checksumPattern.MatchString(checksum) {
+		return nil, fmt.Errorf("invalid metadata: checksum must be a hex sha256")
+	}
+
+	upload := &models.TusUpload{
+		ID:        uuid.New().String(),
+		UserID:    user.UserID.String(),
+		Bucket:    v.cfg.S3.InputBucket,
+		Key:       fmt.Sprintf("uploads/%s/%s", user.UserID, fileName),
+		Length:    input.Length,
+		PartSize:  videofiles.TusPartSize,
+		FileName:  fileName,
+		MimeType:  mimeType,
+		Format:    format,
+		Checksum:  strings.ToLower(checksum),
+		CreatedAt: time.Now(),
+	}
+	if upload.UploadID, err = v.awsRepo.CreateMultipartUpload(ctx, upload.Bucket, upload.Key, mimeType, false); err != nil {
+		v.logger.Errorf("CreateTusUpload - CreateMultipartUpload error: %v", err)
+		return nil, fmt.Errorf("failed to start upload: %v", err)
+	}
+	if err = v.redisRepo.SaveTusUpload(ctx, upload, v.uploadTTL()); err != nil {
+		v.logger.Errorf("CreateTusUpload - SaveTusUpload error: %v", err)
+		return nil, fmt.Errorf("failed to start upload: %v", err)
+	}
+	return upload, nil
+}
+
+func (v *videoFileUC) GetTusUpload(ctx context.Context, id string) (*models.TusUpload, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		v.logger.Errorf("GetTusUpload - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	upload, err := v.redisRepo.GetTusUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.UserID != user.UserID.String() {
+		v.logger.Warnf("User %s is not authorized to access upload %s", user.UserID, id)
+		return nil, videofiles.ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+func (v *videoFileUC) WriteTusChunk(ctx context.Context, id string, offset int64, body io.Reader) (*models.TusUpload, error) {
+	unlock, err := v.lockTusUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	upload, err := v.GetTusUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, videofiles.ErrUploadOffsetMismatch
+	}
+	hasher, err := restoreHash(upload)
+	if err != nil {
+		return nil, err
+	}
+
+	// The state only ever moves on to bytes that are stored: full parts in S3, the rest as tail.
+	// If anything fails on the way the client resumes from the last saved offset.
+	buf := make([]byte, min(upload.PartSize, videofiles.TusPartSize))
+	filled, err := v.loadTusTail(ctx, upload, buf)
+	if err != nil {
+		return nil, err
+	}
+	reader := io.LimitReader(body, upload.Length-upload.Offset)
+	var readErr error
+	for {
+		n, err := io.ReadFull(reader, buf[filled:])
+		hasher.Write(buf[filled : filled+n])
+		filled += n
+		upload.Offset += int64(n)
+
+		if filled == len(buf) && upload.Offset < upload.Length {
+			if err := v.uploadTusPart(ctx, upload, buf, hasher); err != nil {
+				return nil, err
+			}
+			filled = 0
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				// Keep what arrived before the connection broke, tus clients resume from there
+				readErr = err
+			}
+			break
+		}
+	}
+
+	if upload.Offset < upload.Length {
+		if err = v.saveTusTail(ctx, upload, buf[:filled], hasher); err != nil {
+			return nil, err
+		}
+		if readErr != nil {
+			return upload, fmt.Errorf("failed to read chunk: %v", readErr)
+		}
+		return upload, nil
+	}
+
+	if err = v.uploadTusPart(ctx, upload, buf[:filled], hasher); err != nil {
+		return nil, err
+	}
+	return v.finishTusUpload(ctx, upload, hasher)
+}
+
+func (v *videoFileUC) TerminateTusUpload(ctx context.Context, id string) error {
+	unlock, err := v.lockTusUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	upload, err := v.GetTusUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err = v.awsRepo.AbortMultipartUpload(ctx, upload.Bucket, upload.Key, upload.UploadID); err != nil {
+		v.logger.Errorf("TerminateTusUpload - AbortMultipartUpload error: %v", err)
+		return fmt.Errorf("failed to terminate upload: %v", err)
+	}
+	if err = v.redisRepo.DeleteTusUpload(ctx, id); err != nil {
+		v.logger.Errorf("TerminateTusUpload - DeleteTusUpload error: %v", err)
+		return fmt.Errorf("failed to terminate upload: %v", err)
+	}
+	v.removeTusTail(ctx, upload)
+	return nil
+}
+
+// uploadTusPart sends data as the next part and saves the state, so the part survives a later
+// failure in the same request.
+func (v *videoFileUC) uploadTusPart(ctx context.Context, upload *models.TusUpload, data []byte, hasher hash.Hash) error {
+	part, err := v.awsRepo.UploadPart(ctx, upload.Bucket, upload.Key, upload.UploadID, int32(len(upload.Parts)+1), data)
+	if err != nil {
+		v.logger.Errorf("WriteTusChunk - UploadPart error: %v", err)
+		return fmt.Errorf("failed to store chunk: %v", err)
+	}
+	upload.Parts = append(upload.Parts, *part)
+	// The tail went into the part, whatever is left in its object isn't part of the upload
+	upload.TailSize = 0
+	return v.saveTusUpload(ctx, upload, hasher)
+}
+
+// saveTusTail stores the bytes that don't fill a part yet and then the state. The state names
+// how much of the tail object belongs to the upload, so an object written by a request that
+// failed before saving the state can't add bytes.
+func (v *videoFileUC) saveTusTail(ctx context.Context, upload *models.TusUpload, tail []byte, hasher hash.Hash) error {
+	if len(tail) > 0 {
+		if _, err := v.awsRepo.PutObject(ctx, models.UploadInput{
+			File:       bytes.NewReader(tail),
+			Name:       upload.ID,
+			MimeType:   "application/octet-stream",
+			Size:       int64(len(tail)),
+			Key:        tusTailKey(upload.ID),
+			BucketName: upload.Bucket,
+		}); err != nil {
+			v.logger.Errorf("WriteTusChunk - PutObject error: %v", err)
+			return fmt.Errorf("failed to store chunk: %v", err)
+		}
+	}
+	upload.TailSize = int64(len(tail))
+	return v.saveTusUpload(ctx, upload, hasher)
+}
+
+// loadTusTail reads the upload's tail into the start of buf and returns its length.
+func (v *videoFileUC) loadTusTail(ctx context.Context, upload *models.TusUpload, buf []byte) (int, error) {
+	if upload.TailSize == 0 {
+		return 0, nil
+	}
+	if upload.TailSize > int64(len(buf)) {
+		return 0, fmt.Errorf("failed to load upload: tail exceeds the part size")
+	}
+	object, err := v.awsRepo.GetObject(ctx, upload.Bucket, tusTailKey(upload.ID))
+	if err != nil {
+		v.logger.Errorf("WriteTusChunk - GetObject error: %v", err)
+		return 0, fmt.Errorf("failed to load upload: %v", err)
+	}
+	defer object.Body.Close()
+	n, err := io.ReadFull(object.Body, buf[:upload.TailSize])
+	if err != nil {
+		return 0, fmt.Errorf("failed to load upload: %v", err)
+	}
+	return n, nil
+}
+
+func (v *videoFileUC) removeTusTail(ctx context.Context, upload *models.TusUpload) {
+	// Uploads that never had a tail have nothing to remove, which S3 doesn't mind
+	if err := v.awsRepo.RemoveObject(ctx, upload.Bucket, tusTailKey(upload.ID)); err != nil {
+		v.logger.Errorf("RemoveTusTail error: %v", err)
+	}
+}
+
+func (v *videoFileUC) saveTusUpload(ctx context.Context, upload *models.TusUpload, hasher hash.Hash) error {
+	if upload.Checksum != "" {
+		state, err := hasher.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("failed to save checksum state: %v", err)
+		}
+		upload.HashState = state
+	}
+	if err := v.redisRepo.SaveTusUpload(ctx, upload, v.uploadTTL()); err != nil {
+		v.logger.Errorf("WriteTusChunk - SaveTusUpload error: %v", err)
+		return fmt.Errorf("failed to save upload: %v", err)
+	}
+	return nil
+}
+
+// finishTusUpload assembles the object, creates its video and completes the upload.
+func (v *videoFileUC) finishTusUpload(ctx context.Context, upload *models.TusUpload, hasher hash.Hash) (*models.TusUpload, error) {
+	// Checked before completing, the key may hold the source of another video already
+	if upload.Checksum != "" && hex.EncodeToString(hasher.Sum(nil)) != upload.Checksum {
+		if err := v.awsRepo.AbortMultipartUpload(ctx, upload.Bucket, upload.Key, upload.UploadID); err != nil {
+			v.logger.Errorf("WriteTusChunk - AbortMultipartUpload error: %v", err)
+		}
+		if err := v.redisRepo.DeleteTusUpload(ctx, upload.ID); err != nil {
+			v.logger.Errorf("WriteTusChunk - DeleteTusUpload error: %v", err)
+		}
+		v.removeTusTail(ctx, upload)
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+
+	if err := v.awsRepo.CompleteMultipartUpload(ctx, upload.Bucket, upload.Key, upload.UploadID, upload.Parts); err != nil {
+		v.logger.Errorf("WriteTusChunk - CompleteMultipartUpload error: %v", err)
+		return nil, fmt.Errorf("failed to complete upload: %v", err)
+	}
+	// The multipart upload is gone now, the state can't be resumed either way
+	if err := v.redisRepo.DeleteTusUpload(ctx, upload.ID); err != nil {
+		v.logger.Errorf("WriteTusChunk - DeleteTusUpload error: %v", err)
+	}
+	v.removeTusTail(ctx, upload)
+
+	userID, err := uuid.Parse(upload.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload owner: %v", err)
+	}
+	input := &models.VideoUploadInput{
+		FileName: upload.FileName,
+		FileSize: upload.Length,
+		Format:   upload.Format,
+		MimeType: upload.MimeType,
+	}
+	applyEncodeDefaults(input)
+	// The checksum was verified above over the bytes as they came in
+	video, err := v.videoRepo.CreateVideo(ctx, v.newVideoFile(userID, input, models.VideoStatusPendingUpload))
+	if err != nil {
+		v.logger.Errorf("WriteTusChunk - CreateVideo error: %v", err)
+		return nil, fmt.Errorf("failed to create video: %v", err)
+	}
+	upload.VideoID = video.VideoID.String()
+
+	if _, err = v.CompleteUpload(ctx, video.VideoID); err != nil {
+		// The video stays pending, complete-upload can be retried for it
+		v.logger.Errorf("WriteTusChunk - CompleteUpload of video %s error: %v", video.VideoID, err)
+		return upload, fmt.Errorf("upload of video %s is stored but failed to complete, retry complete-upload: %v", video.VideoID, err)
+	}
+	return upload, nil
+}
+
+func tusTailKey(id string) string {
+	return videofiles.TusTailPrefix + id
+}
+
+// lockTusUpload makes sure only one request at a time writes to an upload.
+func (v *videoFileUC) lockTusUpload(ctx context.Context, id string) (func(), error) {
+	locked, err := v.redisRepo.LockTusUpload(ctx, id, tusLockTTL)
+	if err != nil {
+		v.logger.Errorf("LockTusUpload error: %v", err)
+		return nil, fmt.Errorf("failed to lock upload: %v", err)
+	}
+	if !locked {
+		return nil, videofiles.ErrUploadLocked
+	}
+	return func() {
+		// The request context may be gone by now
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := v.redisRepo.UnlockTusUpload(unlockCtx, id); err != nil {
+			v.logger.Errorf("UnlockTusUpload error: %v", err)
+		}
+	}, nil
+}
+
+func (v *videoFileUC) uploadTTL() time.Duration {
+	if v.cfg.S3.AbandonedUploadHours > 0 {
+		return time.Duration(v.cfg.S3.AbandonedUploadHours) * time.Hour
+	}
+	return defaultAbandonedUploadAge
+}
+
+func restoreHash(upload *models.TusUpload) (hash.Hash, error) {
+	hasher := sha256.New()
+	if upload.Checksum != "" && len(upload.HashState) > 0 {
+		if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.HashState); err != nil {
+			return nil, fmt.Errorf("failed to restore checksum state: %v", err)
+		}
+	}
+	return hasher, nil
+}
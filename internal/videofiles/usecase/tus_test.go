@@ -0,0 +1,381 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+const testPartSize = 8
+
+var testUserID = uuid.MustParse("9f1c2d3e-0000-4000-8000-000000000002")
+
+// fakeTusRedis keeps the upload state serialized, like Redis does, so the usecase can't lean on
+// changes to a pointer it handed over earlier.
+type fakeTusRedis struct {
+	videofiles.RedisRepository
+	state    map[string][]byte
+	locked   map[string]bool
+	failSave bool
+}
+
+func (r *fakeTusRedis) SaveTusUpload(_ context.Context, upload *models.TusUpload, _ time.Duration) error {
+	if r.failSave {
+		return errors.New("redis down")
+	}
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	r.state[upload.ID] = data
+	return nil
+}
+
+func (r *fakeTusRedis) GetTusUpload(_ context.Context, id string) (*models.TusUpload, error) {
+	data, ok := r.state[id]
+	if !ok {
+		return nil, videofiles.ErrUploadNotFound
+	}
+	upload := &models.TusUpload{}
+	return upload, json.Unmarshal(data, upload)
+}
+
+func (r *fakeTusRedis) DeleteTusUpload(_ context.Context, id string) error {
+	delete(r.state, id)
+	return nil
+}
+
+func (r *fakeTusRedis) LockTusUpload(_ context.Context, id string, _ time.Duration) (bool, error) {
+	if r.locked[id] {
+		return false, nil
+	}
+	r.locked[id] = true
+	return true, nil
+}
+
+func (r *fakeTusRedis) UnlockTusUpload(_ context.Context, id string) error {
+	delete(r.locked, id)
+	return nil
+}
+
+type fakeTusStore struct {
+	videofiles.AWSRepository
+	parts     map[int32][]byte
+	objects   map[string][]byte
+	assembled []byte
+	removed   []string
+	aborted   bool
+	failPart  bool
+}
+
+func (s *fakeTusStore) UploadPart(_ context.Context, _, _, _ string, partNumber int32, data []byte) (*models.UploadedPart, error) {
+	if s.failPart {
+		return nil, errors.New("s3 down")
+	}
+	s.parts[partNumber] = append([]byte(nil), data...)
+	return &models.UploadedPart{PartNumber: partNumber, ETag: fmt.Sprintf("etag-%d", partNumber), Size: int64(len(data))}, nil
+}
+
+func (s *fakeTusStore) PutObject(_ context.Context, input models.UploadInput) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(input.File)
+	if err != nil {
+		return nil, err
+	}
+	s.objects[input.Key] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (s *fakeTusStore) GetObject(_ context.Context, _, key string) (*s3.GetObjectOutput, error) {
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (s *fakeTusStore) RemoveObject(_ context.Context, _, key string) error {
+	delete(s.objects, key)
+	s.removed = append(s.removed, key)
+	return nil
+}
+
+func (s *fakeTusStore) AbortMultipartUpload(context.Context, string, string, string) error {
+	s.aborted = true
+	return nil
+}
+
+func (s *fakeTusStore) CompleteMultipartUpload(_ context.Context, _, _, _ string, parts []models.UploadedPart) error {
+	s.assembled = nil
+	for i, part := range parts {
+		if part.PartNumber != int32(i+1) {
+			return fmt.Errorf("part %d listed as number %d", i+1, part.PartNumber)
+		}
+		// S3 rejects parts below the minimum size unless they come last
+		if i < len(parts)-1 && len(s.parts[part.PartNumber]) != testPartSize {
+			return fmt.Errorf("part %d has %d bytes", part.PartNumber, len(s.parts[part.PartNumber]))
+		}
+		s.assembled = append(s.assembled, s.parts[part.PartNumber]...)
+	}
+	return nil
+}
+
+type nopLogger struct {
+	logger.Logger
+}
+
+func (nopLogger) Warnf(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+// brokenReader returns data and then fails, like a connection dropped mid-chunk.
+type brokenReader struct {
+	data []byte
+}
+
+func (r *brokenReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// newTusTest sets up an upload of data whose declared checksum doesn't match, so that the last
+// chunk stops at the checksum check with all parts uploaded rather than creating a video.
+func newTusTest(t *testing.T, data []byte) (*videoFileUC, *fakeTusRedis, *fakeTusStore, context.Context) {
+	t.Helper()
+	redis := &fakeTusRedis{state: map[string][]byte{}, locked: map[string]bool{}}
+	store := &fakeTusStore{parts: map[int32][]byte{}, objects: map[string][]byte{}}
+	uc := &videoFileUC{cfg: &config.Config{}, redisRepo: redis, awsRepo: store, logger: nopLogger{}}
+	upload := &models.TusUpload{
+		ID:       "upload-1",
+		UserID:   testUserID.String(),
+		Bucket:   "in",
+		Key:      "uploads/u/video.mp4",
+		UploadID: "s3-upload-1",
+		Length:   int64(len(data)),
+		PartSize: testPartSize,
+		Checksum: hex.EncodeToString(make([]byte, sha256.Size)),
+	}
+	if err := redis.SaveTusUpload(context.Background(), upload, 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), utils.UserCtxKey{}, &models.User{UserID: testUserID})
+	return uc, redis, store, ctx
+}
+
+// checkTusState checks that the saved offset and checksum state cover exactly data[:offset].
+func checkTusState(t *testing.T, redis *fakeTusRedis, data []byte, offset int64) {
+	t.Helper()
+	upload, err := redis.GetTusUpload(context.Background(), "upload-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Offset != offset {
+		t.Fatalf("saved offset = %d, want %d", upload.Offset, offset)
+	}
+	hasher, err := restoreHash(upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hasher.Sum(nil), sha256.Sum256(data[:offset]); !bytes.Equal(got, want[:]) {
+		t.Errorf("saved checksum state doesn't cover the first %d bytes", offset)
+	}
+}
+
+// checkAssembled checks that the parts uploaded by the time the last chunk stopped at the checksum
+// hold data, and that the upload was aborted rather than completed.
+func checkAssembled(t *testing.T, err error, redis *fakeTusRedis, store *fakeTusStore, data []byte) {
+	t.Helper()
+	if err == nil || err.Error() != "checksum mismatch" {
+		t.Fatalf("WriteTusChunk() of the last chunk error = %v, want checksum mismatch", err)
+	}
+	var parts []byte
+	for i := 1; i <= len(store.parts); i++ {
+		part := store.parts[int32(i)]
+		if i < len(store.parts) && len(part) != testPartSize {
+			t.Errorf("part %d has %d bytes, want %d", i, len(part), testPartSize)
+		}
+		parts = append(parts, part...)
+	}
+	if !bytes.Equal(parts, data) {
+		t.Errorf("parts hold %q, want %q", parts, data)
+	}
+	if !store.aborted || store.assembled != nil {
+		t.Error("upload that failed its checksum was completed instead of aborted")
+	}
+	if slices.Contains(store.removed, "uploads/u/video.mp4") {
+		t.Error("removed the upload key, which may hold another video's source")
+	}
+	if _, ok := redis.state["upload-1"]; ok {
+		t.Error("upload state kept after aborting")
+	}
+	if _, ok := store.objects[tusTailKey("upload-1")]; ok {
+		t.Error("tail object kept after aborting")
+	}
+}
+
+func ones(n int) []int {
+	sizes := make([]int, n)
+	for i := range sizes {
+		sizes[i] = 1
+	}
+	return sizes
+}
+
+func TestWriteTusChunks(t *testing.T) {
+	data := []byte("abcdefghijklmnopqrstuvwxyz0123456789")
+	tests := []struct {
+		name   string
+		chunks []int
+	}{
+		{"one chunk", []int{36}},
+		{"byte by byte", ones(36)},
+		{"part sized", []int{8, 8, 8, 8, 4}},
+		{"across parts", []int{3, 7, 11, 2, 13}},
+		{"ends on a part", []int{5, 3, 28}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, redis, store, ctx := newTusTest(t, data)
+			var offset int64
+			for i, size := range tt.chunks {
+				chunk := data[offset : offset+int64(size)]
+				upload, err := uc.WriteTusChunk(ctx, "upload-1", offset, bytes.NewReader(chunk))
+				offset += int64(size)
+				if i == len(tt.chunks)-1 {
+					checkAssembled(t, err, redis, store, data)
+					break
+				}
+				if err != nil {
+					t.Fatalf("WriteTusChunk() error = %v", err)
+				}
+				if upload.Offset != offset {
+					t.Fatalf("WriteTusChunk() offset = %d, want %d", upload.Offset, offset)
+				}
+				checkTusState(t, redis, data, offset)
+			}
+		})
+	}
+}
+
+func TestWriteTusChunkOffsetMismatch(t *testing.T) {
+	data := []byte("abcdefghijklmnopqrst")
+	uc, redis, _, ctx := newTusTest(t, data)
+	if _, err := uc.WriteTusChunk(ctx, "upload-1", 0, bytes.NewReader(data[:5])); err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range []int64{0, 4, 6, 20} {
+		upload, err := uc.WriteTusChunk(ctx, "upload-1", offset, bytes.NewReader(data[5:10]))
+		if !errors.Is(err, videofiles.ErrUploadOffsetMismatch) {
+			t.Errorf("WriteTusChunk() at %d error = %v, want %v", offset, err, videofiles.ErrUploadOffsetMismatch)
+		}
+		if upload == nil || upload.Offset != 5 {
+			t.Errorf("WriteTusChunk() at %d returned %+v, want the current offset 5", offset, upload)
+		}
+	}
+	checkTusState(t, redis, data, 5)
+}
+
+func TestWriteTusChunkIgnoresExtraBytes(t *testing.T) {
+	data := []byte("abcdefghijklmnopqrst")
+	uc, redis, store, ctx := newTusTest(t, data)
+	_, err := uc.WriteTusChunk(ctx, "upload-1", 0, bytes.NewReader(append(append([]byte(nil), data...), "overflow"...)))
+	checkAssembled(t, err, redis, store, data)
+}
+
+func TestWriteTusChunkResumesAfterBrokenConnection(t *testing.T) {
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	uc, redis, store, ctx := newTusTest(t, data)
+
+	upload, err := uc.WriteTusChunk(ctx, "upload-1", 0, &brokenReader{data: data[:11]})
+	if err == nil {
+		t.Fatal("WriteTusChunk() hid the read error")
+	}
+	if upload == nil || upload.Offset != 11 {
+		t.Fatalf("WriteTusChunk() returned %+v, want the bytes before the break kept", upload)
+	}
+	checkTusState(t, redis, data, 11)
+	if _, ok := redis.locked["upload-1"]; ok {
+		t.Error("upload still locked after the request")
+	}
+
+	_, err = uc.WriteTusChunk(ctx, "upload-1", 11, bytes.NewReader(data[11:]))
+	checkAssembled(t, err, redis, store, data)
+}
+
+func TestWriteTusChunkFailedPart(t *testing.T) {
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	uc, redis, store, ctx := newTusTest(t, data)
+	if _, err := uc.WriteTusChunk(ctx, "upload-1", 0, bytes.NewReader(data[:10])); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second part fails, the client resumes from what was saved before it
+	store.failPart = true
+	if _, err := uc.WriteTusChunk(ctx, "upload-1", 10, bytes.NewReader(data[10:20])); err == nil {
+		t.Fatal("WriteTusChunk() hid the part error")
+	}
+	checkTusState(t, redis, data, 10)
+
+	store.failPart = false
+	_, err := uc.WriteTusChunk(ctx, "upload-1", 10, bytes.NewReader(data[10:]))
+	checkAssembled(t, err, redis, store, data)
+}
+
+func TestWriteTusChunkIgnoresUnsavedTail(t *testing.T) {
+	data := []byte("abcdefghijklmnopqrst")
+	uc, redis, store, ctx := newTusTest(t, data)
+	if _, err := uc.WriteTusChunk(ctx, "upload-1", 0, bytes.NewReader(data[:2])); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tail object is written but saving the state fails, so the longer tail isn't trusted
+	redis.failSave = true
+	if _, err := uc.WriteTusChunk(ctx, "upload-1", 2, bytes.NewReader(data[2:5])); err == nil {
+		t.Fatal("WriteTusChunk() hid the save error")
+	}
+	redis.failSave = false
+	if got := store.objects[tusTailKey("upload-1")]; !bytes.Equal(got, data[:5]) {
+		t.Fatalf("tail object = %q, want the unsaved tail %q", got, data[:5])
+	}
+	checkTusState(t, redis, data, 2)
+
+	_, err := uc.WriteTusChunk(ctx, "upload-1", 2, bytes.NewReader(data[2:]))
+	checkAssembled(t, err, redis, store, data)
+}
+
+func TestWriteTusChunkAccess(t *testing.T) {
+	data := []byte("abcdefghij")
+	uc, redis, _, ctx := newTusTest(t, data)
+
+	other := context.WithValue(context.Background(), utils.UserCtxKey{}, &models.User{UserID: uuid.New()})
+	if _, err := uc.WriteTusChunk(other, "upload-1", 0, bytes.NewReader(data)); !errors.Is(err, videofiles.ErrUploadNotFound) {
+		t.Errorf("WriteTusChunk() by another user error = %v, want %v", err, videofiles.ErrUploadNotFound)
+	}
+	if _, err := uc.WriteTusChunk(ctx, "upload-2", 0, bytes.NewReader(data)); !errors.Is(err, videofiles.ErrUploadNotFound) {
+		t.Errorf("WriteTusChunk() of an unknown upload error = %v, want %v", err, videofiles.ErrUploadNotFound)
+	}
+
+	redis.locked["upload-1"] = true
+	if _, err := uc.WriteTusChunk(ctx, "upload-1", 0, bytes.NewReader(data)); !errors.Is(err, videofiles.ErrUploadLocked) {
+		t.Errorf("WriteTusChunk() of a locked upload error = %v, want %v", err, videofiles.ErrUploadLocked)
+	}
+	checkTusState(t, redis, data, 0)
+}
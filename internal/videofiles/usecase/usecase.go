@@ -2,15 +2,24 @@ package usecase
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/jobs"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
+	"io"
+	"mime"
+	"strings"
 	"time"
 )
 
@@ -19,6 +28,8 @@ type videoFileUC struct {
 	videoRepo videofiles.Repository
 	redisRepo videofiles.RedisRepository
 	awsRepo   videofiles.AWSRepository
+	jobRepo   jobs.Repository
+	webhooks  webhooks.Dispatcher
 	logger    logger.Logger
 }
 
@@ -27,6 +38,8 @@ func NewVideoUseCase(
 	videoRepo videofiles.Repository,
 	redisRepo videofiles.RedisRepository,
 	awsRepo videofiles.AWSRepository,
+	jobRepo jobs.Repository,
+	webhookDispatcher webhooks.Dispatcher,
 	log logger.Logger,
 ) videofiles.UseCase {
 	return &videoFileUC{
@@ -34,6 +47,8 @@ func NewVideoUseCase(
 		videoRepo: videoRepo,
 		redisRepo: redisRepo,
 		awsRepo:   awsRepo,
+		jobRepo:   jobRepo,
+		webhooks:  webhookDispatcher,
 		logger:    log,
 	}
 }
@@ -77,17 +92,15 @@ func (v *videoFileUC) CreateVideo(ctx context.Context, input *models.VideoUpload
 		v.logger.Errorf("UploadVideo - ValidateStruct error: %v", err)
 		return nil, fmt.Errorf("invalid input: %v", err)
 	}
-	videoFile := &models.VideoFile{
-		UserID:   user.UserID,
-		FileName: input.FileName,
-		FileSize: input.FileSize,
-		Duration: 0,
-		S3Key:    fmt.Sprintf("uploads/%s/%s", user.UserID, input.FileName),
-		Status:   models.JobStatusQueued,
-		S3Bucket: v.cfg.S3.InputBucket,
-		Format:   input.Format,
-	}
-	videoFile, err = v.videoRepo.CreateVideo(ctx, videoFile)
+	applyEncodeDefaults(input)
+	if err = checkEncryption(input); err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	if err = v.checkOverlays(ctx, user.UserID, input.Overlays); err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	// The video waits for CompleteUpload to confirm the object landed before it is encoded
+	videoFile, err := v.videoRepo.CreateVideo(ctx, v.newVideoFile(user.UserID, input, models.VideoStatusPendingUpload))
 	if err != nil {
 		v.logger.Errorf("UploadVideo - CreateVideo error: %v", err)
 		return nil, err
@@ -95,6 +108,84 @@ func (v *videoFileUC) CreateVideo(ctx context.Context, input *models.VideoUpload
 	return videoFile, nil
 }
 
+func (v *videoFileUC) CompleteUpload(ctx context.Context, videoID uuid.UUID) (*models.CompletedUpload, error) {
+	video, err := v.GetVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	if video.Status != models.VideoStatusPendingUpload {
+		return nil, fmt.Errorf("upload already completed")
+	}
+	if err = v.verifyUpload(ctx, video); err != nil {
+		v.logger.Warnf("CompleteUpload - verification of video %s failed: %v", videoID, err)
+		return nil, fmt.Errorf("upload verification failed: %v", err)
+	}
+
+	moved, err := v.videoRepo.TransitionVideoStatus(ctx, videoID, models.VideoStatusPendingUpload, models.VideoStatusUploaded)
+	if err != nil {
+		v.logger.Errorf("CompleteUpload - TransitionVideoStatus error: %v", err)
+		return nil, fmt.Errorf("failed to complete upload: %v", err)
+	}
+	if !moved {
+		// A concurrent request got here first
+		return nil, fmt.Errorf("upload already completed")
+	}
+	video.Status = models.VideoStatusUploaded
+
+	job, err := v.queueJob(ctx, video)
+	if err != nil {
+		// Leave the upload pending so completing it can be retried
+		if _, rerr := v.videoRepo.TransitionVideoStatus(ctx, videoID, models.VideoStatusUploaded, models.VideoStatusPendingUpload); rerr != nil {
+			v.logger.Errorf("CompleteUpload - failed to reset status of video %s: %v", videoID, rerr)
+		}
+		return nil, err
+	}
+	v.notify(ctx, video.UserID, models.EventVideoUploaded, video)
+	return &models.CompletedUpload{Video: video, Job: job}, nil
+}
+
+// verifyUpload checks the uploaded object against what the client declared when creating the
+// video: its size, content type and, if one was given, SHA-256 checksum.
+func (v *videoFileUC) verifyUpload(ctx context.Context, video *models.VideoFile) error {
+	head, err := v.awsRepo.HeadObject(ctx, video.S3Bucket, video.S3Key)
+	if err != nil {
+		return fmt.Errorf("uploaded object not found: %v", err)
+	}
+	if head.ContentLength == nil || *head.ContentLength != video.FileSize {
+		var size int64
+		if head.ContentLength != nil {
+			size = *head.ContentLength
+		}
+		return fmt.Errorf("size mismatch: declared %d bytes, uploaded %d", video.FileSize, size)
+	}
+	if video.MimeType != "" {
+		var contentType string
+		if head.ContentType != nil {
+			contentType = *head.ContentType
+		}
+		if !sameMediaType(video.MimeType, contentType) {
+			return fmt.Errorf("content type mismatch: declared %q, uploaded %q", video.MimeType, contentType)
+		}
+	}
+	if video.Checksum != "" {
+		checksum := objectChecksum(head)
+		if checksum == "" && isMultipartChecksum(head) {
+			// S3 only checked the parts against their own checksums, the declared one covers
+			// the whole file and is checked against what was assembled
+			if checksum, err = v.readObjectChecksum(ctx, video.S3Bucket, video.S3Key); err != nil {
+				return err
+			}
+		}
+		if checksum == "" {
+			return fmt.Errorf("uploaded object has no sha256 checksum to verify")
+		}
+		if !strings.EqualFold(checksum, video.Checksum) {
+			return fmt.Errorf("checksum mismatch")
+		}
+	}
+	return nil
+}
+
 func (v *videoFileUC) CreateJob(ctx context.Context, input *models.VideoUploadInput) (*models.EncodeJob, error) {
 	user, err := utils.GetUserFromCtx(ctx)
 	if err != nil {
@@ -105,6 +196,102 @@ func (v *videoFileUC) CreateJob(ctx context.Context, input *models.VideoUploadIn
 		v.logger.Errorf("UploadVideo - ValidateStruct error: %v", err)
 		return nil, fmt.Errorf("invalid input: %v", err)
 	}
+	applyEncodeDefaults(input)
+	if err = checkEncryption(input); err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	if err = v.checkOverlays(ctx, user.UserID, input.Overlays); err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	videoFile, err := v.videoRepo.CreateVideo(ctx, v.newVideoFile(user.UserID, input, models.VideoStatusUploaded))
+	if err != nil {
+		v.logger.Errorf("UploadVideo - CreateVideo error: %v", err)
+		return nil, err
+	}
+	v.notify(ctx, user.UserID, models.EventVideoUploaded, videoFile)
+	return v.queueJob(ctx, videoFile)
+}
+
+func (v *videoFileUC) newVideoFile(userID uuid.UUID, input *models.VideoUploadInput, status models.JobStatus) *models.VideoFile {
+	s3Key := input.S3Key
+	if s3Key == "" {
+		s3Key = fmt.Sprintf("uploads/%s/%s", userID, input.FileName)
+	}
+	return &models.VideoFile{
+		UserID:                 userID,
+		FileName:               input.FileName,
+		FileSize:               input.FileSize,
+		Duration:               0,
+		S3Key:                  s3Key,
+		Status:                 status,
+		S3Bucket:               v.cfg.S3.InputBucket,
+		Format:                 input.Format,
+		MimeType:               input.MimeType,
+		Checksum:               strings.ToLower(input.Checksum),
+		Qualities:              input.Qualities,
+		OutputFormats:          input.OutputFormats,
+		EnablePerTitleEncoding: input.EnablePerTitleEncoding,
+		EncryptionMode:         input.EncryptionMode,
+		KeyRotationSegments:    input.KeyRotationSegments,
+		Overlays:               input.Overlays,
+	}
+}
+
+// queueJob creates the encode job for an uploaded video and puts it on the queue.
+func (v *videoFileUC) queueJob(ctx context.Context, videoFile *models.VideoFile) (*models.EncodeJob, error) {
+	job := v.newJob(videoFile)
+	if err := v.enqueueJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (v *videoFileUC) newJob(videoFile *models.VideoFile) *models.EncodeJob {
+	jobID := uuid.New().String()
+	return &models.EncodeJob{
+		JobID:                  jobID,
+		UserID:                 videoFile.UserID.String(),
+		VideoID:                videoFile.VideoID.String(),
+		InputS3Key:             videoFile.S3Key,
+		InputBucket:            videoFile.S3Bucket,
+		OutputS3Key:            fmt.Sprintf("outputs/%s/%s", videoFile.UserID, jobID),
+		OutputBucket:           v.cfg.S3.OutputBucket,
+		FileSize:               videoFile.FileSize,
+		Duration:               float64(videoFile.Duration),
+		Progress:               0,
+		Qualities:              videoFile.Qualities,
+		OutputFormats:          videoFile.OutputFormats,
+		EnablePerTitleEncoding: videoFile.EnablePerTitleEncoding,
+		EncryptionMode:         videoFile.EncryptionMode,
+		KeyRotationSegments:    videoFile.KeyRotationSegments,
+		ClipRanges:             videoFile.ClipRanges,
+		Overlays:               videoFile.Overlays,
+		Status:                 models.JobStatusQueued,
+		CreatedAt:              time.Now(),
+	}
+}
+
+// enqueueJob saves a new job and puts it on the queue.
+func (v *videoFileUC) enqueueJob(ctx context.Context, job *models.EncodeJob) error {
+	if err := v.jobRepo.SaveJob(ctx, job); err != nil {
+		v.logger.Errorf("UploadVideo - SaveJob error: %v", err)
+		return fmt.Errorf("failed to save the job :%v", err)
+	}
+	// Record the queued state so the job can be followed before a worker picks it up
+	if err := v.redisRepo.CheckpointJob(ctx, models.JobProgressKey, job); err != nil {
+		v.logger.Errorf("UploadVideo - CheckpointJob error: %v", err)
+		return fmt.Errorf("failed to record the job :%v", err)
+	}
+	if err := v.redisRepo.EnqueueJob(ctx, v.cfg.Redis.JobQueueKey, job); err != nil {
+		v.logger.Errorf("UploadVideo - EnqueueJob error: %v", err)
+		return fmt.Errorf("failed to queue the job :%v", err)
+	}
+	return nil
+}
+
+// applyEncodeDefaults fills in the default qualities and output format and keeps requested
+// bitrates within the range of their resolution.
+func applyEncodeDefaults(input *models.VideoUploadInput) {
 	if len(input.Qualities) == 0 {
 		input.Qualities = utils.GetDefaultQualities()
 	} else {
@@ -128,41 +315,39 @@ func (v *videoFileUC) CreateJob(ctx context.Context, input *models.VideoUploadIn
 		input.OutputFormats = []models.PlaybackFormat{
 			models.FormatHLS,
 		}
+		// cenc segments only play over DASH
+		if input.EncryptionMode == models.EncryptionCENC {
+			input.OutputFormats[0] = models.FormatDASH
+		}
 	}
-	videoFile := &models.VideoFile{
-		UserID:   user.UserID,
-		FileName: input.FileName,
-		FileSize: input.FileSize,
-		Duration: 0,
-		S3Key:    fmt.Sprintf("uploads/%s/%s", user.UserID, input.FileName),
-		Status:   models.JobStatusQueued,
-		S3Bucket: v.cfg.S3.InputBucket,
-		Format:   input.Format,
-	}
-	videoFile, err = v.videoRepo.CreateVideo(ctx, videoFile)
-	if err != nil {
-		v.logger.Errorf("UploadVideo - CreateVideo error: %v", err)
-		return nil, err
-	}
-	job := &models.EncodeJob{
-		JobID:                  uuid.New().String(),
-		UserID:                 user.UserID.String(),
-		VideoID:                videoFile.VideoID.String(),
-		InputS3Key:             videoFile.S3Key,
-		InputBucket:            videoFile.S3Bucket,
-		OutputBucket:           v.cfg.S3.OutputBucket,
-		Progress:               0,
-		Qualities:              input.Qualities,
-		OutputFormats:          input.OutputFormats,
-		EnablePerTitleEncoding: input.EnablePerTitleEncoding,
-		Status:                 videoFile.Status,
-		StartedAt:              time.Now(),
+}
+
+// checkEncryption rejects encryption settings the packager can't produce. AES-128 and
+// SAMPLE-AES segments are only referenced from HLS playlists and cenc ones only from the MPD.
+// Only AES-128 rotates keys.
+func checkEncryption(input *models.VideoUploadInput) error {
+	if input.EncryptionMode == models.EncryptionNone {
+		if input.KeyRotationSegments > 0 {
+			return fmt.Errorf("key rotation needs an encryption mode")
+		}
+		return nil
+	}
+	only := models.FormatHLS
+	switch input.EncryptionMode {
+	case models.EncryptionCENC:
+		only = models.FormatDASH
+	case models.EncryptionCBCS:
+		only = ""
+	}
+	for _, format := range input.OutputFormats {
+		if only != "" && format != only {
+			return fmt.Errorf("%s encryption is only available for %s output", input.EncryptionMode, only)
+		}
 	}
-	if err = v.redisRepo.EnqueueJob(ctx, v.cfg.Redis.JobQueueKey, job); err != nil {
-		v.logger.Errorf("UploadVideo - EnqueueJob error: %v", err)
-		return nil, fmt.Errorf("failed to queue the job :%v", err)
+	if input.EncryptionMode != models.EncryptionAES128 && input.KeyRotationSegments > 0 {
+		return fmt.Errorf("key rotation is only available with aes-128 encryption")
 	}
-	return job, nil
+	return nil
 }
 
 func (v *videoFileUC) GetVideo(ctx context.Context, videoID uuid.UUID) (*models.VideoFile, error) {
@@ -321,8 +506,59 @@ func (v *videoFileUC) GetPlaybackInfo(ctx context.Context, videoID uuid.UUID) (*
 	}
 	playbackInfo, err := v.videoRepo.GetPlaybackInfo(ctx, videoID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, videofiles.ErrPlaybackNotReady
+		}
 		v.logger.Errorf("GetPlaybackInfo - failed to fetch playback info: %v", err)
 		return nil, fmt.Errorf("failed to fetch playback info: %v", err)
 	}
+	if err = v.resolvePlaybackInfo(ctx, user.UserID, videoID, playbackInfo); err != nil {
+		return nil, err
+	}
 	return playbackInfo, nil
 }
+
+// sameMediaType compares two Content-Type values ignoring case and parameters.
+func sameMediaType(a, b string) bool {
+	mediaA, _, errA := mime.ParseMediaType(a)
+	mediaB, _, errB := mime.ParseMediaType(b)
+	return errA == nil && errB == nil && mediaA == mediaB
+}
+
+// isMultipartChecksum reports whether the object carries a checksum of its part checksums
+// ("<base64>-<parts>") rather than one of its content.
+func isMultipartChecksum(head *s3.HeadObjectOutput) bool {
+	return head.ChecksumSHA256 != nil && strings.Contains(*head.ChecksumSHA256, "-")
+}
+
+// objectChecksum returns the hex SHA-256 of an object, either as computed by S3 for a single
+// part upload or as recorded in its metadata. It is empty if neither is available.
+func objectChecksum(head *s3.HeadObjectOutput) string {
+	if head.ChecksumSHA256 != nil && !isMultipartChecksum(head) {
+		if raw, err := base64.StdEncoding.DecodeString(*head.ChecksumSHA256); err == nil {
+			return hex.EncodeToString(raw)
+		}
+	}
+	return head.Metadata[models.ChecksumMetadataKey]
+}
+
+// readObjectChecksum reads the object back and returns its hex SHA-256.
+func (v *videoFileUC) readObjectChecksum(ctx context.Context, bucket, key string) (string, error) {
+	object, err := v.awsRepo.GetObject(ctx, bucket, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read uploaded object: %v", err)
+	}
+	defer object.Body.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, object.Body); err != nil {
+		return "", fmt.Errorf("failed to read uploaded object: %v", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// notify queues a webhook event. A failure here must not fail the request that caused it.
+func (v *videoFileUC) notify(ctx context.Context, userID uuid.UUID, event models.WebhookEvent, data interface{}) {
+	if err := v.webhooks.Dispatch(ctx, userID, event, data); err != nil {
+		v.logger.Errorf("Failed to dispatch %s webhook: %v", event, err)
+	}
+}
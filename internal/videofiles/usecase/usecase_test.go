@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type fakeObjectStore struct {
+	videofiles.AWSRepository
+	data     []byte
+	checksum string // ChecksumSHA256 S3 reports for the object
+	reads    int
+}
+
+func (s *fakeObjectStore) HeadObject(context.Context, string, string) (*s3.HeadObjectOutput, error) {
+	size := int64(len(s.data))
+	head := &s3.HeadObjectOutput{ContentLength: &size}
+	if s.checksum != "" {
+		head.ChecksumSHA256 = &s.checksum
+	}
+	return head, nil
+}
+
+func (s *fakeObjectStore) GetObject(context.Context, string, string) (*s3.GetObjectOutput, error) {
+	s.reads++
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(s.data))}, nil
+}
+
+func TestVerifyUploadChecksum(t *testing.T) {
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	sum := sha256.Sum256(data)
+	declared := hex.EncodeToString(sum[:])
+	other := hex.EncodeToString(make([]byte, sha256.Size))
+
+	tests := []struct {
+		name      string
+		checksum  string
+		declared  string
+		wantErr   bool
+		wantReads int
+	}{
+		{name: "single part", checksum: base64.StdEncoding.EncodeToString(sum[:]), declared: declared},
+		{name: "single part mismatch", checksum: base64.StdEncoding.EncodeToString(sum[:]), declared: other, wantErr: true},
+		{name: "multipart", checksum: "c29tZS1jb21wb3NpdGU=-3", declared: declared, wantReads: 1},
+		{name: "multipart mismatch", checksum: "c29tZS1jb21wb3NpdGU=-3", declared: other, wantErr: true, wantReads: 1},
+		{name: "no checksum", declared: declared, wantErr: true},
+		{name: "none declared", checksum: "c29tZS1jb21wb3NpdGU=-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeObjectStore{data: data, checksum: tt.checksum}
+			uc := &videoFileUC{cfg: &config.Config{}, awsRepo: store, logger: nopLogger{}}
+			video := &models.VideoFile{S3Bucket: "in", S3Key: "uploads/u/video.mp4", FileSize: int64(len(data)), Checksum: tt.declared}
+			if err := uc.verifyUpload(context.Background(), video); (err != nil) != tt.wantErr {
+				t.Errorf("verifyUpload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if store.reads != tt.wantReads {
+				t.Errorf("verifyUpload() read the object %d times, want %d", store.reads, tt.wantReads)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package webhooks
+
+import "github.com/labstack/echo/v4"
+
+type Handler interface {
+	CreateWebhook() echo.HandlerFunc
+	ListWebhooks() echo.HandlerFunc
+	DeleteWebhook() echo.HandlerFunc
+	ListDeliveries() echo.HandlerFunc
+	TestWebhook() echo.HandlerFunc
+}
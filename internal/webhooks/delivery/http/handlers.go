@@ -0,0 +1,90 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type webhookHandler struct {
+	webhookUC webhooks.UseCase
+}
+
+func NewWebhookHandler(webhookUC webhooks.UseCase) webhooks.Handler {
+	return &webhookHandler{
+		webhookUC: webhookUC,
+	}
+}
+
+func (h *webhookHandler) CreateWebhook() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		input := &models.WebhookInput{}
+		if err := c.Bind(input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		}
+		webhook, err := h.webhookUC.CreateWebhook(c.Request().Context(), input)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusCreated, webhook)
+	}
+}
+
+func (h *webhookHandler) ListWebhooks() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		hooks, err := h.webhookUC.ListWebhooks(c.Request().Context())
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, hooks)
+	}
+}
+
+func (h *webhookHandler) DeleteWebhook() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		webhookID, err := uuid.Parse(c.Param("webhook_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid webhook id"})
+		}
+		if err = h.webhookUC.DeleteWebhook(c.Request().Context(), webhookID); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "Webhook deleted successfully"})
+	}
+}
+
+func (h *webhookHandler) ListDeliveries() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		webhookID, err := uuid.Parse(c.Param("webhook_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid webhook id"})
+		}
+		pagination, err := utils.GetPaginationFromCtx(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		deliveries, err := h.webhookUC.ListDeliveries(c.Request().Context(), webhookID, pagination)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+func (h *webhookHandler) TestWebhook() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		webhookID, err := uuid.Parse(c.Param("webhook_id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid webhook id"})
+		}
+		delivery, err := h.webhookUC.TestWebhook(c.Request().Context(), webhookID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, delivery)
+	}
+}
@@ -0,0 +1,16 @@
+package http
+
+import (
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/middleware"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks"
+	"github.com/labstack/echo/v4"
+)
+
+func MapWebhookRoutes(webhookGroup *echo.Group, h webhooks.Handler, mw *middleware.MiddlewareManager) {
+	webhookGroup.Use(mw.AuthSessionMiddleware)
+	webhookGroup.POST("", h.CreateWebhook())
+	webhookGroup.GET("", h.ListWebhooks())
+	webhookGroup.DELETE("/:webhook_id", h.DeleteWebhook())
+	webhookGroup.GET("/:webhook_id/deliveries", h.ListDeliveries())
+	webhookGroup.POST("/:webhook_id/test", h.TestWebhook())
+}
@@ -0,0 +1,20 @@
+package webhooks
+
+import (
+	"context"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/google/uuid"
+)
+
+// Dispatcher records events for a user's webhooks and delivers them.
+type Dispatcher interface {
+	// Dispatch queues the event for every webhook of the user that subscribes to it.
+	// Delivery happens in the background.
+	Dispatch(ctx context.Context, userID uuid.UUID, event models.WebhookEvent, data interface{}) error
+	// Send delivers the event to one webhook right away and returns the logged delivery.
+	// Failed attempts are retried in the background like any other delivery.
+	Send(ctx context.Context, webhook *models.Webhook, event models.WebhookEvent, data interface{}) (*models.WebhookDelivery, error)
+	// Run delivers queued events and retries failed ones until ctx is done.
+	Run(ctx context.Context)
+}
@@ -0,0 +1,25 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error)
+	GetWebhookByID(ctx context.Context, webhookID uuid.UUID) (*models.Webhook, error)
+	ListWebhooks(ctx context.Context, userID uuid.UUID) ([]*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID) error
+	GetWebhooksForEvent(ctx context.Context, userID uuid.UUID, event models.WebhookEvent) ([]*models.Webhook, error)
+
+	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) (*models.WebhookDelivery, error)
+	// ClaimDueDeliveries leases up to limit pending deliveries whose next attempt is due, so
+	// concurrent dispatchers never send the same delivery twice.
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	ListDeliveries(ctx context.Context, webhookID uuid.UUID, pq *utils.Pagination) (*models.WebhookDeliveryList, error)
+}
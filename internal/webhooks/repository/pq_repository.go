@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type webhookRepo struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepo(db *sqlx.DB) webhooks.Repository {
+	return &webhookRepo{
+		db: db,
+	}
+}
+
+func (r *webhookRepo) CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	created := &models.Webhook{}
+	if err := r.db.QueryRowxContext(
+		ctx,
+		createWebhookQuery,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Secret,
+		webhook.Events,
+	).StructScan(created); err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return created, nil
+}
+
+func (r *webhookRepo) GetWebhookByID(ctx context.Context, webhookID uuid.UUID) (*models.Webhook, error) {
+	webhook := &models.Webhook{}
+	if err := r.db.GetContext(ctx, webhook, getWebhookByIDQuery, webhookID); err != nil {
+		return nil, fmt.Errorf("failed to get webhook by id: %w", err)
+	}
+	return webhook, nil
+}
+
+func (r *webhookRepo) ListWebhooks(ctx context.Context, userID uuid.UUID) ([]*models.Webhook, error) {
+	hooks := make([]*models.Webhook, 0)
+	if err := r.db.SelectContext(ctx, &hooks, listWebhooksQuery, userID); err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+func (r *webhookRepo) DeleteWebhook(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, deleteWebhookQuery, webhookID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	count, _ := res.RowsAffected()
+	if count == 0 {
+		return fmt.Errorf("no webhook found to delete")
+	}
+	return nil
+}
+
+func (r *webhookRepo) GetWebhooksForEvent(ctx context.Context, userID uuid.UUID, event models.WebhookEvent) ([]*models.Webhook, error) {
+	hooks := make([]*models.Webhook, 0)
+	if err := r.db.SelectContext(ctx, &hooks, getWebhooksForEventQuery, userID, string(event)); err != nil {
+		return nil, fmt.Errorf("failed to get webhooks for event: %w", err)
+	}
+	return hooks, nil
+}
+
+func (r *webhookRepo) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	created := &models.WebhookDelivery{}
+	if err := r.db.QueryRowxContext(
+		ctx,
+		createDeliveryQuery,
+		delivery.WebhookID,
+		delivery.Event,
+		delivery.Payload,
+		delivery.NextAttemptAt,
+	).StructScan(created); err != nil {
+		return nil, fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	return created, nil
+}
+
+func (r *webhookRepo) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	deliveries := make([]*models.WebhookDelivery, 0, limit)
+	if err := r.db.SelectContext(ctx, &deliveries, claimDueDeliveriesQuery, limit, lease.Seconds()); err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepo) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if _, err := r.db.ExecContext(
+		ctx,
+		updateDeliveryQuery,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseStatus,
+		delivery.ErrorMessage,
+		delivery.NextAttemptAt,
+		delivery.DeliveredAt,
+		delivery.DeliveryID,
+	); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (r *webhookRepo) ListDeliveries(ctx context.Context, webhookID uuid.UUID, pq *utils.Pagination) (*models.WebhookDeliveryList, error) {
+	var totalCount int
+	if err := r.db.GetContext(ctx, &totalCount, getTotalDeliveriesQuery, webhookID); err != nil {
+		return nil, fmt.Errorf("failed to get total webhook deliveries: %w", err)
+	}
+	deliveries := make([]*models.WebhookDelivery, 0, pq.GetSize())
+	if totalCount > 0 {
+		if err := r.db.SelectContext(
+			ctx,
+			&deliveries,
+			listDeliveriesQuery,
+			webhookID,
+			pq.GetOffset(),
+			pq.GetLimit(),
+		); err != nil {
+			return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+		}
+	}
+	return &models.WebhookDeliveryList{
+		Deliveries: deliveries,
+		TotalCount: totalCount,
+		Page:       pq.GetPage(),
+		PageSize:   pq.GetSize(),
+		HasMore:    utils.GetHasMore(pq.GetPage(), totalCount, pq.GetSize()),
+	}, nil
+}
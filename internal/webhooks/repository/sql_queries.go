@@ -0,0 +1,33 @@
+package repository
+
+const (
+	createWebhookQuery = `INSERT INTO webhooks (user_id, url, secret, events)
+					VALUES ($1, $2, $3, $4)
+					RETURNING webhook_id, user_id, url, secret, events, active, created_at, updated_at`
+	getWebhookByIDQuery = `SELECT webhook_id, user_id, url, secret, events, active, created_at, updated_at FROM webhooks
+					WHERE webhook_id = $1`
+	listWebhooksQuery = `SELECT webhook_id, user_id, url, secret, events, active, created_at, updated_at FROM webhooks
+					WHERE user_id = $1 ORDER BY created_at`
+	deleteWebhookQuery       = `DELETE FROM webhooks WHERE webhook_id = $1 AND user_id = $2`
+	getWebhooksForEventQuery = `SELECT webhook_id, user_id, url, secret, events, active, created_at, updated_at FROM webhooks
+					WHERE user_id = $1 AND active
+					AND (jsonb_array_length(events) = 0 OR events @> jsonb_build_array($2::text))`
+
+	createDeliveryQuery = `INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt_at)
+					VALUES ($1, $2, $3, $4)
+					RETURNING delivery_id, webhook_id, event, payload, status, attempts, response_status, error_message, next_attempt_at, created_at, delivered_at`
+	claimDueDeliveriesQuery = `UPDATE webhook_deliveries SET next_attempt_at = NOW() + ($2 * INTERVAL '1 second')
+					WHERE delivery_id IN (
+						SELECT delivery_id FROM webhook_deliveries
+						WHERE status = 'pending' AND next_attempt_at <= NOW()
+						ORDER BY next_attempt_at LIMIT $1
+						FOR UPDATE SKIP LOCKED
+					)
+					RETURNING delivery_id, webhook_id, event, payload, status, attempts, response_status, error_message, next_attempt_at, created_at, delivered_at`
+	updateDeliveryQuery = `UPDATE webhook_deliveries
+					SET status = $1, attempts = $2, response_status = $3, error_message = $4, next_attempt_at = $5, delivered_at = $6
+					WHERE delivery_id = $7`
+	getTotalDeliveriesQuery = `SELECT COUNT(delivery_id) FROM webhook_deliveries WHERE webhook_id = $1`
+	listDeliveriesQuery     = `SELECT delivery_id, webhook_id, event, payload, status, attempts, response_status, error_message, next_attempt_at, created_at, delivered_at
+					FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY created_at DESC OFFSET $2 LIMIT $3`
+)
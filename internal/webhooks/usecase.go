@@ -0,0 +1,17 @@
+package webhooks
+
+import (
+	"context"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+type UseCase interface {
+	CreateWebhook(ctx context.Context, input *models.WebhookInput) (*models.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID uuid.UUID) error
+	ListDeliveries(ctx context.Context, webhookID uuid.UUID, pagination *utils.Pagination) (*models.WebhookDeliveryList, error)
+	TestWebhook(ctx context.Context, webhookID uuid.UUID) (*models.WebhookDelivery, error)
+}
@@ -0,0 +1,255 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMaxAttempts    = 8
+	defaultRequestTimeout = 10 * time.Second
+	defaultPollInterval   = 5 * time.Second
+
+	minRetryBackoff = 10 * time.Second
+	maxRetryBackoff = time.Hour
+
+	claimBatchSize = 20
+	maxErrorLength = 1024
+	maxDrainLength = 4 << 10 // Response bytes read so the connection can be reused
+
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+type dispatcher struct {
+	repo        webhooks.Repository
+	client      *http.Client
+	logger      logger.Logger
+	maxAttempts int
+	poll        time.Duration
+	wake        chan struct{}
+}
+
+func NewWebhookDispatcher(cfg *config.Config, repo webhooks.Repository, log logger.Logger) webhooks.Dispatcher {
+	timeout := defaultRequestTimeout
+	if cfg.Webhooks.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.Webhooks.TimeoutSeconds) * time.Second
+	}
+	// Endpoints are user supplied: only public addresses are dialed and redirects aren't
+	// followed, a redirect counts as a failed delivery
+	client := utils.NewPublicHTTPClient(timeout, cfg.Webhooks.AllowPrivateNetworks)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	d := &dispatcher{
+		repo:        repo,
+		client:      client,
+		logger:      log,
+		maxAttempts: defaultMaxAttempts,
+		poll:        defaultPollInterval,
+		wake:        make(chan struct{}, 1),
+	}
+	if cfg.Webhooks.MaxAttempts > 0 {
+		d.maxAttempts = cfg.Webhooks.MaxAttempts
+	}
+	if cfg.Webhooks.PollInterval > 0 {
+		d.poll = time.Duration(cfg.Webhooks.PollInterval) * time.Second
+	}
+	return d
+}
+
+func (d *dispatcher) Dispatch(ctx context.Context, userID uuid.UUID, event models.WebhookEvent, data interface{}) error {
+	hooks, err := d.repo.GetWebhooksForEvent(ctx, userID, event)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if _, err := d.queue(ctx, hook, event, data, time.Now()); err != nil {
+			return err
+		}
+	}
+	if len(hooks) > 0 {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (d *dispatcher) Send(ctx context.Context, hook *models.Webhook, event models.WebhookEvent, data interface{}) (*models.WebhookDelivery, error) {
+	// Keep the background loop away from it while the first attempt is in flight
+	delivery, err := d.queue(ctx, hook, event, data, time.Now().Add(2*d.client.Timeout))
+	if err != nil {
+		return nil, err
+	}
+	d.attempt(ctx, hook, delivery)
+	return delivery, nil
+}
+
+// queue logs a pending delivery due at the given time. The payload is built once so every
+// retry sends the same body.
+func (d *dispatcher) queue(ctx context.Context, hook *models.Webhook, event models.WebhookEvent, data interface{}, due time.Time) (*models.WebhookDelivery, error) {
+	payload, err := json.Marshal(models.WebhookPayload{
+		ID:        uuid.New(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+	return d.repo.CreateDelivery(ctx, &models.WebhookDelivery{
+		WebhookID:     hook.WebhookID,
+		Event:         event,
+		Payload:       models.RawJSON(payload),
+		NextAttemptAt: due,
+	})
+}
+
+func (d *dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.poll)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliverDue claims due deliveries in batches and attempts each of them once.
+func (d *dispatcher) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		// The lease covers the request timeout so a slow attempt isn't picked up twice
+		deliveries, err := d.repo.ClaimDueDeliveries(ctx, claimBatchSize, 2*d.client.Timeout)
+		if err != nil {
+			d.logger.Errorf("Webhooks: failed to claim deliveries: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer wg.Done()
+				hook, err := d.repo.GetWebhookByID(ctx, delivery.WebhookID)
+				if err != nil {
+					d.logger.Errorf("Webhooks: failed to load webhook %s: %v", delivery.WebhookID, err)
+					return
+				}
+				d.attempt(ctx, hook, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+	}
+}
+
+// attempt posts the delivery once and records the outcome, scheduling a retry on failure.
+func (d *dispatcher) attempt(ctx context.Context, hook *models.Webhook, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+	status, err := d.post(ctx, hook, delivery)
+	delivery.ResponseStatus = status
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryStatusSucceeded
+		delivery.ErrorMessage = ""
+		delivery.DeliveredAt = &now
+	case !hook.Active:
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.ErrorMessage = "webhook is disabled"
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.ErrorMessage = truncate(err.Error(), maxErrorLength)
+	default:
+		delivery.Status = models.DeliveryStatusPending
+		delivery.ErrorMessage = truncate(err.Error(), maxErrorLength)
+		delivery.NextAttemptAt = now.Add(utils.Backoff(delivery.Attempts-1, minRetryBackoff, maxRetryBackoff))
+	}
+	if err != nil {
+		d.logger.Warnf("Webhooks: delivery %s of %s to %s failed (attempt %d/%d): %v",
+			delivery.DeliveryID, delivery.Event, hook.URL, delivery.Attempts, d.maxAttempts, err)
+	}
+
+	// Record the outcome even if the caller's context is gone, otherwise it would be sent again
+	updateCtx, cancel := context.WithTimeout(context.Background(), defaultRequestTimeout)
+	defer cancel()
+	if err := d.repo.UpdateDelivery(updateCtx, delivery); err != nil {
+		d.logger.Errorf("Webhooks: failed to record delivery %s: %v", delivery.DeliveryID, err)
+	}
+}
+
+func (d *dispatcher) post(ctx context.Context, hook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	if !hook.Active {
+		return 0, fmt.Errorf("webhook is disabled")
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(delivery.Event))
+	req.Header.Set(DeliveryHeader, delivery.DeliveryID.String())
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "v1="+Sign(hook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Only the status is recorded, the body of an arbitrary endpoint is never stored
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainLength))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret.
+// Receivers recompute it to check the payload came from us and reject stale timestamps.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,168 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const secretBytes = 32
+
+type webhookUC struct {
+	cfg        *config.Config
+	repo       webhooks.Repository
+	dispatcher webhooks.Dispatcher
+	logger     logger.Logger
+}
+
+func NewWebhookUseCase(cfg *config.Config, repo webhooks.Repository, dispatcher webhooks.Dispatcher, log logger.Logger) webhooks.UseCase {
+	return &webhookUC{
+		cfg:        cfg,
+		repo:       repo,
+		dispatcher: dispatcher,
+		logger:     log,
+	}
+}
+
+func (w *webhookUC) CreateWebhook(ctx context.Context, input *models.WebhookInput) (*models.Webhook, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		w.logger.Errorf("CreateWebhook - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	if err = utils.ValidateStruct(ctx, input); err != nil {
+		w.logger.Errorf("CreateWebhook - ValidateStruct error: %v", err)
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	endpoint, err := url.Parse(input.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url: must be an absolute http(s) url")
+	}
+	if !w.cfg.Webhooks.AllowPrivateNetworks {
+		if err = utils.CheckPublicHost(ctx, endpoint.Hostname()); err != nil {
+			w.logger.Warnf("CreateWebhook - CheckPublicHost error: %v", err)
+			return nil, fmt.Errorf("invalid webhook url: %v", err)
+		}
+	}
+	for _, event := range input.Events {
+		if !event.Valid() {
+			return nil, fmt.Errorf("unknown webhook event: %s", event)
+		}
+	}
+
+	secret := make([]byte, secretBytes)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %v", err)
+	}
+
+	webhook, err := w.repo.CreateWebhook(ctx, &models.Webhook{
+		UserID: user.UserID,
+		URL:    input.URL,
+		Secret: hex.EncodeToString(secret),
+		Events: input.Events,
+	})
+	if err != nil {
+		w.logger.Errorf("CreateWebhook - CreateWebhook error: %v", err)
+		return nil, fmt.Errorf("failed to create webhook: %v", err)
+	}
+	// The secret is only returned here, the user needs it to verify signatures
+	return webhook, nil
+}
+
+func (w *webhookUC) ListWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		w.logger.Errorf("ListWebhooks - GetUserFromCtx error: %v", err)
+		return nil, err
+	}
+	hooks, err := w.repo.ListWebhooks(ctx, user.UserID)
+	if err != nil {
+		w.logger.Errorf("ListWebhooks - ListWebhooks error: %v", err)
+		return nil, fmt.Errorf("failed to list webhooks: %v", err)
+	}
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+	return hooks, nil
+}
+
+func (w *webhookUC) DeleteWebhook(ctx context.Context, webhookID uuid.UUID) error {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		w.logger.Errorf("DeleteWebhook - GetUserFromCtx error: %v", err)
+		return err
+	}
+	if err = w.repo.DeleteWebhook(ctx, user.UserID, webhookID); err != nil {
+		w.logger.Errorf("DeleteWebhook - DeleteWebhook error: %v", err)
+		return fmt.Errorf("failed to delete webhook: %v", err)
+	}
+	return nil
+}
+
+func (w *webhookUC) ListDeliveries(ctx context.Context, webhookID uuid.UUID, pagination *utils.Pagination) (*models.WebhookDeliveryList, error) {
+	if _, err := w.getOwnWebhook(ctx, webhookID); err != nil {
+		return nil, err
+	}
+	if pagination.Page < 1 {
+		pagination.Page = 1
+	}
+	if pagination.Size < 1 || pagination.Size > 100 {
+		pagination.Size = 10
+	}
+	deliveries, err := w.repo.ListDeliveries(ctx, webhookID, pagination)
+	if err != nil {
+		w.logger.Errorf("ListDeliveries - ListDeliveries error: %v", err)
+		return nil, fmt.Errorf("failed to list deliveries: %v", err)
+	}
+	return deliveries, nil
+}
+
+func (w *webhookUC) TestWebhook(ctx context.Context, webhookID uuid.UUID) (*models.WebhookDelivery, error) {
+	webhook, err := w.getOwnWebhook(ctx, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := w.dispatcher.Send(ctx, webhook, models.EventWebhookTest, map[string]interface{}{
+		"webhook_id": webhook.WebhookID,
+		"message":    "This is a test delivery",
+		"sent_at":    time.Now().UTC(),
+	})
+	if err != nil {
+		w.logger.Errorf("TestWebhook - Send error: %v", err)
+		return nil, fmt.Errorf("failed to send test delivery: %v", err)
+	}
+	return delivery, nil
+}
+
+func (w *webhookUC) getOwnWebhook(ctx context.Context, webhookID uuid.UUID) (*models.Webhook, error) {
+	user, err := utils.GetUserFromCtx(ctx)
+	if err != nil {
+		w.logger.Errorf("GetUserFromCtx: %v", err)
+		return nil, err
+	}
+	webhook, err := w.repo.GetWebhookByID(ctx, webhookID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("webhook not found")
+		}
+		w.logger.Errorf("GetWebhookByID error: %v", err)
+		return nil, fmt.Errorf("failed to fetch webhook: %v", err)
+	}
+	if webhook.UserID != user.UserID {
+		w.logger.Warnf("User %s is not authorized to access webhook %s", user.UserID, webhookID)
+		return nil, fmt.Errorf("webhook not found")
+	}
+	return webhook, nil
+}
@@ -0,0 +1,230 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/mem"
+)
+
+const (
+	resourceSampleInterval = 2 * time.Second
+	cpuSmoothingFactor     = 0.3
+
+	assumedSourceBitrate = 8_000_000 // bits per second, used when the job has no duration
+	defaultJobDuration   = 300       // seconds, used when neither duration nor size is known
+
+	// Rough working-set size of one SVT-AV1 instance per pixel, and how much scratch space a
+	// job needs relative to its source (source + split segments + encoded segments + package).
+	encoderBytesPerPixel = 600
+	scratchSizeFactor    = 4
+
+	// One cost unit is a single 1080p rung of a one minute source.
+	costUnitPixelSeconds = 1920 * 1080 * 60
+
+	minDeferBackoff = 5 * time.Second
+	maxDeferBackoff = 2 * time.Minute
+
+	// After this many deferrals a job goes back to the queue so other workers get to try it
+	maxDeferrals = 5
+)
+
+type admissionVerdict int
+
+const (
+	verdictAdmit admissionVerdict = iota
+	verdictDefer
+	verdictReject // The job can't fit even on an idle worker
+)
+
+type jobCost struct {
+	units       float64
+	memoryBytes uint64
+	diskBytes   uint64
+}
+
+func (c jobCost) String() string {
+	return fmt.Sprintf("%.2f units, %d MB memory, %d MB disk", c.units, c.memoryBytes>>20, c.diskBytes>>20)
+}
+
+// estimateJobCost derives the resources a job needs from the top rung resolution, the source
+// duration and the number of rungs. The duration falls back to an estimate from the file size.
+func estimateJobCost(job *models.EncodeJob) jobCost {
+	duration := job.Duration
+	if duration <= 0 && job.FileSize > 0 {
+		duration = float64(job.FileSize*8) / assumedSourceBitrate
+	}
+	if duration <= 0 {
+		duration = defaultJobDuration
+	}
+
+	qualities := job.Qualities
+	if len(qualities) == 0 {
+		qualities = utils.GetDefaultQualities()
+	}
+	var maxPixels int
+	for _, quality := range qualities {
+		width, height := utils.GetResolutionDimensions(quality.Resolution)
+		if width*height > maxPixels {
+			maxPixels = width * height
+		}
+	}
+	rungs := len(qualities)
+
+	return jobCost{
+		units:       float64(maxPixels) * duration * float64(rungs) / costUnitPixelSeconds,
+		memoryBytes: uint64(maxPixels) * encoderBytesPerPixel * MaxParallelJobs,
+		diskBytes:   uint64(job.FileSize) * scratchSizeFactor,
+	}
+}
+
+// admissionController decides whether the host can take on another job. It samples CPU over
+// an interval and smooths it, and keeps track of what already admitted jobs have reserved so
+// memory and disk that is about to be used is not handed out twice.
+type admissionController struct {
+	cfg        *config.WorkerConfig
+	logger     logger.Logger
+	scratchDir string
+
+	mu          sync.Mutex
+	smoothedCPU float64
+	sampled     bool
+	reserved    map[string]jobCost
+	deferrals   map[string]int
+}
+
+func newAdmissionController(cfg *config.WorkerConfig, logger logger.Logger, scratchDir string) *admissionController {
+	return &admissionController{
+		cfg:        cfg,
+		logger:     logger,
+		scratchDir: scratchDir,
+		reserved:   make(map[string]jobCost),
+		deferrals:  make(map[string]int),
+	}
+}
+
+// run keeps the smoothed CPU figure up to date until the context is cancelled.
+func (a *admissionController) run(ctx context.Context, stopChan <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopChan:
+			return
+		default:
+		}
+
+		// cpu.Percent blocks for the interval and measures usage across it
+		usage, err := cpu.PercentWithContext(ctx, resourceSampleInterval, false)
+		if err != nil || len(usage) == 0 {
+			a.logger.Warnf("Admission: failed to sample CPU usage: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(resourceSampleInterval):
+			}
+			continue
+		}
+
+		a.mu.Lock()
+		if !a.sampled {
+			a.smoothedCPU = usage[0]
+			a.sampled = true
+		} else {
+			a.smoothedCPU = cpuSmoothingFactor*usage[0] + (1-cpuSmoothingFactor)*a.smoothedCPU
+		}
+		a.mu.Unlock()
+	}
+}
+
+// admit reserves resources for the job if the host can take it and returns a reason otherwise.
+func (a *admissionController) admit(job *models.EncodeJob) (admissionVerdict, string) {
+	cost := estimateJobCost(job)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var reservedUnits float64
+	var reservedMemory, reservedDisk uint64
+	for _, c := range a.reserved {
+		reservedUnits += c.units
+		reservedMemory += c.memoryBytes
+		reservedDisk += c.diskBytes
+	}
+
+	// With nothing running a job is always admitted, otherwise a job larger than the
+	// budget would never run.
+	if len(a.reserved) > 0 {
+		if a.cfg.MaxCPUUsage > 0 && a.sampled && a.smoothedCPU > a.cfg.MaxCPUUsage {
+			return verdictDefer, fmt.Sprintf("smoothed CPU usage %.2f%% above %.2f%%", a.smoothedCPU, a.cfg.MaxCPUUsage)
+		}
+		if a.cfg.MaxJobCost > 0 && reservedUnits+cost.units > a.cfg.MaxJobCost {
+			return verdictDefer, fmt.Sprintf("job cost %.2f would exceed budget (%.2f of %.2f in use)", cost.units, reservedUnits, a.cfg.MaxJobCost)
+		}
+	}
+
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return verdictDefer, fmt.Sprintf("failed to read memory stats: %v", err)
+	}
+	minFreeMemory := uint64(a.cfg.MinFreeMemoryMB) << 20
+	if vm.Available < reservedMemory+cost.memoryBytes+minFreeMemory && len(a.reserved) > 0 {
+		return verdictDefer, fmt.Sprintf("not enough memory: %d MB available, %d MB reserved, job needs %d MB",
+			vm.Available>>20, reservedMemory>>20, cost.memoryBytes>>20)
+	}
+
+	// Scratch disk is checked even on an idle worker, a job that can't fit would fail halfway anyway
+	usage, err := disk.Usage(a.scratchDir)
+	if err != nil {
+		return verdictDefer, fmt.Sprintf("failed to read scratch disk stats: %v", err)
+	}
+	minFreeDisk := uint64(a.cfg.MinFreeDiskMB) << 20
+	if usage.Total < cost.diskBytes+minFreeDisk {
+		return verdictReject, fmt.Sprintf("scratch disk of %d MB can never hold the %d MB the job needs",
+			usage.Total>>20, cost.diskBytes>>20)
+	}
+	if usage.Free < reservedDisk+cost.diskBytes+minFreeDisk {
+		return verdictDefer, fmt.Sprintf("not enough scratch disk: %d MB free, %d MB reserved, job needs %d MB",
+			usage.Free>>20, reservedDisk>>20, cost.diskBytes>>20)
+	}
+
+	a.reserved[job.JobID] = cost
+	delete(a.deferrals, job.JobID)
+	a.logger.Infof("Admission: admitted job %s (%s)", job.JobID, cost)
+	return verdictAdmit, ""
+}
+
+// release frees the resources reserved for a finished job.
+func (a *admissionController) release(jobID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.reserved, jobID)
+}
+
+// nextBackoff records another deferral of the job and returns how long to wait before retrying.
+// It returns false once the job was deferred maxDeferrals times.
+func (a *admissionController) nextBackoff(jobID string) (time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	attempt := a.deferrals[jobID]
+	if attempt >= maxDeferrals {
+		return 0, false
+	}
+	a.deferrals[jobID] = attempt + 1
+	return utils.Backoff(attempt, minDeferBackoff, maxDeferBackoff), true
+}
+
+// forget drops deferral bookkeeping for a job that left this worker.
+func (a *admissionController) forget(jobID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.deferrals, jobID)
+}
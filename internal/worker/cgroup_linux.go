@@ -0,0 +1,111 @@
+//go:build linux
+
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/containerd/cgroups/v3"
+	"github.com/containerd/cgroups/v3/cgroup2"
+)
+
+const (
+	cgroupMountpoint = "/sys/fs/cgroup"
+	cpuPeriodMicros  = 100000
+)
+
+// jobCgroup is the cgroup v2 group that holds every subprocess of a single job.
+type jobCgroup struct {
+	manager *cgroup2.Manager
+	dir     *os.File
+}
+
+// newJobCgroup creates <slice>/job-<jobID> with the CPU weight, CPU quota and memory limit
+// from the worker config. Subprocesses are placed into it when they are spawned.
+func newJobCgroup(cfg *config.WorkerConfig, jobID string) (*jobCgroup, error) {
+	if cgroups.Mode() != cgroups.Unified {
+		return nil, errors.New("cgroup v2 unified hierarchy is not available")
+	}
+
+	slice := cfg.CgroupSlice
+	if slice == "" {
+		slice = defaultCgroupSlice
+	}
+	if !strings.HasPrefix(slice, "/") {
+		slice = "/" + slice
+	}
+
+	// The slice only enables the controllers, the limits live on the per-job child
+	parent, err := cgroup2.NewManager(cgroupMountpoint, slice, &cgroup2.Resources{
+		CPU:    &cgroup2.CPU{},
+		Memory: &cgroup2.Memory{},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cgroup slice %s: %w", slice, err)
+	}
+
+	name := "job-" + jobID
+	manager, err := parent.NewChild(name, jobCgroupResources(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job cgroup: %w", err)
+	}
+
+	dir, err := os.Open(filepath.Join(cgroupMountpoint, slice, name))
+	if err != nil {
+		manager.Delete()
+		return nil, fmt.Errorf("failed to open job cgroup: %w", err)
+	}
+
+	return &jobCgroup{manager: manager, dir: dir}, nil
+}
+
+func jobCgroupResources(cfg *config.WorkerConfig) *cgroup2.Resources {
+	resources := &cgroup2.Resources{
+		CPU:    &cgroup2.CPU{},
+		Memory: &cgroup2.Memory{},
+	}
+	if cfg.CgroupCPUWeight > 0 {
+		weight := cfg.CgroupCPUWeight
+		resources.CPU.Weight = &weight
+	}
+	if cfg.CgroupCPUQuota > 0 {
+		// CgroupCPUQuota is a percentage of one CPU, 400 means four full cores
+		quota := int64(cfg.CgroupCPUQuota) * cpuPeriodMicros / 100
+		period := uint64(cpuPeriodMicros)
+		resources.CPU.Max = cgroup2.NewCPUMax(&quota, &period)
+	}
+	if cfg.CgroupMemoryLimitMB > 0 {
+		limit := cfg.CgroupMemoryLimitMB << 20
+		resources.Memory.Max = &limit
+	}
+	return resources
+}
+
+// prepare makes the command start directly inside the job cgroup, so there is no window in
+// which the process runs unconstrained.
+func (c *jobCgroup) prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(c.dir.Fd())
+}
+
+// delete kills anything left in the group and removes it.
+func (c *jobCgroup) delete() error {
+	c.dir.Close()
+	if err := c.manager.Kill(); err != nil {
+		return fmt.Errorf("failed to kill job cgroup processes: %w", err)
+	}
+	if err := c.manager.Delete(); err != nil {
+		return fmt.Errorf("failed to delete job cgroup: %w", err)
+	}
+	return nil
+}
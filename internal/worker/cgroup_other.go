@@ -0,0 +1,22 @@
+//go:build !linux
+
+package worker
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+)
+
+type jobCgroup struct{}
+
+func newJobCgroup(cfg *config.WorkerConfig, jobID string) (*jobCgroup, error) {
+	return nil, errors.New("per-job cgroups are only supported on linux")
+}
+
+func (c *jobCgroup) prepare(cmd *exec.Cmd) {}
+
+func (c *jobCgroup) delete() error {
+	return nil
+}
@@ -0,0 +1,296 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+const (
+	clipDir = "clip"
+	// Boundary pieces shorter than this are left out rather than encoded as a frame or two
+	minClipPiece = 0.001
+	// Nudges a seek onto the keyframe it names despite the rounding of probed timestamps
+	keyframeSeekSlack = 0.001
+)
+
+// smartCutEncoders re-encode the boundaries of sources whose codec can be joined with stream
+// copied pieces in MPEG-TS, where every piece carries its own parameter sets.
+var smartCutEncoders = map[string][]string{
+	"h264": {"-c:v", "libx264", "-preset", "veryfast", "-crf", "16"},
+	"hevc": {"-c:v", "libx265", "-preset", "veryfast", "-crf", "18"},
+}
+
+// clipSource is what cutting a clip needs to know about its source.
+type clipSource struct {
+	path     string
+	duration float64
+	codec    string
+	pixFmt   string
+	hasAudio bool
+}
+
+// cutClip cuts the ranges of a clip from the source and joins them into a single file in dir,
+// which then goes through the pipeline in place of the source. The cut is frame accurate: only the
+// frames between a range boundary and the nearest keyframe inside the range are re-encoded,
+// everything from keyframe to keyframe is stream copied. Sources whose codec can't be joined
+// that way have their ranges re-encoded as a whole.
+func (p *videoProcessor) cutClip(ctx context.Context, inputPath string, ranges models.ClipRangeList, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create clip directory: %w", err)
+	}
+	src, err := probeClipSource(ctx, inputPath)
+	if err != nil {
+		return "", err
+	}
+	ranges, err = clampClipRanges(ranges, src.duration)
+	if err != nil {
+		return "", err
+	}
+
+	var pieces []string
+	for i, r := range ranges {
+		rangePieces, err := p.cutRange(ctx, src, r, filepath.Join(dir, fmt.Sprintf("range_%03d", i)))
+		if err != nil {
+			return "", fmt.Errorf("failed to cut range %d: %w", i, err)
+		}
+		pieces = append(pieces, rangePieces...)
+	}
+
+	videoPath := filepath.Join(dir, "video.ts")
+	if err = p.concatPieces(ctx, pieces, filepath.Join(dir, "pieces.txt"), videoPath); err != nil {
+		return "", err
+	}
+
+	args := []string{"-i", videoPath}
+	if src.hasAudio {
+		audioPath := filepath.Join(dir, "audio.m4a")
+		if err = p.cutAudio(ctx, src, ranges, audioPath); err != nil {
+			return "", err
+		}
+		args = append(args, "-i", audioPath, "-map", "0:v:0", "-map", "1:a:0")
+	} else {
+		args = append(args, "-map", "0:v:0")
+	}
+	clipPath := filepath.Join(dir, "clip.mp4")
+	args = append(args, "-c", "copy", "-movflags", "+faststart", "-y", clipPath)
+	if err = p.runFFmpeg(ctx, "mux", args...); err != nil {
+		return "", err
+	}
+	return clipPath, nil
+}
+
+// cutRange writes the video of one range as up to three pieces: the re-encoded head up to the
+// first keyframe in the range, the stream copied frames up to the last keyframe and the
+// re-encoded tail after it.
+func (p *videoProcessor) cutRange(ctx context.Context, src *clipSource, r models.ClipRange, prefix string) ([]string, error) {
+	encoder, smart := smartCutEncoders[src.codec]
+	if !smart {
+		encoder = smartCutEncoders["h264"]
+		path := prefix + "_full.ts"
+		return []string{path}, p.encodePiece(ctx, src, encoder, r.Start, r.End, path)
+	}
+
+	keyframes, err := probeKeyframes(ctx, src.path, r.Start, r.End)
+	if err != nil {
+		return nil, err
+	}
+	first, last := -1.0, -1.0
+	for _, k := range keyframes {
+		if k < r.Start || k >= r.End {
+			continue
+		}
+		if first < 0 {
+			first = k
+		}
+		last = k
+	}
+	if first < 0 || last <= first {
+		// No stretch between two keyframes to copy
+		path := prefix + "_full.ts"
+		return []string{path}, p.encodePiece(ctx, src, encoder, r.Start, r.End, path)
+	}
+
+	var pieces []string
+	if first-r.Start > minClipPiece {
+		path := prefix + "_head.ts"
+		if err = p.encodePiece(ctx, src, encoder, r.Start, first, path); err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, path)
+	}
+	path := prefix + "_copy.ts"
+	if err = p.runFFmpeg(ctx, "copy",
+		"-ss", formatSeconds(first+keyframeSeekSlack),
+		"-i", src.path,
+		"-t", formatSeconds(last-first),
+		"-map", "0:v:0",
+		"-c", "copy",
+		"-avoid_negative_ts", "make_zero",
+		"-y", path,
+	); err != nil {
+		return nil, err
+	}
+	pieces = append(pieces, path)
+	if r.End-last > minClipPiece {
+		path = prefix + "_tail.ts"
+		if err = p.encodePiece(ctx, src, encoder, last, r.End, path); err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, path)
+	}
+	return pieces, nil
+}
+
+// encodePiece re-encodes the video from start to end. Seeking an input that is decoded is
+// frame accurate.
+func (p *videoProcessor) encodePiece(ctx context.Context, src *clipSource, encoder []string, start, end float64, path string) error {
+	args := []string{
+		"-ss", formatSeconds(start),
+		"-i", src.path,
+		"-t", formatSeconds(end - start),
+		"-map", "0:v:0",
+	}
+	args = append(args, encoder...)
+	if src.pixFmt != "" {
+		args = append(args, "-pix_fmt", src.pixFmt)
+	}
+	args = append(args, "-y", path)
+	return p.runFFmpeg(ctx, "encode", args...)
+}
+
+// cutAudio trims and joins the audio of all ranges in one pass. Audio is cheap to encode, so
+// it is cut sample accurately instead of at packet boundaries.
+func (p *videoProcessor) cutAudio(ctx context.Context, src *clipSource, ranges models.ClipRangeList, path string) error {
+	var filter strings.Builder
+	for i, r := range ranges {
+		fmt.Fprintf(&filter, "[0:a:0]atrim=start=%s:end=%s,asetpts=PTS-STARTPTS[a%d];",
+			formatSeconds(r.Start), formatSeconds(r.End), i)
+	}
+	for i := range ranges {
+		fmt.Fprintf(&filter, "[a%d]", i)
+	}
+	fmt.Fprintf(&filter, "concat=n=%d:v=0:a=1[a]", len(ranges))
+	return p.runFFmpeg(ctx, "audio",
+		"-i", src.path,
+		"-filter_complex", filter.String(),
+		"-map", "[a]",
+		"-c:a", "aac",
+		"-b:a", "192k",
+		"-y", path,
+	)
+}
+
+func (p *videoProcessor) concatPieces(ctx context.Context, pieces []string, listPath, outputPath string) error {
+	var list strings.Builder
+	for _, piece := range pieces {
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(piece, "'", `'\''`))
+	}
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write concat list: %w", err)
+	}
+	return p.runFFmpeg(ctx, "concat",
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+		"-c", "copy",
+		"-y", outputPath,
+	)
+}
+
+func (p *videoProcessor) runFFmpeg(ctx context.Context, step string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", append([]string{"-v", "error"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := p.runCommand(cmd); err != nil {
+		return fmt.Errorf("ffmpeg clip %s failed: %v, stderr: %s", step, err, stderr.String())
+	}
+	return nil
+}
+
+// clampClipRanges checks the ranges against the probed duration of the source. The API only
+// knows the duration rounded to the second, so ends just past the source are cut to it.
+func clampClipRanges(ranges models.ClipRangeList, duration float64) (models.ClipRangeList, error) {
+	clamped := make(models.ClipRangeList, len(ranges))
+	for i, r := range ranges {
+		r.End = math.Min(r.End, duration)
+		clamped[i] = r
+	}
+	if err := clamped.Check(duration); err != nil {
+		return nil, fmt.Errorf("invalid clip: %w", err)
+	}
+	return clamped, nil
+}
+
+func probeClipSource(ctx context.Context, path string) (*clipSource, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error",
+		"-show_entries", "format=duration:stream=codec_type,codec_name,pix_fmt", "-of", "csv=p=0", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe clip source error: %v", err)
+	}
+
+	src := &clipSource{path: path}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ",")
+		switch {
+		case len(fields) == 1:
+			if src.duration, err = strconv.ParseFloat(fields[0], 64); err != nil {
+				return nil, fmt.Errorf("invalid duration: %v", err)
+			}
+		case len(fields) >= 2 && fields[1] == "video" && src.codec == "":
+			src.codec = fields[0]
+			if len(fields) >= 3 {
+				src.pixFmt = fields[2]
+			}
+		case len(fields) >= 2 && fields[1] == "audio":
+			src.hasAudio = true
+		}
+	}
+	if src.codec == "" {
+		return nil, fmt.Errorf("source has no video stream")
+	}
+	if src.duration <= 0 {
+		return nil, fmt.Errorf("source has no duration")
+	}
+	return src, nil
+}
+
+// probeKeyframes returns the times of the video keyframes between start and end, in order.
+func probeKeyframes(ctx context.Context, path string, start, end float64) ([]float64, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error",
+		"-select_streams", "v:0",
+		"-skip_frame", "nokey",
+		"-read_intervals", formatSeconds(start)+"%"+formatSeconds(end),
+		"-show_entries", "frame=best_effort_timestamp_time",
+		"-of", "csv=p=0", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe keyframes error: %v", err)
+	}
+	var keyframes []float64
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimRight(strings.TrimSpace(line), ",")
+		if line == "" || line == "N/A" {
+			continue
+		}
+		t, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keyframe time %q: %v", line, err)
+		}
+		keyframes = append(keyframes, t)
+	}
+	return keyframes, nil
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 6, 64)
+}
@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+func TestClampClipRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranges   models.ClipRangeList
+		duration float64
+		want     models.ClipRangeList
+		wantErr  bool
+	}{
+		{"inside the source", models.ClipRangeList{{Start: 1, End: 4}}, 10.2,
+			models.ClipRangeList{{Start: 1, End: 4}}, false},
+		{"end rounded past the source", models.ClipRangeList{{Start: 2, End: 10.5}}, 10.2,
+			models.ClipRangeList{{Start: 2, End: 10.2}}, false},
+		{"only the last range clamped", models.ClipRangeList{{Start: 0, End: 1}, {Start: 9, End: 11}}, 10,
+			models.ClipRangeList{{Start: 0, End: 1}, {Start: 9, End: 10}}, false},
+		{"starts after the source", models.ClipRangeList{{Start: 11, End: 12}}, 10, nil, true},
+		{"starts at the end of the source", models.ClipRangeList{{Start: 10, End: 10.4}}, 10, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clampClipRanges(tt.ranges, tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clampClipRanges error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("clampClipRanges = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClampClipRangesKeepsInput(t *testing.T) {
+	ranges := models.ClipRangeList{{Start: 0, End: 12}}
+	if _, err := clampClipRanges(ranges, 10); err != nil {
+		t.Fatalf("clampClipRanges: %v", err)
+	}
+	if ranges[0].End != 12 {
+		t.Fatalf("input range changed to %v", ranges[0])
+	}
+}
@@ -0,0 +1,241 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+const (
+	composeClipDir    = "compose-clips"
+	composeSampleRate = 48000
+	defaultComposeFPS = 30.0
+	maxComposeFPS     = 60.0
+)
+
+// composeSource is what normalizing a video of a composition needs to know about it.
+type composeSource struct {
+	path     string
+	width    int
+	height   int
+	fps      float64
+	duration float64
+	hasAudio bool
+}
+
+// downloadComposeSources fetches every video of a composition. A video joined more than once
+// is only downloaded once.
+func (p *videoProcessor) downloadComposeSources(ctx context.Context, sources models.ComposeSourceList) ([]string, error) {
+	paths := make([]string, len(sources))
+	downloaded := make(map[string]string, len(sources))
+	for i, source := range sources {
+		if path, ok := downloaded[source.S3Key]; ok {
+			paths[i] = path
+			continue
+		}
+		path, err := p.downloadVideo(ctx, source.S3Key)
+		if err != nil {
+			return nil, fmt.Errorf("video %s: %w", source.VideoID, err)
+		}
+		downloaded[source.S3Key] = path
+		paths[i] = path
+	}
+	return paths, nil
+}
+
+// cutComposeSources cuts the sources that are clips to their ranges, a clip is composed as it
+// plays and not as its whole parent. It returns the paths to compose.
+func (p *videoProcessor) cutComposeSources(ctx context.Context, sources models.ComposeSourceList, paths []string) ([]string, error) {
+	inputs := make([]string, len(paths))
+	for i, source := range sources {
+		if len(source.ClipRanges) == 0 {
+			inputs[i] = paths[i]
+			continue
+		}
+		dir := filepath.Join(p.tempDir, composeClipDir, strconv.Itoa(i))
+		path, err := p.cutClip(ctx, paths[i], source.ClipRanges, dir)
+		if err != nil {
+			return nil, fmt.Errorf("video %s: %w", source.VideoID, err)
+		}
+		inputs[i] = path
+	}
+	return inputs, nil
+}
+
+// composeVideos joins the sources into a single file and stores it as the job's input, so the
+// composed video has a source like any other. Every source is first brought to the resolution
+// and frame rate of the first one, letterboxed where its aspect ratio differs, and to stereo
+// audio at a common sample rate; sources without audio get silence.
+func (p *videoProcessor) composeVideos(ctx context.Context, job *models.EncodeJob, paths []string) (string, error) {
+	sources := make([]*composeSource, len(paths))
+	list := make(models.ComposeSourceList, len(job.ComposeSources))
+	copy(list, job.ComposeSources)
+	for i, path := range paths {
+		source, err := probeComposeSource(ctx, path)
+		if err != nil {
+			return "", fmt.Errorf("video %s: %w", list[i].VideoID, err)
+		}
+		sources[i] = source
+		list[i].Duration = source.duration
+	}
+	if err := list.Check(); err != nil {
+		return "", fmt.Errorf("invalid composition: %w", err)
+	}
+
+	outputPath := filepath.Join(p.tempDir, sourceDir, filepath.Base(job.InputS3Key))
+	args := []string{"-v", "error"}
+	for _, source := range sources {
+		args = append(args, "-i", source.path)
+	}
+	args = append(args,
+		"-filter_complex", composeFilter(sources, list),
+		"-map", "[v]",
+		"-map", "[a]",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "16",
+		"-c:a", "aac",
+		"-b:a", "192k",
+		"-movflags", "+faststart",
+		"-y", outputPath,
+	)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := p.runCommand(cmd); err != nil {
+		return "", fmt.Errorf("ffmpeg compose failed: %v, stderr: %s", err, stderr.String())
+	}
+
+	if _, err := p.awsRepo.UploadFile(ctx, p.cfg.S3.InputBucket, job.InputS3Key, outputPath, "video/mp4", ""); err != nil {
+		return "", fmt.Errorf("failed to store composed source: %w", err)
+	}
+	return outputPath, nil
+}
+
+// composeFilter builds the filter graph normalizing the sources and joining them, with a
+// concat for cuts and xfade/acrossfade for transitions.
+func composeFilter(sources []*composeSource, list models.ComposeSourceList) string {
+	width, height := sources[0].width&^1, sources[0].height&^1
+	fps := sources[0].fps
+	if fps <= 0 || fps > maxComposeFPS {
+		fps = defaultComposeFPS
+	}
+
+	var graph strings.Builder
+	for i, source := range sources {
+		fmt.Fprintf(&graph, "[%d:v:0]scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,"+
+			"setsar=1,fps=%s,format=yuv420p,settb=AVTB,setpts=PTS-STARTPTS[v%d];",
+			i, width, height, width, height, formatRate(fps), i)
+		if source.hasAudio {
+			fmt.Fprintf(&graph, "[%d:a:0]aformat=sample_fmts=fltp:sample_rates=%d:channel_layouts=stereo,asetpts=PTS-STARTPTS,", i, composeSampleRate)
+		} else {
+			fmt.Fprintf(&graph, "anullsrc=channel_layout=stereo:sample_rate=%d,aformat=sample_fmts=fltp,", composeSampleRate)
+		}
+		// Audio as long as the video keeps the transition offsets in step
+		fmt.Fprintf(&graph, "apad,atrim=duration=%s[a%d];", formatSeconds(source.duration), i)
+	}
+
+	video, audio := "v0", "a0"
+	offset := sources[0].duration
+	for i := 1; i < len(sources); i++ {
+		nextVideo, nextAudio := fmt.Sprintf("vj%d", i), fmt.Sprintf("aj%d", i)
+		if i == len(sources)-1 {
+			nextVideo, nextAudio = "v", "a"
+		}
+		transition := list[i].Transition
+		overlap := transition.Overlap()
+		if overlap == 0 {
+			fmt.Fprintf(&graph, "[%s][v%d]concat=n=2:v=1:a=0[%s];", video, i, nextVideo)
+			fmt.Fprintf(&graph, "[%s][a%d]concat=n=2:v=0:a=1[%s];", audio, i, nextAudio)
+		} else {
+			fmt.Fprintf(&graph, "[%s][v%d]xfade=transition=%s:duration=%s:offset=%s[%s];",
+				video, i, transition.Type, formatSeconds(overlap), formatSeconds(offset-overlap), nextVideo)
+			fmt.Fprintf(&graph, "[%s][a%d]acrossfade=d=%s[%s];", audio, i, formatSeconds(overlap), nextAudio)
+		}
+		video, audio = nextVideo, nextAudio
+		offset += sources[i].duration - overlap
+	}
+	return strings.TrimSuffix(graph.String(), ";")
+}
+
+func probeComposeSource(ctx context.Context, path string) (*composeSource, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error",
+		"-show_entries", "format=duration:stream=codec_type,width,height,r_frame_rate", "-of", "csv=p=0", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe compose source error: %v", err)
+	}
+
+	source := &composeSource{path: path}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(strings.TrimRight(strings.TrimSpace(line), ","), ",")
+		switch {
+		case fields[0] == "video" && len(fields) >= 4 && source.width == 0:
+			if source.width, err = strconv.Atoi(fields[1]); err != nil {
+				return nil, fmt.Errorf("invalid width: %v", err)
+			}
+			if source.height, err = strconv.Atoi(fields[2]); err != nil {
+				return nil, fmt.Errorf("invalid height: %v", err)
+			}
+			source.fps = parseRate(fields[3])
+		case fields[0] == "audio":
+			source.hasAudio = true
+		case len(fields) == 1 && fields[0] != "":
+			if source.duration, err = strconv.ParseFloat(fields[0], 64); err != nil {
+				return nil, fmt.Errorf("invalid duration: %v", err)
+			}
+		}
+	}
+	if source.width <= 0 || source.height <= 0 {
+		return nil, fmt.Errorf("source has no video stream")
+	}
+	if source.duration <= 0 {
+		return nil, fmt.Errorf("source has no duration")
+	}
+	return source, nil
+}
+
+// parseRate parses an ffprobe frame rate like 30000/1001, 0 if it isn't one.
+func parseRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		den = "1"
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func formatRate(fps float64) string {
+	// Keep the common NTSC rates exact
+	for _, base := range []float64{24, 30, 60} {
+		if math.Abs(fps-base*1000/1001) < 0.01 {
+			return fmt.Sprintf("%.0f/1001", base*1000)
+		}
+	}
+	return strconv.FormatFloat(fps, 'f', 3, 64)
+}
+
+// removeComposeSources frees the space of the downloaded videos and the cut clips once they
+// are composed.
+func (p *videoProcessor) removeComposeSources(paths []string, keep string) {
+	for _, path := range paths {
+		if path != keep {
+			os.Remove(path)
+		}
+	}
+	os.RemoveAll(filepath.Join(p.tempDir, composeClipDir))
+}
@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+// hlsPlaylist is a media playlist of the packaged output.
+type hlsPlaylist struct {
+	path     string
+	lines    []string
+	segments int
+}
+
+// encryptHLS encrypts every segment of the media playlists under outputPath with AES-128-CBC
+// and adds the EXT-X-KEY tags that point players at keyURL. Segment i uses key i/rotation
+// (key 0 throughout when rotation is 0) and its media sequence number as IV, so the tags need
+// no IV attribute. keys returns the keys for a number of rotation periods.
+//
+// I-frame playlists address byte ranges of the segments, which can't be decrypted on their
+// own, so they are dropped along with their entries in the master playlists.
+func encryptHLS(outputPath string, rotation int, keys func(count int) ([]*models.ContentKey, error), keyURL func(index int) string) error {
+	playlists, masters, err := readHLSPlaylists(outputPath)
+	if err != nil {
+		return err
+	}
+
+	maxSegments := 0
+	for _, playlist := range playlists {
+		maxSegments = max(maxSegments, playlist.segments)
+	}
+	count := 1
+	if rotation > 0 && maxSegments > 0 {
+		count = (maxSegments + rotation - 1) / rotation
+	}
+	contentKeys, err := keys(count)
+	if err != nil {
+		return fmt.Errorf("failed to get content keys: %w", err)
+	}
+
+	encrypted := make(map[string]bool)
+	for _, playlist := range playlists {
+		if err := encryptPlaylist(playlist, rotation, contentKeys, keyURL, encrypted); err != nil {
+			return fmt.Errorf("%s: %w", playlist.path, err)
+		}
+	}
+	for _, master := range masters {
+		if err := dropIFramePlaylists(master); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readHLSPlaylists sorts the playlists under outputPath into media playlists and master
+// playlists. I-frame playlists are removed.
+func readHLSPlaylists(outputPath string) (playlists []*hlsPlaylist, masters []string, err error) {
+	err = filepath.Walk(outputPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.EqualFold(filepath.Ext(path), ".m3u8") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		content := string(data)
+		switch {
+		case strings.Contains(content, "#EXT-X-STREAM-INF"):
+			masters = append(masters, path)
+		case strings.Contains(content, "#EXT-X-I-FRAMES-ONLY"):
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove I-frame playlist %s: %w", path, err)
+			}
+		default:
+			playlist := &hlsPlaylist{path: path, lines: strings.Split(content, "\n")}
+			for _, line := range playlist.lines {
+				if strings.HasPrefix(line, "#EXT-X-BYTERANGE") {
+					return fmt.Errorf("%s addresses byte ranges, segments can't be encrypted whole", path)
+				}
+				if strings.HasPrefix(line, "#EXTINF") {
+					playlist.segments++
+				}
+			}
+			playlists = append(playlists, playlist)
+		}
+		return nil
+	})
+	return playlists, masters, err
+}
+
+func encryptPlaylist(playlist *hlsPlaylist, rotation int, keys []*models.ContentKey, keyURL func(index int) string, encrypted map[string]bool) error {
+	var (
+		out      = make([]string, 0, len(playlist.lines)+len(keys))
+		sequence int64
+		segment  int
+		current  = -1
+	)
+	for _, line := range playlist.lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "#EXT-X-MEDIA-SEQUENCE:"):
+			value, err := strconv.ParseInt(strings.TrimPrefix(trimmed, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid media sequence: %w", err)
+			}
+			sequence = value
+		case strings.HasPrefix(trimmed, "#EXTINF"):
+			index := 0
+			if rotation > 0 {
+				index = segment / rotation
+			}
+			if index != current {
+				out = append(out, fmt.Sprintf(`#EXT-X-KEY:METHOD=AES-128,URI="%s"`, keyURL(index)))
+				current = index
+			}
+		case trimmed != "" && !strings.HasPrefix(trimmed, "#"):
+			if current < 0 {
+				return fmt.Errorf("segment %s has no EXTINF", trimmed)
+			}
+			path := filepath.Join(filepath.Dir(playlist.path), filepath.FromSlash(trimmed))
+			if encrypted[path] {
+				return fmt.Errorf("segment %s is referenced twice", trimmed)
+			}
+			if err := encryptSegment(path, keys[current].Key, sequence+int64(segment)); err != nil {
+				return err
+			}
+			encrypted[path] = true
+			segment++
+		}
+		out = append(out, line)
+	}
+	return os.WriteFile(playlist.path, []byte(strings.Join(out, "\n")), 0644)
+}
+
+// encryptSegment encrypts a segment in place with AES-128-CBC and PKCS#7 padding.
+func encryptSegment(path string, key []byte, sequence int64) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read segment: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("invalid content key: %w", err)
+	}
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	data = append(data, bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	// HLS takes the media sequence number, big-endian, as the IV when the key tag has none
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write encrypted segment: %w", err)
+	}
+	return nil
+}
+
+// dropIFramePlaylists removes the references to I-frame playlists from a master playlist.
+func dropIFramePlaylists(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	lines := strings.Split(string(data), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#EXT-X-I-FRAME-STREAM-INF") {
+			kept = append(kept, line)
+		}
+	}
+	return os.WriteFile(path, []byte(strings.Join(kept, "\n")), 0644)
+}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptSegment(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	tests := []struct {
+		name     string
+		size     int
+		sequence int64
+	}{
+		{"empty", 0, 0},
+		{"partial block", 10, 1},
+		{"whole blocks", 2 * aes.BlockSize, 42},
+		{"large sequence", 100, 1 << 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := bytes.Repeat([]byte{0x47}, tt.size)
+			path := filepath.Join(t.TempDir(), "seg.ts")
+			if err := os.WriteFile(path, plain, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := encryptSegment(path, key, tt.sequence); err != nil {
+				t.Fatalf("encryptSegment() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data)%aes.BlockSize != 0 || len(data) <= tt.size {
+				t.Fatalf("encryptSegment() wrote %d bytes for %d", len(data), tt.size)
+			}
+
+			// Decrypt the way a player does, with the media sequence number as IV
+			block, _ := aes.NewCipher(key)
+			iv := make([]byte, aes.BlockSize)
+			binary.BigEndian.PutUint64(iv[8:], uint64(tt.sequence))
+			cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+			padding := int(data[len(data)-1])
+			if padding < 1 || padding > aes.BlockSize || !bytes.Equal(data[len(data)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+				t.Fatalf("encryptSegment() padding = %x", data[len(data)-padding:])
+			}
+			if !bytes.Equal(data[:len(data)-padding], plain) {
+				t.Error("encryptSegment() didn't round-trip")
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "seg.ts")
+	if err := os.WriteFile(path, []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptSegment(path, []byte("short"), 0); err == nil {
+		t.Error("encryptSegment() accepted a 5 byte key")
+	}
+}
@@ -0,0 +1,600 @@
+package worker
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+var (
+	hlsResolution = regexp.MustCompile(`^[1-9]\d*x[1-9]\d*$`)
+	hlsFrameRate  = regexp.MustCompile(`^\d+(\.\d{1,3})?$`)
+)
+
+// hlsAttribute is one NAME=VALUE pair of an attribute list, its value as written.
+type hlsAttribute struct {
+	name  string
+	value string
+}
+
+type hlsAttributes []hlsAttribute
+
+// parseAttributes splits an attribute list on the commas outside quoted strings.
+func parseAttributes(list string) hlsAttributes {
+	var attrs hlsAttributes
+	for len(list) > 0 {
+		end, quoted := 0, false
+		for ; end < len(list); end++ {
+			if list[end] == '"' {
+				quoted = !quoted
+			}
+			if list[end] == ',' && !quoted {
+				break
+			}
+		}
+		if name, value, ok := strings.Cut(list[:end], "="); ok {
+			attrs = append(attrs, hlsAttribute{name: strings.TrimSpace(name), value: strings.TrimSpace(value)})
+		}
+		list = list[min(end+1, len(list)):]
+	}
+	return attrs
+}
+
+// get returns an attribute's value without quotes.
+func (a hlsAttributes) get(name string) (string, bool) {
+	for _, attr := range a {
+		if attr.name == name {
+			return strings.Trim(attr.value, `"`), true
+		}
+	}
+	return "", false
+}
+
+func (a hlsAttributes) String() string {
+	parts := make([]string, len(a))
+	for i, attr := range a {
+		parts[i] = attr.name + "=" + attr.value
+	}
+	return strings.Join(parts, ",")
+}
+
+// hlsMaster is the structure of a master playlist: its renditions, variants and I-frame
+// variants with their attributes.
+type hlsMaster struct {
+	lines    []string // session tags, kept as they are
+	media    []hlsAttributes
+	variants []hlsVariant
+	iframes  []hlsAttributes
+}
+
+type hlsVariant struct {
+	attrs hlsAttributes
+	uri   string
+}
+
+func parseMaster(content string) (*hlsMaster, error) {
+	master := &hlsMaster{}
+	lines := strings.Split(content, "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "#EXTM3U" {
+		return nil, fmt.Errorf("playlist doesn't start with #EXTM3U")
+	}
+	var pending hlsAttributes
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		tag, value, _ := strings.Cut(line, ":")
+		switch {
+		case line == "":
+		case tag == "#EXT-X-MEDIA":
+			master.media = append(master.media, parseAttributes(value))
+		case tag == "#EXT-X-STREAM-INF":
+			pending = parseAttributes(value)
+		case tag == "#EXT-X-I-FRAME-STREAM-INF":
+			master.iframes = append(master.iframes, parseAttributes(value))
+		case tag == "#EXT-X-SESSION-KEY" || tag == "#EXT-X-SESSION-DATA":
+			master.lines = append(master.lines, line)
+		case strings.HasPrefix(line, "#"):
+		default:
+			if pending == nil {
+				return nil, fmt.Errorf("URI %s doesn't follow an EXT-X-STREAM-INF tag", line)
+			}
+			master.variants = append(master.variants, hlsVariant{attrs: pending, uri: line})
+			pending = nil
+		}
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("EXT-X-STREAM-INF tag without URI")
+	}
+	return master, nil
+}
+
+// mediaPlaylist is what the master playlist needs to know of a media playlist.
+type mediaPlaylist struct {
+	path        string // relative to the output, slash separated
+	version     int
+	target      int
+	mapURI      string
+	iframesOnly bool
+	endList     bool
+	entries     []mediaEntry
+}
+
+type mediaEntry struct {
+	duration float64
+	uri      string
+	length   int64 // of the byte range, -1 for the whole resource
+}
+
+func readMediaPlaylist(outputPath, rel string) (*mediaPlaylist, error) {
+	data, err := os.ReadFile(filepath.Join(outputPath, filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rel, err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "#EXTM3U" {
+		return nil, fmt.Errorf("%s doesn't start with #EXTM3U", rel)
+	}
+
+	playlist := &mediaPlaylist{path: rel, version: 1}
+	var (
+		duration = -1.0
+		length   = int64(-1)
+	)
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		tag, value, _ := strings.Cut(line, ":")
+		switch {
+		case line == "":
+		case tag == "#EXT-X-VERSION":
+			if playlist.version, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("%s: invalid version %q", rel, value)
+			}
+		case tag == "#EXT-X-TARGETDURATION":
+			if playlist.target, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("%s: invalid target duration %q", rel, value)
+			}
+		case tag == "#EXT-X-MAP":
+			playlist.mapURI, _ = parseAttributes(value).get("URI")
+		case tag == "#EXT-X-I-FRAMES-ONLY":
+			playlist.iframesOnly = true
+		case tag == "#EXT-X-ENDLIST":
+			playlist.endList = true
+		case tag == "#EXTINF":
+			number, _, _ := strings.Cut(value, ",")
+			if duration, err = strconv.ParseFloat(number, 64); err != nil || duration < 0 {
+				return nil, fmt.Errorf("%s: invalid segment duration %q", rel, value)
+			}
+		case tag == "#EXT-X-BYTERANGE":
+			number, _, _ := strings.Cut(value, "@")
+			if length, err = strconv.ParseInt(number, 10, 64); err != nil {
+				return nil, fmt.Errorf("%s: invalid byte range %q", rel, value)
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			if duration < 0 {
+				return nil, fmt.Errorf("%s: segment %s has no EXTINF", rel, line)
+			}
+			playlist.entries = append(playlist.entries, mediaEntry{duration: duration, uri: line, length: length})
+			duration, length = -1, -1
+		}
+	}
+	return playlist, nil
+}
+
+// resolve returns the output path of a URI of the playlist.
+func (p *mediaPlaylist) resolve(uri string) (string, error) {
+	if strings.Contains(uri, "://") || strings.HasPrefix(uri, "/") {
+		return "", fmt.Errorf("%s: %s is not relative to the playlist", p.path, uri)
+	}
+	rel := path.Join(path.Dir(p.path), uri)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s: %s leaves the output", p.path, uri)
+	}
+	return rel, nil
+}
+
+// bitrates measures the peak and average segment bit rates of the playlist from the sizes of
+// its segments or byte ranges.
+func (p *mediaPlaylist) bitrates(outputPath string) (peak, average int64, err error) {
+	durations := make([]float64, len(p.entries))
+	sizes := make([]int64, len(p.entries))
+	for i, entry := range p.entries {
+		durations[i] = entry.duration
+		sizes[i] = entry.length
+		if entry.length >= 0 {
+			continue
+		}
+		rel, err := p.resolve(entry.uri)
+		if err != nil {
+			return 0, 0, err
+		}
+		info, err := os.Stat(filepath.Join(outputPath, filepath.FromSlash(rel)))
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", p.path, err)
+		}
+		sizes[i] = info.Size()
+	}
+	peak, average = segmentBitrates(durations, sizes, float64(p.target))
+	return peak, average, nil
+}
+
+// validate checks the playlist against the rules of RFC 8216 that the packaged output can
+// break.
+func (p *mediaPlaylist) validate(outputPath string) error {
+	if p.target <= 0 {
+		return fmt.Errorf("%s has no EXT-X-TARGETDURATION", p.path)
+	}
+	if len(p.entries) == 0 {
+		return fmt.Errorf("%s has no segments", p.path)
+	}
+	if !p.endList {
+		return fmt.Errorf("%s has no EXT-X-ENDLIST", p.path)
+	}
+	required := 3
+	for _, entry := range p.entries {
+		if int(math.Round(entry.duration)) > p.target {
+			return fmt.Errorf("%s: segment %s lasts longer than the target duration", p.path, entry.uri)
+		}
+		if entry.length >= 0 {
+			required = max(required, 4)
+		}
+		rel, err := p.resolve(entry.uri)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(outputPath, filepath.FromSlash(rel))); err != nil {
+			return fmt.Errorf("%s: segment %s is missing", p.path, entry.uri)
+		}
+	}
+	if p.mapURI != "" {
+		required = max(required, 6)
+		if p.iframesOnly {
+			required = max(required, 5)
+		}
+	}
+	if p.version < required {
+		return fmt.Errorf("%s needs EXT-X-VERSION %d, has %d", p.path, required, p.version)
+	}
+	return nil
+}
+
+// writeMasterPlaylist regenerates the master playlist in outputPath from the media playlists
+// it lists and the measured renditions. Renditions, groups and session tags are kept;
+// bandwidths, codecs, resolution, frame rate and video range are measured.
+func writeMasterPlaylist(outputPath string, renditions []*rendition) error {
+	masterPath := filepath.Join(outputPath, models.HLSManifestName)
+	data, err := os.ReadFile(masterPath)
+	if err != nil {
+		return fmt.Errorf("failed to read master playlist: %w", err)
+	}
+	master, err := parseMaster(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid master playlist: %w", err)
+	}
+	g := &masterGenerator{
+		outputPath: outputPath,
+		byInit:     make(map[string]*rendition, len(renditions)),
+		playlists:  make(map[string]*measuredPlaylist),
+	}
+	for _, r := range renditions {
+		g.byInit[r.init] = r
+	}
+
+	content, err := g.generate(master)
+	if err != nil {
+		return err
+	}
+	if err := validateMasterPlaylist(outputPath, content); err != nil {
+		return fmt.Errorf("generated master playlist is invalid: %w", err)
+	}
+	if err := os.WriteFile(masterPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write master playlist: %w", err)
+	}
+	return nil
+}
+
+type masterGenerator struct {
+	outputPath string
+	byInit     map[string]*rendition
+	playlists  map[string]*measuredPlaylist
+}
+
+// measuredPlaylist is a media playlist with its track and bit rates.
+type measuredPlaylist struct {
+	*mediaPlaylist
+	rendition *rendition
+	peak      int64
+	average   int64
+}
+
+func (g *masterGenerator) measure(uri string) (*measuredPlaylist, error) {
+	rel := path.Clean(uri)
+	if p, ok := g.playlists[rel]; ok {
+		return p, nil
+	}
+	playlist, err := readMediaPlaylist(g.outputPath, rel)
+	if err != nil {
+		return nil, err
+	}
+	if playlist.mapURI == "" {
+		return nil, fmt.Errorf("%s has no init segment", rel)
+	}
+	init, err := playlist.resolve(playlist.mapURI)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := g.byInit[init]
+	if !ok {
+		return nil, fmt.Errorf("%s: init segment %s was not measured", rel, init)
+	}
+	peak, average, err := playlist.bitrates(g.outputPath)
+	if err != nil {
+		return nil, err
+	}
+	p := &measuredPlaylist{mediaPlaylist: playlist, rendition: r, peak: peak, average: average}
+	g.playlists[rel] = p
+	return p, nil
+}
+
+func (g *masterGenerator) generate(master *hlsMaster) (string, error) {
+	// Audio renditions by group, in playlist order
+	groups := make(map[string][]*measuredPlaylist)
+	media := make([]hlsAttributes, 0, len(master.media))
+	for _, attrs := range master.media {
+		attrs = append(hlsAttributes(nil), attrs...)
+		typ, _ := attrs.get("TYPE")
+		uri, hasURI := attrs.get("URI")
+		if typ == "AUDIO" && hasURI {
+			p, err := g.measure(uri)
+			if err != nil {
+				return "", err
+			}
+			group, _ := attrs.get("GROUP-ID")
+			groups[group] = append(groups[group], p)
+			attrs = setAttribute(attrs, "CHANNELS", strconv.Quote(strconv.Itoa(p.rendition.track.channels)))
+		}
+		media = append(media, attrs)
+	}
+
+	var variants []string
+	independent := true
+	for _, variant := range master.variants {
+		p, err := g.measure(variant.uri)
+		if err != nil {
+			return "", err
+		}
+		track := p.rendition.track
+		peak, average := p.peak, p.average
+		codecs := []string{track.codec}
+		group, hasGroup := variant.attrs.get("AUDIO")
+		if hasGroup {
+			// The variant plays with any one rendition of its group
+			var groupPeak, groupAverage int64
+			for _, audio := range groups[group] {
+				groupPeak = max(groupPeak, audio.peak)
+				groupAverage = max(groupAverage, audio.average)
+				codecs = appendUnique(codecs, audio.rendition.track.codec)
+			}
+			peak += groupPeak
+			average += groupAverage
+		}
+
+		attrs := hlsAttributes{
+			{"BANDWIDTH", strconv.FormatInt(peak, 10)},
+			{"AVERAGE-BANDWIDTH", strconv.FormatInt(average, 10)},
+			{"CODECS", strconv.Quote(strings.Join(codecs, ","))},
+		}
+		if track.kind == "video" {
+			attrs = append(attrs, hlsAttribute{"RESOLUTION", fmt.Sprintf("%dx%d", track.width, track.height)})
+			if num, den := p.rendition.frameRate(); num > 0 {
+				attrs = append(attrs, hlsAttribute{"FRAME-RATE", fmt.Sprintf("%.3f", float64(num)/float64(den))})
+			}
+			attrs = append(attrs, hlsAttribute{"VIDEO-RANGE", track.videoRange()})
+			independent = independent && p.rendition.independent()
+		}
+		for _, name := range []string{"AUDIO", "SUBTITLES", "CLOSED-CAPTIONS"} {
+			for _, attr := range variant.attrs {
+				if attr.name == name {
+					attrs = append(attrs, attr)
+				}
+			}
+		}
+		variants = append(variants, "#EXT-X-STREAM-INF:"+attrs.String(), variant.uri)
+	}
+
+	var iframes []string
+	for _, original := range master.iframes {
+		uri, _ := original.get("URI")
+		p, err := g.measure(uri)
+		if err != nil {
+			return "", err
+		}
+		track := p.rendition.track
+		attrs := hlsAttributes{
+			{"BANDWIDTH", strconv.FormatInt(p.peak, 10)},
+			{"AVERAGE-BANDWIDTH", strconv.FormatInt(p.average, 10)},
+			{"CODECS", strconv.Quote(track.codec)},
+			{"RESOLUTION", fmt.Sprintf("%dx%d", track.width, track.height)},
+			{"VIDEO-RANGE", track.videoRange()},
+			{"URI", strconv.Quote(uri)},
+		}
+		iframes = append(iframes, "#EXT-X-I-FRAME-STREAM-INF:"+attrs.String())
+	}
+
+	version := 1
+	for _, p := range g.playlists {
+		version = max(version, p.version)
+	}
+	lines := []string{"#EXTM3U", fmt.Sprintf("#EXT-X-VERSION:%d", version)}
+	if independent {
+		lines = append(lines, "#EXT-X-INDEPENDENT-SEGMENTS")
+	}
+	lines = append(lines, master.lines...)
+	for _, attrs := range media {
+		lines = append(lines, "#EXT-X-MEDIA:"+attrs.String())
+	}
+	lines = append(lines, variants...)
+	lines = append(lines, iframes...)
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// validateMasterPlaylist checks a master playlist and the media playlists it lists against
+// RFC 8216 and what strict players, Apple's in particular, require of them.
+func validateMasterPlaylist(outputPath, content string) error {
+	master, err := parseMaster(content)
+	if err != nil {
+		return err
+	}
+	if len(master.variants) == 0 {
+		return fmt.Errorf("no variant streams")
+	}
+
+	// Whether each checked playlist is I-frames only
+	checked := make(map[string]bool)
+	checkPlaylist := func(uri string, iframesOnly bool) error {
+		if kind, ok := checked[uri]; ok {
+			if kind != iframesOnly {
+				return fmt.Errorf("%s is listed as the wrong kind of playlist", uri)
+			}
+			return nil
+		}
+		checked[uri] = iframesOnly
+		playlist, err := readMediaPlaylist(outputPath, path.Clean(uri))
+		if err != nil {
+			return err
+		}
+		if playlist.iframesOnly != iframesOnly {
+			return fmt.Errorf("%s is listed as the wrong kind of playlist", uri)
+		}
+		return playlist.validate(outputPath)
+	}
+
+	groups := make(map[string]map[string]bool)
+	defaults := make(map[string]int)
+	for _, attrs := range master.media {
+		typ, _ := attrs.get("TYPE")
+		group, hasGroup := attrs.get("GROUP-ID")
+		name, hasName := attrs.get("NAME")
+		if typ == "" || !hasGroup || !hasName {
+			return fmt.Errorf("EXT-X-MEDIA needs TYPE, GROUP-ID and NAME: %s", attrs)
+		}
+		key := typ + "/" + group
+		if groups[key] == nil {
+			groups[key] = make(map[string]bool)
+		}
+		if groups[key][name] {
+			return fmt.Errorf("rendition name %q is used twice in group %s", name, group)
+		}
+		groups[key][name] = true
+		if value, _ := attrs.get("DEFAULT"); value == "YES" {
+			if defaults[key]++; defaults[key] > 1 {
+				return fmt.Errorf("group %s has more than one default rendition", group)
+			}
+			if value, ok := attrs.get("AUTOSELECT"); ok && value != "YES" {
+				return fmt.Errorf("default rendition %q must be autoselected", name)
+			}
+		}
+		uri, hasURI := attrs.get("URI")
+		if typ == "CLOSED-CAPTIONS" && hasURI {
+			return fmt.Errorf("closed captions rendition %q has a URI", name)
+		}
+		if hasURI {
+			if err := checkPlaylist(uri, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, variant := range master.variants {
+		bandwidth, average, err := validateBandwidth(variant.attrs)
+		if err != nil {
+			return fmt.Errorf("variant %s: %w", variant.uri, err)
+		}
+		if codecs, _ := variant.attrs.get("CODECS"); codecs == "" {
+			return fmt.Errorf("variant %s has no CODECS", variant.uri)
+		}
+		if err := validateVideoAttributes(variant.attrs); err != nil {
+			return fmt.Errorf("variant %s: %w", variant.uri, err)
+		}
+		if rate, ok := variant.attrs.get("FRAME-RATE"); ok && !hlsFrameRate.MatchString(rate) {
+			return fmt.Errorf("variant %s has an invalid FRAME-RATE %q", variant.uri, rate)
+		}
+		for attr, typ := range map[string]string{"AUDIO": "AUDIO", "SUBTITLES": "SUBTITLES", "CLOSED-CAPTIONS": "CLOSED-CAPTIONS"} {
+			if group, ok := variant.attrs.get(attr); ok && group != "NONE" && groups[typ+"/"+group] == nil {
+				return fmt.Errorf("variant %s refers to missing %s group %q", variant.uri, typ, group)
+			}
+		}
+		if average > bandwidth {
+			return fmt.Errorf("variant %s has AVERAGE-BANDWIDTH above BANDWIDTH", variant.uri)
+		}
+		if err := checkPlaylist(variant.uri, false); err != nil {
+			return err
+		}
+	}
+
+	for _, attrs := range master.iframes {
+		uri, ok := attrs.get("URI")
+		if !ok {
+			return fmt.Errorf("EXT-X-I-FRAME-STREAM-INF has no URI")
+		}
+		if _, _, err := validateBandwidth(attrs); err != nil {
+			return fmt.Errorf("I-frame stream %s: %w", uri, err)
+		}
+		if err := validateVideoAttributes(attrs); err != nil {
+			return fmt.Errorf("I-frame stream %s: %w", uri, err)
+		}
+		if err := checkPlaylist(uri, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateBandwidth(attrs hlsAttributes) (bandwidth, average int64, err error) {
+	value, ok := attrs.get("BANDWIDTH")
+	if bandwidth, err = strconv.ParseInt(value, 10, 64); !ok || err != nil || bandwidth <= 0 {
+		return 0, 0, fmt.Errorf("invalid BANDWIDTH %q", value)
+	}
+	if value, ok := attrs.get("AVERAGE-BANDWIDTH"); ok {
+		if average, err = strconv.ParseInt(value, 10, 64); err != nil || average <= 0 {
+			return 0, 0, fmt.Errorf("invalid AVERAGE-BANDWIDTH %q", value)
+		}
+	}
+	return bandwidth, average, nil
+}
+
+func validateVideoAttributes(attrs hlsAttributes) error {
+	if resolution, ok := attrs.get("RESOLUTION"); ok && !hlsResolution.MatchString(resolution) {
+		return fmt.Errorf("invalid RESOLUTION %q", resolution)
+	}
+	if videoRange, ok := attrs.get("VIDEO-RANGE"); ok && videoRange != "SDR" && videoRange != "PQ" && videoRange != "HLG" {
+		return fmt.Errorf("invalid VIDEO-RANGE %q", videoRange)
+	}
+	return nil
+}
+
+// setAttribute replaces the value of an attribute, or appends it.
+func setAttribute(attrs hlsAttributes, name, value string) hlsAttributes {
+	for i := range attrs {
+		if attrs[i].name == name {
+			attrs[i].value = value
+			return attrs
+		}
+	}
+	return append(attrs, hlsAttribute{name, value})
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
@@ -0,0 +1,279 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+const (
+	videoPlaylist = "#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-TARGETDURATION:2\n#EXT-X-MAP:URI=\"init.mp4\"\n" +
+		"#EXTINF:2.0,\nseg-1.m4s\n#EXTINF:2.0,\nseg-2.m4s\n#EXT-X-ENDLIST\n"
+	audioPlaylist = "#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-TARGETDURATION:2\n#EXT-X-MAP:URI=\"init.mp4\"\n" +
+		"#EXTINF:2.0,\nseg-1.m4s\n#EXTINF:2.0,\nseg-2.m4s\n#EXT-X-ENDLIST\n"
+	// What the packager writes, with placeholder attributes that are replaced by measurements
+	packagerMaster = "#EXTM3U\n#EXT-X-VERSION:4\n" +
+		"#EXT-X-SESSION-KEY:METHOD=SAMPLE-AES,URI=\"https://keys.example.com/k\"\n" +
+		"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=\"en\",LANGUAGE=\"en\",DEFAULT=YES,AUTOSELECT=YES,URI=\"audio/media.m3u8\"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1,CODECS=\"avc1\",RESOLUTION=1x1,AUDIO=\"audio\"\n" +
+		"video/media.m3u8\n"
+)
+
+// hlsOutput is the packaged output with its HLS playlists.
+func hlsOutput(t *testing.T) string {
+	t.Helper()
+	dir := packagedOutput(t)
+	writeFiles(t, dir, map[string][]byte{
+		"video/media.m3u8":     []byte(videoPlaylist),
+		"audio/media.m3u8":     []byte(audioPlaylist),
+		models.HLSManifestName: []byte(packagerMaster),
+	})
+	return dir
+}
+
+func TestParseAttributes(t *testing.T) {
+	attrs := parseAttributes(`BANDWIDTH=1000, CODECS="avc1.64001F,mp4a.40.2",RESOLUTION=1280x720,BROKEN`)
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"BANDWIDTH", "1000", true},
+		{"CODECS", "avc1.64001F,mp4a.40.2", true},
+		{"RESOLUTION", "1280x720", true},
+		{"BROKEN", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := attrs.get(tt.name); got != tt.want || ok != tt.ok {
+			t.Errorf("get(%s) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+	if got, want := attrs.String(), `BANDWIDTH=1000,CODECS="avc1.64001F,mp4a.40.2",RESOLUTION=1280x720`; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+func TestParseMaster(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantVariants int
+		wantMedia    int
+		wantIFrames  int
+		wantLines    int
+		wantErr      bool
+	}{
+		{name: "packager output", content: packagerMaster, wantVariants: 1, wantMedia: 1, wantLines: 1},
+		{
+			name:         "I-frame streams",
+			content:      "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\na.m3u8\n#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=1,URI=\"i.m3u8\"\n",
+			wantVariants: 1, wantIFrames: 1,
+		},
+		{name: "no header", content: "#EXT-X-VERSION:6\n", wantErr: true},
+		{name: "URI without STREAM-INF", content: "#EXTM3U\na.m3u8\n", wantErr: true},
+		{name: "STREAM-INF without URI", content: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			master, err := parseMaster(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMaster() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(master.variants) != tt.wantVariants || len(master.media) != tt.wantMedia ||
+				len(master.iframes) != tt.wantIFrames || len(master.lines) != tt.wantLines {
+				t.Errorf("parseMaster() = %d variants, %d media, %d I-frame streams, %d session lines",
+					len(master.variants), len(master.media), len(master.iframes), len(master.lines))
+			}
+		})
+	}
+}
+
+func TestReadMediaPlaylist(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantEntries int
+		wantLength  int64
+		wantErr     bool
+	}{
+		{name: "segments", content: videoPlaylist, wantEntries: 2, wantLength: -1},
+		{name: "byte ranges", content: "#EXTM3U\n#EXTINF:2,\n#EXT-X-BYTERANGE:500@0\nall.mp4\n", wantEntries: 1, wantLength: 500},
+		{name: "no header", content: "#EXTINF:2,\na.m4s\n", wantErr: true},
+		{name: "segment without EXTINF", content: "#EXTM3U\na.m4s\n", wantErr: true},
+		{name: "negative duration", content: "#EXTM3U\n#EXTINF:-1,\na.m4s\n", wantErr: true},
+		{name: "invalid version", content: "#EXTM3U\n#EXT-X-VERSION:six\n", wantErr: true},
+		{name: "invalid byte range", content: "#EXTM3U\n#EXTINF:2,\n#EXT-X-BYTERANGE:x@0\na.m4s\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string][]byte{"media.m3u8": []byte(tt.content)})
+			playlist, err := readMediaPlaylist(dir, "media.m3u8")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readMediaPlaylist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(playlist.entries) != tt.wantEntries || playlist.entries[0].length != tt.wantLength {
+				t.Errorf("readMediaPlaylist() = %+v", playlist.entries)
+			}
+		})
+	}
+}
+
+func TestMediaPlaylistResolve(t *testing.T) {
+	p := &mediaPlaylist{path: "video/media.m3u8"}
+	tests := []struct {
+		uri     string
+		want    string
+		wantErr bool
+	}{
+		{"seg-1.m4s", "video/seg-1.m4s", false},
+		{"../audio/init.mp4", "audio/init.mp4", false},
+		{"../../etc/passwd", "", true},
+		{"/etc/passwd", "", true},
+		{"https://cdn.example.com/seg.m4s", "", true},
+	}
+	for _, tt := range tests {
+		got, err := p.resolve(tt.uri)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolve(%q) = %q, %v; want %q, error %v", tt.uri, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteMasterPlaylist(t *testing.T) {
+	dir := hlsOutput(t)
+	renditions, err := measureRenditions(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMasterPlaylist(dir, renditions); err != nil {
+		t.Fatalf("writeMasterPlaylist() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, models.HLSManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Peaks are those of the largest segment of each track, both last 2 seconds
+	videoPeak := (fileSize(t, dir, "video/seg-2.m4s")*8 + 1) / 2
+	audioPeak := (fileSize(t, dir, "audio/seg-1.m4s")*8 + 1) / 2
+	videoAverage := ((fileSize(t, dir, "video/seg-1.m4s")+fileSize(t, dir, "video/seg-2.m4s"))*8 + 3) / 4
+	audioAverage := (fileSize(t, dir, "audio/seg-1.m4s")*8*2 + 3) / 4
+	want := strings.Join([]string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:6",
+		"#EXT-X-INDEPENDENT-SEGMENTS",
+		`#EXT-X-SESSION-KEY:METHOD=SAMPLE-AES,URI="https://keys.example.com/k"`,
+		`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="en",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,URI="audio/media.m3u8",CHANNELS="2"`,
+		fmt.Sprintf(`#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,CODECS="avc1.64001F,mp4a.40.2",RESOLUTION=1280x720,FRAME-RATE=30.000,VIDEO-RANGE=SDR,AUDIO="audio"`,
+			videoPeak+audioPeak, videoAverage+audioAverage),
+		"video/media.m3u8",
+	}, "\n") + "\n"
+	if string(data) != want {
+		t.Errorf("master playlist =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestWriteMasterPlaylistErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string][]byte
+	}{
+		{"variant playlist missing", map[string][]byte{
+			"video/media.m3u8": nil,
+		}},
+		{"playlist without init segment", map[string][]byte{
+			"video/media.m3u8": []byte("#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-TARGETDURATION:2\n#EXTINF:2.0,\nseg-1.m4s\n#EXT-X-ENDLIST\n"),
+		}},
+		{"init segment outside the output", map[string][]byte{
+			"video/media.m3u8": []byte(strings.Replace(videoPlaylist, `URI="init.mp4"`, `URI="../../init.mp4"`, 1)),
+		}},
+		{"segment missing", map[string][]byte{
+			"video/media.m3u8": []byte(strings.Replace(videoPlaylist, "seg-2.m4s", "seg-3.m4s", 1)),
+		}},
+		{"segment longer than the target", map[string][]byte{
+			"video/media.m3u8": []byte(strings.Replace(videoPlaylist, "#EXTINF:2.0,\nseg-2", "#EXTINF:3.0,\nseg-2", 1)),
+		}},
+		{"version too low for EXT-X-MAP", map[string][]byte{
+			"video/media.m3u8": []byte(strings.Replace(videoPlaylist, "VERSION:6", "VERSION:3", 1)),
+		}},
+		{"no end list", map[string][]byte{
+			"video/media.m3u8": []byte(strings.Replace(videoPlaylist, "#EXT-X-ENDLIST\n", "", 1)),
+		}},
+		{"two default renditions", map[string][]byte{
+			models.HLSManifestName: []byte(strings.Replace(packagerMaster, "#EXT-X-STREAM-INF",
+				`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="de",DEFAULT=YES,URI="audio/media.m3u8"`+"\n#EXT-X-STREAM-INF", 1)),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := hlsOutput(t)
+			for name, data := range tt.files {
+				if data == nil {
+					if err := os.Remove(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+						t.Fatal(err)
+					}
+					delete(tt.files, name)
+				}
+			}
+			writeFiles(t, dir, tt.files)
+			renditions, err := measureRenditions(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeMasterPlaylist(dir, renditions); err == nil {
+				t.Error("writeMasterPlaylist() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestValidateMasterPlaylist(t *testing.T) {
+	variant := func(attrs string) string {
+		return "#EXTM3U\n#EXT-X-STREAM-INF:" + attrs + "\nvideo/media.m3u8\n"
+	}
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", variant(`BANDWIDTH=2000,AVERAGE-BANDWIDTH=1000,CODECS="avc1.64001F",RESOLUTION=1280x720,FRAME-RATE=29.970,VIDEO-RANGE=PQ`), false},
+		{"no variants", "#EXTM3U\n", true},
+		{"no bandwidth", variant(`CODECS="avc1.64001F"`), true},
+		{"zero bandwidth", variant(`BANDWIDTH=0,CODECS="avc1.64001F"`), true},
+		{"average above peak", variant(`BANDWIDTH=1000,AVERAGE-BANDWIDTH=2000,CODECS="avc1.64001F"`), true},
+		{"no codecs", variant(`BANDWIDTH=1000`), true},
+		{"invalid resolution", variant(`BANDWIDTH=1000,CODECS="avc1.64001F",RESOLUTION=1280x0`), true},
+		{"invalid frame rate", variant(`BANDWIDTH=1000,CODECS="avc1.64001F",FRAME-RATE=29.97002`), true},
+		{"invalid video range", variant(`BANDWIDTH=1000,CODECS="avc1.64001F",VIDEO-RANGE=HDR10`), true},
+		{"missing audio group", variant(`BANDWIDTH=1000,CODECS="avc1.64001F",AUDIO="aac"`), true},
+		{"rendition without name", "#EXTM3U\n#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"a\"\n" + variant(`BANDWIDTH=1000,CODECS="avc1.64001F"`)[8:], true},
+		{"closed captions with URI", "#EXTM3U\n#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID=\"cc\",NAME=\"en\",URI=\"cc.m3u8\"\n" + variant(`BANDWIDTH=1000,CODECS="avc1.64001F"`)[8:], true},
+		{"I-frame stream listing a media playlist", variant(`BANDWIDTH=1000,CODECS="avc1.64001F"`) + "#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100,URI=\"video/media.m3u8\"\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string][]byte{
+				"video/media.m3u8": []byte(videoPlaylist),
+				"video/init.mp4":   nil,
+				"video/seg-1.m4s":  nil,
+				"video/seg-2.m4s":  nil,
+			})
+			err := validateMasterPlaylist(dir, tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateMasterPlaylist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+)
+
+const defaultImportConcurrency = 2
+
+// ImportRunner takes queued URL imports and runs them. Imports are network bound, so they run
+// next to the encode jobs without going through admission.
+type ImportRunner struct {
+	logger     logger.Logger
+	redisRepo  videofiles.RedisRepository
+	videoUC    videofiles.UseCase
+	queueKey   string
+	wg         sync.WaitGroup
+	semaphore  chan struct{}
+	cancel     context.CancelFunc
+	subscribed atomic.Bool
+}
+
+func NewImportRunner(cfg *config.Config, logger logger.Logger, redisRepo videofiles.RedisRepository, videoUC videofiles.UseCase) *ImportRunner {
+	concurrency := cfg.Import.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultImportConcurrency
+	}
+	queueKey := cfg.Import.QueueKey
+	if queueKey == "" {
+		queueKey = models.DefaultImportQueueKey
+	}
+	return &ImportRunner{
+		logger:    logger,
+		redisRepo: redisRepo,
+		videoUC:   videoUC,
+		queueKey:  queueKey,
+		semaphore: make(chan struct{}, concurrency),
+	}
+}
+
+func (r *ImportRunner) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.wg.Add(1)
+	go r.subscribe(ctx)
+}
+
+// Stop cancels running imports, returns them to the queue and waits for that to finish.
+func (r *ImportRunner) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// CheckSubscription reports whether the runner is subscribed to the import queue.
+func (r *ImportRunner) CheckSubscription(ctx context.Context) error {
+	if !r.subscribed.Load() {
+		return errors.New("not subscribed to the import queue")
+	}
+	return nil
+}
+
+func (r *ImportRunner) subscribe(ctx context.Context) {
+	defer r.wg.Done()
+	defer r.subscribed.Store(false)
+
+	attempt := 0
+	for {
+		tasks, err := r.redisRepo.SubscribeToImports(ctx, r.queueKey)
+		if err != nil {
+			delay := utils.Backoff(attempt, minClaimBackoff, maxClaimBackoff)
+			r.logger.Errorf("Failed to subscribe to imports, retrying in %s: %v", delay, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			attempt++
+			continue
+		}
+
+		attempt = 0
+		r.subscribed.Store(true)
+		for task := range tasks {
+			select {
+			case r.semaphore <- struct{}{}:
+			case <-ctx.Done():
+				r.requeue(task)
+				continue
+			}
+			r.wg.Add(1)
+			go func() {
+				defer r.wg.Done()
+				defer func() { <-r.semaphore }()
+				r.run(ctx, task)
+			}()
+		}
+		r.subscribed.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Warn("Import subscription closed, resubscribing")
+	}
+}
+
+func (r *ImportRunner) run(ctx context.Context, task *models.ImportTask) {
+	r.logger.Infof("Importing %s for import %s", task.Input.SourceURL, task.ImportID)
+	err := r.videoUC.RunImport(ctx, task)
+	if err != nil && ctx.Err() != nil {
+		r.requeue(task)
+		return
+	}
+	if err != nil {
+		r.logger.Errorf("Import %s failed: %v", task.ImportID, err)
+	} else {
+		r.logger.Infof("Import %s created video %s", task.ImportID, task.VideoID)
+	}
+
+	releaseCtx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
+	if err = r.redisRepo.ReleaseImportLock(releaseCtx, task.ImportID); err != nil {
+		r.logger.Errorf("Failed to release lock of import %s: %v", task.ImportID, err)
+	}
+}
+
+// requeue hands an interrupted import back to the queue so another worker can run it.
+func (r *ImportRunner) requeue(task *models.ImportTask) {
+	ctx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
+	if err := r.redisRepo.ReleaseImportLock(ctx, task.ImportID); err != nil {
+		r.logger.Errorf("Failed to release lock of import %s: %v", task.ImportID, err)
+	}
+	if err := r.redisRepo.EnqueueImport(ctx, r.queueKey, task); err != nil {
+		r.logger.Errorf("Failed to requeue import %s: %v", task.ImportID, err)
+		return
+	}
+	r.logger.Infof("Import %s returned to the queue", task.ImportID)
+}
@@ -0,0 +1,230 @@
+package worker
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// rendition is one track of the packaged output: an init segment and the media segments of its
+// directory, in presentation order.
+type rendition struct {
+	dir      string
+	init     string
+	track    *trackInfo
+	segments []*renditionSegment
+}
+
+type renditionSegment struct {
+	path string
+	size int64
+	*fragmentInfo
+}
+
+// measureRenditions reads the init and media segments under outputPath. Paths are relative to
+// outputPath and slash separated. It must run before anything encrypts whole segments.
+func measureRenditions(outputPath string) ([]*rendition, error) {
+	inits := make(map[string]string)
+	media := make(map[string][]string)
+	err := filepath.Walk(outputPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".m3u8", ".mpd":
+			return nil
+		}
+		data, err := readHeader(file, 8)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(outputPath, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		dir := path.Dir(rel)
+		switch firstBoxType(data) {
+		case "ftyp":
+			if previous, ok := inits[dir]; ok {
+				return fmt.Errorf("%s and %s are both init segments of %s", previous, rel, dir)
+			}
+			inits[dir] = rel
+		case "styp", "sidx", "moof":
+			media[dir] = append(media[dir], rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read packaged output: %w", err)
+	}
+
+	renditions := make([]*rendition, 0, len(inits))
+	for dir, init := range inits {
+		r, err := readRendition(outputPath, dir, init, media[dir])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		renditions = append(renditions, r)
+		delete(media, dir)
+	}
+	for dir := range media {
+		return nil, fmt.Errorf("%s has media segments but no init segment", dir)
+	}
+	sort.Slice(renditions, func(i, j int) bool { return renditions[i].dir < renditions[j].dir })
+	return renditions, nil
+}
+
+func readRendition(outputPath, dir, init string, segments []string) (*rendition, error) {
+	data, err := os.ReadFile(filepath.Join(outputPath, filepath.FromSlash(init)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read init segment: %w", err)
+	}
+	track, err := parseInitSegment(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid init segment %s: %w", init, err)
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("no media segments")
+	}
+
+	r := &rendition{dir: dir, init: init, track: track}
+	for _, segment := range segments {
+		data, err := os.ReadFile(filepath.Join(outputPath, filepath.FromSlash(segment)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read media segment: %w", err)
+		}
+		info, err := parseMediaSegment(data, track)
+		if err != nil {
+			return nil, fmt.Errorf("invalid media segment %s: %w", segment, err)
+		}
+		r.segments = append(r.segments, &renditionSegment{path: segment, size: int64(len(data)), fragmentInfo: info})
+	}
+	sort.Slice(r.segments, func(i, j int) bool { return r.segments[i].start < r.segments[j].start })
+	return r, nil
+}
+
+func readHeader(file string, n int) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+	data := make([]byte, n)
+	read, _ := f.Read(data)
+	return data[:read], nil
+}
+
+// duration is the length of the rendition in seconds.
+func (r *rendition) duration() float64 {
+	var total uint64
+	for _, segment := range r.segments {
+		total += segment.duration
+	}
+	return float64(total) / float64(r.track.timescale)
+}
+
+// bitrate is the average bit rate of the rendition in bits per second.
+func (r *rendition) bitrate() int64 {
+	durations := make([]float64, len(r.segments))
+	sizes := make([]int64, len(r.segments))
+	for i, segment := range r.segments {
+		durations[i] = float64(segment.duration) / float64(r.track.timescale)
+		sizes[i] = segment.size
+	}
+	_, average := segmentBitrates(durations, sizes, 0)
+	return average
+}
+
+// frameRate returns the frame rate of a video rendition as a fraction, from its most common
+// sample duration.
+func (r *rendition) frameRate() (num, den uint64) {
+	counts := make(map[uint32]int)
+	for _, segment := range r.segments {
+		for duration, count := range segment.sampleDurations {
+			counts[duration] += count
+		}
+	}
+	var common uint32
+	best := 0
+	for duration, count := range counts {
+		if duration > 0 && (count > best || count == best && duration < common) {
+			common, best = duration, count
+		}
+	}
+	if common == 0 {
+		return 0, 0
+	}
+	num, den = uint64(r.track.timescale), uint64(common)
+	divisor := gcd(num, den)
+	return num / divisor, den / divisor
+}
+
+// independent reports whether every segment starts with a sync sample.
+func (r *rendition) independent() bool {
+	for _, segment := range r.segments {
+		if !segment.independent {
+			return false
+		}
+	}
+	return true
+}
+
+// videoRange names the HLS VIDEO-RANGE of the track's transfer characteristics.
+func (t *trackInfo) videoRange() string {
+	switch t.transfer {
+	case 16:
+		return "PQ"
+	case 18:
+		return "HLG"
+	}
+	return "SDR"
+}
+
+// segmentBitrates returns the peak and average segment bit rates as HLS defines them: the
+// peak is the highest rate of any run of consecutive segments lasting between half and one and
+// a half times target, the average the total size over the total duration. With target 0 the
+// peak is that of the single largest-rate segment.
+func segmentBitrates(durations []float64, sizes []int64, target float64) (peak, average int64) {
+	var totalDuration float64
+	var totalSize int64
+	for i := range durations {
+		totalDuration += durations[i]
+		totalSize += sizes[i]
+	}
+	if totalDuration <= 0 {
+		return 0, 0
+	}
+	average = int64(math.Ceil(float64(totalSize*8) / totalDuration))
+
+	for i := range durations {
+		var duration float64
+		var size int64
+		for j := i; j < len(durations); j++ {
+			duration += durations[j]
+			size += sizes[j]
+			if target > 0 && duration > 1.5*target {
+				break
+			}
+			if duration > 0 && (target == 0 || duration >= 0.5*target) {
+				peak = max(peak, int64(math.Ceil(float64(size*8)/duration)))
+			}
+			if target == 0 {
+				break
+			}
+		}
+	}
+	// Content shorter than half the target is one run
+	return max(peak, average), average
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
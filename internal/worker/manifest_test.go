@@ -0,0 +1,189 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles writes files into dir by their slash separated paths.
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// packagedOutput writes what the packager leaves for a 4 second video at 30 fps with stereo
+// audio: two 2 second segments per track, the second video segment larger than the first.
+func packagedOutput(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{
+		"video/init.mp4":  videoInit(1280, 720, 90000),
+		"video/seg-1.m4s": mediaSegment(0, repeat(3000, 60), true, 1000),
+		"video/seg-2.m4s": mediaSegment(180000, repeat(3000, 60), true, 3000),
+		"audio/init.mp4":  audioInit(48000),
+		"audio/seg-1.m4s": mediaSegment(0, repeat(1000, 96), true, 200),
+		"audio/seg-2.m4s": mediaSegment(96000, repeat(1000, 96), true, 200),
+	})
+	return dir
+}
+
+func fileSize(t *testing.T, dir, name string) int64 {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestMeasureRenditions(t *testing.T) {
+	dir := packagedOutput(t)
+	renditions, err := measureRenditions(dir)
+	if err != nil {
+		t.Fatalf("measureRenditions() error = %v", err)
+	}
+	if len(renditions) != 2 {
+		t.Fatalf("measureRenditions() found %d renditions, want 2", len(renditions))
+	}
+
+	audio, video := renditions[0], renditions[1]
+	if audio.dir != "audio" || video.dir != "video" || video.init != "video/init.mp4" {
+		t.Errorf("renditions = %s (%s), %s (%s)", audio.dir, audio.init, video.dir, video.init)
+	}
+	if video.track.kind != "video" || audio.track.kind != "audio" {
+		t.Errorf("track kinds = %s, %s", video.track.kind, audio.track.kind)
+	}
+	if len(video.segments) != 2 || video.segments[0].path != "video/seg-1.m4s" || video.segments[1].start != 180000 {
+		t.Errorf("video segments are not in presentation order: %+v", video.segments)
+	}
+	if got := video.duration(); got != 4 {
+		t.Errorf("video duration = %v, want 4", got)
+	}
+	if num, den := video.frameRate(); num != 30 || den != 1 {
+		t.Errorf("video frame rate = %d/%d, want 30/1", num, den)
+	}
+	if !video.independent() {
+		t.Error("video segments start with sync samples but the rendition isn't independent")
+	}
+
+	size := fileSize(t, dir, "video/seg-1.m4s") + fileSize(t, dir, "video/seg-2.m4s")
+	if got, want := video.bitrate(), (size*8+3)/4; got != want {
+		t.Errorf("video bitrate = %d, want %d", got, want)
+	}
+}
+
+func TestMeasureRenditionsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string][]byte
+	}{
+		{"segments without init", map[string][]byte{
+			"video/seg-1.m4s": mediaSegment(0, repeat(3000, 60), true, 0),
+		}},
+		{"init without segments", map[string][]byte{
+			"video/init.mp4": videoInit(1280, 720, 90000),
+		}},
+		{"two inits in one directory", map[string][]byte{
+			"video/init.mp4":  videoInit(1280, 720, 90000),
+			"video/other.mp4": videoInit(1280, 720, 90000),
+			"video/seg-1.m4s": mediaSegment(0, repeat(3000, 60), true, 0),
+		}},
+		{"broken segment", map[string][]byte{
+			"video/init.mp4":  videoInit(1280, 720, 90000),
+			"video/seg-1.m4s": append(u32(64), "moof"...),
+		}},
+		{"broken init", map[string][]byte{
+			"video/init.mp4":  append(box("ftyp"), box("moov")...),
+			"video/seg-1.m4s": mediaSegment(0, repeat(3000, 60), true, 0),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			if _, err := measureRenditions(dir); err == nil {
+				t.Error("measureRenditions() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestRenditionFrameRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		timescale uint32
+		durations map[uint32]int
+		wantNum   uint64
+		wantDen   uint64
+	}{
+		{"integer", 90000, map[uint32]int{3000: 60}, 30, 1},
+		{"ntsc", 30000, map[uint32]int{1001: 60}, 30000, 1001},
+		{"most common wins", 90000, map[uint32]int{3000: 58, 6000: 2}, 30, 1},
+		{"ties go to the shorter", 1000, map[uint32]int{40: 5, 20: 5}, 50, 1},
+		{"no samples", 90000, map[uint32]int{}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &rendition{
+				track:    &trackInfo{timescale: tt.timescale},
+				segments: []*renditionSegment{{fragmentInfo: &fragmentInfo{sampleDurations: tt.durations}}},
+			}
+			if num, den := r.frameRate(); num != tt.wantNum || den != tt.wantDen {
+				t.Errorf("frameRate() = %d/%d, want %d/%d", num, den, tt.wantNum, tt.wantDen)
+			}
+		})
+	}
+}
+
+func TestSegmentBitrates(t *testing.T) {
+	tests := []struct {
+		name        string
+		durations   []float64
+		sizes       []int64
+		target      float64
+		wantPeak    int64
+		wantAverage int64
+	}{
+		{"single segments", []float64{2, 2}, []int64{1000, 3000}, 2, 12000, 8000},
+		{"no target", []float64{2, 2}, []int64{1000, 3000}, 0, 12000, 8000},
+		{"short segments are combined", []float64{1, 1, 1, 1}, []int64{100, 900, 100, 100}, 4, 4000, 2400},
+		{"content shorter than half the target", []float64{0.5}, []int64{100}, 6, 1600, 1600},
+		{"rates round up", []float64{3}, []int64{1}, 0, 3, 3},
+		{"no duration", []float64{0}, []int64{100}, 2, 0, 0},
+		{"no segments", nil, nil, 2, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peak, average := segmentBitrates(tt.durations, tt.sizes, tt.target)
+			if peak != tt.wantPeak || average != tt.wantAverage {
+				t.Errorf("segmentBitrates() = %d, %d; want %d, %d", peak, average, tt.wantPeak, tt.wantAverage)
+			}
+		})
+	}
+}
+
+func TestVideoRange(t *testing.T) {
+	tests := []struct {
+		transfer int
+		want     string
+	}{
+		{-1, "SDR"},
+		{1, "SDR"},
+		{16, "PQ"},
+		{18, "HLG"},
+	}
+	for _, tt := range tests {
+		if got := (&trackInfo{transfer: tt.transfer}).videoRange(); got != tt.want {
+			t.Errorf("videoRange() with transfer %d = %q, want %q", tt.transfer, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,516 @@
+package worker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// Sizes of the sample entry fields that precede the child boxes of video and audio entries.
+const (
+	visualSampleEntrySize = 78
+	audioSampleEntrySize  = 28
+)
+
+// trackInfo is what a player needs to know about the track of an init segment.
+type trackInfo struct {
+	kind       string // "video" or "audio"
+	codec      string // RFC 6381 codec string
+	timescale  uint32
+	language   string
+	width      int
+	height     int
+	channels   int
+	sampleRate int
+	// Colour description from the sample entry, -1 when it has none
+	primaries int
+	transfer  int
+	matrix    int
+	fullRange bool
+	// Common encryption of the track, empty when it is clear
+	scheme string
+	kid    []byte
+	// Defaults from trex for fragments that don't carry their own
+	defaultDuration uint32
+	defaultFlags    uint32
+}
+
+// fragmentInfo is what a media segment holds of its track.
+type fragmentInfo struct {
+	start       uint64
+	duration    uint64
+	samples     int
+	independent bool
+	// How often each sample duration occurs, to find the frame rate
+	sampleDurations map[uint32]int
+}
+
+// isNonSyncSample is the sample_is_non_sync_sample bit of ISO BMFF sample flags.
+const isNonSyncSample = 0x00010000
+
+// walkBoxes calls fn with the type and payload of every box in data.
+func walkBoxes(data []byte, fn func(typ string, payload []byte) error) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return fmt.Errorf("truncated box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return fmt.Errorf("truncated %s box header", typ)
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return fmt.Errorf("invalid size of %s box", typ)
+		}
+		if err := fn(typ, data[header:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// findBox returns the payload of the first box along path, nil if there is none.
+func findBox(data []byte, path ...string) []byte {
+	for _, typ := range path {
+		var found []byte
+		_ = walkBoxes(data, func(t string, payload []byte) error {
+			if found == nil && t == typ {
+				found = payload
+			}
+			return nil
+		})
+		if found == nil {
+			return nil
+		}
+		data = found
+	}
+	return data
+}
+
+// firstBoxType returns the type of the first box in data.
+func firstBoxType(data []byte) string {
+	if len(data) < 8 {
+		return ""
+	}
+	return string(data[4:8])
+}
+
+// parseInitSegment reads the single track of a CMAF init segment.
+func parseInitSegment(data []byte) (*trackInfo, error) {
+	moov := findBox(data, "moov")
+	if moov == nil {
+		return nil, fmt.Errorf("no moov box")
+	}
+	tracks := 0
+	_ = walkBoxes(moov, func(typ string, _ []byte) error {
+		if typ == "trak" {
+			tracks++
+		}
+		return nil
+	})
+	if tracks != 1 {
+		return nil, fmt.Errorf("init segment has %d tracks, expected 1", tracks)
+	}
+
+	track := &trackInfo{primaries: -1, transfer: -1, matrix: -1}
+	mdhd := findBox(moov, "trak", "mdia", "mdhd")
+	if len(mdhd) < 24 {
+		return nil, fmt.Errorf("missing or short mdhd box")
+	}
+	language := mdhd[20:22]
+	track.timescale = binary.BigEndian.Uint32(mdhd[12:])
+	if mdhd[0] == 1 {
+		if len(mdhd) < 36 {
+			return nil, fmt.Errorf("short mdhd box")
+		}
+		track.timescale = binary.BigEndian.Uint32(mdhd[20:])
+		language = mdhd[32:34]
+	}
+	if track.timescale == 0 {
+		return nil, fmt.Errorf("track has no timescale")
+	}
+	track.language = unpackLanguage(binary.BigEndian.Uint16(language))
+
+	hdlr := findBox(moov, "trak", "mdia", "hdlr")
+	if len(hdlr) < 12 {
+		return nil, fmt.Errorf("missing or short hdlr box")
+	}
+	switch string(hdlr[8:12]) {
+	case "vide":
+		track.kind = "video"
+	case "soun":
+		track.kind = "audio"
+	default:
+		return nil, fmt.Errorf("unsupported %s track", hdlr[8:12])
+	}
+
+	if trex := findBox(moov, "mvex", "trex"); len(trex) >= 24 {
+		track.defaultDuration = binary.BigEndian.Uint32(trex[12:])
+		track.defaultFlags = binary.BigEndian.Uint32(trex[20:])
+	}
+
+	stsd := findBox(moov, "trak", "mdia", "minf", "stbl", "stsd")
+	if len(stsd) < 8 {
+		return nil, fmt.Errorf("missing or short stsd box")
+	}
+	var (
+		format string
+		entry  []byte
+	)
+	_ = walkBoxes(stsd[8:], func(typ string, payload []byte) error {
+		if entry == nil {
+			format, entry = typ, payload
+		}
+		return nil
+	})
+	if entry == nil {
+		return nil, fmt.Errorf("no sample entry")
+	}
+	if err := track.readSampleEntry(format, entry); err != nil {
+		return nil, err
+	}
+	return track, nil
+}
+
+func (t *trackInfo) readSampleEntry(format string, entry []byte) error {
+	offset := audioSampleEntrySize
+	if t.kind == "video" {
+		offset = visualSampleEntrySize
+	}
+	if len(entry) < offset {
+		return fmt.Errorf("short %s sample entry", format)
+	}
+	if t.kind == "video" {
+		t.width = int(binary.BigEndian.Uint16(entry[24:]))
+		t.height = int(binary.BigEndian.Uint16(entry[26:]))
+	} else {
+		t.channels = int(binary.BigEndian.Uint16(entry[16:]))
+		t.sampleRate = int(binary.BigEndian.Uint32(entry[24:]) >> 16)
+	}
+	children := entry[offset:]
+
+	// Encrypted entries name the original format in their protection scheme info
+	if format == "encv" || format == "enca" {
+		sinf := findBox(children, "sinf")
+		frma := findBox(sinf, "frma")
+		if len(frma) < 4 {
+			return fmt.Errorf("%s sample entry has no original format", format)
+		}
+		format = string(frma[:4])
+		if schm := findBox(sinf, "schm"); len(schm) >= 8 {
+			t.scheme = string(schm[4:8])
+		}
+		if tenc := findBox(sinf, "schi", "tenc"); len(tenc) >= 24 {
+			t.kid = tenc[8:24]
+		}
+	}
+
+	if colr := findBox(children, "colr"); len(colr) >= 10 {
+		if kind := string(colr[:4]); kind == "nclx" || kind == "nclc" {
+			t.primaries = int(binary.BigEndian.Uint16(colr[4:]))
+			t.transfer = int(binary.BigEndian.Uint16(colr[6:]))
+			t.matrix = int(binary.BigEndian.Uint16(colr[8:]))
+			t.fullRange = kind == "nclx" && len(colr) > 10 && colr[10]&0x80 != 0
+		}
+	}
+
+	codec, err := t.codecString(format, children)
+	if err != nil {
+		return err
+	}
+	t.codec = codec
+	return nil
+}
+
+// codecString builds the RFC 6381 codec string of a sample entry from its decoder
+// configuration.
+func (t *trackInfo) codecString(format string, children []byte) (string, error) {
+	switch format {
+	case "avc1", "avc3":
+		avcC := findBox(children, "avcC")
+		if len(avcC) < 4 {
+			return "", fmt.Errorf("%s sample entry has no avcC box", format)
+		}
+		return fmt.Sprintf("%s.%02X%02X%02X", format, avcC[1], avcC[2], avcC[3]), nil
+	case "hvc1", "hev1":
+		hvcC := findBox(children, "hvcC")
+		if len(hvcC) < 13 {
+			return "", fmt.Errorf("%s sample entry has no hvcC box", format)
+		}
+		return hevcCodecString(format, hvcC), nil
+	case "av01":
+		av1C := findBox(children, "av1C")
+		if len(av1C) < 4 {
+			return "", fmt.Errorf("av01 sample entry has no av1C box")
+		}
+		return t.av1CodecString(av1C), nil
+	case "vp09":
+		vpcC := findBox(children, "vpcC")
+		if len(vpcC) < 10 {
+			return "", fmt.Errorf("vp09 sample entry has no vpcC box")
+		}
+		if t.transfer < 0 {
+			t.primaries, t.transfer, t.matrix = int(vpcC[7]), int(vpcC[8]), int(vpcC[9])
+			t.fullRange = vpcC[6]&0x01 != 0
+		}
+		return fmt.Sprintf("vp09.%02d.%02d.%02d", vpcC[4], vpcC[5], vpcC[6]>>4), nil
+	case "mp4a":
+		esds := findBox(children, "esds")
+		if len(esds) < 4 {
+			return "", fmt.Errorf("mp4a sample entry has no esds box")
+		}
+		return mp4aCodecString(esds[4:])
+	case "ac-3", "ec-3", "Opus", "fLaC":
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported codec %q", format)
+}
+
+// hevcCodecString follows ISO/IEC 14496-15 Annex E.
+func hevcCodecString(format string, hvcC []byte) string {
+	space := []string{"", "A", "B", "C"}[hvcC[1]>>6]
+	tier := "L"
+	if hvcC[1]&0x20 != 0 {
+		tier = "H"
+	}
+	compatibility := bits.Reverse32(binary.BigEndian.Uint32(hvcC[2:]))
+	codec := fmt.Sprintf("%s.%s%d.%X.%s%d", format, space, hvcC[1]&0x1f, compatibility, tier, hvcC[12])
+
+	constraints := hvcC[6:12]
+	for len(constraints) > 0 && constraints[len(constraints)-1] == 0 {
+		constraints = constraints[:len(constraints)-1]
+	}
+	for _, b := range constraints {
+		codec += fmt.Sprintf(".%X", b)
+	}
+	return codec
+}
+
+// av1CodecString follows the AV1 codec ISO media file format binding; the optional colour
+// fields are added when the sample entry describes its colour.
+func (t *trackInfo) av1CodecString(av1C []byte) string {
+	profile := av1C[1] >> 5
+	level := av1C[1] & 0x1f
+	tier := "M"
+	if av1C[2]&0x80 != 0 {
+		tier = "H"
+	}
+	depth := 8
+	switch {
+	case av1C[2]&0x20 != 0:
+		depth = 12
+	case av1C[2]&0x40 != 0:
+		depth = 10
+	}
+	codec := fmt.Sprintf("av01.%d.%02d%s.%02d", profile, level, tier, depth)
+	if t.transfer < 0 {
+		return codec
+	}
+
+	mono := (av1C[2] >> 4) & 1
+	subX, subY := (av1C[2]>>3)&1, (av1C[2]>>2)&1
+	position := byte(0)
+	if subX == 1 && subY == 1 {
+		position = av1C[2] & 0x03
+	}
+	fullRange := 0
+	if t.fullRange {
+		fullRange = 1
+	}
+	return fmt.Sprintf("%s.%d.%d%d%d.%02d.%02d.%02d.%d", codec, mono, subX, subY, position, t.primaries, t.transfer, t.matrix, fullRange)
+}
+
+// mp4aCodecString reads the object type and audio object type out of an ES descriptor.
+func mp4aCodecString(descriptors []byte) (string, error) {
+	tag, es, _, err := readDescriptor(descriptors)
+	if err != nil || tag != 0x03 || len(es) < 3 {
+		return "", fmt.Errorf("invalid ES descriptor")
+	}
+	flags := es[2]
+	es = es[3:]
+	if flags&0x80 != 0 {
+		es = es[min(2, len(es)):]
+	}
+	if flags&0x40 != 0 && len(es) > 0 {
+		es = es[min(1+int(es[0]), len(es)):]
+	}
+	if flags&0x20 != 0 {
+		es = es[min(2, len(es)):]
+	}
+
+	tag, config, _, err := readDescriptor(es)
+	if err != nil || tag != 0x04 || len(config) < 13 {
+		return "", fmt.Errorf("invalid decoder config descriptor")
+	}
+	codec := fmt.Sprintf("mp4a.%02X", config[0])
+	tag, specific, _, err := readDescriptor(config[13:])
+	if err != nil || tag != 0x05 || len(specific) == 0 {
+		return codec, nil
+	}
+	objectType := int(specific[0] >> 3)
+	if objectType == 31 && len(specific) > 1 {
+		objectType = 32 + int(specific[0]&0x07)<<3 | int(specific[1]>>5)
+	}
+	return fmt.Sprintf("%s.%d", codec, objectType), nil
+}
+
+// readDescriptor reads an MPEG-4 descriptor with its variable length size.
+func readDescriptor(data []byte) (tag byte, payload, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, fmt.Errorf("truncated descriptor")
+	}
+	tag = data[0]
+	size, i := 0, 1
+	for {
+		if i >= len(data) || i > 4 {
+			return 0, nil, nil, fmt.Errorf("invalid descriptor size")
+		}
+		b := data[i]
+		i++
+		size = size<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if i+size > len(data) {
+		return 0, nil, nil, fmt.Errorf("truncated descriptor")
+	}
+	return tag, data[i : i+size], data[i+size:], nil
+}
+
+// unpackLanguage decodes the packed ISO 639-2/T code of an mdhd box.
+func unpackLanguage(packed uint16) string {
+	if packed == 0 || packed == 0x7fff {
+		return "und"
+	}
+	var code strings.Builder
+	for shift := 10; shift >= 0; shift -= 5 {
+		code.WriteByte(byte((packed>>uint(shift))&0x1f) + 0x60)
+	}
+	return code.String()
+}
+
+// parseMediaSegment sums up the fragments of a media segment of track.
+func parseMediaSegment(data []byte, track *trackInfo) (*fragmentInfo, error) {
+	info := &fragmentInfo{sampleDurations: make(map[uint32]int)}
+	fragments := 0
+	err := walkBoxes(data, func(typ string, moof []byte) error {
+		if typ != "moof" {
+			return nil
+		}
+		traf := findBox(moof, "traf")
+		if traf == nil {
+			return fmt.Errorf("moof has no traf box")
+		}
+		tfhd := findBox(traf, "tfhd")
+		if len(tfhd) < 8 {
+			return fmt.Errorf("missing or short tfhd box")
+		}
+		defaultDuration, defaultFlags := track.defaultDuration, track.defaultFlags
+		flags := binary.BigEndian.Uint32(tfhd) & 0xffffff
+		field := tfhd[8:]
+		for _, f := range []struct {
+			flag uint32
+			size int
+			dest *uint32
+		}{{0x01, 8, nil}, {0x02, 4, nil}, {0x08, 4, &defaultDuration}, {0x10, 4, nil}, {0x20, 4, &defaultFlags}} {
+			if flags&f.flag == 0 {
+				continue
+			}
+			if len(field) < f.size {
+				return fmt.Errorf("short tfhd box")
+			}
+			if f.dest != nil {
+				*f.dest = binary.BigEndian.Uint32(field)
+			}
+			field = field[f.size:]
+		}
+
+		if tfdt := findBox(traf, "tfdt"); fragments == 0 && len(tfdt) >= 8 {
+			info.start = uint64(binary.BigEndian.Uint32(tfdt[4:]))
+			if tfdt[0] == 1 && len(tfdt) >= 12 {
+				info.start = binary.BigEndian.Uint64(tfdt[4:])
+			}
+		}
+		fragments++
+
+		return walkBoxes(traf, func(typ string, trun []byte) error {
+			if typ != "trun" {
+				return nil
+			}
+			return info.addRun(trun, defaultDuration, defaultFlags)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if fragments == 0 {
+		return nil, fmt.Errorf("no movie fragment")
+	}
+	return info, nil
+}
+
+// addRun adds the samples of a trun box.
+func (f *fragmentInfo) addRun(trun []byte, defaultDuration, defaultFlags uint32) error {
+	if len(trun) < 8 {
+		return fmt.Errorf("short trun box")
+	}
+	flags := binary.BigEndian.Uint32(trun) & 0xffffff
+	count := int(binary.BigEndian.Uint32(trun[4:]))
+	data := trun[8:]
+	firstFlags, hasFirstFlags := uint32(0), false
+	if flags&0x01 != 0 {
+		data = data[min(4, len(data)):]
+	}
+	if flags&0x04 != 0 {
+		if len(data) < 4 {
+			return fmt.Errorf("short trun box")
+		}
+		firstFlags, hasFirstFlags = binary.BigEndian.Uint32(data), true
+		data = data[4:]
+	}
+
+	sampleSize := 0
+	for _, flag := range []uint32{0x100, 0x200, 0x400, 0x800} {
+		if flags&flag != 0 {
+			sampleSize += 4
+		}
+	}
+	if len(data) < count*sampleSize {
+		return fmt.Errorf("short trun box")
+	}
+	for i := 0; i < count; i++ {
+		sample := data[i*sampleSize:]
+		duration, sampleFlags := defaultDuration, defaultFlags
+		if flags&0x100 != 0 {
+			duration = binary.BigEndian.Uint32(sample)
+			sample = sample[4:]
+		}
+		if flags&0x200 != 0 {
+			sample = sample[4:]
+		}
+		if flags&0x400 != 0 {
+			sampleFlags = binary.BigEndian.Uint32(sample)
+		}
+		if i == 0 && hasFirstFlags {
+			sampleFlags = firstFlags
+		}
+		if f.samples == 0 {
+			f.independent = sampleFlags&isNonSyncSample == 0
+		}
+		f.duration += uint64(duration)
+		f.sampleDurations[duration]++
+		f.samples++
+	}
+	return nil
+}
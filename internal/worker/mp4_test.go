@@ -0,0 +1,344 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func u16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	return append(append(u32(uint32(8+len(body))), typ...), body...)
+}
+
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	return box(typ, append([][]byte{u32(uint32(version)<<24 | flags)}, payload...)...)
+}
+
+// initSegment builds a single track init segment around a sample entry.
+func initSegment(handler string, timescale uint32, entry []byte) []byte {
+	mdhd := fullBox("mdhd", 0, 0, u32(0), u32(0), u32(timescale), u32(0), u16(0x15c7), u16(0)) // eng
+	hdlr := fullBox("hdlr", 0, 0, u32(0), []byte(handler), make([]byte, 12), []byte{0})
+	stsd := fullBox("stsd", 0, 0, u32(1), entry)
+	trak := box("trak", box("mdia", mdhd, hdlr, box("minf", box("stbl", stsd))))
+	trex := fullBox("trex", 0, 0, u32(1), u32(1), u32(0), u32(0), u32(0))
+	return append(box("ftyp", []byte("iso6"), u32(0)), box("moov", trak, box("mvex", trex))...)
+}
+
+func avcEntry(width, height uint16, children ...[]byte) []byte {
+	entry := make([]byte, visualSampleEntrySize)
+	binary.BigEndian.PutUint16(entry[24:], width)
+	binary.BigEndian.PutUint16(entry[26:], height)
+	return append(entry, bytes.Join(children, nil)...)
+}
+
+func videoInit(width, height uint16, timescale uint32) []byte {
+	return initSegment("vide", timescale, box("avc1", avcEntry(width, height, box("avcC", []byte{1, 0x64, 0x00, 0x1f}))))
+}
+
+func audioInit(timescale uint32) []byte {
+	entry := make([]byte, audioSampleEntrySize)
+	binary.BigEndian.PutUint16(entry[16:], 2)
+	binary.BigEndian.PutUint32(entry[24:], 48000<<16)
+	// ES descriptor with an AAC LC decoder config
+	esds := fullBox("esds", 0, 0, []byte{
+		0x03, 22, 0, 1, 0,
+		0x04, 17, 0x40, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x05, 2, 0x12, 0x10,
+	})
+	return initSegment("soun", timescale, box("mp4a", entry, esds))
+}
+
+// mediaSegment builds a one fragment segment with the sample durations and padding bytes of
+// media data.
+func mediaSegment(start uint32, durations []uint32, sync bool, padding int) []byte {
+	firstFlags := uint32(isNonSyncSample)
+	if sync {
+		firstFlags = 0x02000000
+	}
+	samples := [][]byte{u32(uint32(len(durations))), u32(firstFlags)}
+	for _, d := range durations {
+		samples = append(samples, u32(d))
+	}
+	traf := box("traf",
+		fullBox("tfhd", 0, 0, u32(1)),
+		fullBox("tfdt", 0, 0, u32(start)),
+		fullBox("trun", 0, 0x104, samples...),
+	)
+	return append(box("moof", fullBox("mfhd", 0, 0, u32(1)), traf), box("mdat", make([]byte, padding))...)
+}
+
+func repeat(d uint32, n int) []uint32 {
+	durations := make([]uint32, n)
+	for i := range durations {
+		durations[i] = d
+	}
+	return durations
+}
+
+func TestWalkBoxes(t *testing.T) {
+	large := append(append(u32(1), "free"...), binary.BigEndian.AppendUint64(nil, 20)...)
+	large = append(large, 1, 2, 3, 4)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []string
+		wantErr bool
+	}{
+		{"empty", nil, nil, false},
+		{"siblings", append(box("ftyp", u32(0)), box("free")...), []string{"ftyp", "free"}, false},
+		{"size zero runs to the end", append(u32(0), "mdat\x01\x02"...), []string{"mdat"}, false},
+		{"64-bit size", large, []string{"free"}, false},
+		{"truncated header", []byte{0, 0, 0, 8, 'f'}, nil, true},
+		{"size below header", append(u32(4), "free"...), nil, true},
+		{"size beyond data", append(u32(64), "free"...), nil, true},
+		{"truncated 64-bit size", append(u32(1), "free\x00\x00"...), nil, true},
+		{"64-bit size below header", append(append(u32(1), "free"...), binary.BigEndian.AppendUint64(nil, 8)...), nil, true},
+		{"64-bit size beyond data", append(append(u32(1), "free"...), binary.BigEndian.AppendUint64(nil, 1<<40)...), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := walkBoxes(tt.data, func(typ string, _ []byte) error {
+				got = append(got, typ)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("walkBoxes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !equalStrings(got, tt.want) {
+				t.Errorf("walkBoxes() visited %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindBox(t *testing.T) {
+	data := box("moov", box("trak", box("mdia", []byte("payload"))))
+	if got := findBox(data, "moov", "trak", "mdia"); string(got) != "payload" {
+		t.Errorf("findBox() = %q, want %q", got, "payload")
+	}
+	if got := findBox(data, "moov", "mvex"); got != nil {
+		t.Errorf("findBox() of a missing box = %q, want nil", got)
+	}
+	// A child claiming more than its parent holds is not found
+	broken := box("moov", append(u32(100), "trak"...))
+	if got := findBox(broken, "moov", "trak"); got != nil {
+		t.Errorf("findBox() of an oversized box = %q, want nil", got)
+	}
+}
+
+func TestParseInitSegment(t *testing.T) {
+	encrypted := avcEntry(640, 360,
+		box("avcC", []byte{1, 0x42, 0xc0, 0x1e}),
+		box("sinf",
+			box("frma", []byte("avc1")),
+			fullBox("schm", 0, 0, []byte("cbcs"), u32(0x10000)),
+			box("schi", fullBox("tenc", 1, 0, u32(0), []byte("0123456789abcdef"))),
+		),
+	)
+	twoTracks := initSegment("vide", 90000, box("avc1", avcEntry(640, 360, box("avcC", []byte{1, 0x64, 0, 0x1f}))))
+	moov := findBox(twoTracks, "moov")
+	trak := box("trak", findBox(moov, "trak"))
+	twoTracks = append(box("ftyp"), box("moov", trak, trak)...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    trackInfo
+		wantErr bool
+	}{
+		{
+			name: "avc video",
+			data: videoInit(1280, 720, 90000),
+			want: trackInfo{kind: "video", codec: "avc1.64001F", timescale: 90000, language: "eng", width: 1280, height: 720},
+		},
+		{
+			name: "aac audio",
+			data: audioInit(48000),
+			want: trackInfo{kind: "audio", codec: "mp4a.40.2", timescale: 48000, language: "eng", channels: 2, sampleRate: 48000},
+		},
+		{
+			name: "encrypted video",
+			data: initSegment("vide", 90000, box("encv", encrypted)),
+			want: trackInfo{kind: "video", codec: "avc1.42C01E", timescale: 90000, language: "eng", width: 640, height: 360, scheme: "cbcs", kid: []byte("0123456789abcdef")},
+		},
+		{name: "no moov", data: box("ftyp"), wantErr: true},
+		{name: "two tracks", data: twoTracks, wantErr: true},
+		{name: "zero timescale", data: videoInit(1280, 720, 0), wantErr: true},
+		{name: "subtitle track", data: initSegment("subt", 1000, box("wvtt")), wantErr: true},
+		{name: "short sample entry", data: initSegment("vide", 90000, box("avc1", make([]byte, 20))), wantErr: true},
+		{name: "no avcC", data: initSegment("vide", 90000, box("avc1", avcEntry(640, 360))), wantErr: true},
+		{name: "short avcC", data: initSegment("vide", 90000, box("avc1", avcEntry(640, 360, box("avcC", []byte{1})))), wantErr: true},
+		{name: "encrypted without frma", data: initSegment("vide", 90000, box("encv", avcEntry(640, 360, box("sinf")))), wantErr: true},
+		{name: "unknown codec", data: initSegment("vide", 90000, box("xyz1", avcEntry(640, 360))), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseInitSegment(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseInitSegment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.kind != tt.want.kind || got.codec != tt.want.codec || got.timescale != tt.want.timescale ||
+				got.language != tt.want.language || got.width != tt.want.width || got.height != tt.want.height ||
+				got.channels != tt.want.channels || got.sampleRate != tt.want.sampleRate ||
+				got.scheme != tt.want.scheme || !bytes.Equal(got.kid, tt.want.kid) {
+				t.Errorf("parseInitSegment() = %+v, want %+v", *got, tt.want)
+			}
+			if got.transfer != -1 {
+				t.Errorf("transfer = %d for a sample entry without colr, want -1", got.transfer)
+			}
+		})
+	}
+}
+
+func TestParseMediaSegment(t *testing.T) {
+	track := &trackInfo{kind: "video", timescale: 90000}
+	withDefaults := &trackInfo{kind: "video", timescale: 90000, defaultDuration: 3000}
+
+	tests := []struct {
+		name            string
+		data            []byte
+		track           *trackInfo
+		wantStart       uint64
+		wantDuration    uint64
+		wantSamples     int
+		wantIndependent bool
+		wantErr         bool
+	}{
+		{
+			name:  "sync start",
+			data:  mediaSegment(180000, repeat(3000, 60), true, 10),
+			track: track, wantStart: 180000, wantDuration: 180000, wantSamples: 60, wantIndependent: true,
+		},
+		{
+			name:  "non-sync start",
+			data:  mediaSegment(0, []uint32{3000, 3001}, false, 0),
+			track: track, wantDuration: 6001, wantSamples: 2,
+		},
+		{
+			name: "default duration from trex",
+			data: box("moof", box("traf",
+				fullBox("tfhd", 0, 0, u32(1)),
+				fullBox("trun", 0, 0, u32(4)),
+			)),
+			track: withDefaults, wantDuration: 12000, wantSamples: 4, wantIndependent: true,
+		},
+		{
+			name: "default duration from tfhd",
+			data: box("moof", box("traf",
+				fullBox("tfhd", 0, 0x08, u32(1), u32(1500)),
+				fullBox("trun", 0, 0, u32(2)),
+			)),
+			track: withDefaults, wantDuration: 3000, wantSamples: 2, wantIndependent: true,
+		},
+		{name: "no fragment", data: box("mdat"), track: track, wantErr: true},
+		{name: "no traf", data: box("moof"), track: track, wantErr: true},
+		{name: "short tfhd", data: box("moof", box("traf", fullBox("tfhd", 0, 0))), track: track, wantErr: true},
+		{name: "tfhd missing its fields", data: box("moof", box("traf", fullBox("tfhd", 0, 0x08|0x20, u32(1), u32(1500)))), track: track, wantErr: true},
+		{name: "short trun", data: box("moof", box("traf", fullBox("tfhd", 0, 0, u32(1)), fullBox("trun", 0, 0))), track: track, wantErr: true},
+		{
+			name: "trun counting more samples than it holds",
+			data: box("moof", box("traf",
+				fullBox("tfhd", 0, 0, u32(1)),
+				fullBox("trun", 0, 0x100, u32(1000), u32(3000)),
+			)),
+			track: track, wantErr: true,
+		},
+		{
+			name: "trun without first sample flags",
+			data: box("moof", box("traf",
+				fullBox("tfhd", 0, 0, u32(1)),
+				fullBox("trun", 0, 0x04, u32(1)),
+			)),
+			track: track, wantErr: true,
+		},
+		{name: "truncated box", data: mediaSegment(0, []uint32{3000}, true, 0)[:20], track: track, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMediaSegment(tt.data, tt.track)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMediaSegment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.start != tt.wantStart || got.duration != tt.wantDuration || got.samples != tt.wantSamples || got.independent != tt.wantIndependent {
+				t.Errorf("parseMediaSegment() = start %d, duration %d, samples %d, independent %v; want %d, %d, %d, %v",
+					got.start, got.duration, got.samples, got.independent,
+					tt.wantStart, tt.wantDuration, tt.wantSamples, tt.wantIndependent)
+			}
+		})
+	}
+}
+
+func TestReadDescriptor(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantTag  byte
+		wantSize int
+		wantRest int
+		wantErr  bool
+	}{
+		{"one byte size", []byte{0x05, 2, 0x12, 0x10, 0xff}, 0x05, 2, 1, false},
+		{"multi byte size", append([]byte{0x04, 0x80, 0x80, 0x03}, 1, 2, 3), 0x04, 3, 0, false},
+		{"too short", []byte{0x03}, 0, 0, 0, true},
+		{"size runs off the end", []byte{0x03, 0x80, 0x80}, 0, 0, 0, true},
+		{"size longer than four bytes", []byte{0x03, 0x80, 0x80, 0x80, 0x80, 0x01, 0}, 0, 0, 0, true},
+		{"payload truncated", []byte{0x03, 10, 1, 2}, 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, payload, rest, err := readDescriptor(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readDescriptor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (tag != tt.wantTag || len(payload) != tt.wantSize || len(rest) != tt.wantRest) {
+				t.Errorf("readDescriptor() = tag %#x, %d byte payload, %d left; want %#x, %d, %d",
+					tag, len(payload), len(rest), tt.wantTag, tt.wantSize, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestUnpackLanguage(t *testing.T) {
+	tests := []struct {
+		packed uint16
+		want   string
+	}{
+		{0x15c7, "eng"},
+		{0, "und"},
+		{0x7fff, "und"},
+	}
+	for _, tt := range tests {
+		if got := unpackLanguage(tt.packed); got != tt.want {
+			t.Errorf("unpackLanguage(%#x) = %q, want %q", tt.packed, got, tt.want)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
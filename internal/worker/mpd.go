@@ -0,0 +1,463 @@
+package worker
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+const (
+	mpdNamespace       = "urn:mpeg:dash:schema:mpd:2011"
+	cencNamespace      = "urn:mpeg:cenc:2013"
+	dashifNamespace    = "https://dashif.org/CPS"
+	liveProfile        = "urn:mpeg:dash:profile:isoff-live:2011"
+	mainProfile        = "urn:mpeg:dash:profile:isoff-main:2011"
+	mp4ProtectionURI   = "urn:mpeg:dash:mp4protection:2011"
+	clearKeySystemURI  = "urn:uuid:e2719d58-a985-b3c9-781a-b030af78d30e"
+	channelConfigURI   = "urn:mpeg:dash:23003:3:audio_channel_configuration:2011"
+	colourPrimariesURI = "urn:mpeg:mpegB:cicp:ColourPrimaries"
+	transferURI        = "urn:mpeg:mpegB:cicp:TransferCharacteristics"
+	matrixURI          = "urn:mpeg:mpegB:cicp:MatrixCoefficients"
+)
+
+// segmentNumber splits a segment file name around the number before its extension.
+var segmentNumber = regexp.MustCompile(`^(.*?)(\d+)((?:\.[^.]*)?)$`)
+
+type mpdDocument struct {
+	XMLName                   xml.Name    `xml:"MPD"`
+	Xmlns                     string      `xml:"xmlns,attr"`
+	XmlnsCenc                 string      `xml:"xmlns:cenc,attr,omitempty"`
+	XmlnsDashif               string      `xml:"xmlns:dashif,attr,omitempty"`
+	Profiles                  string      `xml:"profiles,attr"`
+	Type                      string      `xml:"type,attr"`
+	MediaPresentationDuration string      `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime             string      `xml:"minBufferTime,attr"`
+	Periods                   []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	ID             string             `xml:"id,attr"`
+	Start          string             `xml:"start,attr"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	ID                     int                    `xml:"id,attr"`
+	ContentType            string                 `xml:"contentType,attr"`
+	MimeType               string                 `xml:"mimeType,attr"`
+	Lang                   string                 `xml:"lang,attr,omitempty"`
+	SegmentAlignment       bool                   `xml:"segmentAlignment,attr"`
+	StartWithSAP           int                    `xml:"startWithSAP,attr,omitempty"`
+	MaxWidth               int                    `xml:"maxWidth,attr,omitempty"`
+	MaxHeight              int                    `xml:"maxHeight,attr,omitempty"`
+	MaxFrameRate           string                 `xml:"maxFrameRate,attr,omitempty"`
+	ContentProtections     []mpdContentProtection `xml:"ContentProtection"`
+	EssentialProperties    []mpdDescriptor        `xml:"EssentialProperty"`
+	SupplementalProperties []mpdDescriptor        `xml:"SupplementalProperty"`
+	Representations        []mpdRepresentation    `xml:"Representation"`
+}
+
+type mpdContentProtection struct {
+	SchemeIDURI string   `xml:"schemeIdUri,attr"`
+	Value       string   `xml:"value,attr,omitempty"`
+	DefaultKID  string   `xml:"cenc:default_KID,attr,omitempty"`
+	Laurl       *mpdText `xml:"dashif:Laurl,omitempty"`
+}
+
+type mpdText struct {
+	Value string `xml:",chardata"`
+}
+
+type mpdDescriptor struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type mpdRepresentation struct {
+	ID                        string              `xml:"id,attr"`
+	Bandwidth                 int64               `xml:"bandwidth,attr"`
+	Codecs                    string              `xml:"codecs,attr"`
+	Width                     int                 `xml:"width,attr,omitempty"`
+	Height                    int                 `xml:"height,attr,omitempty"`
+	FrameRate                 string              `xml:"frameRate,attr,omitempty"`
+	AudioSamplingRate         int                 `xml:"audioSamplingRate,attr,omitempty"`
+	AudioChannelConfiguration []mpdDescriptor     `xml:"AudioChannelConfiguration"`
+	SegmentList               *mpdSegmentList     `xml:"SegmentList"`
+	SegmentTemplate           *mpdSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type mpdSegmentTemplate struct {
+	Timescale              uint32       `xml:"timescale,attr"`
+	PresentationTimeOffset uint64       `xml:"presentationTimeOffset,attr,omitempty"`
+	Initialization         string       `xml:"initialization,attr"`
+	Media                  string       `xml:"media,attr"`
+	StartNumber            int          `xml:"startNumber,attr"`
+	Timeline               *mpdTimeline `xml:"SegmentTimeline"`
+}
+
+type mpdSegmentList struct {
+	Timescale              uint32          `xml:"timescale,attr"`
+	PresentationTimeOffset uint64          `xml:"presentationTimeOffset,attr,omitempty"`
+	Initialization         mpdURL          `xml:"Initialization"`
+	Timeline               *mpdTimeline    `xml:"SegmentTimeline"`
+	SegmentURLs            []mpdSegmentURL `xml:"SegmentURL"`
+}
+
+type mpdURL struct {
+	SourceURL string `xml:"sourceURL,attr"`
+}
+
+type mpdSegmentURL struct {
+	Media string `xml:"media,attr"`
+}
+
+type mpdTimeline struct {
+	S []mpdTimelineEntry `xml:"S"`
+}
+
+type mpdTimelineEntry struct {
+	T *uint64 `xml:"t,attr,omitempty"`
+	D uint64  `xml:"d,attr"`
+	R int     `xml:"r,attr,omitempty"`
+}
+
+// writeMPD replaces the MPD in outputPath with one describing the measured renditions.
+// Encrypted tracks are signalled for ClearKey with licenseURL.
+func writeMPD(outputPath string, renditions []*rendition, licenseURL string) error {
+	doc, err := buildMPD(outputPath, renditions, licenseURL)
+	if err != nil {
+		return err
+	}
+	if err := validateMPD(doc); err != nil {
+		return fmt.Errorf("generated MPD is invalid: %w", err)
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode MPD: %w", err)
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	if err := os.WriteFile(filepath.Join(outputPath, models.DASHManifestName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write MPD: %w", err)
+	}
+	return nil
+}
+
+func buildMPD(outputPath string, renditions []*rendition, licenseURL string) (*mpdDocument, error) {
+	doc := &mpdDocument{
+		Xmlns:    mpdNamespace,
+		Profiles: liveProfile,
+		Type:     "static",
+	}
+	period := mpdPeriod{ID: "0", Start: "PT0S"}
+	sets := make(map[string]*mpdAdaptationSet)
+	var order []string
+	var duration, longestSegment float64
+
+	for i, r := range renditions {
+		sizes, err := segmentSizes(outputPath, r)
+		if err != nil {
+			return nil, err
+		}
+		durations := r.segmentDurations()
+		peak, _ := segmentBitrates(durations, sizes, 0)
+		duration = math.Max(duration, r.duration())
+		for _, d := range durations {
+			longestSegment = math.Max(longestSegment, d)
+		}
+
+		representation := mpdRepresentation{
+			ID:        fmt.Sprintf("%s-%d", r.track.kind, i),
+			Bandwidth: peak,
+			Codecs:    r.track.codec,
+		}
+		template, ok := r.segmentTemplate()
+		if ok {
+			representation.SegmentTemplate = template
+		} else {
+			representation.SegmentList = r.segmentList()
+			doc.Profiles = mainProfile
+		}
+
+		key := r.track.kind + "/" + r.track.language
+		set, ok := sets[key]
+		if !ok {
+			set = &mpdAdaptationSet{
+				ContentType:      r.track.kind,
+				MimeType:         r.track.kind + "/mp4",
+				SegmentAlignment: true,
+			}
+			if r.track.kind == "audio" {
+				set.Lang = r.track.language
+			}
+			if r.independent() {
+				set.StartWithSAP = 1
+			}
+			set.ContentProtections = contentProtections(r.track, licenseURL)
+			set.EssentialProperties, set.SupplementalProperties = colourProperties(r.track)
+			sets[key] = set
+			order = append(order, key)
+		}
+		if len(set.ContentProtections) > 0 {
+			doc.XmlnsCenc = cencNamespace
+			if licenseURL != "" {
+				doc.XmlnsDashif = dashifNamespace
+			}
+		}
+
+		if r.track.kind == "video" {
+			representation.Width, representation.Height = r.track.width, r.track.height
+			if num, den := r.frameRate(); num > 0 {
+				representation.FrameRate = dashFrameRate(num, den)
+				if set.MaxFrameRate == "" || float64(num)/float64(den) > parseFrameRate(set.MaxFrameRate) {
+					set.MaxFrameRate = representation.FrameRate
+				}
+			}
+			set.MaxWidth = max(set.MaxWidth, r.track.width)
+			set.MaxHeight = max(set.MaxHeight, r.track.height)
+		} else {
+			representation.AudioSamplingRate = r.track.sampleRate
+			representation.AudioChannelConfiguration = []mpdDescriptor{{
+				SchemeIDURI: channelConfigURI,
+				Value:       strconv.Itoa(r.track.channels),
+			}}
+		}
+		set.Representations = append(set.Representations, representation)
+	}
+
+	// Video first, for players that start with the first adaptation set
+	sort.SliceStable(order, func(i, j int) bool {
+		return sets[order[i]].ContentType == "video" && sets[order[j]].ContentType != "video"
+	})
+	for i, key := range order {
+		sets[key].ID = i
+		period.AdaptationSets = append(period.AdaptationSets, *sets[key])
+	}
+	doc.Periods = []mpdPeriod{period}
+	doc.MediaPresentationDuration = fmt.Sprintf("PT%.3fS", duration)
+	// Delivered at its bandwidth, a representation plays after buffering its longest segment
+	doc.MinBufferTime = fmt.Sprintf("PT%.3fS", math.Ceil(longestSegment))
+	return doc, nil
+}
+
+// validateMPD checks what DASH clients rely on in the generated MPD.
+func validateMPD(doc *mpdDocument) error {
+	if len(doc.Periods) == 0 || len(doc.Periods[0].AdaptationSets) == 0 {
+		return fmt.Errorf("no adaptation sets")
+	}
+	if doc.MediaPresentationDuration == "PT0.000S" {
+		return fmt.Errorf("presentation has no duration")
+	}
+	for _, set := range doc.Periods[0].AdaptationSets {
+		for _, r := range set.Representations {
+			switch {
+			case r.Bandwidth <= 0:
+				return fmt.Errorf("representation %s has no bandwidth", r.ID)
+			case r.Codecs == "":
+				return fmt.Errorf("representation %s has no codecs", r.ID)
+			case set.ContentType == "video" && (r.Width == 0 || r.Height == 0 || r.FrameRate == ""):
+				return fmt.Errorf("video representation %s has no resolution or frame rate", r.ID)
+			case set.ContentType == "audio" && len(r.AudioChannelConfiguration) == 0:
+				return fmt.Errorf("audio representation %s has no channel configuration", r.ID)
+			case r.SegmentTemplate == nil && r.SegmentList == nil:
+				return fmt.Errorf("representation %s has no segments", r.ID)
+			case r.SegmentList != nil && timelineLength(r.SegmentList.Timeline) != len(r.SegmentList.SegmentURLs):
+				return fmt.Errorf("representation %s has a timeline that doesn't match its segments", r.ID)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *rendition) segmentDurations() []float64 {
+	durations := make([]float64, len(r.segments))
+	for i, segment := range r.segments {
+		durations[i] = float64(segment.duration) / float64(r.track.timescale)
+	}
+	return durations
+}
+
+// segmentSizes stats the segments, which encryption may have resized since they were measured.
+func segmentSizes(outputPath string, r *rendition) ([]int64, error) {
+	sizes := make([]int64, len(r.segments))
+	for i, segment := range r.segments {
+		info, err := os.Stat(filepath.Join(outputPath, filepath.FromSlash(segment.path)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat segment: %w", err)
+		}
+		sizes[i] = info.Size()
+	}
+	return sizes, nil
+}
+
+// timeline run-length encodes the segment durations. Start times are only written where they
+// don't follow from the previous segment.
+func (r *rendition) timeline() *mpdTimeline {
+	timeline := &mpdTimeline{}
+	var next uint64
+	for i, segment := range r.segments {
+		last := len(timeline.S) - 1
+		if i > 0 && segment.start == next && timeline.S[last].D == segment.duration {
+			timeline.S[last].R++
+		} else {
+			entry := mpdTimelineEntry{D: segment.duration}
+			if i == 0 || segment.start != next {
+				start := segment.start
+				entry.T = &start
+			}
+			timeline.S = append(timeline.S, entry)
+		}
+		next = segment.start + segment.duration
+	}
+	return timeline
+}
+
+func timelineLength(timeline *mpdTimeline) int {
+	if timeline == nil {
+		return 0
+	}
+	n := 0
+	for _, s := range timeline.S {
+		n += 1 + s.R
+	}
+	return n
+}
+
+// segmentTemplate describes the segments with a $Number$ template when their names differ
+// only in a consecutive number.
+func (r *rendition) segmentTemplate() (*mpdSegmentTemplate, bool) {
+	var prefix, suffix string
+	width, start := 0, 0
+	for i, segment := range r.segments {
+		match := segmentNumber.FindStringSubmatch(path.Base(segment.path))
+		if match == nil || path.Dir(segment.path) != r.dir {
+			return nil, false
+		}
+		number, err := strconv.Atoi(match[2])
+		if err != nil {
+			return nil, false
+		}
+		padded := 0
+		if len(match[2]) > 1 && match[2][0] == '0' {
+			padded = len(match[2])
+		}
+		if i == 0 {
+			prefix, suffix, width, start = match[1], match[3], padded, number
+			continue
+		}
+		if match[1] != prefix || match[3] != suffix || number != start+i ||
+			(width > 0 && len(match[2]) != width) || (width == 0 && padded > 0) {
+			return nil, false
+		}
+	}
+
+	number := "$Number$"
+	if width > 0 {
+		number = fmt.Sprintf("$Number%%0%dd$", width)
+	}
+	media := escapeTemplate(prefix) + number + escapeTemplate(suffix)
+	if r.dir != "." {
+		media = escapeTemplate(r.dir) + "/" + media
+	}
+	return &mpdSegmentTemplate{
+		Timescale:              r.track.timescale,
+		PresentationTimeOffset: r.segments[0].start,
+		Initialization:         escapeTemplate(r.init),
+		Media:                  media,
+		StartNumber:            start,
+		Timeline:               r.timeline(),
+	}, true
+}
+
+func (r *rendition) segmentList() *mpdSegmentList {
+	list := &mpdSegmentList{
+		Timescale:              r.track.timescale,
+		PresentationTimeOffset: r.segments[0].start,
+		Initialization:         mpdURL{SourceURL: r.init},
+		Timeline:               r.timeline(),
+	}
+	for _, segment := range r.segments {
+		list.SegmentURLs = append(list.SegmentURLs, mpdSegmentURL{Media: segment.path})
+	}
+	return list
+}
+
+func escapeTemplate(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+// contentProtections signals the common encryption of a track, and ClearKey when it has a
+// license server.
+func contentProtections(track *trackInfo, licenseURL string) []mpdContentProtection {
+	if track.scheme == "" {
+		return nil
+	}
+	protections := []mpdContentProtection{{
+		SchemeIDURI: mp4ProtectionURI,
+		Value:       track.scheme,
+		DefaultKID:  formatKID(track.kid),
+	}}
+	if licenseURL != "" {
+		protections = append(protections, mpdContentProtection{
+			SchemeIDURI: clearKeySystemURI,
+			Value:       "ClearKey1.0",
+			Laurl:       &mpdText{Value: licenseURL},
+		})
+	}
+	return protections
+}
+
+// colourProperties signals HDR transfer characteristics. PQ needs a capable display, HLG
+// degrades to SDR, so only PQ is essential.
+func colourProperties(track *trackInfo) (essential, supplemental []mpdDescriptor) {
+	if track.transfer != 16 && track.transfer != 18 {
+		return nil, nil
+	}
+	colour := []mpdDescriptor{
+		{SchemeIDURI: colourPrimariesURI, Value: strconv.Itoa(track.primaries)},
+		{SchemeIDURI: matrixURI, Value: strconv.Itoa(track.matrix)},
+	}
+	transfer := mpdDescriptor{SchemeIDURI: transferURI, Value: strconv.Itoa(track.transfer)}
+	if track.transfer == 16 {
+		return append(colour, transfer), nil
+	}
+	return colour, []mpdDescriptor{transfer}
+}
+
+// formatKID writes a key ID in the UUID form of cenc:default_KID.
+func formatKID(kid []byte) string {
+	if len(kid) != 16 {
+		return ""
+	}
+	h := hex.EncodeToString(kid)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func dashFrameRate(num, den uint64) string {
+	if den == 1 {
+		return strconv.FormatUint(num, 10)
+	}
+	return fmt.Sprintf("%d/%d", num, den)
+}
+
+func parseFrameRate(rate string) float64 {
+	num, den, found := strings.Cut(rate, "/")
+	n, _ := strconv.ParseFloat(num, 64)
+	if !found {
+		return n
+	}
+	d, _ := strconv.ParseFloat(den, 64)
+	if d == 0 {
+		return 0
+	}
+	return n / d
+}
@@ -0,0 +1,252 @@
+package worker
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+func segmentsAt(paths []string, starts []uint64, duration uint64) []*renditionSegment {
+	segments := make([]*renditionSegment, len(paths))
+	for i, p := range paths {
+		segments[i] = &renditionSegment{path: p, fragmentInfo: &fragmentInfo{start: starts[i], duration: duration}}
+	}
+	return segments
+}
+
+func TestWriteMPD(t *testing.T) {
+	dir := packagedOutput(t)
+	renditions, err := measureRenditions(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMPD(dir, renditions, ""); err != nil {
+		t.Fatalf("writeMPD() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, models.DASHManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc mpdDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("written MPD doesn't parse: %v", err)
+	}
+
+	if doc.Profiles != liveProfile || doc.Type != "static" || doc.MediaPresentationDuration != "PT4.000S" || doc.MinBufferTime != "PT2.000S" {
+		t.Errorf("MPD = profiles %s, type %s, duration %s, min buffer %s", doc.Profiles, doc.Type, doc.MediaPresentationDuration, doc.MinBufferTime)
+	}
+	if len(doc.Periods) != 1 || len(doc.Periods[0].AdaptationSets) != 2 {
+		t.Fatalf("MPD has %d periods, want 1 with 2 adaptation sets", len(doc.Periods))
+	}
+	video, audio := doc.Periods[0].AdaptationSets[0], doc.Periods[0].AdaptationSets[1]
+	if video.ContentType != "video" || audio.ContentType != "audio" {
+		t.Fatalf("adaptation sets = %s, %s; want video first", video.ContentType, audio.ContentType)
+	}
+	if video.MaxWidth != 1280 || video.MaxHeight != 720 || video.MaxFrameRate != "30" || video.StartWithSAP != 1 {
+		t.Errorf("video set = %+v", video)
+	}
+	if audio.Lang != "eng" {
+		t.Errorf("audio language = %q, want eng", audio.Lang)
+	}
+
+	r := video.Representations[0]
+	wantPeak := (fileSize(t, dir, "video/seg-2.m4s")*8 + 1) / 2
+	if r.Bandwidth != wantPeak || r.Codecs != "avc1.64001F" || r.Width != 1280 || r.Height != 720 || r.FrameRate != "30" {
+		t.Errorf("video representation = %+v, want bandwidth %d", r, wantPeak)
+	}
+	template := r.SegmentTemplate
+	if template == nil {
+		t.Fatal("video representation has no segment template")
+	}
+	if template.Media != "video/seg-$Number$.m4s" || template.Initialization != "video/init.mp4" || template.StartNumber != 1 || template.Timescale != 90000 {
+		t.Errorf("segment template = %+v", template)
+	}
+	if s := template.Timeline.S; len(s) != 1 || s[0].T == nil || *s[0].T != 0 || s[0].D != 180000 || s[0].R != 1 {
+		t.Errorf("segment timeline = %+v, want one entry at 0 repeated once", s)
+	}
+
+	a := audio.Representations[0]
+	if a.AudioSamplingRate != 48000 || len(a.AudioChannelConfiguration) != 1 || a.AudioChannelConfiguration[0].Value != "2" {
+		t.Errorf("audio representation = %+v", a)
+	}
+}
+
+func TestBuildMPDProtection(t *testing.T) {
+	kid := []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	track := &trackInfo{kind: "video", codec: "avc1.64001F", timescale: 90000, width: 640, height: 360, scheme: "cenc", kid: kid, transfer: 16, primaries: 9, matrix: 9}
+
+	protections := contentProtections(track, "https://api.example.com/license")
+	if len(protections) != 2 {
+		t.Fatalf("contentProtections() = %d elements, want 2", len(protections))
+	}
+	if protections[0].Value != "cenc" || protections[0].DefaultKID != "01234567-89ab-cdef-0123-456789abcdef" {
+		t.Errorf("mp4protection = %+v", protections[0])
+	}
+	if protections[1].SchemeIDURI != clearKeySystemURI || protections[1].Laurl == nil || protections[1].Laurl.Value != "https://api.example.com/license" {
+		t.Errorf("ClearKey protection = %+v", protections[1])
+	}
+	if got := contentProtections(&trackInfo{}, "https://api.example.com/license"); got != nil {
+		t.Errorf("contentProtections() of a clear track = %+v, want none", got)
+	}
+
+	essential, supplemental := colourProperties(track)
+	if len(essential) != 3 || len(supplemental) != 0 {
+		t.Errorf("colourProperties() of PQ = %d essential, %d supplemental; want 3, 0", len(essential), len(supplemental))
+	}
+	track.transfer = 18
+	if essential, supplemental = colourProperties(track); len(essential) != 2 || len(supplemental) != 1 {
+		t.Errorf("colourProperties() of HLG = %d essential, %d supplemental; want 2, 1", len(essential), len(supplemental))
+	}
+	track.transfer = 1
+	if essential, supplemental = colourProperties(track); essential != nil || supplemental != nil {
+		t.Error("colourProperties() of SDR signals colour")
+	}
+}
+
+func TestRenditionTimeline(t *testing.T) {
+	tests := []struct {
+		name   string
+		starts []uint64
+		want   []mpdTimelineEntry
+	}{
+		{"contiguous", []uint64{0, 100, 200}, []mpdTimelineEntry{{T: ptr(uint64(0)), D: 100, R: 2}}},
+		{"offset start", []uint64{500, 600}, []mpdTimelineEntry{{T: ptr(uint64(500)), D: 100, R: 1}}},
+		{"gap", []uint64{0, 100, 300}, []mpdTimelineEntry{{T: ptr(uint64(0)), D: 100, R: 1}, {T: ptr(uint64(300)), D: 100}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := make([]string, len(tt.starts))
+			r := &rendition{segments: segmentsAt(paths, tt.starts, 100)}
+			got := r.timeline().S
+			if len(got) != len(tt.want) {
+				t.Fatalf("timeline() = %d entries, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].D != tt.want[i].D || got[i].R != tt.want[i].R || (got[i].T == nil) != (tt.want[i].T == nil) ||
+					got[i].T != nil && *got[i].T != *tt.want[i].T {
+					t.Errorf("timeline()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+			if n := timelineLength(r.timeline()); n != len(tt.starts) {
+				t.Errorf("timelineLength() = %d, want %d", n, len(tt.starts))
+			}
+		})
+	}
+}
+
+func TestRenditionSegmentTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		dir       string
+		paths     []string
+		wantMedia string
+		wantStart int
+		wantOK    bool
+	}{
+		{"numbered", "video", []string{"video/seg-1.m4s", "video/seg-2.m4s"}, "video/seg-$Number$.m4s", 1, true},
+		{"zero based", "video", []string{"video/seg0.m4s", "video/seg1.m4s"}, "video/seg$Number$.m4s", 0, true},
+		{"padded", "video", []string{"video/s001.m4s", "video/s002.m4s"}, "video/s$Number%03d$.m4s", 1, true},
+		{"top level", ".", []string{"seg-1.m4s", "seg-2.m4s"}, "seg-$Number$.m4s", 1, true},
+		{"dollar in name", "v$1", []string{"v$1/a$-1.m4s", "v$1/a$-2.m4s"}, "v$$1/a$$-$Number$.m4s", 1, true},
+		{"gap in numbers", "video", []string{"video/seg-1.m4s", "video/seg-3.m4s"}, "", 0, false},
+		{"different names", "video", []string{"video/seg-1.m4s", "video/part-2.m4s"}, "", 0, false},
+		{"padded past a power of ten", "video", []string{"video/s09.m4s", "video/s10.m4s"}, "video/s$Number%02d$.m4s", 9, true},
+		{"padding changes width", "video", []string{"video/s09.m4s", "video/s010.m4s"}, "", 0, false},
+		{"unpadded then padded", "video", []string{"video/s9.m4s", "video/s010.m4s"}, "", 0, false},
+		{"no number", "video", []string{"video/seg.m4s"}, "", 0, false},
+		{"other directory", "video", []string{"video/seg-1.m4s", "other/seg-2.m4s"}, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &rendition{
+				dir:      tt.dir,
+				init:     tt.dir + "/init.mp4",
+				track:    &trackInfo{timescale: 1000},
+				segments: segmentsAt(tt.paths, make([]uint64, len(tt.paths)), 100),
+			}
+			template, ok := r.segmentTemplate()
+			if ok != tt.wantOK {
+				t.Fatalf("segmentTemplate() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (template.Media != tt.wantMedia || template.StartNumber != tt.wantStart) {
+				t.Errorf("segmentTemplate() = media %q, start %d; want %q, %d", template.Media, template.StartNumber, tt.wantMedia, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestValidateMPD(t *testing.T) {
+	valid := func() *mpdDocument {
+		return &mpdDocument{
+			MediaPresentationDuration: "PT4.000S",
+			Periods: []mpdPeriod{{AdaptationSets: []mpdAdaptationSet{{
+				ContentType: "video",
+				Representations: []mpdRepresentation{{
+					ID: "video-0", Bandwidth: 1000, Codecs: "avc1.64001F", Width: 1280, Height: 720, FrameRate: "30",
+					SegmentTemplate: &mpdSegmentTemplate{},
+				}},
+			}}}},
+		}
+	}
+	tests := []struct {
+		name    string
+		change  func(doc *mpdDocument)
+		wantErr bool
+	}{
+		{"valid", func(*mpdDocument) {}, false},
+		{"no adaptation sets", func(doc *mpdDocument) { doc.Periods[0].AdaptationSets = nil }, true},
+		{"no duration", func(doc *mpdDocument) { doc.MediaPresentationDuration = "PT0.000S" }, true},
+		{"no bandwidth", func(doc *mpdDocument) { doc.Periods[0].AdaptationSets[0].Representations[0].Bandwidth = 0 }, true},
+		{"no codecs", func(doc *mpdDocument) { doc.Periods[0].AdaptationSets[0].Representations[0].Codecs = "" }, true},
+		{"no frame rate", func(doc *mpdDocument) { doc.Periods[0].AdaptationSets[0].Representations[0].FrameRate = "" }, true},
+		{"no segments", func(doc *mpdDocument) { doc.Periods[0].AdaptationSets[0].Representations[0].SegmentTemplate = nil }, true},
+		{"audio without channels", func(doc *mpdDocument) { doc.Periods[0].AdaptationSets[0].ContentType = "audio" }, true},
+		{"list not matching its timeline", func(doc *mpdDocument) {
+			r := &doc.Periods[0].AdaptationSets[0].Representations[0]
+			r.SegmentTemplate = nil
+			r.SegmentList = &mpdSegmentList{
+				Timeline:    &mpdTimeline{S: []mpdTimelineEntry{{D: 100, R: 1}}},
+				SegmentURLs: []mpdSegmentURL{{Media: "seg-1.m4s"}},
+			}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := valid()
+			tt.change(doc)
+			if err := validateMPD(doc); (err != nil) != tt.wantErr {
+				t.Errorf("validateMPD() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDashFrameRate(t *testing.T) {
+	tests := []struct {
+		num, den uint64
+		want     string
+		value    float64
+	}{
+		{30, 1, "30", 30},
+		{30000, 1001, "30000/1001", 30000.0 / 1001},
+	}
+	for _, tt := range tests {
+		got := dashFrameRate(tt.num, tt.den)
+		if got != tt.want {
+			t.Errorf("dashFrameRate(%d, %d) = %q, want %q", tt.num, tt.den, got, tt.want)
+		}
+		if value := parseFrameRate(got); value != tt.value {
+			t.Errorf("parseFrameRate(%q) = %v, want %v", got, value, tt.value)
+		}
+	}
+	if value := parseFrameRate("30/0"); value != 0 {
+		t.Errorf("parseFrameRate(30/0) = %v, want 0", value)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,205 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+const overlayDir = "overlays"
+
+// overlaySet is the filter graph burning a job's overlays into the video. The segments are
+// encoded separately, so each one is shifted to its place in the video while the overlays are
+// drawn: their time ranges and timestamps then refer to the whole video.
+type overlaySet struct {
+	inputs []string // Overlay images, the inputs after the segment
+	graph  string   // Filters from [base] to [v]
+}
+
+// prepareOverlays fetches the images of the job's overlays and builds their filters for a video
+// of the given size. It returns nil for jobs without overlays.
+func (p *videoProcessor) prepareOverlays(ctx context.Context, job *models.EncodeJob, videoInfo *VideoInfo) (*overlaySet, error) {
+	if len(job.Overlays) == 0 {
+		return nil, nil
+	}
+	dir := filepath.Join(p.tempDir, overlayDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create overlay directory: %w", err)
+	}
+
+	set := &overlaySet{}
+	var graph strings.Builder
+	current := "base"
+	for i, overlay := range job.Overlays {
+		overlay = overlay.WithDefaults()
+		next := fmt.Sprintf("o%d", i)
+		margin := int(math.Round(overlay.Margin * float64(videoInfo.Height)))
+		enable := overlayEnable(overlay)
+
+		switch overlay.Type {
+		case models.OverlayImage:
+			path := filepath.Join(dir, fmt.Sprintf("image_%d%s", i, filepath.Ext(overlay.ImageKey)))
+			size, err := p.awsRepo.DownloadFile(ctx, p.cfg.S3.InputBucket, overlay.ImageKey, path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to download overlay %d image: %w", i, err)
+			}
+			if err = checkOverlayImage(path, size); err != nil {
+				return nil, fmt.Errorf("overlay %d: %w", i, err)
+			}
+			set.inputs = append(set.inputs, path)
+			width := int(math.Round(overlay.Scale*float64(videoInfo.Width))) &^ 1
+			x, y := overlayPosition(overlay.Position, margin, "w", "h")
+			fmt.Fprintf(&graph, "[%d:v]scale=%d:-2,format=rgba,colorchannelmixer=aa=%s[img%d];",
+				len(set.inputs), max(width, 2), formatOpacity(overlay.Opacity), i)
+			fmt.Fprintf(&graph, "[%s][img%d]overlay=x=%s:y=%s:eof_action=repeat%s[%s];", current, i, x, y, enable, next)
+
+		case models.OverlayText:
+			// A text file spares the text from the escaping of the filter graph
+			path := filepath.Join(dir, fmt.Sprintf("text_%d.txt", i))
+			if err := os.WriteFile(path, []byte(overlayText(overlay.Text, job)), 0644); err != nil {
+				return nil, fmt.Errorf("failed to write overlay %d text: %w", i, err)
+			}
+			size := int(math.Round(overlay.FontSize * float64(videoInfo.Height)))
+			x, y := overlayPosition(overlay.Position, margin, "tw", "th")
+			font := ""
+			if p.cfg.Worker.OverlayFontFile != "" {
+				font = ":fontfile=" + escapeFilterValue(p.cfg.Worker.OverlayFontFile)
+			}
+			fmt.Fprintf(&graph, "[%s]drawtext=textfile=%s:expansion=normal%s:fontsize=%d:fontcolor=%s@%s:x=%s:y=%s%s[%s];",
+				current, escapeFilterValue(path), font, max(size, 1), expandColor(overlay.FontColor), formatOpacity(overlay.Opacity), x, y, enable, next)
+		}
+		current = next
+	}
+	fmt.Fprintf(&graph, "[%s]setpts=PTS-STARTPTS[v]", current)
+	set.graph = graph.String()
+	return set, nil
+}
+
+// args returns the ffmpeg arguments drawing the overlays on a segment starting offset seconds
+// into the video. They follow the segment's own input.
+func (s *overlaySet) args(offset float64) []string {
+	var args []string
+	for _, input := range s.inputs {
+		args = append(args, "-i", input)
+	}
+	graph := fmt.Sprintf("[0:v]setpts=PTS+%s/TB[base];%s", formatSeconds(offset), s.graph)
+	return append(args, "-filter_complex", graph, "-map", "[v]", "-map", "0:a?")
+}
+
+// segmentOffsets returns where in the video each segment starts.
+func segmentOffsets(ctx context.Context, segments []string) ([]float64, error) {
+	offsets := make([]float64, len(segments))
+	var offset float64
+	for i, segment := range segments {
+		offsets[i] = offset
+		cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries",
+			"format=duration", "-of", "csv=p=0", segment)
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("ffprobe segment duration error: %v", err)
+		}
+		duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid segment duration: %v", err)
+		}
+		offset += duration
+	}
+	return offsets, nil
+}
+
+func overlayEnable(overlay models.Overlay) string {
+	switch {
+	case overlay.End > 0:
+		return fmt.Sprintf(":enable='between(t,%s,%s)'", formatSeconds(overlay.Start), formatSeconds(overlay.End))
+	case overlay.Start > 0:
+		return fmt.Sprintf(":enable='gte(t,%s)'", formatSeconds(overlay.Start))
+	default:
+		return ""
+	}
+}
+
+// overlayPosition returns the x and y expressions placing an overlay whose size is named by
+// width and height inside the main video, W and H for overlay and w and h for drawtext.
+func overlayPosition(position models.OverlayPosition, margin int, width, height string) (string, string) {
+	mainWidth, mainHeight := "W", "H"
+	if width == "tw" {
+		mainWidth, mainHeight = "w", "h"
+	}
+	right := fmt.Sprintf("%s-%s-%d", mainWidth, width, margin)
+	bottom := fmt.Sprintf("%s-%s-%d", mainHeight, height, margin)
+	left, top := strconv.Itoa(margin), strconv.Itoa(margin)
+	switch position {
+	case models.OverlayTopLeft:
+		return left, top
+	case models.OverlayTopRight:
+		return right, top
+	case models.OverlayBottomLeft:
+		return left, bottom
+	case models.OverlayCenter:
+		return fmt.Sprintf("(%s-%s)/2", mainWidth, width), fmt.Sprintf("(%s-%s)/2", mainHeight, height)
+	default:
+		return right, bottom
+	}
+}
+
+// checkOverlayImage makes sure the downloaded file is an image the API would have accepted.
+func checkOverlayImage(path string, size int64) error {
+	if size > models.MaxOverlayImageSize {
+		return fmt.Errorf("image is larger than %d MB", models.MaxOverlayImageSize>>20)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open image: %w", err)
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("failed to read image: %w", err)
+	}
+	if !models.IsOverlayImageType(http.DetectContentType(head[:n])) {
+		return fmt.Errorf("image is not a PNG, JPEG or WebP")
+	}
+	return nil
+}
+
+// escapeFilterValue escapes an option value for a filter graph. The value is escaped for the
+// filter's options first and the result again for the graph, as ffmpeg unescapes both levels.
+func escapeFilterValue(value string) string {
+	option := strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(value)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(option)
+}
+
+// overlayText fills in the variables of a text overlay and escapes the rest for drawtext.
+func overlayText(text string, job *models.EncodeJob) string {
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`)
+	// The variables have nothing to escape, so they come through escaping the text untouched
+	return strings.NewReplacer(
+		models.OverlayVarVideoID, escape.Replace(job.VideoID),
+		models.OverlayVarOwnerID, escape.Replace(job.UserID),
+		models.OverlayVarJobID, escape.Replace(job.JobID),
+		models.OverlayVarTimestamp, "%{pts:hms}",
+	).Replace(escape.Replace(text))
+}
+
+// expandColor turns #rgb into the #rrggbb ffmpeg understands.
+func expandColor(color string) string {
+	if len(color) != 4 || color[0] != '#' {
+		return color
+	}
+	return string([]byte{'#', color[1], color[1], color[2], color[2], color[3], color[3]})
+}
+
+func formatOpacity(opacity float64) string {
+	return strconv.FormatFloat(opacity, 'f', 3, 64)
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+func TestEscapeFilterValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"/tmp/overlays/text_0.txt", "/tmp/overlays/text_0.txt"},
+		{"C:/fonts/font.ttf", `C\\:/fonts/font.ttf`},
+		{"/fonts/it's.ttf", `/fonts/it\\\'s.ttf`},
+		{"/tmp/a,b;c[d]", `/tmp/a\,b\;c\[d\]`},
+		{`/tmp/back\slash`, `/tmp/back\\\\slash`},
+	}
+	for _, tt := range tests {
+		if got := escapeFilterValue(tt.value); got != tt.want {
+			t.Errorf("escapeFilterValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestOverlayText(t *testing.T) {
+	job := &models.EncodeJob{VideoID: "video-1", UserID: "owner-1", JobID: "job-1"}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"{video_id} by {owner_id}", "video-1 by owner-1"},
+		{"job {job_id} at {timestamp}", "job job-1 at %{pts:hms}"},
+		// Only the documented variables are filled in
+		{"{user_id}", "{user_id}"},
+		{`100% \ done`, `100\% \\ done`},
+	}
+	for _, tt := range tests {
+		if got := overlayText(tt.text, job); got != tt.want {
+			t.Errorf("overlayText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOverlayImage(t *testing.T) {
+	dir := t.TempDir()
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+	tests := []struct {
+		name    string
+		data    []byte
+		size    int64
+		wantErr bool
+	}{
+		{"png", png, int64(len(png)), false},
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), 11, false},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), 46, true},
+		{"video", []byte("\x00\x00\x00\x18ftypmp42"), 12, true},
+		{"too large", png, models.MaxOverlayImageSize + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := checkOverlayImage(path, tt.size); (err != nil) != tt.wantErr {
+				t.Fatalf("checkOverlayImage error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
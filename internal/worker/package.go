@@ -2,37 +2,50 @@ package worker
 
 import (
 	"bytes"
+	"context"
+	"encoding/hex"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"github.com/google/uuid"
 )
 
 type stitchAndPackageOptions struct {
 	segmentDuration int
 	withHLS         bool
 	withDASH        bool
+	// encryption has the packager encrypt under key: HLS players fetch it from keyURL and DASH
+	// players through the ClearKey license server at licenseURL
+	encryption models.EncryptionMode
+	key        *models.ContentKey
+	keyURL     string
+	licenseURL string
 }
 
-func (p *videoProcessor) stitchAndPackage(segments []string, outputPath string) error {
+func (p *videoProcessor) stitchAndPackage(ctx context.Context, job *models.EncodeJob, segments []string, outputPath string) ([]*rendition, error) {
 	// Create temporary directory for packaged output
 	packagingDir := filepath.Join(p.tempDir, "packaging")
 	if err := os.MkdirAll(packagingDir, 0755); err != nil {
-		return fmt.Errorf("failed to create packaging directory: %w", err)
+		return nil, fmt.Errorf("failed to create packaging directory: %w", err)
 	}
 	defer os.RemoveAll(packagingDir) // Cleanup after upload
 
 	// Step 1: Stitch segments together
 	stitchedPath := filepath.Join(packagingDir, "stitched.mp4")
-	if err := p.stitchSegments(segments, stitchedPath); err != nil {
-		return fmt.Errorf("failed to stitch segments: %w", err)
+	if err := p.stitchSegments(ctx, segments, stitchedPath); err != nil {
+		return nil, fmt.Errorf("failed to stitch segments: %w", err)
 	}
 
 	// Step 2: Fragment the stitched video
 	fragmentedPath := filepath.Join(packagingDir, "fragmented.mp4")
-	if err := p.fragmentVideo(stitchedPath, fragmentedPath); err != nil {
-		return fmt.Errorf("failed to fragment video: %w", err)
+	if err := p.fragmentVideo(ctx, stitchedPath, fragmentedPath); err != nil {
+		return nil, fmt.Errorf("failed to fragment video: %w", err)
 	}
 
 	// Step 3: Package the video with HLS/DASH
@@ -41,15 +54,96 @@ func (p *videoProcessor) stitchAndPackage(segments []string, outputPath string)
 		withHLS:         true,
 		withDASH:        true,
 	}
+	switch job.EncryptionMode {
+	case models.EncryptionSampleAES, models.EncryptionCENC, models.EncryptionCBCS:
+		// One key encrypts the CMAF segments once for both HLS and DASH
+		keys, err := p.contentKeys(job, 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get content key: %w", err)
+		}
+		opts.encryption = job.EncryptionMode
+		opts.key = keys[0]
+		opts.keyURL = drm.KeyURL(p.cfg.Playback.PublicURL, job.VideoID, 0)
+		opts.licenseURL = drm.LicenseURL(p.cfg.Playback.PublicURL, job.VideoID)
+		// HLS can't carry cenc, so the playlists would be unplayable
+		opts.withHLS = job.EncryptionMode != models.EncryptionCENC
+	}
+
+	if err := p.packageVideo(ctx, fragmentedPath, outputPath, opts); err != nil {
+		return nil, fmt.Errorf("failed to package video: %w", err)
+	}
+	// Measured while the segments are still readable MP4
+	renditions, err := measureRenditions(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure renditions: %w", err)
+	}
+
+	if job.EncryptionMode != models.EncryptionNone {
+		if err := p.finishEncryption(job, outputPath); err != nil {
+			return nil, fmt.Errorf("failed to encrypt output: %w", err)
+		}
+	}
+	if err := writeManifests(outputPath, renditions, opts.licenseURL); err != nil {
+		return nil, err
+	}
+	return renditions, nil
+}
 
-	if err := p.packageVideo(fragmentedPath, outputPath, opts); err != nil {
-		return fmt.Errorf("failed to package video: %w", err)
+// writeManifests replaces the manifests the packager wrote with ones generated from the
+// measured renditions.
+func writeManifests(outputPath string, renditions []*rendition, licenseURL string) error {
+	if _, err := os.Stat(filepath.Join(outputPath, models.HLSManifestName)); err == nil {
+		if err := writeMasterPlaylist(outputPath, renditions); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outputPath, models.DASHManifestName)); err == nil {
+		if err := writeMPD(outputPath, renditions, licenseURL); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+// finishEncryption applies AES-128 to the clear output and removes what must not be published
+// with encrypted output: any key file the packager left next to the playlists and, for the
+// HLS-only modes, the MPD, whose segments DASH players could no longer read.
+func (p *videoProcessor) finishEncryption(job *models.EncodeJob, outputPath string) error {
+	if job.EncryptionMode == models.EncryptionAES128 {
+		err := encryptHLS(outputPath, job.KeyRotationSegments, func(count int) ([]*models.ContentKey, error) {
+			return p.contentKeys(job, count)
+		}, func(index int) string {
+			return drm.KeyURL(p.cfg.Playback.PublicURL, job.VideoID, index)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	remove := []string{"key.bin"}
+	if job.EncryptionMode == models.EncryptionAES128 || job.EncryptionMode == models.EncryptionSampleAES {
+		remove = append(remove, models.DASHManifestName)
+	}
+	for _, name := range remove {
+		if err := os.Remove(filepath.Join(outputPath, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
 	return nil
 }
 
-func (p *videoProcessor) stitchSegments(segments []string, outputPath string) error {
+// contentKeys returns the first count keys of the job's video.
+func (p *videoProcessor) contentKeys(job *models.EncodeJob, count int) ([]*models.ContentKey, error) {
+	videoID, err := uuid.Parse(job.VideoID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid video id %q: %w", job.VideoID, err)
+	}
+	// Key storage is quick and must not be cut short by a job that is being cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return p.keyRepo.EnsureKeys(ctx, videoID, count)
+}
+
+func (p *videoProcessor) stitchSegments(ctx context.Context, segments []string, outputPath string) error {
 	// Create concat file
 	concatListPath := filepath.Join(p.tempDir, "concat_list.txt")
 	concatFile, err := os.Create(concatListPath)
@@ -72,7 +166,7 @@ func (p *videoProcessor) stitchSegments(segments []string, outputPath string) er
 	concatFile.Close() // Close before using in ffmpeg
 
 	// Run ffmpeg concat
-	cmd := exec.Command("ffmpeg",
+	cmd := exec.CommandContext(ctx, "ffmpeg",
 		"-f", "concat",
 		"-safe", "0",
 		"-i", concatListPath,
@@ -84,15 +178,15 @@ func (p *videoProcessor) stitchSegments(segments []string, outputPath string) er
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
+	if err := p.runCommand(cmd); err != nil {
 		return fmt.Errorf("ffmpeg concat failed: %v, stderr: %s", err, stderr.String())
 	}
 
 	return nil
 }
 
-func (p *videoProcessor) fragmentVideo(inputPath, outputPath string) error {
-	cmd := exec.Command("mp4fragment",
+func (p *videoProcessor) fragmentVideo(ctx context.Context, inputPath, outputPath string) error {
+	cmd := exec.CommandContext(ctx, "mp4fragment",
 		"--fragment-duration", "4000",
 		"--timescale", "1000",
 		inputPath,
@@ -102,14 +196,14 @@ func (p *videoProcessor) fragmentVideo(inputPath, outputPath string) error {
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
+	if err := p.runCommand(cmd); err != nil {
 		return fmt.Errorf("mp4fragment failed: %v, stderr: %s", err, stderr.String())
 	}
 
 	return nil
 }
 
-func (p *videoProcessor) packageVideo(inputPath, outputPath string, opts stitchAndPackageOptions) error {
+func (p *videoProcessor) packageVideo(ctx context.Context, inputPath, outputPath string, opts stitchAndPackageOptions) error {
 	args := []string{
 		"--output-dir", outputPath,
 		"--force",
@@ -119,6 +213,19 @@ func (p *videoProcessor) packageVideo(inputPath, outputPath string, opts stitchA
 	if opts.withHLS {
 		args = append(args, "--hls")
 	}
+	if key := opts.key; key != nil {
+		scheme := "cbcs"
+		if opts.encryption == models.EncryptionCENC {
+			scheme = "cenc"
+		}
+		args = append(args, "--encryption-cenc-scheme="+scheme)
+		if opts.withHLS {
+			args = append(args, "--hls-key-url="+opts.keyURL)
+		}
+		if opts.encryption != models.EncryptionSampleAES {
+			args = append(args, "--clearkey", "--clearkey-license-uri="+opts.licenseURL)
+		}
+	}
 	//if opts.withDASH {
 	//	args = append(args, "--mpd")
 	//}
@@ -126,13 +233,27 @@ func (p *videoProcessor) packageVideo(inputPath, outputPath string, opts stitchA
 	// Add input file
 	args = append(args, inputPath)
 
-	cmd := exec.Command("mp4dash", args...)
+	cmd := exec.CommandContext(ctx, "mp4dash", args...)
+	if opts.key != nil {
+		keyPath, err := writePackagerKey(p.tempDir, opts.key)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(keyPath)
+		// mp4dash only takes the key as an option, so the shell reads it from the file and
+		// puts it there: it stays out of the worker's arguments and logs
+		cmd = exec.CommandContext(ctx, "sh", append([]string{"-c",
+			`key=$(cat "$1") && shift && exec mp4dash --encryption-key="$key" "$@"`, "mp4dash", keyPath}, args...)...)
+	}
 
-	log.Println(args)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("mp4dash failed: %v, err: %v", err, string(output))
+	if err := p.runCommand(cmd); err != nil {
+		// The packager echoes the mp4encrypt command line it failed on, key included, and the
+		// error ends up in the job
+		return fmt.Errorf("mp4dash failed: %v, err: %v", err, redactKey(output.String(), opts.key))
 	}
 
 	// Verify output
@@ -143,6 +264,37 @@ func (p *videoProcessor) packageVideo(inputPath, outputPath string, opts stitchA
 	return nil
 }
 
+// writePackagerKey writes the key spec mp4dash expects, KID:KEY:IV in hex, to a file only the
+// worker can read.
+func writePackagerKey(dir string, key *models.ContentKey) (string, error) {
+	file, err := os.CreateTemp(dir, "packager-key-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create key file: %w", err)
+	}
+	defer file.Close()
+	if err = file.Chmod(0600); err == nil {
+		_, err = fmt.Fprintf(file, "%s:%s:%s", key.KID, hex.EncodeToString(key.Key), hex.EncodeToString(key.IV))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write key file: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// redactKey blanks out the content key and its IV wherever the packager printed them.
+func redactKey(output string, key *models.ContentKey) string {
+	if key == nil {
+		return output
+	}
+	for _, secret := range [][]byte{key.Key, key.IV} {
+		if len(secret) > 0 {
+			output = strings.ReplaceAll(output, hex.EncodeToString(secret), "[redacted]")
+		}
+	}
+	return output
+}
+
 func (p *videoProcessor) verifyPackagedOutput(outputPath string) error {
 	// Check for essential files
 	requiredFiles := []string{
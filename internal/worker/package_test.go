@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+func testPackagerKey() *models.ContentKey {
+	return &models.ContentKey{
+		KID: "00112233445566778899aabbccddeeff",
+		Key: []byte("0123456789abcdef"),
+		IV:  []byte("fedcba9876543210"),
+	}
+}
+
+func TestWritePackagerKey(t *testing.T) {
+	key := testPackagerKey()
+	path, err := writePackagerKey(t.TempDir(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("writePackagerKey() mode = %v, want 0600", info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := key.KID + ":" + hex.EncodeToString(key.Key) + ":" + hex.EncodeToString(key.IV)
+	if string(data) != want {
+		t.Errorf("writePackagerKey() wrote %q, want %q", data, want)
+	}
+}
+
+func TestRedactKey(t *testing.T) {
+	key := testPackagerKey()
+	keyHex, ivHex := hex.EncodeToString(key.Key), hex.EncodeToString(key.IV)
+	tests := []struct {
+		name   string
+		output string
+		key    *models.ContentKey
+		want   string
+	}{
+		{"no key", "key " + keyHex, nil, "key " + keyHex},
+		{"key and iv", "--key=1:" + keyHex + ":" + ivHex, key, "--key=1:[redacted]:[redacted]"},
+		{"repeated", keyHex + " " + keyHex, key, "[redacted] [redacted]"},
+		{"kid kept", "kid " + key.KID, key, "kid " + key.KID},
+		{"nothing to redact", "mp4dash: error", key, "mp4dash: error"},
+		{"empty iv", "iv is empty", &models.ContentKey{Key: key.Key}, "iv is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactKey(tt.output, tt.key)
+			if got != tt.want {
+				t.Errorf("redactKey() = %q, want %q", got, tt.want)
+			}
+			if tt.key != nil && strings.Contains(got, keyHex) {
+				t.Errorf("redactKey() = %q still holds the key", got)
+			}
+		})
+	}
+}
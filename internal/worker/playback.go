@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+)
+
+const (
+	thumbnailName  = "thumbnail.jpg"
+	thumbnailWidth = 640
+	// The thumbnail is taken a tenth into the video, but no later than this
+	maxThumbnailOffset = 10.0
+)
+
+// createThumbnail writes a frame of the source into the output as thumbnailName.
+func (p *videoProcessor) createThumbnail(ctx context.Context, inputPath, outputPath string, duration float64) error {
+	offset := math.Min(duration/10, maxThumbnailOffset)
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-i", inputPath,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", thumbnailWidth),
+		"-q:v", "3",
+		"-y", filepath.Join(outputPath, thumbnailName),
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := p.runCommand(cmd); err != nil {
+		return fmt.Errorf("ffmpeg thumbnail failed: %v, stderr: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// playbackInfo describes the packaged output of a job. URLs are the object keys the output is
+// published under; formats the packager didn't produce are left out. There is a quality for
+// each video rendition, as measured from its segments.
+func playbackInfo(job *models.EncodeJob, videoInfo *VideoInfo, renditions []*rendition, outputPath string) *models.PlaybackInfo {
+	info := &models.PlaybackInfo{
+		VideoID:   job.VideoID,
+		Duration:  videoInfo.Duration,
+		Qualities: models.QualityMap{},
+		Subtitles: models.StringList{},
+		Status:    models.JobStatusCompleted,
+	}
+	if _, err := os.Stat(filepath.Join(outputPath, thumbnailName)); err == nil {
+		info.Thumbnail = job.OutputS3Key + "/" + thumbnailName
+	}
+
+	var urls models.PlaybackURLs
+	for _, format := range job.OutputFormats {
+		name, url := models.HLSManifestName, &urls.HLS
+		if format == models.FormatDASH {
+			name, url = models.DASHManifestName, &urls.DASH
+		}
+		if _, err := os.Stat(filepath.Join(outputPath, name)); err != nil {
+			continue
+		}
+		*url = job.OutputS3Key + "/" + name
+		if info.Format == "" {
+			info.Format = format
+		}
+	}
+
+	// Players switch between renditions within the manifests, so every quality has their URLs
+	for _, r := range renditions {
+		if r.track.kind != "video" {
+			continue
+		}
+		quality := models.VideoQuality(fmt.Sprintf("%dp", r.track.height))
+		bitrate := int((r.bitrate() + 500) / 1000)
+		// Renditions of the same height are told apart by bit rate only, the best one stands for them
+		if existing, ok := info.Qualities[quality]; ok && existing.Bitrate >= bitrate {
+			continue
+		}
+		info.Qualities[quality] = models.QualityInfo{
+			URLs:       urls,
+			Resolution: fmt.Sprintf("%dx%d", r.track.width, r.track.height),
+			Bitrate:    bitrate,
+		}
+	}
+	return info
+}
@@ -4,11 +4,13 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
-	"io"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/metrics"
 	"log"
 	"math"
 	"mime"
@@ -22,205 +24,158 @@ import (
 )
 
 const (
-	maxConcurrentUploads = 50
+	maxConcurrentUploads = 10 // Each upload may itself run several parts in parallel
+	sourceDir            = "source"
 )
 
+// stageProgress is the overall progress reported when a stage starts.
+var stageProgress = map[models.JobStage]float64{
+	models.JobStageDownload: 0,
+	models.JobStageClip:     5,
+	models.JobStageCompose:  5,
+	models.JobStageSplit:    10,
+	models.JobStageEncode:   20,
+	models.JobStagePackage:  80,
+	models.JobStageUpload:   90,
+}
+
 type videoProcessor struct {
-	cfg     *config.Config
-	awsRepo videofiles.AWSRepository
-	tempDir string
+	cfg        *config.Config
+	awsRepo    videofiles.AWSRepository
+	keyRepo    drm.Repository
+	tempDir    string
+	cgroup     *jobCgroup
+	onProgress func(job *models.EncodeJob)
+	onOutput   func(info *models.PlaybackInfo) error
 }
 
-func NewVideoProcessor(cfg *config.Config, awsRepo videofiles.AWSRepository) VideoProcessor {
+// NewVideoProcessor returns a processor working in tempDir. onProgress, if set, is called
+// whenever the job moves to a new stage. onOutput, if set, is called with the playback info of
+// the output once every file of it is published; an error from it rolls the publish back.
+func NewVideoProcessor(cfg *config.Config, awsRepo videofiles.AWSRepository, keyRepo drm.Repository, tempDir string, onProgress func(job *models.EncodeJob), onOutput func(info *models.PlaybackInfo) error) VideoProcessor {
 	return &videoProcessor{
-		cfg:     cfg,
-		awsRepo: awsRepo,
-		tempDir: TempDir,
+		cfg:        cfg,
+		awsRepo:    awsRepo,
+		keyRepo:    keyRepo,
+		tempDir:    tempDir,
+		onProgress: onProgress,
+		onOutput:   onOutput,
 	}
 }
 
-func (p *videoProcessor) ProcessVideo(ctx context.Context, inputKey, outputKey string) error {
-	defer p.cleanup()
+func (p *videoProcessor) ProcessVideo(ctx context.Context, job *models.EncodeJob) (*models.PlaybackInfo, error) {
+	defer func() {
+		// An interrupted job keeps its (partial) source so a retry on this host can resume it
+		p.cleanup(ctx.Err() != nil)
+	}()
 
-	localPath, err := p.downloadVideo(ctx, inputKey)
-	if err != nil {
-		return fmt.Errorf("download failed: %w", err)
+	if p.cfg.Worker.CgroupEnabled {
+		cg, err := newJobCgroup(&p.cfg.Worker, job.JobID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up job cgroup: %w", err)
+		}
+		p.cgroup = cg
+		defer func() {
+			if err := cg.delete(); err != nil {
+				log.Printf("Failed to clean up cgroup for job %s: %v", job.JobID, err)
+			}
+		}()
 	}
 
-	videoInfo, err := GetVideoInfo(localPath)
+	localPath, err := p.fetchSource(ctx, job)
 	if err != nil {
-		return fmt.Errorf("video info extraction failed: %w", err)
+		return nil, err
 	}
 
-	segments, err := p.splitVideo(localPath, videoInfo)
-	if err != nil {
-		return fmt.Errorf("split failed: %w", err)
+	var endStage func()
+	if len(job.ClipRanges) > 0 {
+		endStage = p.beginStage(job, models.JobStageClip)
+		localPath, err = p.cutClip(ctx, localPath, job.ClipRanges, filepath.Join(p.tempDir, clipDir))
+		endStage()
+		if err != nil {
+			return nil, fmt.Errorf("clip failed: %w", err)
+		}
 	}
 
-	bitrate, err := p.analyzeBitrate(segments[0], videoInfo)
+	endStage = p.beginStage(job, models.JobStageSplit)
+	videoInfo, err := GetVideoInfo(ctx, localPath)
 	if err != nil {
-		return fmt.Errorf("bitrate analysis failed: %w", err)
+		endStage()
+		return nil, fmt.Errorf("video info extraction failed: %w", err)
 	}
-
-	encodedSegments, err := p.encodeSegments(segments, bitrate)
+	segments, err := p.splitVideo(ctx, localPath, videoInfo)
+	endStage()
 	if err != nil {
-		return fmt.Errorf("encoding failed: %w", err)
+		return nil, fmt.Errorf("split failed: %w", err)
 	}
 
-	outputPath := filepath.Join(p.tempDir, "output")
-	if err := p.stitchAndPackage(encodedSegments, outputPath); err != nil {
-		return fmt.Errorf("finalization failed: %w", err)
+	endStage = p.beginStage(job, models.JobStageEncode)
+	bitrate, err := p.analyzeBitrate(ctx, segments[0], videoInfo)
+	if err != nil {
+		endStage()
+		return nil, fmt.Errorf("bitrate analysis failed: %w", err)
 	}
-
-	if err := p.uploadProcessedFiles(ctx, outputPath, outputKey); err != nil {
-		return fmt.Errorf("upload failed: %w", err)
+	overlays, err := p.prepareOverlays(ctx, job, videoInfo)
+	if err != nil {
+		endStage()
+		return nil, fmt.Errorf("overlay preparation failed: %w", err)
 	}
-
-	return nil
-}
-
-func (p *videoProcessor) uploadProcessedFiles(ctx context.Context, outputPath, outputKey string) error {
-
-	if outputPath == "" || outputKey == "" {
-		return fmt.Errorf("output path and key cannot be empty")
+	encodedSegments, err := p.encodeSegments(ctx, segments, bitrate, overlays)
+	endStage()
+	if err != nil {
+		return nil, fmt.Errorf("encoding failed: %w", err)
 	}
 
-	outputKey = strings.TrimPrefix(outputKey, "/")
-	baseKey := strings.TrimSuffix(outputKey, filepath.Ext(outputKey))
-
-	log.Printf("Starting concurrent upload process from %s with base key: %s", outputPath, baseKey)
-
-	type uploadJob struct {
-		path     string
-		relPath  string
-		s3Key    string
-		fileInfo os.FileInfo
+	endStage = p.beginStage(job, models.JobStagePackage)
+	outputPath := filepath.Join(p.tempDir, "output")
+	renditions, err := p.stitchAndPackage(ctx, job, encodedSegments, outputPath)
+	if err != nil {
+		endStage()
+		return nil, fmt.Errorf("finalization failed: %w", err)
 	}
-
-	jobs := make(chan uploadJob)
-	results := make(chan error)
-	var wg sync.WaitGroup
-
-	for i := 0; i < maxConcurrentUploads; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for job := range jobs {
-				err := p.uploadSingleFile(ctx, job.path, job.s3Key, job.fileInfo)
-				if err != nil {
-					select {
-					case results <- fmt.Errorf("worker %d failed to upload %s: %w", workerID, job.relPath, err):
-					case <-ctx.Done():
-					}
-				} else {
-					log.Printf("Worker %d successfully uploaded %s", workerID, job.s3Key)
-				}
-			}
-		}(i)
+	// A missing thumbnail is no reason to fail the job
+	if err = p.createThumbnail(ctx, localPath, outputPath, videoInfo.Duration); err != nil {
+		log.Printf("Failed to create thumbnail for job %s: %v", job.JobID, err)
 	}
+	endStage()
+	info := playbackInfo(job, videoInfo, renditions, outputPath)
 
-	go func() {
-		err := filepath.Walk(outputPath, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			if info.IsDir() {
-				return nil
-			}
-
-			relPath, err := filepath.Rel(outputPath, path)
-			if err != nil {
-				return fmt.Errorf("failed to get relative path: %w", err)
-			}
-
-			relPath = filepath.ToSlash(relPath)
-			s3Key := fmt.Sprintf("%s/%s", baseKey, relPath)
-			s3Key = strings.TrimPrefix(s3Key, "/")
-
-			select {
-			case jobs <- uploadJob{
-				path:     path,
-				relPath:  relPath,
-				s3Key:    s3Key,
-				fileInfo: info,
-			}:
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-
+	endStage = p.beginStage(job, models.JobStageUpload)
+	err = p.publishOutput(ctx, outputPath, job.OutputS3Key, func() error {
+		if p.onOutput == nil {
 			return nil
-		})
-
-		if err != nil {
-			select {
-			case results <- fmt.Errorf("failed to walk directory: %w", err):
-			case <-ctx.Done():
-			}
 		}
-
-		close(jobs)
-	}()
-
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
-	var uploadErrors []error
-	for err := range results {
-		if err != nil {
-			uploadErrors = append(uploadErrors, err)
-		}
-	}
-
-	if len(uploadErrors) > 0 {
-		return fmt.Errorf("encountered %d upload errors: %v", len(uploadErrors), uploadErrors[0])
+		return p.onOutput(info)
+	})
+	endStage()
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
 	}
 
-	return nil
+	return info, nil
 }
 
-func (p *videoProcessor) uploadSingleFile(ctx context.Context, path, s3Key string, fileInfo os.FileInfo) error {
-	file, err := os.Open(path)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+// beginStage marks the job as being in the given stage and returns a func that records how
+// long the stage took.
+func (p *videoProcessor) beginStage(job *models.EncodeJob, stage models.JobStage) func() {
+	start := time.Now()
+	timing := &models.StageTiming{StartedAt: start}
+	if job.StageTimings == nil {
+		job.StageTimings = models.StageTimings{}
 	}
-	defer file.Close()
+	job.StageTimings[stage] = timing
 
-	contentType := getContentType(path)
-
-	uploadInput := models.UploadInput{
-		File:       file,
-		BucketName: p.cfg.S3.OutputBucket,
-		Key:        s3Key,
-		MimeType:   contentType,
-		Size:       fileInfo.Size(),
+	job.Stage = stage
+	job.Progress = stageProgress[stage]
+	if p.onProgress != nil {
+		p.onProgress(job)
 	}
-
-	// Attempt upload with retry
-	maxRetries := 3
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		if _, err := file.Seek(0, 0); err != nil {
-			return fmt.Errorf("failed to reset file pointer: %w", err)
-		}
-
-		_, err := p.awsRepo.PutObject(ctx, uploadInput)
-		if err == nil {
-			return nil
-		}
-
-		if attempt < maxRetries {
-			log.Printf("Upload attempt %d/%d failed for %s: %v. Retrying...",
-				attempt, maxRetries, s3Key, err)
-			time.Sleep(time.Duration(attempt) * time.Second)
-			continue
-		}
-
-		return fmt.Errorf("failed to upload after %d attempts: %w", maxRetries, err)
+	return func() {
+		end := time.Now()
+		timing.CompletedAt = &end
+		timing.Seconds = end.Sub(start).Seconds()
+		metrics.StageDuration.WithLabelValues(string(stage)).Observe(timing.Seconds)
 	}
-
-	return nil
 }
 
 func getContentType(filename string) string {
@@ -245,37 +200,82 @@ func getContentType(filename string) string {
 		return "application/octet-stream"
 	}
 }
-func (p *videoProcessor) cleanup() {
-	os.RemoveAll(p.tempDir)
-}
 
-func (p *videoProcessor) downloadVideo(ctx context.Context, inputKey string) (string, error) {
-	if err := os.MkdirAll(p.tempDir, os.ModePerm); err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %w", err)
+// runCommand runs a job subprocess, inside the job cgroup when one is configured.
+func (p *videoProcessor) runCommand(cmd *exec.Cmd) error {
+	if p.cgroup != nil {
+		p.cgroup.prepare(cmd)
+	}
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		metrics.CommandFailures.WithLabelValues(filepath.Base(cmd.Path)).Inc()
 	}
+	return err
+}
 
-	localPath := filepath.Join(p.tempDir, filepath.Base(inputKey))
+func (p *videoProcessor) cleanup(keepSource bool) {
+	if !keepSource {
+		os.RemoveAll(p.tempDir)
+		return
+	}
+	entries, err := os.ReadDir(p.tempDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() != sourceDir {
+			os.RemoveAll(filepath.Join(p.tempDir, entry.Name()))
+		}
+	}
+}
 
-	videoFile, err := p.awsRepo.GetObject(ctx, p.cfg.S3.InputBucket, inputKey)
+// fetchSource downloads the source of a job, composing it first for compositions.
+func (p *videoProcessor) fetchSource(ctx context.Context, job *models.EncodeJob) (string, error) {
+	endStage := p.beginStage(job, models.JobStageDownload)
+	if len(job.ComposeSources) == 0 {
+		localPath, err := p.downloadVideo(ctx, job.InputS3Key)
+		endStage()
+		if err != nil {
+			return "", fmt.Errorf("download failed: %w", err)
+		}
+		return localPath, nil
+	}
+	sourcePaths, err := p.downloadComposeSources(ctx, job.ComposeSources)
+	endStage()
 	if err != nil {
-		return "", fmt.Errorf("failed to get object from S3: %w", err)
+		return "", fmt.Errorf("download failed: %w", err)
 	}
-	defer videoFile.Body.Close()
 
-	outFile, err := os.Create(localPath)
+	endStage = p.beginStage(job, models.JobStageCompose)
+	inputPaths, err := p.cutComposeSources(ctx, job.ComposeSources, sourcePaths)
+	var localPath string
+	if err == nil {
+		localPath, err = p.composeVideos(ctx, job, inputPaths)
+	}
+	endStage()
 	if err != nil {
-		return "", fmt.Errorf("failed to create local video file: %w", err)
+		return "", fmt.Errorf("compose failed: %w", err)
 	}
-	defer outFile.Close()
+	p.removeComposeSources(sourcePaths, localPath)
+	return localPath, nil
+}
 
-	if _, err = io.Copy(outFile, videoFile.Body); err != nil {
-		return "", fmt.Errorf("failed to write video file: %w", err)
+func (p *videoProcessor) downloadVideo(ctx context.Context, inputKey string) (string, error) {
+	dir := filepath.Join(p.tempDir, sourceDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	localPath := filepath.Join(dir, filepath.Base(inputKey))
+	if _, err := p.awsRepo.DownloadFile(ctx, p.cfg.S3.InputBucket, inputKey, localPath); err != nil {
+		return "", fmt.Errorf("failed to download source: %w", err)
 	}
 
 	return localPath, nil
 }
 
-func (p *videoProcessor) splitVideo(inputPath string, videoInfo *VideoInfo) ([]string, error) {
+func (p *videoProcessor) splitVideo(ctx context.Context, inputPath string, videoInfo *VideoInfo) ([]string, error) {
 	segmentDir := filepath.Join(p.tempDir, "segments")
 	if err := os.MkdirAll(segmentDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create segment directory: %w", err)
@@ -286,7 +286,7 @@ func (p *videoProcessor) splitVideo(inputPath string, videoInfo *VideoInfo) ([]s
 	segmentDuration := math.Ceil(videoInfo.Duration / segmentCount)
 
 	// Prepare FFmpeg command for segmentation
-	cmd := exec.Command("ffmpeg",
+	cmd := exec.CommandContext(ctx, "ffmpeg",
 		"-i", inputPath,
 		"-c", "copy",
 		"-f", "segment",
@@ -299,7 +299,7 @@ func (p *videoProcessor) splitVideo(inputPath string, videoInfo *VideoInfo) ([]s
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
+	if err := p.runCommand(cmd); err != nil {
 		return nil, fmt.Errorf("splitting failed: %v, stderr: %s", err, stderr.String())
 	}
 
@@ -316,9 +316,9 @@ func (p *videoProcessor) splitVideo(inputPath string, videoInfo *VideoInfo) ([]s
 	return segments, nil
 }
 
-func (p *videoProcessor) encodeSingleSegment(inputPath, outputPath string, bitrate int) error {
-	cmd := exec.Command("ffmpeg",
-		"-i", inputPath,
+func (p *videoProcessor) encodeSingleSegment(ctx context.Context, inputPath, outputPath string, bitrate int, overlayArgs []string) error {
+	args := append([]string{"-i", inputPath}, overlayArgs...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", append(args,
 		"-c:v", "libsvtav1",
 		"-preset", "9",
 		"-crf", "32",
@@ -329,12 +329,12 @@ func (p *videoProcessor) encodeSingleSegment(inputPath, outputPath string, bitra
 		"-c:a", "aac",
 		"-b:a", "128k",
 		"-y", outputPath,
-	)
+	)...)
 
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
+	if err := p.runCommand(cmd); err != nil {
 		return fmt.Errorf("ffmpeg encoding failed: %v, stderr: %s", err, stderr.String())
 	}
 
@@ -373,7 +373,8 @@ func StitchSegments(segments []string, outputPath string) error {
 	return cmd.Run()
 }
 
-func (p *videoProcessor) encodeSegments(segments []string, bitrate int) ([]string, error) {
+// encodeSegments encodes the segments in parallel, burning in the overlays if there are any.
+func (p *videoProcessor) encodeSegments(ctx context.Context, segments []string, bitrate int, overlays *overlaySet) ([]string, error) {
 	type encodeResult struct {
 		index int
 		path  string
@@ -389,6 +390,14 @@ func (p *videoProcessor) encodeSegments(segments []string, bitrate int) ([]strin
 		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
+	var offsets []float64
+	if overlays != nil {
+		var err error
+		if offsets, err = segmentOffsets(ctx, segments); err != nil {
+			return nil, err
+		}
+	}
+
 	for i, segment := range segments {
 		wg.Add(1)
 		go func(idx int, inputPath string) {
@@ -396,8 +405,12 @@ func (p *videoProcessor) encodeSegments(segments []string, bitrate int) ([]strin
 			sem <- struct{}{}        // Acquire semaphore
 			defer func() { <-sem }() // Release semaphore
 
+			var overlayArgs []string
+			if overlays != nil {
+				overlayArgs = overlays.args(offsets[idx])
+			}
 			outputPath := filepath.Join(outputDir, fmt.Sprintf("encoded_%03d.mp4", idx))
-			err := p.encodeSingleSegment(inputPath, outputPath, bitrate)
+			err := p.encodeSingleSegment(ctx, inputPath, outputPath, bitrate, overlayArgs)
 
 			resultChan <- encodeResult{
 				index: idx,
@@ -425,13 +438,13 @@ func (p *videoProcessor) encodeSegments(segments []string, bitrate int) ([]strin
 	return encodedSegments, nil
 }
 
-func GetVideoInfo(inputPath string) (*VideoInfo, error) {
-	dir, err := os.Getwd()
+func GetVideoInfo(ctx context.Context, inputPath string) (*VideoInfo, error) {
+	// The scratch directory can be absolute, joining it to the working directory would break it
+	finalPath, err := filepath.Abs(inputPath)
 	if err != nil {
 		return nil, err
 	}
-	finalPath := filepath.Join(dir, inputPath)
-	cmd := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0",
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-select_streams", "v:0",
 		"-show_entries", "stream=width,height", "-of", "csv=p=0", finalPath)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -456,7 +469,7 @@ func GetVideoInfo(inputPath string) (*VideoInfo, error) {
 		return nil, fmt.Errorf("invalid height: %v", err)
 	}
 
-	cmd = exec.Command("ffprobe", "-v", "error", "-show_entries",
+	cmd = exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries",
 		"format=duration", "-of", "csv=p=0", finalPath)
 	durationOutput, err := cmd.CombinedOutput()
 	if err != nil {
@@ -513,7 +526,7 @@ func (p *videoProcessor) parseLogFile(filename, key string) (float64, error) {
 	return sum / float64(count), nil
 }
 
-func (p *videoProcessor) analyzeComplexity(inputPath string) (spatial, temporal float64, err error) {
+func (p *videoProcessor) analyzeComplexity(ctx context.Context, inputPath string) (spatial, temporal float64, err error) {
 	dir := filepath.Dir(inputPath)
 	spatialLog := filepath.Join(dir, "spatial.log")
 	temporalLog := filepath.Join(dir, "temporal.log")
@@ -522,7 +535,7 @@ func (p *videoProcessor) analyzeComplexity(inputPath string) (spatial, temporal
 	defer os.Remove(temporalLog)
 
 	// Analyze spatial complexity
-	cmdSpatial := exec.Command("ffmpeg",
+	cmdSpatial := exec.CommandContext(ctx, "ffmpeg",
 		"-i", inputPath,
 		"-vf", "signalstats=stat=tout,metadata=print:key=lavfi.signalstats.YAVG:file="+spatialLog,
 		"-f", "null", "-",
@@ -531,7 +544,7 @@ func (p *videoProcessor) analyzeComplexity(inputPath string) (spatial, temporal
 	var spatialStderr bytes.Buffer
 	cmdSpatial.Stderr = &spatialStderr
 
-	if err := cmdSpatial.Run(); err != nil {
+	if err := p.runCommand(cmdSpatial); err != nil {
 		return 0, 0, fmt.Errorf("spatial analysis failed: %v, stderr: %s", err, spatialStderr.String())
 	}
 
@@ -542,7 +555,7 @@ func (p *videoProcessor) analyzeComplexity(inputPath string) (spatial, temporal
 	spatial = math.Pow(yavg, 2)
 
 	// Analyze temporal complexity
-	cmdTemp := exec.Command("ffmpeg",
+	cmdTemp := exec.CommandContext(ctx, "ffmpeg",
 		"-i", inputPath,
 		"-vf", "signalstats=stat=tout,metadata=print:key=lavfi.signalstats.YDIF:file="+temporalLog,
 		"-f", "null", "-",
@@ -551,7 +564,7 @@ func (p *videoProcessor) analyzeComplexity(inputPath string) (spatial, temporal
 	var temporalStderr bytes.Buffer
 	cmdTemp.Stderr = &temporalStderr
 
-	if err := cmdTemp.Run(); err != nil {
+	if err := p.runCommand(cmdTemp); err != nil {
 		return 0, 0, fmt.Errorf("temporal analysis failed: %v, stderr: %s", err, temporalStderr.String())
 	}
 
@@ -563,9 +576,9 @@ func (p *videoProcessor) analyzeComplexity(inputPath string) (spatial, temporal
 	return spatial, temporal, nil
 }
 
-func (p *videoProcessor) analyzeBitrate(sampleSegment string, videoInfo *VideoInfo) (int, error) {
+func (p *videoProcessor) analyzeBitrate(ctx context.Context, sampleSegment string, videoInfo *VideoInfo) (int, error) {
 	// Analyze complexity
-	spatial, temporal, err := p.analyzeComplexity(sampleSegment)
+	spatial, temporal, err := p.analyzeComplexity(ctx, sampleSegment)
 	if err != nil {
 		return 0, fmt.Errorf("complexity analysis failed: %w", err)
 	}
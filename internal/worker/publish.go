@@ -0,0 +1,330 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/metrics"
+)
+
+const rollbackTimeout = 2 * time.Minute
+
+type outputFile struct {
+	path     string
+	key      string
+	size     int64
+	checksum string // hex SHA-256
+}
+
+// publication tracks the keys written for one output so a failed publish can be undone. Keys
+// that already existed, from an earlier encode of the video, aren't undone: removing them
+// would break the output that is live now.
+type publication struct {
+	mu       sync.Mutex
+	existing map[string]bool
+	uploaded []string
+	finals   []string
+}
+
+func (pub *publication) record(key string, final bool) {
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+	if pub.existing[key] {
+		return
+	}
+	if final {
+		pub.finals = append(pub.finals, key)
+	} else {
+		pub.uploaded = append(pub.uploaded, key)
+	}
+}
+
+// publishOutput uploads the packaged output so that players never see a partial stream.
+// Segments go first, then media playlists, and once every one of them is verified against its
+// checksum the master playlists and MPDs that make the stream discoverable are uploaded last.
+// Then commit records the output. If any step fails everything written so far is removed
+// again, manifests first.
+func (p *videoProcessor) publishOutput(ctx context.Context, outputPath, outputKey string, commit func() error) error {
+	if outputPath == "" || outputKey == "" {
+		return fmt.Errorf("output path and key cannot be empty")
+	}
+
+	outputKey = strings.TrimPrefix(outputKey, "/")
+	baseKey := strings.TrimSuffix(outputKey, filepath.Ext(outputKey))
+
+	segments, playlists, manifests, err := collectOutputFiles(outputPath, baseKey)
+	if err != nil {
+		return fmt.Errorf("failed to collect output files: %w", err)
+	}
+	if len(manifests) == 0 {
+		return fmt.Errorf("no master playlist or MPD found in %s", outputPath)
+	}
+
+	log.Printf("Publishing %d segments, %d media playlists and %d manifests under %s",
+		len(segments), len(playlists), len(manifests), baseKey)
+
+	existing, err := p.awsRepo.ListObjectsWithPrefix(ctx, p.cfg.S3.OutputBucket, strings.TrimPrefix(baseKey+"/", "/"))
+	if err != nil {
+		return fmt.Errorf("failed to list existing output: %w", err)
+	}
+	pub := &publication{existing: make(map[string]bool, len(existing))}
+	for _, object := range existing {
+		pub.existing[object.Key] = true
+	}
+	err = p.publishFiles(ctx, pub, segments, playlists, manifests)
+	if err == nil {
+		if err = commit(); err != nil {
+			err = fmt.Errorf("failed to record published output: %w", err)
+		}
+	}
+	if err != nil {
+		p.rollbackPublication(pub)
+		return err
+	}
+
+	log.Printf("Published output under %s", baseKey)
+	return nil
+}
+
+func (p *videoProcessor) publishFiles(ctx context.Context, pub *publication, segments, playlists, manifests []outputFile) error {
+	if err := p.uploadOutputFiles(ctx, pub, segments, false); err != nil {
+		return fmt.Errorf("failed to upload segments: %w", err)
+	}
+	if err := p.uploadOutputFiles(ctx, pub, playlists, false); err != nil {
+		return fmt.Errorf("failed to upload media playlists: %w", err)
+	}
+
+	staged := append(append([]outputFile{}, segments...), playlists...)
+	if err := p.verifyOutputFiles(ctx, staged); err != nil {
+		return fmt.Errorf("output verification failed: %w", err)
+	}
+
+	if err := p.uploadOutputFiles(ctx, pub, manifests, true); err != nil {
+		return fmt.Errorf("failed to upload manifests: %w", err)
+	}
+	return nil
+}
+
+func (p *videoProcessor) uploadOutputFiles(ctx context.Context, pub *publication, files []outputFile, final bool) error {
+	return forEachOutputFile(ctx, files, func(ctx context.Context, file outputFile) error {
+		// Recorded up front: an upload that fails client-side may still have landed
+		pub.record(file.key, final)
+		size, err := p.awsRepo.UploadFile(ctx, p.cfg.S3.OutputBucket, file.key, file.path, getContentType(file.path), file.checksum)
+		if err != nil {
+			return err
+		}
+		metrics.S3UploadedBytes.Add(float64(size))
+		return nil
+	})
+}
+
+// verifyOutputFiles checks that every uploaded object has the expected size and checksum. The
+// checksum is the one S3 computed over the object it stored. Multipart objects only carry a
+// checksum of their parts' checksums, those are read back and hashed instead.
+func (p *videoProcessor) verifyOutputFiles(ctx context.Context, files []outputFile) error {
+	return forEachOutputFile(ctx, files, func(ctx context.Context, file outputFile) error {
+		head, err := p.awsRepo.HeadObject(ctx, p.cfg.S3.OutputBucket, file.key)
+		if err != nil {
+			return err
+		}
+		if head.ContentLength == nil || *head.ContentLength != file.size {
+			return fmt.Errorf("%s: size mismatch", file.key)
+		}
+		var stored string
+		if head.ChecksumSHA256 != nil {
+			stored = *head.ChecksumSHA256
+		}
+		if stored == "" || strings.Contains(stored, "-") {
+			// No checksum over the whole object, "<checksum>-<parts>" for multipart ones
+			stored, err = p.objectChecksum(ctx, file.key)
+			if err != nil {
+				return err
+			}
+		} else if stored, err = hexChecksum(stored); err != nil {
+			return fmt.Errorf("%s: %w", file.key, err)
+		}
+		if stored != file.checksum {
+			return fmt.Errorf("%s: checksum mismatch", file.key)
+		}
+		return nil
+	})
+}
+
+// objectChecksum reads the object back and returns its hex SHA-256.
+func (p *videoProcessor) objectChecksum(ctx context.Context, key string) (string, error) {
+	object, err := p.awsRepo.GetObject(ctx, p.cfg.S3.OutputBucket, key)
+	if err != nil {
+		return "", err
+	}
+	defer object.Body.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, object.Body); err != nil {
+		return "", fmt.Errorf("failed to read back %s: %w", key, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hexChecksum turns the base64 checksum S3 reports into hex.
+func hexChecksum(checksum string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(checksum)
+	if err != nil {
+		return "", fmt.Errorf("invalid stored checksum %q", checksum)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// rollbackPublication removes everything a failed publish wrote. Manifests go first so the
+// stream stops being discoverable before its segments disappear.
+func (p *videoProcessor) rollbackPublication(pub *publication) {
+	// The job context is likely cancelled or failing, roll back on a fresh one
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	pub.mu.Lock()
+	finals, uploaded := pub.finals, pub.uploaded
+	pub.mu.Unlock()
+
+	log.Printf("Rolling back publish: removing %d manifests and %d files", len(finals), len(uploaded))
+	for _, keys := range [][]string{finals, uploaded} {
+		files := make([]outputFile, len(keys))
+		for i, key := range keys {
+			files[i] = outputFile{key: key}
+		}
+		err := forEachOutputFile(ctx, files, func(ctx context.Context, file outputFile) error {
+			if err := p.awsRepo.RemoveObject(ctx, p.cfg.S3.OutputBucket, file.key); err != nil {
+				log.Printf("Rollback: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Rollback interrupted: %v", err)
+			return
+		}
+	}
+}
+
+// forEachOutputFile runs fn for every file with at most maxConcurrentUploads at once. The first
+// error cancels the remaining files and is returned.
+func forEachOutputFile(ctx context.Context, files []outputFile, fn func(ctx context.Context, file outputFile) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	work := make(chan outputFile)
+	for i := 0; i < maxConcurrentUploads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range work {
+				if err := fn(ctx, file); err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("%s: %w", file.key, err)
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, file := range files {
+		select {
+		case work <- file:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// collectOutputFiles walks the packaged output, checksums every file and sorts it into
+// segments, media playlists and top-level manifests (master playlists and MPDs).
+func collectOutputFiles(outputPath, baseKey string) (segments, playlists, manifests []outputFile, err error) {
+	err = filepath.Walk(outputPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(outputPath, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		checksum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		file := outputFile{
+			path:     path,
+			key:      strings.TrimPrefix(baseKey+"/"+filepath.ToSlash(relPath), "/"),
+			size:     info.Size(),
+			checksum: checksum,
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".mpd":
+			manifests = append(manifests, file)
+		case ".m3u8":
+			master, err := isMasterPlaylist(path)
+			if err != nil {
+				return err
+			}
+			if master {
+				manifests = append(manifests, file)
+			} else {
+				playlists = append(playlists, file)
+			}
+		default:
+			segments = append(segments, file)
+		}
+		return nil
+	})
+	return segments, playlists, manifests, err
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to checksum %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// isMasterPlaylist reports whether an HLS playlist references variant streams rather than
+// media segments.
+func isMasterPlaylist(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return bytes.Contains(data, []byte("#EXT-X-STREAM-INF")), nil
+}
@@ -2,10 +2,14 @@ package worker
 
 import (
 	"context"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 )
 
 const (
 	VideoJobsQueueKey  = "video_jobs"
+	JobProgressKey     = models.JobProgressKey
+	defaultCgroupSlice = "video-worker.slice"
 	TempDir            = "tmp_segments"
 	MaxParallelJobs    = 4
 	MinSegmentDuration = 15
@@ -15,6 +19,13 @@ const (
 	FullHDBaseBitrate  = 1500
 )
 
+var (
+	// RequiredBinaries are the external tools a job shells out to.
+	RequiredBinaries = []string{"ffmpeg", "ffprobe", "mp4fragment", "mp4dash"}
+	// RequiredEncoders are the ffmpeg encoders used for renditions.
+	RequiredEncoders = []string{"libsvtav1", "aac"}
+)
+
 type VideoInfo struct {
 	Width    int
 	Height   int
@@ -22,5 +33,6 @@ type VideoInfo struct {
 }
 
 type VideoProcessor interface {
-	ProcessVideo(ctx context.Context, inputPath, outputPath string) error
+	// ProcessVideo encodes and publishes the job's video and describes the published output.
+	ProcessVideo(ctx context.Context, job *models.EncodeJob) (*models.PlaybackInfo, error)
 }
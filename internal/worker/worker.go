@@ -4,46 +4,131 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/drm"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/jobs"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/videofiles"
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/webhooks"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/logger"
+	"github.com/amankumarsingh77/cloud-video-encoder/pkg/metrics"
 	"github.com/amankumarsingh77/cloud-video-encoder/pkg/utils"
+	"github.com/google/uuid"
 )
 
-var ErrNoJob = errors.New("no job available")
+const (
+	defaultDrainTimeout = 30 * time.Second
+	requeueTimeout      = 10 * time.Second
+	// Partial sources of interrupted jobs are kept for resuming, but not forever
+	staleScratchAge = 24 * time.Hour
+
+	minClaimBackoff = time.Second
+	maxClaimBackoff = 30 * time.Second
+
+	// Job locks and the worker's heartbeat run out this long after the worker stops renewing
+	// them, its claimed jobs are then recovered by the other workers
+	jobLockTTL     = time.Minute
+	jobLockRefresh = jobLockTTL / 3
+
+	queueDepthInterval = 15 * time.Second
+)
+
+var (
+	ErrNoJob = errors.New("no job available")
+
+	errJobLockLost = errors.New("job lock was taken over by another worker")
+)
+
+// claim is a job the worker took off the queue. It stays on the worker's processing list until
+// it is acked with the receipt.
+type claim struct {
+	receipt string
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+}
 
 type Worker struct {
-	logger    logger.Logger
-	redisRepo videofiles.RedisRepository
-	awsRepo   videofiles.AWSRepository
-	cfg       *config.Config
-	wg        sync.WaitGroup
-	stopChan  chan struct{}
-	jobs      chan *models.EncodeJob
-	semaphore chan struct{} // For limiting concurrent tasks per worker
+	logger     logger.Logger
+	redisRepo  videofiles.RedisRepository
+	awsRepo    videofiles.AWSRepository
+	keyRepo    drm.Repository
+	jobRepo    jobs.Repository
+	videoRepo  videofiles.Repository
+	webhooks   webhooks.Dispatcher
+	cfg        *config.Config
+	wg         sync.WaitGroup
+	jobsWg     sync.WaitGroup // Tracks in-flight job goroutines
+	stopChan   chan struct{}
+	semaphore  chan struct{} // For limiting concurrent tasks per worker
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
+	admission  *admissionController
+	scratchDir string
+	hostname   string
+	consumer   string      // Names the worker's processing list and the job locks it holds
+	held       sync.Map    // Job ID to the *claim of jobs claimed and not acked yet
+	subscribed atomic.Bool // Whether the last claim from the queue reached Redis
+	aliveDone  chan struct{}
 }
 
-func NewWorker(cfg *config.Config, logger logger.Logger, redisRepo videofiles.RedisRepository, awsRepo videofiles.AWSRepository) *Worker {
+func NewWorker(cfg *config.Config, logger logger.Logger, redisRepo videofiles.RedisRepository, awsRepo videofiles.AWSRepository, keyRepo drm.Repository, jobRepo jobs.Repository, videoRepo videofiles.Repository, webhookDispatcher webhooks.Dispatcher) *Worker {
+	scratchDir := cfg.Worker.ScratchDir
+	if scratchDir == "" {
+		scratchDir = TempDir
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
 	return &Worker{
-		logger:    logger,
-		redisRepo: redisRepo,
-		awsRepo:   awsRepo,
-		cfg:       cfg,
-		stopChan:  make(chan struct{}),
-		jobs:      make(chan *models.EncodeJob, 100),           // Buffer size for job channel
-		semaphore: make(chan struct{}, cfg.Worker.WorkerCount), // Limit concurrent tasks
+		logger:     logger,
+		redisRepo:  redisRepo,
+		awsRepo:    awsRepo,
+		keyRepo:    keyRepo,
+		jobRepo:    jobRepo,
+		videoRepo:  videoRepo,
+		webhooks:   webhookDispatcher,
+		cfg:        cfg,
+		stopChan:   make(chan struct{}),
+		semaphore:  make(chan struct{}, cfg.Worker.WorkerCount), // Limit concurrent tasks
+		admission:  newAdmissionController(&cfg.Worker, logger, scratchDir),
+		scratchDir: scratchDir,
+		hostname:   hostname,
+		consumer:   fmt.Sprintf("%s-%s", hostname, uuid.NewString()[:8]),
+		aliveDone:  make(chan struct{}),
 	}
 }
 
 func (w *Worker) Start(ctx context.Context) error {
 	w.logger.Info("Starting worker pool")
 
-	// Start the Redis subscriber in a separate goroutine
+	if err := os.MkdirAll(w.scratchDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	w.pruneScratch()
+
+	// Jobs get their own context so a drain can cancel them without tearing down the caller's context
+	w.jobsCtx, w.cancelJobs = context.WithCancel(ctx)
+
+	// The heartbeat has to exist before the first claim, or other workers take the locks over
+	w.renewJobs()
+	go w.keepJobsAlive()
+
+	w.wg.Add(1)
+	go w.reportQueueDepth(ctx)
+
+	// Keep resource samples fresh for admission decisions
 	w.wg.Add(1)
-	go w.subscribeToJobs(ctx)
+	go func() {
+		defer w.wg.Done()
+		w.admission.run(ctx, w.stopChan)
+	}()
 
 	// Start worker goroutines
 	for i := 0; i < w.cfg.Worker.WorkerCount; i++ {
@@ -56,47 +141,142 @@ func (w *Worker) Start(ctx context.Context) error {
 	return nil
 }
 
+// Stop drains the worker pool. It stops taking new jobs, hands deferred jobs back to the queue
+// and waits for in-flight jobs up to the configured drain timeout. Jobs still running after
+// the deadline are cancelled, checkpointed and requeued before Stop returns.
 func (w *Worker) Stop() {
 	close(w.stopChan)
 	w.wg.Wait()
+
+	drainTimeout := defaultDrainTimeout
+	if w.cfg.Worker.DrainTimeout > 0 {
+		drainTimeout = time.Duration(w.cfg.Worker.DrainTimeout) * time.Second
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.jobsWg.Wait()
+		close(done)
+	}()
+
+	w.logger.Infof("Draining in-flight jobs (timeout %s)", drainTimeout)
+	select {
+	case <-done:
+		w.logger.Info("All in-flight jobs finished")
+	case <-time.After(drainTimeout):
+		w.logger.Warnf("Drain timeout of %s exceeded, cancelling in-flight jobs", drainTimeout)
+		w.cancelJobs()
+		<-done
+	}
+
+	w.cancelJobs()
+	<-w.aliveDone
 	w.logger.Info("Worker pool stopped")
 }
 
-func (w *Worker) subscribeToJobs(ctx context.Context) {
-	defer w.wg.Done()
+func (w *Worker) isStopping() bool {
+	select {
+	case <-w.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// keepJobsAlive renews the worker's heartbeat and the locks of its jobs until the jobs are
+// cancelled, so that running and deferred jobs stay with this worker.
+func (w *Worker) keepJobsAlive() {
+	defer close(w.aliveDone)
+
+	ticker := time.NewTicker(jobLockRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.jobsCtx.Done():
+			return
+		case <-ticker.C:
+			w.renewJobs()
+		}
+	}
+}
+
+// renewJobs renews the heartbeat and the job locks, stops jobs whose lock another worker took
+// over and returns the jobs of workers that died to the queue.
+func (w *Worker) renewJobs() {
+	ctx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
 
-	jobChan, err := w.redisRepo.SubscribeToJobs(ctx, VideoJobsQueueKey)
+	var jobIDs []string
+	w.held.Range(func(jobID, _ any) bool {
+		jobIDs = append(jobIDs, jobID.(string))
+		return true
+	})
+	lost, err := w.redisRepo.KeepJobsAlive(ctx, VideoJobsQueueKey, w.consumer, jobIDs, jobLockTTL)
 	if err != nil {
-		w.logger.Errorf("Failed to subscribe to jobs: %v", err)
-		return
+		w.logger.Warnf("Failed to renew job locks: %v", err)
+	}
+	for _, jobID := range lost {
+		if c, ok := w.held.Load(jobID); ok {
+			w.logger.Warnf("Job %s was taken over by another worker, stopping it here", jobID)
+			c.(*claim).cancel(errJobLockLost)
+		}
 	}
 
+	recovered, err := w.redisRepo.RecoverJobs(ctx, VideoJobsQueueKey)
+	if err != nil {
+		w.logger.Warnf("Failed to recover jobs of stopped workers: %v", err)
+	} else if recovered > 0 {
+		w.logger.Infof("Returned %d jobs of stopped workers to the queue", recovered)
+	}
+}
+
+// reportQueueDepth samples the length of the shared Redis queue until the worker stops.
+func (w *Worker) reportQueueDepth(ctx context.Context) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(queueDepthInterval)
+	defer ticker.Stop()
 	for {
+		depth, err := w.redisRepo.QueueLength(ctx, VideoJobsQueueKey)
+		if err != nil {
+			w.logger.Warnf("Failed to read job queue length: %v", err)
+		} else {
+			metrics.QueueDepth.Set(float64(depth))
+		}
+
 		select {
 		case <-ctx.Done():
 			return
 		case <-w.stopChan:
 			return
-		case job := <-jobChan:
-			if job != nil {
-				select {
-				case w.jobs <- job:
-					// Job successfully queued
-				case <-ctx.Done():
-					return
-				case <-w.stopChan:
-					return
-				}
-			}
+		case <-ticker.C:
 		}
 	}
 }
 
+// CheckSubscription reports whether the worker reaches the queue and is taking jobs.
+func (w *Worker) CheckSubscription(ctx context.Context) error {
+	if w.isStopping() {
+		return errors.New("worker is draining")
+	}
+	if !w.subscribed.Load() {
+		return errors.New("can't claim jobs from the job queue")
+	}
+	return nil
+}
+
+// ScratchDir returns the directory jobs are processed in.
+func (w *Worker) ScratchDir() string {
+	return w.scratchDir
+}
+
 func (w *Worker) runWorker(ctx context.Context, workerID int) {
 	defer w.wg.Done()
 	w.logger.Infof("Worker %d started", workerID)
 
+	attempt := 0
 	for {
+		// Only claim a job with a slot free to run it, the rest stay queued for other workers
 		select {
 		case <-ctx.Done():
 			w.logger.Infof("Worker %d received context cancellation", workerID)
@@ -104,48 +284,291 @@ func (w *Worker) runWorker(ctx context.Context, workerID int) {
 		case <-w.stopChan:
 			w.logger.Infof("Worker %d received stop signal", workerID)
 			return
-		case job := <-w.jobs:
-			// Acquire semaphore slot
+		case w.semaphore <- struct{}{}:
+		}
+
+		job, receipt, err := w.redisRepo.ClaimJob(ctx, VideoJobsQueueKey, w.consumer, jobLockTTL)
+		if err != nil {
+			<-w.semaphore
+			w.subscribed.Store(false)
+			delay := utils.Backoff(attempt, minClaimBackoff, maxClaimBackoff)
+			w.logger.Errorf("Worker %d failed to claim a job, retrying in %s: %v", workerID, delay, err)
+			attempt++
+			select {
+			case <-ctx.Done():
+			case <-w.stopChan:
+			case <-time.After(delay):
+			}
+			continue
+		}
+		attempt = 0
+		w.subscribed.Store(true)
+		if job == nil {
+			<-w.semaphore
+			continue
+		}
+
+		c := &claim{receipt: receipt}
+		c.ctx, c.cancel = context.WithCancelCause(w.jobsCtx)
+		w.held.Store(job.JobID, c)
+		if w.isStopping() {
+			// Claimed just as the worker started draining
+			<-w.semaphore
+			w.returnUnstartedJob(job)
+			continue
+		}
+		w.startJob(workerID, job, c)
+	}
+}
+
+// startJob runs a claimed job if admission lets it, and defers it otherwise. The caller holds a
+// semaphore slot, which the job keeps until it finishes.
+func (w *Worker) startJob(workerID int, job *models.EncodeJob, c *claim) {
+	switch verdict, reason := w.admission.admit(job); verdict {
+	case verdictReject:
+		<-w.semaphore
+		w.admission.forget(job.JobID)
+		w.logger.Errorf("Worker %d: rejecting job %s: %s", workerID, job.JobID, reason)
+		w.failJob(job, errors.New(reason))
+		w.finishJob(job, c)
+		return
+	case verdictDefer:
+		<-w.semaphore
+		delay, ok := w.admission.nextBackoff(job.JobID)
+		if !ok {
+			w.admission.forget(job.JobID)
+			w.logger.Infof("Worker %d: handing job %s back to the queue after %d deferrals: %s",
+				workerID, job.JobID, maxDeferrals, reason)
+			w.returnUnstartedJob(job)
+			return
+		}
+		w.logger.Infof("Worker %d: deferring job %s for %s: %s", workerID, job.JobID, delay, reason)
+		w.deferJob(workerID, job, c, delay)
+		return
+	}
+
+	// Process the job in a separate goroutine
+	w.jobsWg.Add(1)
+	go func() {
+		defer w.jobsWg.Done()
+		defer func() { <-w.semaphore }() // Release semaphore slot
+		defer w.admission.release(job.JobID)
+		defer w.finishJob(job, c)
+		if err := w.processJob(c.ctx, workerID, job); err != nil {
+			w.logger.Errorf("Worker %d failed to process job %s: %v", workerID, job.JobID, err)
+		}
+	}()
+}
+
+// deferJob tries the job again after the delay, once a slot is free. If the worker stops in the
+// meantime the job is handed back to the queue instead.
+func (w *Worker) deferJob(workerID int, job *models.EncodeJob, c *claim, delay time.Duration) {
+	w.wg.Add(1)
+	metrics.DeferredJobs.Inc()
+	go func() {
+		defer w.wg.Done()
+		defer metrics.DeferredJobs.Dec()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
 			select {
 			case w.semaphore <- struct{}{}:
-				// Process the job in a separate goroutine
-				go func() {
-					defer func() { <-w.semaphore }() // Release semaphore slot
-					if err := w.processJob(ctx, workerID, job); err != nil {
-						w.logger.Errorf("Worker %d failed to process job %s: %v", workerID, job.JobID, err)
-					}
-				}()
-			default:
-				// If we can't acquire semaphore, put job back in channel
-				select {
-				case w.jobs <- job:
-				default:
-					w.logger.Warnf("Worker %d: Failed to requeue job %s, channel full", workerID, job.JobID)
+				if !w.isStopping() {
+					w.startJob(workerID, job, c)
+					return
 				}
+				<-w.semaphore
+			case <-c.ctx.Done():
+			case <-w.stopChan:
 			}
+		case <-c.ctx.Done():
+		case <-w.stopChan:
+		}
+
+		w.admission.forget(job.JobID)
+		if errors.Is(context.Cause(c.ctx), errJobLockLost) {
+			w.finishJob(job, c)
+			return
 		}
+		w.returnUnstartedJob(job)
+	}()
+}
+
+// returnUnstartedJob hands a claimed job that never started back to the queue.
+func (w *Worker) returnUnstartedJob(job *models.EncodeJob) {
+	if err := w.requeueJob(job); err != nil {
+		w.logger.Errorf("Failed to requeue job %s: %v", job.JobID, err)
+	}
+}
+
+// finishJob takes a job the worker is done with off its processing list and releases its lock.
+// It does nothing when the claim was already finished, by a requeue for instance.
+func (w *Worker) finishJob(job *models.EncodeJob, c *claim) {
+	if !w.held.CompareAndDelete(job.JobID, c) {
+		return
+	}
+	c.cancel(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
+	if err := w.redisRepo.AckJob(ctx, VideoJobsQueueKey, w.consumer, c.receipt); err != nil {
+		w.logger.Errorf("Failed to ack job %s: %v", job.JobID, err)
+	}
+	if err := w.redisRepo.ReleaseJobLock(ctx, job.JobID, w.consumer); err != nil {
+		w.logger.Errorf("Failed to release lock of job %s: %v", job.JobID, err)
 	}
 }
 
 func (w *Worker) processJob(ctx context.Context, workerID int, job *models.EncodeJob) error {
 	w.logger.Infof("Worker %d processing job: %s", workerID, job.VideoID)
+	if !job.CreatedAt.IsZero() {
+		metrics.JobQueueWait.Observe(time.Since(job.CreatedAt).Seconds())
+	}
 
-	// Check CPU usage before processing
-	canAcceptJob, usage := utils.CheckCPUUsage(w.cfg.Worker.MaxCPUUsage)
-	if !canAcceptJob {
-		w.logger.Infof("Worker %d: CPU usage too high (%.2f%%), requeueing job", workerID, usage)
-		select {
-		case w.jobs <- job:
+	job.Status = models.JobStatusProcessing
+	job.WorkerID = fmt.Sprintf("%s/%d", w.hostname, workerID)
+	if job.StartedAt == nil {
+		now := time.Now()
+		job.StartedAt = &now
+	}
+	w.recordJobState(job)
+	w.notify(job, models.EventJobStarted)
+
+	// The playback info is saved once the output is published, until then the info of the
+	// output that is live stays. If saving fails the publish is rolled back.
+	processor := NewVideoProcessor(w.cfg, w.awsRepo, w.keyRepo, filepath.Join(w.scratchDir, job.JobID), func(job *models.EncodeJob) {
+		w.recordJobState(job)
+		w.notify(job, models.EventJobProgress)
+	}, w.savePlaybackInfo)
+	if _, err := processor.ProcessVideo(ctx, job); err != nil {
+		if errors.Is(context.Cause(ctx), errJobLockLost) {
+			// The worker that took the job over records its state from here on
+			w.logger.Warnf("Worker %d: abandoning job %s, another worker took it over", workerID, job.JobID)
 			return nil
-		default:
-			return fmt.Errorf("failed to requeue job, channel full")
 		}
+		if errors.Is(ctx.Err(), context.Canceled) && w.isStopping() {
+			w.logger.Warnf("Worker %d: job %s interrupted during %s stage, requeueing", workerID, job.JobID, job.Stage)
+			metrics.JobsTotal.WithLabelValues("requeued").Inc()
+			return w.requeueJob(job)
+		}
+		w.failJob(job, err)
+		return fmt.Errorf("failed to process video: %w", err)
 	}
 
-	processor := NewVideoProcessor(w.cfg, w.awsRepo)
-	if err := processor.ProcessVideo(ctx, job.InputS3Key, job.OutputS3Key); err != nil {
-		return fmt.Errorf("failed to process video: %w", err)
+	metrics.JobsTotal.WithLabelValues(string(models.JobStatusCompleted)).Inc()
+	job.Status = models.JobStatusCompleted
+	job.Progress = 100
+	now := time.Now()
+	job.CompletedAt = &now
+	w.recordJobState(job)
+	w.notify(job, models.EventJobCompleted)
+	return nil
+}
+
+// failJob records the job as failed with err and tells its owner.
+func (w *Worker) failJob(job *models.EncodeJob, err error) {
+	metrics.JobsTotal.WithLabelValues(string(models.JobStatusFailed)).Inc()
+	job.Status = models.JobStatusFailed
+	job.ErrorMessage = err.Error()
+	now := time.Now()
+	job.CompletedAt = &now
+	w.recordJobState(job)
+	w.notify(job, models.EventJobFailed)
+}
+
+// recordJobState stores the job's status, stage and progress, publishes the change to clients
+// following the job and saves it for the job query API.
+func (w *Worker) recordJobState(job *models.EncodeJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
+	if err := w.redisRepo.CheckpointJob(ctx, JobProgressKey, job); err != nil {
+		w.logger.Errorf("Failed to record state of job %s: %v", job.JobID, err)
+	}
+	if err := w.jobRepo.SaveJob(ctx, job); err != nil {
+		w.logger.Errorf("Failed to save state of job %s: %v", job.JobID, err)
+	}
+}
+
+// savePlaybackInfo stores the playback info of a published job and marks its video completed,
+// both in one transaction.
+func (w *Worker) savePlaybackInfo(info *models.PlaybackInfo) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
+	if err := w.videoRepo.SavePlaybackInfo(ctx, info); err != nil {
+		return fmt.Errorf("failed to save playback info: %w", err)
+	}
+	return nil
+}
+
+// notify queues a job webhook event for the job owner. Failures are only logged, a webhook
+// problem must never fail the job.
+func (w *Worker) notify(job *models.EncodeJob, event models.WebhookEvent) {
+	userID, err := uuid.Parse(job.UserID)
+	if err != nil {
+		return
+	}
+	// The job context may be cancelled by now, the event still has to go out
+	ctx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
+	if err := w.webhooks.Dispatch(ctx, userID, event, models.NewJobEvent(job)); err != nil {
+		w.logger.Errorf("Failed to dispatch %s webhook for job %s: %v", event, job.JobID, err)
+	}
+}
+
+// pruneScratch removes job directories left behind by jobs that were interrupted long ago.
+func (w *Worker) pruneScratch() {
+	entries, err := os.ReadDir(w.scratchDir)
+	if err != nil {
+		w.logger.Warnf("Failed to read scratch directory: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < staleScratchAge {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(w.scratchDir, entry.Name())); err != nil {
+			w.logger.Warnf("Failed to remove stale scratch entry %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// requeueJob checkpoints the job state and puts the job back on the queue list so another worker
+// can pick it up, also when none is running right now. Its claim is released first, so a worker
+// claiming the job again doesn't find it locked. It uses its own context because the job
+// context is usually cancelled.
+func (w *Worker) requeueJob(job *models.EncodeJob) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
+
+	job.Status = models.JobStatusQueued
+	job.Attempts++
+	if err := w.redisRepo.CheckpointJob(ctx, JobProgressKey, job); err != nil {
+		return fmt.Errorf("failed to checkpoint job %s: %w", job.JobID, err)
+	}
+	if err := w.jobRepo.SaveJob(ctx, job); err != nil {
+		w.logger.Errorf("Failed to save state of job %s: %v", job.JobID, err)
+	}
+
+	held, ok := w.held.LoadAndDelete(job.JobID)
+	if !ok {
+		return fmt.Errorf("job %s isn't claimed by this worker", job.JobID)
+	}
+	c := held.(*claim)
+	c.cancel(nil)
+	if err := w.redisRepo.ReleaseJobLock(ctx, job.JobID, w.consumer); err != nil {
+		return fmt.Errorf("failed to release lock for job %s: %w", job.JobID, err)
+	}
+	if err := w.redisRepo.EnqueueJob(ctx, VideoJobsQueueKey, job); err != nil {
+		// The claim stays on the processing list and is recovered once this worker stops
+		return fmt.Errorf("failed to requeue job %s: %w", job.JobID, err)
+	}
+	if err := w.redisRepo.AckJob(ctx, VideoJobsQueueKey, w.consumer, c.receipt); err != nil {
+		w.logger.Errorf("Failed to ack requeued job %s: %v", job.JobID, err)
 	}
 
+	w.logger.Infof("Job %s checkpointed at %s stage and returned to the queue", job.JobID, job.Stage)
 	return nil
 }
@@ -0,0 +1,226 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/shirou/gopsutil/disk"
+)
+
+const (
+	defaultCheckTimeout = 5 * time.Second
+	// The toolchain doesn't change while the process runs, so its probe result is reused for a while
+	toolCheckTTL = 5 * time.Minute
+)
+
+// Check reports whether a single dependency is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs a set of readiness checks. Liveness only says the process can serve HTTP,
+// readiness says every dependency it needs to do useful work is reachable.
+type Checker struct {
+	timeout time.Duration
+	checks  []namedCheck
+}
+
+type Result struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a readiness check. Checks must be added before the checker is served.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Ready runs all checks concurrently, each bounded by the checker timeout.
+func (c *Checker) Ready(ctx context.Context) (bool, Result) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	ready := true
+	results := make(map[string]string, len(c.checks))
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+			status := "ok"
+			if err := nc.check(ctx); err != nil {
+				status = err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			results[nc.name] = status
+			if status != "ok" {
+				ready = false
+			}
+		}(nc)
+	}
+	wg.Wait()
+
+	result := Result{Status: "ready", Checks: results}
+	if !ready {
+		result.Status = "not ready"
+	}
+	return ready, result
+}
+
+// LiveHandler always answers OK while the process is able to serve requests.
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Result{Status: "alive"})
+	})
+}
+
+// ReadyHandler answers 200 when all checks pass and 503 otherwise.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready, result := c.Ready(r.Context())
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, result)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func Postgres(db *sqlx.DB) Check {
+	return func(ctx context.Context) error {
+		if db == nil {
+			return fmt.Errorf("postgres not connected")
+		}
+		if err := db.PingContext(ctx); err != nil {
+			return fmt.Errorf("postgres ping failed: %w", err)
+		}
+		return nil
+	}
+}
+
+func Redis(client *redis.Client) Check {
+	return func(ctx context.Context) error {
+		if client == nil {
+			return fmt.Errorf("redis not connected")
+		}
+		if err := client.Ping(ctx).Err(); err != nil {
+			return fmt.Errorf("redis ping failed: %w", err)
+		}
+		return nil
+	}
+}
+
+// S3Buckets checks that every bucket exists and the credentials can reach it.
+func S3Buckets(client *s3.Client, buckets ...string) Check {
+	return func(ctx context.Context) error {
+		if client == nil {
+			return fmt.Errorf("s3 client not initialized")
+		}
+		for _, bucket := range buckets {
+			if bucket == "" {
+				continue
+			}
+			if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &bucket}); err != nil {
+				return fmt.Errorf("bucket %s unreachable: %w", bucket, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Tools checks that the binaries are on PATH. If ffmpeg is one of them, it also checks that it
+// was built with the given encoders.
+func Tools(binaries []string, encoders []string) Check {
+	var (
+		mu        sync.Mutex
+		checkedAt time.Time
+		lastErr   error
+	)
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !checkedAt.IsZero() && time.Since(checkedAt) < toolCheckTTL {
+			return lastErr
+		}
+		lastErr = checkTools(ctx, binaries, encoders)
+		checkedAt = time.Now()
+		return lastErr
+	}
+}
+
+func checkTools(ctx context.Context, binaries []string, encoders []string) error {
+	for _, binary := range binaries {
+		if _, err := exec.LookPath(binary); err != nil {
+			return fmt.Errorf("%s not found on PATH", binary)
+		}
+	}
+	if len(encoders) == 0 {
+		return nil
+	}
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list ffmpeg encoders: %w", err)
+	}
+	available := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		// Lines look like " V....D libsvtav1   SVT-AV1(Scalable Video Technology for AV1) encoder"
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			available[fields[1]] = true
+		}
+	}
+	var missing []string
+	for _, encoder := range encoders {
+		if !available[encoder] {
+			missing = append(missing, encoder)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("ffmpeg is missing encoders: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// DiskSpace checks that the filesystem holding dir has at least minFreeMB free.
+func DiskSpace(dir string, minFreeMB int) Check {
+	return func(ctx context.Context) error {
+		usage, err := disk.UsageWithContext(ctx, dir)
+		if err != nil {
+			return fmt.Errorf("failed to read disk usage of %s: %w", dir, err)
+		}
+		if usage.Free < uint64(minFreeMB)<<20 {
+			return fmt.Errorf("only %d MB free in %s, need %d MB", usage.Free>>20, dir, minFreeMB)
+		}
+		return nil
+	}
+}
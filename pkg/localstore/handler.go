@@ -0,0 +1,116 @@
+package localstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Handler serves the signed URLs of a store: GET and HEAD of objects, PUT of objects and of
+// multipart upload parts.
+type Handler struct {
+	store  *Store
+	signer *Signer
+}
+
+func NewHandler(store *Store, signer *Signer) *Handler {
+	return &Handler{store: store, signer: signer}
+}
+
+// MapRoutes registers the handler under RoutePrefix, which group must be mounted at.
+func (h *Handler) MapRoutes(group *echo.Group) {
+	group.GET("/:bucket/*", h.Get())
+	group.HEAD("/:bucket/*", h.Get())
+	group.PUT("/:bucket/*", h.Put())
+}
+
+func (h *Handler) Get() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req, err := h.verify(c)
+		if err != nil {
+			return signatureError(c, err)
+		}
+		f, meta, err := h.store.Open(req.Bucket, req.Key)
+		if err != nil {
+			return storeError(c, err)
+		}
+		defer f.Close()
+		header := c.Response().Header()
+		header.Set("ETag", `"`+meta.ETag+`"`)
+		if meta.ContentType != "" {
+			header.Set(echo.HeaderContentType, meta.ContentType)
+		}
+		// ServeContent handles ranges and conditional requests like S3 does
+		http.ServeContent(c.Response(), c.Request(), "", meta.LastModified, f)
+		return nil
+	}
+}
+
+func (h *Handler) Put() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req, err := h.verify(c)
+		if err != nil {
+			return signatureError(c, err)
+		}
+		r := c.Request()
+		if req.ContentType != "" && r.Header.Get(echo.HeaderContentType) != req.ContentType {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Content-Type does not match the signed URL"})
+		}
+		if req.ContentLength >= 0 && r.ContentLength != req.ContentLength {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Content-Length does not match the signed URL"})
+		}
+		checksum := req.Checksum
+		if checksum == "" {
+			// Not signed in, the client may still send one for the store to check
+			checksum = r.Header.Get("X-Amz-Checksum-Sha256")
+		}
+		body := io.LimitReader(r.Body, max(r.ContentLength, 0))
+		if r.ContentLength < 0 {
+			body = r.Body
+		}
+
+		var etag string
+		if req.UploadID != "" {
+			part, err := h.store.WritePart(req.Bucket, req.Key, req.UploadID, req.PartNumber, body, checksum)
+			if err != nil {
+				return storeError(c, err)
+			}
+			etag = part.ETag
+		} else {
+			meta, err := h.store.Put(req.Bucket, req.Key, body, r.Header.Get(echo.HeaderContentType), checksum, nil)
+			if err != nil {
+				return storeError(c, err)
+			}
+			etag = meta.ETag
+		}
+		// Multipart clients read the ETag of every part from this header
+		c.Response().Header().Set("ETag", `"`+etag+`"`)
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+func (h *Handler) verify(c echo.Context) (*SignedRequest, error) {
+	// The decoded request path, route parameters may still be escaped
+	bucket := c.Param("bucket")
+	key := strings.TrimPrefix(c.Request().URL.Path, RoutePrefix+"/"+bucket+"/")
+	return h.signer.Verify(c.Request().Method, bucket, key, c.QueryParams())
+}
+
+func signatureError(c echo.Context, err error) error {
+	return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+}
+
+func storeError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrUploadNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrInvalidName), errors.Is(err, ErrChecksumMismatch), errors.Is(err, ErrInvalidPart):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("storage error: %v", err)})
+	}
+}
@@ -0,0 +1,152 @@
+package localstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RoutePrefix is the path the signed URLs are served under.
+const RoutePrefix = "/api/v1/storage"
+
+// Query parameters of a signed URL. Everything but the signature is covered by it.
+const (
+	paramMethod        = "X-Method"
+	paramExpires       = "X-Expires"
+	paramContentType   = "X-Content-Type"
+	paramContentLength = "X-Content-Length"
+	paramChecksum      = "X-Checksum-Sha256"
+	paramUploadID      = "uploadId"
+	paramPartNumber    = "partNumber"
+	paramSignature     = "X-Signature"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("url expired")
+)
+
+// SignedRequest is what a signed URL allows.
+type SignedRequest struct {
+	Method        string
+	Bucket        string
+	Key           string
+	Expires       time.Time
+	ContentType   string // PUT only, empty to allow any
+	ContentLength int64  // PUT only, -1 to allow any
+	Checksum      string // Base64 SHA-256 the body must have, PUT only
+	UploadID      string // Set with PartNumber for the PUT of a multipart upload part
+	PartNumber    int32
+}
+
+// Signer creates and checks the HMAC-signed URLs that stand in for S3 presigned URLs.
+type Signer struct {
+	key     []byte
+	baseURL string
+}
+
+// NewSigner signs URLs with key. baseURL is where clients reach the server, e.g.
+// "http://localhost:5000".
+func NewSigner(key, baseURL string) (*Signer, error) {
+	if key == "" {
+		return nil, errors.New("local storage signing key is not set")
+	}
+	return &Signer{key: []byte(key), baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (s *Signer) Sign(req *SignedRequest) string {
+	query := url.Values{}
+	query.Set(paramMethod, req.Method)
+	query.Set(paramExpires, strconv.FormatInt(req.Expires.Unix(), 10))
+	if req.ContentType != "" {
+		query.Set(paramContentType, req.ContentType)
+	}
+	if req.ContentLength >= 0 && req.Method == http.MethodPut {
+		query.Set(paramContentLength, strconv.FormatInt(req.ContentLength, 10))
+	}
+	if req.Checksum != "" {
+		query.Set(paramChecksum, req.Checksum)
+	}
+	if req.UploadID != "" {
+		query.Set(paramUploadID, req.UploadID)
+		query.Set(paramPartNumber, strconv.Itoa(int(req.PartNumber)))
+	}
+	query.Set(paramSignature, s.signature(req.Bucket, req.Key, query))
+	return fmt.Sprintf("%s%s/%s/%s?%s", s.baseURL, RoutePrefix, req.Bucket, escapeKey(req.Key), query.Encode())
+}
+
+// Verify checks the signature and expiry of a request for bucket and key and returns what the
+// URL allows.
+func (s *Signer) Verify(method, bucket, key string, query url.Values) (*SignedRequest, error) {
+	given, err := hex.DecodeString(query.Get(paramSignature))
+	if err != nil || len(given) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	signed := url.Values{}
+	for name, values := range query {
+		if name != paramSignature {
+			signed[name] = values
+		}
+	}
+	expected, _ := hex.DecodeString(s.signature(bucket, key, signed))
+	if !hmac.Equal(given, expected) {
+		return nil, ErrInvalidSignature
+	}
+
+	req := &SignedRequest{
+		Method:        query.Get(paramMethod),
+		Bucket:        bucket,
+		Key:           key,
+		ContentType:   query.Get(paramContentType),
+		ContentLength: -1,
+		Checksum:      query.Get(paramChecksum),
+		UploadID:      query.Get(paramUploadID),
+	}
+	// A URL signed for GET also serves HEAD, like in S3
+	if req.Method != method && !(req.Method == http.MethodGet && method == http.MethodHead) {
+		return nil, ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(query.Get(paramExpires), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	req.Expires = time.Unix(expires, 0)
+	if time.Now().After(req.Expires) {
+		return nil, ErrExpired
+	}
+	if v := query.Get(paramContentLength); v != "" {
+		if req.ContentLength, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, ErrInvalidSignature
+		}
+	}
+	if req.UploadID != "" {
+		partNumber, err := strconv.ParseInt(query.Get(paramPartNumber), 10, 32)
+		if err != nil {
+			return nil, ErrInvalidSignature
+		}
+		req.PartNumber = int32(partNumber)
+	}
+	return req, nil
+}
+
+// signature covers the bucket, key and every parameter; url.Values.Encode sorts them.
+func (s *Signer) signature(bucket, key string, query url.Values) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(bucket + "\n" + key + "\n" + query.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,152 @@
+package localstore
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedQuery signs req and returns the bucket, key and query of the URL.
+func signedQuery(t *testing.T, s *Signer, req *SignedRequest) (string, string, url.Values) {
+	t.Helper()
+	u, err := url.Parse(s.Sign(req))
+	if err != nil {
+		t.Fatalf("Sign() returned an invalid URL: %v", err)
+	}
+	if u.Scheme != "http" || u.Host != "localhost:5000" {
+		t.Fatalf("Sign() = %s, not under the base URL", u)
+	}
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(u.Path, RoutePrefix+"/"), "/")
+	if !ok {
+		t.Fatalf("Sign() path %s has no bucket and key", u.Path)
+	}
+	return bucket, key, u.Query()
+}
+
+func TestNewSigner(t *testing.T) {
+	if _, err := NewSigner("", "http://localhost:5000"); err == nil {
+		t.Error("NewSigner() with an empty key succeeded")
+	}
+}
+
+func TestSignerRoundTrip(t *testing.T) {
+	s, err := NewSigner("secret", "http://localhost:5000/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name   string
+		req    *SignedRequest
+		method string
+	}{
+		{"get", &SignedRequest{Method: http.MethodGet, Bucket: "out", Key: "videos/a b/master.m3u8", Expires: expires, ContentLength: -1}, http.MethodGet},
+		{"head with a get url", &SignedRequest{Method: http.MethodGet, Bucket: "out", Key: "videos/seg.m4s", Expires: expires, ContentLength: -1}, http.MethodHead},
+		{"put with constraints", &SignedRequest{
+			Method: http.MethodPut, Bucket: "in", Key: "uploads/u/video.mp4", Expires: expires,
+			ContentType: "video/mp4", ContentLength: 1024, Checksum: "n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=",
+		}, http.MethodPut},
+		{"multipart part", &SignedRequest{
+			Method: http.MethodPut, Bucket: "in", Key: "uploads/u/video.mp4", Expires: expires,
+			ContentLength: -1, UploadID: "upload-1", PartNumber: 7,
+		}, http.MethodPut},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, escaped, query := signedQuery(t, s, tt.req)
+			key, err := url.PathUnescape(escaped)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Verify(tt.method, bucket, key, query)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got.Method != tt.req.Method || got.Bucket != tt.req.Bucket || got.Key != tt.req.Key ||
+				!got.Expires.Equal(tt.req.Expires) || got.ContentType != tt.req.ContentType ||
+				got.ContentLength != tt.req.ContentLength || got.Checksum != tt.req.Checksum ||
+				got.UploadID != tt.req.UploadID || got.PartNumber != tt.req.PartNumber {
+				t.Errorf("Verify() = %+v, want %+v", got, tt.req)
+			}
+		})
+	}
+}
+
+func TestSignerRejects(t *testing.T) {
+	s, err := NewSigner("secret", "http://localhost:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := &SignedRequest{
+		Method: http.MethodPut, Bucket: "in", Key: "uploads/u/video.mp4", Expires: time.Now().Add(time.Hour),
+		ContentType: "video/mp4", ContentLength: 1024,
+	}
+	bucket, key, query := signedQuery(t, s, put)
+
+	tests := []struct {
+		name   string
+		method string
+		bucket string
+		key    string
+		change func(q url.Values)
+		signer string
+		want   error
+	}{
+		{name: "other key", method: http.MethodPut, bucket: bucket, key: "uploads/u/other.mp4", want: ErrInvalidSignature},
+		{name: "other bucket", method: http.MethodPut, bucket: "out", key: key, want: ErrInvalidSignature},
+		{name: "other method", method: http.MethodGet, bucket: bucket, key: key, want: ErrInvalidSignature},
+		{name: "head with a put url", method: http.MethodHead, bucket: bucket, key: key, want: ErrInvalidSignature},
+		{name: "raised content length", method: http.MethodPut, bucket: bucket, key: key,
+			change: func(q url.Values) { q.Set(paramContentLength, "999999999") }, want: ErrInvalidSignature},
+		{name: "dropped content type", method: http.MethodPut, bucket: bucket, key: key,
+			change: func(q url.Values) { q.Del(paramContentType) }, want: ErrInvalidSignature},
+		{name: "extended expiry", method: http.MethodPut, bucket: bucket, key: key,
+			change: func(q url.Values) { q.Set(paramExpires, "99999999999") }, want: ErrInvalidSignature},
+		{name: "added parameter", method: http.MethodPut, bucket: bucket, key: key,
+			change: func(q url.Values) { q.Set(paramChecksum, "AAAA") }, want: ErrInvalidSignature},
+		{name: "no signature", method: http.MethodPut, bucket: bucket, key: key,
+			change: func(q url.Values) { q.Del(paramSignature) }, want: ErrInvalidSignature},
+		{name: "signature not hex", method: http.MethodPut, bucket: bucket, key: key,
+			change: func(q url.Values) { q.Set(paramSignature, "zz") }, want: ErrInvalidSignature},
+		{name: "truncated signature", method: http.MethodPut, bucket: bucket, key: key,
+			change: func(q url.Values) { q.Set(paramSignature, q.Get(paramSignature)[:32]) }, want: ErrInvalidSignature},
+		{name: "other signing key", method: http.MethodPut, bucket: bucket, key: key, signer: "other", want: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := url.Values{}
+			for name, values := range query {
+				q[name] = append([]string(nil), values...)
+			}
+			if tt.change != nil {
+				tt.change(q)
+			}
+			verifier := s
+			if tt.signer != "" {
+				if verifier, err = NewSigner(tt.signer, "http://localhost:5000"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := verifier.Verify(tt.method, tt.bucket, tt.key, q); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignerExpired(t *testing.T) {
+	s, err := NewSigner("secret", "http://localhost:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, key, query := signedQuery(t, s, &SignedRequest{
+		Method: http.MethodGet, Bucket: "out", Key: "master.m3u8", Expires: time.Now().Add(-time.Minute), ContentLength: -1,
+	})
+	if _, err := s.Verify(http.MethodGet, bucket, key, query); !errors.Is(err, ErrExpired) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrExpired)
+	}
+}
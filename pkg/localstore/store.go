@@ -0,0 +1,520 @@
+// Package localstore keeps objects in a local directory laid out like buckets and keys, so the
+// services can run on one machine without an object store. It mimics the parts of S3 the
+// services use, including multipart uploads, SHA-256 checksums and presigned URLs.
+package localstore
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	metaDir    = ".meta"
+	uploadsDir = ".uploads"
+	tmpDir     = ".tmp"
+	// MaxParts matches S3's limit on the parts of a multipart upload.
+	MaxParts = 10000
+)
+
+var (
+	ErrNotFound         = errors.New("object not found")
+	ErrUploadNotFound   = errors.New("multipart upload not found")
+	ErrInvalidName      = errors.New("invalid bucket or key")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrInvalidPart      = errors.New("invalid part")
+)
+
+// ObjectMeta is what the store keeps next to an object's data.
+type ObjectMeta struct {
+	Key           string `json:"key"`
+	ContentType   string `json:"content_type"`
+	ContentLength int64  `json:"content_length"`
+	ETag          string `json:"etag"`
+	// ChecksumSHA256 is base64 like S3 reports it; "<base64>-<parts>" for multipart uploads.
+	ChecksumSHA256 string            `json:"checksum_sha256,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	LastModified   time.Time         `json:"last_modified"`
+}
+
+// Upload is a multipart upload in progress.
+type Upload struct {
+	UploadID    string    `json:"upload_id"`
+	Key         string    `json:"key"`
+	ContentType string    `json:"content_type"`
+	Checksummed bool      `json:"checksummed"`
+	Initiated   time.Time `json:"initiated"`
+}
+
+type Part struct {
+	PartNumber     int32     `json:"part_number"`
+	ETag           string    `json:"etag"`
+	Size           int64     `json:"size"`
+	ChecksumSHA256 string    `json:"checksum_sha256,omitempty"` // base64
+	LastModified   time.Time `json:"last_modified"`
+}
+
+type Store struct {
+	root string
+}
+
+func New(root string) (*Store, error) {
+	if root == "" {
+		return nil, errors.New("local storage root is not set")
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local storage root: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Join(abs, tmpDir), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage root: %w", err)
+	}
+	return &Store{root: abs}, nil
+}
+
+// Root returns the directory the store keeps its buckets in.
+func (s *Store) Root() string {
+	return s.root
+}
+
+// Put stores the object read from r. A non-empty checksum (base64 SHA-256) must match the data
+// or nothing is stored.
+func (s *Store) Put(bucket, key string, r io.Reader, contentType, checksum string, metadata map[string]string) (*ObjectMeta, error) {
+	dataPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	tmp, size, sums, err := s.writeTemp(r)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	sha := base64.StdEncoding.EncodeToString(sums.sha.Sum(nil))
+	if checksum != "" && checksum != sha {
+		return nil, ErrChecksumMismatch
+	}
+	meta := &ObjectMeta{
+		Key:            key,
+		ContentType:    contentType,
+		ContentLength:  size,
+		ETag:           hex.EncodeToString(sums.md5.Sum(nil)),
+		ChecksumSHA256: sha,
+		Metadata:       metadata,
+		LastModified:   time.Now().UTC(),
+	}
+	if err = s.commit(bucket, key, tmp, dataPath, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// Open returns the object's data and metadata. The caller closes the file.
+func (s *Store) Open(bucket, key string) (*os.File, *ObjectMeta, error) {
+	meta, err := s.Stat(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataPath, _ := s.objectPath(bucket, key)
+	f, err := os.Open(dataPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	return f, meta, nil
+}
+
+func (s *Store) Stat(bucket, key string) (*ObjectMeta, error) {
+	metaPath, err := s.metaPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	meta := &ObjectMeta{}
+	if err = readJSON(metaPath, meta); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read metadata of %s: %w", key, err)
+	}
+	return meta, nil
+}
+
+// Remove deletes the object. Removing a missing object is not an error, like in S3.
+func (s *Store) Remove(bucket, key string) error {
+	dataPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	metaPath, _ := s.metaPath(bucket, key)
+	for _, p := range []string{dataPath, metaPath} {
+		if err = os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// List returns the objects of the bucket whose key starts with prefix, sorted by key.
+func (s *Store) List(bucket, prefix string) ([]ObjectMeta, error) {
+	if err := validBucket(bucket); err != nil {
+		return nil, err
+	}
+	base := filepath.Join(s.root, metaDir, bucket)
+	var objects []ObjectMeta
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return nil
+		}
+		meta := ObjectMeta{}
+		if err := readJSON(p, &meta); err != nil {
+			return nil // Removed while listing
+		}
+		if strings.HasPrefix(meta.Key, prefix) {
+			objects = append(objects, meta)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *Store) CreateUpload(bucket, key, contentType string, checksummed bool) (*Upload, error) {
+	if _, err := s.objectPath(bucket, key); err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to create upload id: %w", err)
+	}
+	upload := &Upload{
+		UploadID:    hex.EncodeToString(id),
+		Key:         key,
+		ContentType: contentType,
+		Checksummed: checksummed,
+		Initiated:   time.Now().UTC(),
+	}
+	dir := s.uploadDir(bucket, upload.UploadID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	if err := writeJSON(filepath.Join(dir, "upload.json"), upload); err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	return upload, nil
+}
+
+func (s *Store) GetUpload(bucket, key, uploadID string) (*Upload, error) {
+	if err := validBucket(bucket); err != nil {
+		return nil, err
+	}
+	if !validUploadID(uploadID) {
+		return nil, ErrUploadNotFound
+	}
+	upload := &Upload{}
+	if err := readJSON(filepath.Join(s.uploadDir(bucket, uploadID), "upload.json"), upload); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if upload.Key != key {
+		return nil, ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+// WritePart stores one part of an upload, replacing an earlier part with the same number. The
+// part must come with its checksum (base64 SHA-256) if the upload was started checksummed.
+func (s *Store) WritePart(bucket, key, uploadID string, partNumber int32, r io.Reader, checksum string) (*Part, error) {
+	upload, err := s.GetUpload(bucket, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if partNumber < 1 || partNumber > MaxParts {
+		return nil, ErrInvalidPart
+	}
+	if upload.Checksummed && checksum == "" {
+		return nil, fmt.Errorf("%w: upload requires a sha256 checksum per part", ErrInvalidPart)
+	}
+	tmp, size, sums, err := s.writeTemp(r)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	sha := base64.StdEncoding.EncodeToString(sums.sha.Sum(nil))
+	if checksum != "" && checksum != sha {
+		return nil, ErrChecksumMismatch
+	}
+	part := &Part{
+		PartNumber:     partNumber,
+		ETag:           hex.EncodeToString(sums.md5.Sum(nil)),
+		Size:           size,
+		ChecksumSHA256: sha,
+		LastModified:   time.Now().UTC(),
+	}
+	partPath := filepath.Join(s.uploadDir(bucket, uploadID), fmt.Sprintf("%05d", partNumber))
+	if err = os.Rename(tmp, partPath); err != nil {
+		return nil, fmt.Errorf("failed to store part: %w", err)
+	}
+	if err = writeJSON(partPath+".json", part); err != nil {
+		return nil, fmt.Errorf("failed to store part: %w", err)
+	}
+	return part, nil
+}
+
+// ListParts returns the parts received so far, ordered by part number.
+func (s *Store) ListParts(bucket, key, uploadID string) ([]Part, error) {
+	if _, err := s.GetUpload(bucket, key, uploadID); err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(s.uploadDir(bucket, uploadID), "[0-9]*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list parts: %w", err)
+	}
+	parts := make([]Part, 0, len(matches))
+	for _, match := range matches {
+		part := Part{}
+		if err := readJSON(match, &part); err != nil {
+			return nil, fmt.Errorf("failed to read part: %w", err)
+		}
+		parts = append(parts, part)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// CompleteUpload joins the listed parts into the object. Like S3 it wants them in ascending
+// order with the ETags they were stored with.
+func (s *Store) CompleteUpload(bucket, key, uploadID string, parts []Part) (*ObjectMeta, error) {
+	upload, err := s.GetUpload(bucket, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: no parts given", ErrInvalidPart)
+	}
+	stored, err := s.ListParts(bucket, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	byNumber := make(map[int32]Part, len(stored))
+	for _, part := range stored {
+		byNumber[part.PartNumber] = part
+	}
+
+	dir := s.uploadDir(bucket, uploadID)
+	readers := make([]io.Reader, 0, len(parts))
+	md5s := md5.New()
+	shas := sha256.New()
+	for i, part := range parts {
+		got, ok := byNumber[part.PartNumber]
+		if !ok || strings.Trim(part.ETag, `"`) != got.ETag || (i > 0 && part.PartNumber <= parts[i-1].PartNumber) {
+			return nil, fmt.Errorf("%w: part %d", ErrInvalidPart, part.PartNumber)
+		}
+		raw, _ := hex.DecodeString(got.ETag)
+		md5s.Write(raw)
+		rawSHA, _ := base64.StdEncoding.DecodeString(got.ChecksumSHA256)
+		shas.Write(rawSHA)
+
+		f, err := os.Open(filepath.Join(dir, fmt.Sprintf("%05d", part.PartNumber)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open part %d: %w", part.PartNumber, err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	dataPath, _ := s.objectPath(bucket, key)
+	tmp, size, _, err := s.writeTemp(io.MultiReader(readers...))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	meta := &ObjectMeta{
+		Key:           key,
+		ContentType:   upload.ContentType,
+		ContentLength: size,
+		ETag:          fmt.Sprintf("%s-%d", hex.EncodeToString(md5s.Sum(nil)), len(parts)),
+		LastModified:  time.Now().UTC(),
+	}
+	if upload.Checksummed {
+		// S3 can't hash the whole object either, it reports the checksum of the part checksums
+		meta.ChecksumSHA256 = fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(shas.Sum(nil)), len(parts))
+	}
+	if err = s.commit(bucket, key, tmp, dataPath, meta); err != nil {
+		return nil, err
+	}
+	if err = os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to clean up upload: %w", err)
+	}
+	return meta, nil
+}
+
+func (s *Store) AbortUpload(bucket, key, uploadID string) error {
+	if _, err := s.GetUpload(bucket, key, uploadID); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(s.uploadDir(bucket, uploadID)); err != nil {
+		return fmt.Errorf("failed to abort upload: %w", err)
+	}
+	return nil
+}
+
+// ListUploads returns the uploads of the bucket whose key starts with prefix.
+func (s *Store) ListUploads(bucket, prefix string) ([]Upload, error) {
+	if err := validBucket(bucket); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(s.root, uploadsDir, bucket))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	var uploads []Upload
+	for _, entry := range entries {
+		upload := Upload{}
+		if err := readJSON(filepath.Join(s.root, uploadsDir, bucket, entry.Name(), "upload.json"), &upload); err != nil {
+			continue
+		}
+		if strings.HasPrefix(upload.Key, prefix) {
+			uploads = append(uploads, upload)
+		}
+	}
+	return uploads, nil
+}
+
+type checksums struct {
+	md5 hash.Hash
+	sha hash.Hash
+}
+
+// writeTemp copies r into a temporary file, hashing it on the way.
+func (s *Store) writeTemp(r io.Reader) (string, int64, *checksums, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.root, tmpDir), "object-*")
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	sums := &checksums{md5: md5.New(), sha: sha256.New()}
+	size, err := io.Copy(io.MultiWriter(tmp, sums.md5, sums.sha), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, nil, fmt.Errorf("failed to write object: %w", err)
+	}
+	return tmp.Name(), size, sums, nil
+}
+
+// commit moves the data into place and then writes its metadata, which is what makes the
+// object visible.
+func (s *Store) commit(bucket, key, tmp, dataPath string, meta *ObjectMeta) error {
+	metaPath, _ := s.metaPath(bucket, key)
+	for _, dir := range []string{filepath.Dir(dataPath), filepath.Dir(metaPath)} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to store %s: %w", key, err)
+		}
+	}
+	if err := os.Rename(tmp, dataPath); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	if err := writeJSON(metaPath, meta); err != nil {
+		return fmt.Errorf("failed to store metadata of %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *Store) objectPath(bucket, key string) (string, error) {
+	if err := validBucket(bucket); err != nil {
+		return "", err
+	}
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, bucket, filepath.FromSlash(key)), nil
+}
+
+func (s *Store) metaPath(bucket, key string) (string, error) {
+	if err := validBucket(bucket); err != nil {
+		return "", err
+	}
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, metaDir, bucket, filepath.FromSlash(key)+".json"), nil
+}
+
+func (s *Store) uploadDir(bucket, uploadID string) string {
+	return filepath.Join(s.root, uploadsDir, bucket, uploadID)
+}
+
+// Bucket names can't start with a dot, so they never clash with the store's own directories.
+func validBucket(bucket string) error {
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || strings.HasPrefix(bucket, ".") {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// Keys must be clean relative paths; anything that could leave the bucket is rejected.
+func validKey(key string) error {
+	if key == "" || strings.Contains(key, `\`) || path.Clean("/"+key) != "/"+key {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+func validUploadID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return err == nil && len(id) == 32
+}
+
+func readJSON(p string, v interface{}) error {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON replaces p atomically so readers never see a partial file.
+func writeJSON(p string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
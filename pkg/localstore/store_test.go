@@ -0,0 +1,42 @@
+package localstore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidNames(t *testing.T) {
+	tests := []struct {
+		bucket  string
+		key     string
+		wantErr bool
+	}{
+		{"in", "uploads/u/video.mp4", false},
+		{"in", "video.mp4", false},
+		{"", "video.mp4", true},
+		{".meta", "video.mp4", true},
+		{"in/out", "video.mp4", true},
+		{`in\out`, "video.mp4", true},
+		{"in", "", true},
+		{"in", "../out/video.mp4", true},
+		{"in", "uploads/../../out/video.mp4", true},
+		{"in", "/etc/passwd", true},
+		{"in", "uploads//video.mp4", true},
+		{"in", "uploads/./video.mp4", true},
+		{"in", "uploads/", true},
+		{"in", `uploads\..\video.mp4`, true},
+	}
+	store, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		_, err := store.objectPath(tt.bucket, tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("objectPath(%q, %q) error = %v, wantErr %v", tt.bucket, tt.key, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidName) {
+			t.Errorf("objectPath(%q, %q) error = %v, want %v", tt.bucket, tt.key, err, ErrInvalidName)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "video_encoder"
+
+var (
+	// API
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Queue
+	JobQueueWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "job_wait_seconds",
+		Help:      "Time between a job being created and a worker starting it.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	})
+	QueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "depth",
+		Help:      "Jobs waiting in the Redis job queue.",
+	})
+
+	// Worker
+	JobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "jobs_total",
+		Help:      "Jobs that left the worker, by terminal status.",
+	}, []string{"status"})
+	DeferredJobs = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "deferred_jobs",
+		Help:      "Jobs this worker holds back while waiting out an admission backoff.",
+	})
+	StageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "stage_duration_seconds",
+		Help:      "Duration of each processing stage.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 14),
+	}, []string{"stage"})
+	CommandFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "command_failures_total",
+		Help:      "Subprocesses (ffmpeg, ffprobe, mp4dash, ...) that exited with an error.",
+	}, []string{"command"})
+
+	// Storage
+	S3UploadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "s3",
+		Name:      "uploaded_bytes_total",
+		Help:      "Bytes successfully uploaded to object storage.",
+	})
+	S3Retries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "s3",
+		Name:      "retries_total",
+		Help:      "Object storage operations that were retried, by operation.",
+	}, []string{"operation"})
+)
+
+// Handler serves the default registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
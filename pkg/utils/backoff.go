@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Backoff returns the exponential delay for the given attempt (starting at 0), capped at max,
+// with up to 20% jitter so retries from many workers don't line up.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt < 0 {
+		attempt = 0
+	}
+	delay := base
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay - jitter
+}
+
+// SleepWithContext waits for d or until ctx is done, whichever comes first.
+func SleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
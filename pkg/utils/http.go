@@ -6,6 +6,7 @@ import (
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
 	"github.com/labstack/echo/v4"
+	"net"
 	"net/http"
 )
 
@@ -27,6 +28,24 @@ func GetIPAddress(c echo.Context) string {
 	return c.Request().RemoteAddr
 }
 
+// NewIPExtractor returns how the client address of a request is found. With no trusted proxies
+// it is the peer address, forwarding headers anyone can set are ignored. Otherwise it is taken
+// from X-Forwarded-For, skipping hops within the trusted CIDRs.
+func NewIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range %q: %w", cidr, err)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
 func CreateSessionCookie(cfg *config.Config, session string) *http.Cookie {
 	return &http.Cookie{
 		Name:  cfg.Session.Name,
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewIPExtractor(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		peer    string
+		xff     string
+		want    string
+	}{
+		{name: "peer address", peer: "203.0.113.7:4000", want: "203.0.113.7"},
+		{name: "forged header without proxies", peer: "198.51.100.1:4000", xff: "203.0.113.7", want: "198.51.100.1"},
+		{name: "forged header from a private peer", peer: "10.0.0.2:4000", xff: "203.0.113.7", want: "10.0.0.2"},
+		{name: "trusted proxy", proxies: []string{"10.0.0.0/8"}, peer: "10.0.0.2:4000", xff: "203.0.113.7", want: "203.0.113.7"},
+		{name: "untrusted peer", proxies: []string{"10.0.0.0/8"}, peer: "198.51.100.1:4000", xff: "203.0.113.7", want: "198.51.100.1"},
+		// The proxy appends the address it saw, whatever the client sent before it is ignored
+		{name: "forged hop before the proxy", proxies: []string{"10.0.0.0/8"}, peer: "10.0.0.2:4000",
+			xff: "203.0.113.9, 198.51.100.1", want: "198.51.100.1"},
+		{name: "chain of proxies", proxies: []string{"10.0.0.0/8"}, peer: "10.0.0.2:4000",
+			xff: "203.0.113.7, 10.0.0.3", want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract, err := NewIPExtractor(tt.proxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.peer
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			req.Header.Set("X-Real-IP", "203.0.113.8")
+			if got := extract(req); got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewIPExtractor([]string{"10.0.0.0"}); err == nil {
+		t.Error("NewIPExtractor() accepted a range without a prefix length")
+	}
+}
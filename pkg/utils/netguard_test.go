@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700::1111", true},
+		{"::ffff:93.184.216.34", true},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"192.0.0.8", false},
+		{"198.18.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"ff02::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b:1::1", false},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		if ip == nil {
+			t.Fatalf("bad test address %q", tt.ip)
+		}
+		if got := IsPublicIP(ip); got != tt.want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+	if IsPublicIP(nil) {
+		t.Error("IsPublicIP(nil) = true")
+	}
+}
+
+func TestCheckPublicHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want error
+	}{
+		{"93.184.216.34", nil},
+		{"2606:4700::1111", nil},
+		{"127.0.0.1", ErrForbiddenAddress},
+		{"169.254.169.254", ErrForbiddenAddress},
+		{"::1", ErrForbiddenAddress},
+		{"::ffff:10.0.0.1", ErrForbiddenAddress},
+		{"localhost", ErrForbiddenAddress},
+	}
+	for _, tt := range tests {
+		if err := CheckPublicHost(context.Background(), tt.host); !errors.Is(err, tt.want) {
+			t.Errorf("CheckPublicHost(%q) error = %v, want %v", tt.host, err, tt.want)
+		}
+	}
+	if err := CheckPublicHost(context.Background(), "name.invalid"); err == nil {
+		t.Error("CheckPublicHost() of an unresolvable name succeeded")
+	}
+}
+
+func TestPublicHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/ftp":
+			http.Redirect(w, r, "ftp://example.com/video.mp4", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	// The test server listens on loopback, which only the private client may reach
+	if _, err := NewPublicHTTPClient(5*time.Second, false).Get(server.URL); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("Get() of a loopback address error = %v, want %v", err, ErrForbiddenAddress)
+	}
+
+	client := NewPublicHTTPClient(5*time.Second, true)
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() with private addresses allowed error = %v", err)
+	}
+	resp.Body.Close()
+	if _, err := client.Get(server.URL + "/loop"); err == nil {
+		t.Error("Get() followed redirects without a limit")
+	}
+	if _, err := client.Get(server.URL + "/ftp"); err == nil {
+		t.Error("Get() followed a redirect to ftp")
+	}
+}
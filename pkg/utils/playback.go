@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const playbackTokenAudience = "playback"
+
+// PlaybackClaims grant access to the output of one encode job. IP and Referrer are empty
+// unless the token is bound to them.
+type PlaybackClaims struct {
+	VideoID  string `json:"video_id"`
+	UserID   string `json:"user_id"`
+	Bucket   string `json:"bucket"`
+	Prefix   string `json:"prefix"`
+	IP       string `json:"ip,omitempty"`
+	Referrer string `json:"referrer,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Allows reports whether a request from ip, sent with the given Referer header, matches the
+// bindings of the token.
+func (c *PlaybackClaims) Allows(ip, referer string) bool {
+	if c.IP != "" && ip != c.IP {
+		return false
+	}
+	return c.Referrer == "" || Origin(referer) == c.Referrer
+}
+
+// PlaybackSecret is the key playback tokens are signed with. Without a dedicated secret it is
+// derived from the JWT secret, so playback and session tokens are never accepted for each other.
+func PlaybackSecret(cfg *config.Config) string {
+	if cfg.Playback.TokenSecret != "" {
+		return cfg.Playback.TokenSecret
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.Server.JwtSecretKey))
+	mac.Write([]byte("playback"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Origin returns the scheme://host of a URL, or "" when it has none.
+func Origin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+func GeneratePlaybackToken(claims *PlaybackClaims, secretKey string, expiresAt time.Time) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{playbackTokenAudience},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signedToken, err := token.SignedString([]byte(secretKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign playback token: %w", err)
+	}
+	return signedToken, nil
+}
+
+func ValidatePlaybackToken(tokenString string, secretKey string) (*PlaybackClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &PlaybackClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secretKey), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse playback token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*PlaybackClaims)
+	if !ok || !token.Valid || !claims.VerifyAudience(playbackTokenAudience, true) {
+		return nil, fmt.Errorf("invalid playback token claims")
+	}
+	return claims, nil
+}
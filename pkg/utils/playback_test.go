@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/amankumarsingh77/cloud-video-encoder/internal/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func testPlaybackClaims() *PlaybackClaims {
+	return &PlaybackClaims{
+		VideoID: "9f1c2d3e-0000-4000-8000-000000000001",
+		UserID:  "9f1c2d3e-0000-4000-8000-000000000002",
+		Bucket:  "outputs",
+		Prefix:  "videos/job-1",
+		IP:      "203.0.113.7",
+	}
+}
+
+func TestPlaybackTokenRoundTrip(t *testing.T) {
+	token, err := GeneratePlaybackToken(testPlaybackClaims(), "secret", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidatePlaybackToken(token, "secret")
+	if err != nil {
+		t.Fatalf("ValidatePlaybackToken() error = %v", err)
+	}
+	want := testPlaybackClaims()
+	if claims.VideoID != want.VideoID || claims.UserID != want.UserID || claims.Bucket != want.Bucket ||
+		claims.Prefix != want.Prefix || claims.IP != want.IP {
+		t.Errorf("ValidatePlaybackToken() = %+v, want %+v", claims, want)
+	}
+}
+
+func TestValidatePlaybackTokenRejects(t *testing.T) {
+	sign := func(method jwt.SigningMethod, claims jwt.Claims, key interface{}) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := func() *PlaybackClaims {
+		claims := testPlaybackClaims()
+		claims.RegisteredClaims = jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{playbackTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}
+		return claims
+	}
+	expired := valid()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	notYet := valid()
+	notYet.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	noAudience := valid()
+	noAudience.Audience = nil
+	otherAudience := valid()
+	otherAudience.Audience = jwt.ClaimStrings{"session"}
+	session := &Claims{
+		UserID: testPlaybackClaims().UserID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other secret", sign(jwt.SigningMethodHS256, valid(), []byte("other"))},
+		{"unsigned", sign(jwt.SigningMethodNone, valid(), jwt.UnsafeAllowNoneSignatureType)},
+		{"expired", sign(jwt.SigningMethodHS256, expired, []byte("secret"))},
+		{"not valid yet", sign(jwt.SigningMethodHS256, notYet, []byte("secret"))},
+		{"no audience", sign(jwt.SigningMethodHS256, noAudience, []byte("secret"))},
+		{"other audience", sign(jwt.SigningMethodHS256, otherAudience, []byte("secret"))},
+		{"session token", sign(jwt.SigningMethodHS256, session, []byte("secret"))},
+		{"malformed", "not.a.token"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if claims, err := ValidatePlaybackToken(tt.token, "secret"); err == nil {
+				t.Errorf("ValidatePlaybackToken() = %+v, want an error", claims)
+			}
+		})
+	}
+}
+
+func TestPlaybackClaimsAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		ip       string
+		referrer string
+		reqIP    string
+		referer  string
+		want     bool
+	}{
+		{"unbound", "", "", "198.51.100.1", "", true},
+		{"bound ip matches", "203.0.113.7", "", "203.0.113.7", "", true},
+		{"bound ip differs", "203.0.113.7", "", "203.0.113.8", "", false},
+		{"referrer matches", "", "https://player.example.com", "198.51.100.1", "https://player.example.com/watch?v=1", true},
+		{"referrer matches case-insensitively", "", "https://player.example.com", "198.51.100.1", "HTTPS://Player.Example.com/", true},
+		{"referrer differs", "", "https://player.example.com", "198.51.100.1", "https://evil.example.com/", false},
+		{"referrer on another port", "", "https://player.example.com", "198.51.100.1", "https://player.example.com:8443/", false},
+		{"referrer over http", "", "https://player.example.com", "198.51.100.1", "http://player.example.com/", false},
+		{"referrer missing", "", "https://player.example.com", "198.51.100.1", "", false},
+		{"both bound, ip differs", "203.0.113.7", "https://player.example.com", "203.0.113.8", "https://player.example.com/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &PlaybackClaims{IP: tt.ip, Referrer: tt.referrer}
+			if got := claims.Allows(tt.reqIP, tt.referer); got != tt.want {
+				t.Errorf("Allows(%q, %q) = %v, want %v", tt.reqIP, tt.referer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://Player.Example.com/watch?v=1", "https://player.example.com"},
+		{"http://localhost:3000/", "http://localhost:3000"},
+		{"/relative/path", ""},
+		{"player.example.com", ""},
+		{"", ""},
+		{"://bad", ""},
+	}
+	for _, tt := range tests {
+		if got := Origin(tt.url); got != tt.want {
+			t.Errorf("Origin(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestPlaybackSecret(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.JwtSecretKey = "jwt-secret"
+
+	derived := PlaybackSecret(cfg)
+	if derived == "" || derived == cfg.Server.JwtSecretKey {
+		t.Errorf("PlaybackSecret() = %q, want a key derived from the JWT secret", derived)
+	}
+	if again := PlaybackSecret(cfg); again != derived {
+		t.Errorf("PlaybackSecret() isn't stable: %q then %q", derived, again)
+	}
+	cfg.Server.JwtSecretKey = "other-secret"
+	if other := PlaybackSecret(cfg); other == derived {
+		t.Error("PlaybackSecret() doesn't depend on the JWT secret")
+	}
+
+	cfg.Playback.TokenSecret = "playback-secret"
+	if got := PlaybackSecret(cfg); got != "playback-secret" {
+		t.Errorf("PlaybackSecret() = %q, want the configured secret", got)
+	}
+}
+
+func TestSessionTokenIsNotAPlaybackToken(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.JwtSecretKey = "jwt-secret"
+	// A playback token signed with the derived secret isn't a session token either
+	token, err := GeneratePlaybackToken(testPlaybackClaims(), PlaybackSecret(cfg), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(token, cfg.Server.JwtSecretKey); err == nil {
+		t.Error("ValidateToken() accepted a playback token as a session token")
+	}
+}
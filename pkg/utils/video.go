@@ -2,6 +2,9 @@ package utils
 
 import (
 	"github.com/amankumarsingh77/cloud-video-encoder/internal/models"
+	"mime"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -43,6 +46,25 @@ func GetDefaultMaxBitrate(resolution string) int {
 	}
 }
 
+func GetResolutionDimensions(resolution string) (int, int) {
+	switch resolution {
+	case "2160p", "4K":
+		return 3840, 2160
+	case "1440p", "2K":
+		return 2560, 1440
+	case "1080p":
+		return 1920, 1080
+	case "720p":
+		return 1280, 720
+	case "480p":
+		return 854, 480
+	case "360p":
+		return 640, 360
+	default:
+		return 1280, 720
+	}
+}
+
 func AdjustBitrateToRange(bitrate, minBitrate, maxBitrate int) int {
 	if bitrate < minBitrate {
 		return minBitrate
@@ -76,3 +98,39 @@ func ValidateDate(date string) error {
 	}
 	return nil
 }
+
+// Container types the system MIME table often lacks
+var videoMimeTypes = map[string]string{
+	".3gp":  "video/3gpp",
+	".avi":  "video/x-msvideo",
+	".flv":  "video/x-flv",
+	".m2ts": "video/mp2t",
+	".m4v":  "video/x-m4v",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".mp4":  "video/mp4",
+	".mpeg": "video/mpeg",
+	".mpg":  "video/mpeg",
+	".mxf":  "application/mxf",
+	".ts":   "video/mp2t",
+	".webm": "video/webm",
+	".wmv":  "video/x-ms-wmv",
+}
+
+// VideoMimeType returns the MIME type for a file extension, or "" if it is unknown.
+func VideoMimeType(ext string) string {
+	ext = strings.ToLower(ext)
+	if mimeType, ok := videoMimeTypes[ext]; ok {
+		return mimeType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// IsVideoFile reports whether the file name has a video container extension.
+func IsVideoFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if _, ok := videoMimeTypes[ext]; ok {
+		return true
+	}
+	return strings.HasPrefix(mime.TypeByExtension(ext), "video/")
+}